@@ -0,0 +1,272 @@
+// Package allowedsigners parses and edits the allowed_signers files used by
+// ssh-keygen -Y verify and git to check SSH signatures.
+//
+// Each line holds comma separated principals, optional options and a public
+// key. Parsing is lossless through the linefile package: lines that are not
+// modified are written back exactly as they were read.
+package allowedsigners
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/linefile"
+	"golang.org/x/crypto/ssh"
+)
+
+// Options understood by ssh-keygen in allowed_signers files
+const (
+	OptionCertAuthority = "cert-authority"
+	OptionNamespaces    = "namespaces"
+	OptionValidAfter    = "valid-after"
+	OptionValidBefore   = "valid-before"
+)
+
+// timeLayout is the format of valid-after and valid-before written by this package
+const timeLayout = "20060102150405Z"
+
+// Entry is a signer line of an allowed_signers file
+type Entry struct {
+	Principals []string
+	Options    []authkeys.Option
+	KeyType    string
+	KeyData    string
+	Comment    string
+}
+
+// ParseEntry parses a single allowed_signers line
+func ParseEntry(line string) (*Entry, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, fmt.Errorf("not a signer line")
+	}
+
+	principals, rest, err := splitQuotedField(line)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{Principals: strings.Split(principals, ",")}
+	for _, principal := range entry.Principals {
+		if principal == "" {
+			return nil, fmt.Errorf("empty principal in %q", principals)
+		}
+	}
+
+	if first, _, _ := splitQuotedField(rest); !authkeys.IsKeyType(first) {
+		var field string
+		field, rest, err = splitQuotedField(rest)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Options, err = authkeys.ParseOptions(field); err != nil {
+			return nil, err
+		}
+	}
+
+	entry.KeyType, rest, _ = splitQuotedField(rest)
+	if !authkeys.IsKeyType(entry.KeyType) {
+		return nil, fmt.Errorf("unknown key type %q", entry.KeyType)
+	}
+	entry.KeyData, rest, _ = splitQuotedField(rest)
+	if entry.KeyData == "" {
+		return nil, fmt.Errorf("missing key data")
+	}
+	entry.Comment = rest
+	return entry, nil
+}
+
+// NewEntry returns an entry allowing key to sign as principal
+func NewEntry(principal string, key ssh.PublicKey, options []authkeys.Option, comment string) *Entry {
+	return &Entry{
+		Principals: []string{principal},
+		Options:    options,
+		KeyType:    key.Type(),
+		KeyData:    strings.Fields(string(ssh.MarshalAuthorizedKey(key)))[1],
+		Comment:    comment,
+	}
+}
+
+// PublicKey decodes the key of the entry
+func (e *Entry) PublicKey() (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(e.KeyType + " " + e.KeyData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return key, nil
+}
+
+// HasPrincipal reports whether principal is listed exactly by the entry
+func (e *Entry) HasPrincipal(principal string) bool {
+	for _, p := range e.Principals {
+		if p == principal {
+			return true
+		}
+	}
+	return false
+}
+
+// Option returns the first option named name
+func (e *Entry) Option(name string) (authkeys.Option, bool) {
+	for _, opt := range e.Options {
+		if strings.EqualFold(opt.Name, name) {
+			return opt, true
+		}
+	}
+	return authkeys.Option{}, false
+}
+
+// Namespaces returns the namespaces the key may sign for; nil means any
+func (e *Entry) Namespaces() []string {
+	if opt, ok := e.Option(OptionNamespaces); ok {
+		return strings.Split(opt.Value, ",")
+	}
+	return nil
+}
+
+// Validity returns the times the key is valid from and until; zero times
+// mean there is no bound
+func (e *Entry) Validity() (time.Time, time.Time, error) {
+	var after, before time.Time
+	for _, opt := range e.Options {
+		var err error
+		switch strings.ToLower(opt.Name) {
+		case OptionValidAfter:
+			after, err = ParseTime(opt.Value)
+		case OptionValidBefore:
+			before, err = ParseTime(opt.Value)
+		}
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("option %s: %w", opt.Name, err)
+		}
+	}
+	return after, before, nil
+}
+
+// String formats the entry as an allowed_signers line
+func (e *Entry) String() string {
+	fields := make([]string, 0, 5)
+	principals := strings.Join(e.Principals, ",")
+	if strings.ContainsAny(principals, " \t") {
+		principals = `"` + principals + `"`
+	}
+	fields = append(fields, principals)
+	if len(e.Options) > 0 {
+		fields = append(fields, authkeys.FormatOptions(e.Options))
+	}
+	fields = append(fields, e.KeyType, e.KeyData)
+	if e.Comment != "" {
+		fields = append(fields, e.Comment)
+	}
+	return strings.Join(fields, " ")
+}
+
+// ValidateOption checks that opt is an allowed_signers option with a well formed value
+func ValidateOption(opt authkeys.Option) error {
+	switch strings.ToLower(opt.Name) {
+	case OptionCertAuthority:
+		if opt.HasValue {
+			return fmt.Errorf("option %s does not take a value", opt.Name)
+		}
+	case OptionNamespaces:
+		if !opt.HasValue || opt.Value == "" {
+			return fmt.Errorf("option %s requires a value", opt.Name)
+		}
+		for _, namespace := range strings.Split(opt.Value, ",") {
+			if namespace == "" {
+				return fmt.Errorf("option %s: empty namespace in %q", opt.Name, opt.Value)
+			}
+		}
+	case OptionValidAfter, OptionValidBefore:
+		if !opt.HasValue {
+			return fmt.Errorf("option %s requires a value", opt.Name)
+		}
+		if _, err := ParseTime(opt.Value); err != nil {
+			return fmt.Errorf("option %s: %w", opt.Name, err)
+		}
+	default:
+		return fmt.Errorf("unknown option %s", opt.Name)
+	}
+	return nil
+}
+
+// ValidityOptions returns the valid-after and valid-before options for the
+// interval from after to before, leaving out zero times
+func ValidityOptions(after, before time.Time) []authkeys.Option {
+	var options []authkeys.Option
+	if !after.IsZero() {
+		options = append(options, authkeys.Option{Name: OptionValidAfter, Value: FormatTime(after), HasValue: true})
+	}
+	if !before.IsZero() {
+		options = append(options, authkeys.Option{Name: OptionValidBefore, Value: FormatTime(before), HasValue: true})
+	}
+	return options
+}
+
+// FormatTime formats t for valid-after and valid-before as a UTC time
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// ParseTime parses a valid-after or valid-before time: YYYYMMDD[HHMM[SS]] in
+// local time, or in UTC with a trailing Z
+func ParseTime(s string) (time.Time, error) {
+	loc := time.Local
+	value := s
+	if strings.HasSuffix(value, "Z") || strings.HasSuffix(value, "z") {
+		loc = time.UTC
+		value = value[:len(value)-1]
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use YYYYMMDD[HHMM[SS]][Z]", s)
+}
+
+// Line is a single line of an allowed_signers file
+type Line = linefile.Line[*Entry]
+
+// File is a parsed allowed_signers file
+type File struct {
+	linefile.File[*Entry]
+}
+
+// Parse parses the contents of an allowed_signers file
+func Parse(data []byte) *File {
+	f := &File{}
+	f.Lines = linefile.Parse(data, ParseEntry)
+	return f
+}
+
+// splitQuotedField returns the first whitespace separated field of s, which
+// may contain double quoted parts holding whitespace, and the remainder.
+// Quotes are removed from a field that is quoted as a whole.
+func splitQuotedField(s string) (string, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	inQuotes := false
+	end := len(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && inQuotes && i+1 < len(s) && s[i+1] == '"' {
+			i++
+		} else if c == '"' {
+			inQuotes = !inQuotes
+		} else if (c == ' ' || c == '\t') && !inQuotes {
+			end = i
+			break
+		}
+	}
+	if inQuotes {
+		return "", "", fmt.Errorf("unterminated quote")
+	}
+	field, rest := s[:end], strings.TrimLeft(s[end:], " \t")
+	if len(field) >= 2 && field[0] == '"' && field[len(field)-1] == '"' && !strings.Contains(field[1:len(field)-1], `"`) {
+		field = field[1 : len(field)-1]
+	}
+	return field, rest, nil
+}
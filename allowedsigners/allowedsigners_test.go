@@ -0,0 +1,209 @@
+package allowedsigners
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/authkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+const testKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGDyQGvlZnrqFyUuFgd/5QY2K8uwbjtsWmpEqgV9Mz3N"
+
+func newTestKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		principals []string
+		namespaces []string
+		comment    string
+		wantErr    bool
+	}{
+		{"Plain", "alice@example.com " + testKey, []string{"alice@example.com"}, nil, "", false},
+		{"Options and comment", `alice@example.com,bob@example.com namespaces="git,file" ` + testKey + " laptop", []string{"alice@example.com", "bob@example.com"}, []string{"git", "file"}, "laptop", false},
+		{"Quoted principals", `"*@example.com" cert-authority ` + testKey, []string{"*@example.com"}, nil, "", false},
+		{"Comment", "# team signers", nil, nil, "", true},
+		{"Missing key", "alice@example.com", nil, nil, "", true},
+		{"Bad options", `alice@example.com namespaces="git ` + testKey, nil, nil, "", true},
+		{"Empty principal", "alice@example.com,, " + testKey, nil, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := ParseEntry(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if strings.Join(entry.Principals, ",") != strings.Join(tt.principals, ",") {
+				t.Errorf("Principals = %v; want %v", entry.Principals, tt.principals)
+			}
+			if strings.Join(entry.Namespaces(), ",") != strings.Join(tt.namespaces, ",") {
+				t.Errorf("Namespaces() = %v; want %v", entry.Namespaces(), tt.namespaces)
+			}
+			if entry.Comment != tt.comment {
+				t.Errorf("Comment = %q; want %q", entry.Comment, tt.comment)
+			}
+			if _, err := entry.PublicKey(); err != nil {
+				t.Errorf("PublicKey() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	content := "# team signers\n\nalice@example.com  namespaces=\"git\"   " + testKey + "\nnot a signer line\n"
+	file := Parse([]byte(content))
+	if got := string(file.Bytes()); got != content {
+		t.Errorf("Bytes() = %q; want %q", got, content)
+	}
+	if len(file.Entries()) != 1 {
+		t.Errorf("Entries() = %d; want 1", len(file.Entries()))
+	}
+
+	file.Entries()[0].Modified = true
+	if got := file.Lines[2].Text(); got != `alice@example.com namespaces="git" `+testKey {
+		t.Errorf("modified line = %q", got)
+	}
+}
+
+func TestValidity(t *testing.T) {
+	after := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2027, 1, 1, 12, 30, 0, 0, time.UTC)
+	options := ValidityOptions(after, before)
+	if len(options) != 2 || options[0].String() != `valid-after="20260101000000Z"` || options[1].String() != `valid-before="20270101123000Z"` {
+		t.Fatalf("ValidityOptions() = %v", options)
+	}
+	if len(ValidityOptions(time.Time{}, before)) != 1 {
+		t.Error("ValidityOptions() should leave out zero times")
+	}
+
+	entry := &Entry{Options: options}
+	gotAfter, gotBefore, err := entry.Validity()
+	if err != nil || !gotAfter.Equal(after) || !gotBefore.Equal(before) {
+		t.Errorf("Validity() = %v, %v, %v", gotAfter, gotBefore, err)
+	}
+
+	for _, value := range []string{"20260101", "202601011200", "20260101120000Z"} {
+		if _, err := ParseTime(value); err != nil {
+			t.Errorf("ParseTime(%q) error = %v", value, err)
+		}
+	}
+	for _, value := range []string{"2026", "2026-01-01", "20261301"} {
+		if _, err := ParseTime(value); err == nil {
+			t.Errorf("ParseTime(%q) expected error", value)
+		}
+	}
+}
+
+func TestValidateOption(t *testing.T) {
+	valid := []authkeys.Option{
+		{Name: "cert-authority"},
+		{Name: "namespaces", Value: "git,file", HasValue: true},
+		{Name: "valid-before", Value: "20270101", HasValue: true},
+	}
+	for _, opt := range valid {
+		if err := ValidateOption(opt); err != nil {
+			t.Errorf("ValidateOption(%s) error = %v", opt, err)
+		}
+	}
+	invalid := []authkeys.Option{
+		{Name: "cert-authority", Value: "yes", HasValue: true},
+		{Name: "namespaces", Value: "git,", HasValue: true},
+		{Name: "valid-after", Value: "tomorrow", HasValue: true},
+		{Name: "no-pty"},
+	}
+	for _, opt := range invalid {
+		if err := ValidateOption(opt); err == nil {
+			t.Errorf("ValidateOption(%s) expected error", opt)
+		}
+	}
+}
+
+// TestOpenSSHCompatibility verifies a signature against a written file with
+// ssh-keygen when it is installed
+func TestOpenSSHCompatibility(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	dir, err := os.MkdirTemp("", "signers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	messagePath := filepath.Join(dir, "message")
+	if err := os.WriteFile(messagePath, []byte("commit\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("ssh-keygen", "-Y", "sign", "-f", keyPath, "-n", "git", messagePath).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -Y sign: %v %s", err, out)
+	}
+
+	options := append([]authkeys.Option{{Name: OptionNamespaces, Value: "git", HasValue: true}},
+		ValidityOptions(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))...)
+	file := Parse([]byte("# team\n"))
+	file.SetSigners(Marker{Principal: "alice@example.com", Service: "github", Username: "alice"},
+		[]*Entry{NewEntry("alice@example.com", key, options, "")})
+	signersPath := filepath.Join(dir, "allowed_signers")
+	if err := os.WriteFile(signersPath, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(principal, namespace string) error {
+		cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", signersPath, "-I", principal, "-n", namespace, "-s", messagePath+".sig")
+		message, err := os.Open(messagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer message.Close()
+		cmd.Stdin = message
+		return cmd.Run()
+	}
+	if err := verify("alice@example.com", "git"); err != nil {
+		t.Errorf("ssh-keygen -Y verify rejected the signer: %v", err)
+	}
+	if err := verify("alice@example.com", "file"); err == nil {
+		t.Error("ssh-keygen -Y verify accepted a namespace the signer is not allowed")
+	}
+	if err := verify("bob@example.com", "git"); err == nil {
+		t.Error("ssh-keygen -Y verify accepted another principal")
+	}
+}
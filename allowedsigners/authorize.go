@@ -0,0 +1,91 @@
+package allowedsigners
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// Authorize checks that the file allows key to sign as principal for
+// namespace at time at, following the rules ssh-keygen -Y verify applies:
+// the principal must match a line's principal patterns, the namespace its
+// namespaces option and at its validity. A certificate is accepted when a
+// cert-authority line holds the CA that signed it and the certificate is
+// valid for principal; other keys must be listed themselves.
+func (f *File) Authorize(principal, namespace string, key ssh.PublicKey, at time.Time) error {
+	cert, isCert := key.(*ssh.Certificate)
+	reason := fmt.Sprintf("%s is not an allowed signer", principal)
+
+	for _, line := range f.Entries() {
+		entry := line.Entry
+		if !utils.MatchPatternList(entry.Principals, principal) {
+			continue
+		}
+		pub, err := entry.PublicKey()
+		if err != nil {
+			continue
+		}
+
+		_, trustsCA := entry.Option(OptionCertAuthority)
+		switch {
+		case trustsCA && isCert:
+			if !bytes.Equal(cert.SignatureKey.Marshal(), pub.Marshal()) {
+				continue
+			}
+			if err := checkCertificate(cert, principal, at); err != nil {
+				reason = err.Error()
+				continue
+			}
+		case !trustsCA && !isCert:
+			if !bytes.Equal(key.Marshal(), pub.Marshal()) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if namespaces := entry.Namespaces(); namespaces != nil && !utils.MatchPatternList(namespaces, namespace) {
+			reason = fmt.Sprintf("%s may not sign for namespace %q", principal, namespace)
+			continue
+		}
+		after, before, err := entry.Validity()
+		if err != nil {
+			reason = err.Error()
+			continue
+		}
+		if (!after.IsZero() && at.Before(after)) || (!before.IsZero() && !at.Before(before)) {
+			reason = fmt.Sprintf("the key of %s is not valid at %s", principal, at.Format(time.RFC3339))
+			continue
+		}
+		return nil
+	}
+	return errors.New(reason)
+}
+
+// checkCertificate checks that cert is a user certificate naming principal
+// and valid at time at. Unlike for logins, a certificate without principals
+// is not valid for everyone.
+func checkCertificate(cert *ssh.Certificate, principal string, at time.Time) error {
+	if cert.CertType != ssh.UserCert {
+		return fmt.Errorf("certificate %q is not a user certificate", cert.KeyId)
+	}
+	found := false
+	for _, p := range cert.ValidPrincipals {
+		if p == principal {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("certificate %q is not valid for %s (principals %s)", cert.KeyId, principal, strings.Join(cert.ValidPrincipals, ","))
+	}
+	checker := &ssh.CertChecker{Clock: func() time.Time { return at }}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return fmt.Errorf("certificate %q: %w", cert.KeyId, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package allowedsigners
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func newTestCertificate(t *testing.T, ca ssh.Signer, principals []string, before time.Time) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             newTestKey(t),
+		CertType:        ssh.UserCert,
+		KeyId:           "alice-laptop",
+		ValidPrincipals: principals,
+		ValidBefore:     uint64(before.Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestAuthorize(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice := newTestKey(t)
+	bob := newTestKey(t)
+	ca := newTestSigner(t)
+	keyLine := func(key ssh.PublicKey) string {
+		return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	}
+
+	file := Parse([]byte("# team signers\n" +
+		`alice@example.com namespaces="git,file" ` + keyLine(alice) + "\n" +
+		`*@example.org,!mallory@example.org valid-after="20260101",valid-before="20260201" ` + keyLine(bob) + "\n" +
+		`*@example.com cert-authority,namespaces="git" ` + keyLine(ca.PublicKey()) + "\n"))
+
+	tests := []struct {
+		name      string
+		principal string
+		namespace string
+		key       ssh.PublicKey
+		at        time.Time
+		wantErr   string
+	}{
+		{"Listed key", "alice@example.com", "file", alice, now, ""},
+		{"Other namespace", "alice@example.com", "email", alice, now, "may not sign for namespace"},
+		{"Other principal", "carol@example.com", "git", alice, now, "not an allowed signer"},
+		{"Other key", "alice@example.com", "git", bob, now, "not an allowed signer"},
+		{"Pattern within validity", "bob@example.org", "file", bob, now.AddDate(0, -1, -15), ""},
+		{"Negated pattern", "mallory@example.org", "file", bob, now.AddDate(0, -1, -15), "not an allowed signer"},
+		{"Expired", "bob@example.org", "file", bob, now, "not valid at"},
+		{"Not yet valid", "bob@example.org", "file", bob, now.AddDate(-1, 0, 0), "not valid at"},
+		{"Certificate", "carol@example.com", "git", newTestCertificate(t, ca, []string{"carol@example.com"}, now.Add(time.Hour)), now, ""},
+		{"Certificate for another principal", "dave@example.com", "git", newTestCertificate(t, ca, []string{"carol@example.com"}, now.Add(time.Hour)), now, "not valid for dave@example.com"},
+		{"Certificate without principals", "carol@example.com", "git", newTestCertificate(t, ca, nil, now.Add(time.Hour)), now, "not valid for"},
+		{"Expired certificate", "carol@example.com", "git", newTestCertificate(t, ca, []string{"carol@example.com"}, now.Add(-time.Hour)), now, "expired"},
+		{"Certificate from another CA", "carol@example.com", "git", newTestCertificate(t, newTestSigner(t), []string{"carol@example.com"}, now.Add(time.Hour)), now, "not an allowed signer"},
+		{"CA key itself", "carol@example.com", "git", ca.PublicKey(), now, "not an allowed signer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := file.Authorize(tt.principal, tt.namespace, tt.key, tt.at)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Authorize() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Authorize() error = %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package allowedsigners
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/authkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+// Marker is the comment ssh-config writes above signers imported from a
+// provider, so the block can be listed and synced with the provider later
+type Marker struct {
+	Principal string
+	Service   string
+	Username  string
+}
+
+var markerPattern = regexp.MustCompile(`^# Signers for (\S+) from (\S+) user (\S+) via ssh-config$`)
+
+// String formats the marker as a comment line
+func (m Marker) String() string {
+	return fmt.Sprintf("# Signers for %s from %s user %s via ssh-config", m.Principal, m.Service, m.Username)
+}
+
+// ParseMarker parses a marker comment line
+func ParseMarker(line string) (Marker, bool) {
+	match := markerPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return Marker{}, false
+	}
+	return Marker{Principal: match[1], Service: match[2], Username: match[3]}, true
+}
+
+// MarkerFor returns the marker of the block line belongs to. A block is a
+// marker comment followed by consecutive signer lines.
+func (f *File) MarkerFor(line *Line) (Marker, bool) {
+	for i := f.index(line) - 1; i >= 0; i-- {
+		if f.Lines[i].Entry != nil {
+			continue
+		}
+		return ParseMarker(f.Lines[i].Raw)
+	}
+	return Marker{}, false
+}
+
+// Markers returns the markers of the provider blocks in the file
+func (f *File) Markers() []Marker {
+	var markers []Marker
+	for _, line := range f.Lines {
+		if line.Entry == nil {
+			if marker, ok := ParseMarker(line.Raw); ok {
+				markers = append(markers, marker)
+			}
+		}
+	}
+	return markers
+}
+
+// SetSigners replaces the signers in the block of marker with entries,
+// appending a new block when there is none and merging repeated blocks.
+// Lines whose key and options are unchanged are kept as they were. It
+// returns the number of keys added and removed.
+func (f *File) SetSigners(marker Marker, entries []*Entry) (int, int) {
+	lines := make([]*Line, len(entries))
+	for i, entry := range entries {
+		lines[i] = &Line{Entry: entry, Modified: true}
+	}
+	var added, removed int
+	f.Lines, added, removed = authkeys.ReplaceBlock(f.Lines, authkeys.Block[*Line]{
+		IsMarker: func(line *Line) bool {
+			m, ok := ParseMarker(line.Raw)
+			return ok && m == marker
+		},
+		Key: func(line *Line) string {
+			if line.Entry == nil {
+				return ""
+			}
+			return line.Entry.KeyType + " " + line.Entry.KeyData
+		},
+		Entry:   func(line *Line) string { return line.Entry.String() },
+		Text:    (*Line).Text,
+		Comment: func(raw string) *Line { return &Line{Raw: raw} },
+	}, marker.String(), lines)
+	return added, removed
+}
+
+// AddSigner appends entry outside any provider block, so syncing the block
+// leaves it alone
+func (f *File) AddSigner(entry *Entry) {
+	if n := len(f.Lines); n > 0 && f.Lines[n-1].Entry != nil {
+		if _, ok := f.MarkerFor(f.Lines[n-1]); ok {
+			f.Lines = append(f.Lines, &Line{Raw: ""})
+		}
+	}
+	f.Lines = append(f.Lines, &Line{Entry: entry, Modified: true})
+}
+
+// RemovePrincipal stops principal from signing with any key and returns the
+// number of lines changed. Lines listing other principals keep them.
+func (f *File) RemovePrincipal(principal string) int {
+	changed := 0
+	f.Remove(func(line *Line) bool {
+		if line.Entry == nil || !line.Entry.HasPrincipal(principal) {
+			return false
+		}
+		changed++
+		var kept []string
+		for _, p := range line.Entry.Principals {
+			if p != principal {
+				kept = append(kept, p)
+			}
+		}
+		line.Entry.Principals = kept
+		line.Modified = true
+		return len(kept) == 0
+	})
+	f.removeEmptyBlocks()
+	return changed
+}
+
+// RemoveKey removes the lines for key and returns how many were removed
+func (f *File) RemoveKey(key ssh.PublicKey) int {
+	removed := f.Remove(func(line *Line) bool {
+		if line.Entry == nil {
+			return false
+		}
+		pub, err := line.Entry.PublicKey()
+		return err == nil && bytes.Equal(pub.Marshal(), key.Marshal())
+	})
+	f.removeEmptyBlocks()
+	return removed
+}
+
+// removeEmptyBlocks drops markers left without signers, along with the blank
+// line written before them
+func (f *File) removeEmptyBlocks() {
+	empty := make(map[*Line]bool)
+	for i, line := range f.Lines {
+		if line.Entry != nil {
+			continue
+		}
+		if _, ok := ParseMarker(line.Raw); !ok {
+			continue
+		}
+		if i+1 < len(f.Lines) && f.Lines[i+1].Entry != nil {
+			continue
+		}
+		empty[line] = true
+		if i > 0 && f.Lines[i-1].Entry == nil && strings.TrimSpace(f.Lines[i-1].Raw) == "" {
+			empty[f.Lines[i-1]] = true
+		}
+	}
+	f.Remove(func(line *Line) bool { return empty[line] })
+}
+
+func (f *File) index(line *Line) int {
+	for i, l := range f.Lines {
+		if l == line {
+			return i
+		}
+	}
+	return -1
+}
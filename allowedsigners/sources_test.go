@@ -0,0 +1,95 @@
+package allowedsigners
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestMarker(t *testing.T) {
+	marker := Marker{Principal: "alice@example.com", Service: "github", Username: "alice"}
+	parsed, ok := ParseMarker(marker.String())
+	if !ok || parsed != marker {
+		t.Errorf("ParseMarker(%q) = %v, %v", marker.String(), parsed, ok)
+	}
+	if _, ok := ParseMarker("# some other comment"); ok {
+		t.Error("ParseMarker() matched an unrelated comment")
+	}
+}
+
+func TestSetSigners(t *testing.T) {
+	first, second, third := newTestKey(t), newTestKey(t), newTestKey(t)
+	marker := Marker{Principal: "alice@example.com", Service: "github", Username: "alice"}
+	entries := func(keys ...ssh.PublicKey) []*Entry {
+		var result []*Entry
+		for _, key := range keys {
+			result = append(result, NewEntry(marker.Principal, key, nil, ""))
+		}
+		return result
+	}
+
+	file := Parse([]byte("# manual\nbob@example.com " + testKey + "\n"))
+	if added, removed := file.SetSigners(marker, entries(first, second)); added != 2 || removed != 0 {
+		t.Errorf("SetSigners() = %d added, %d removed; want 2, 0", added, removed)
+	}
+	other := Marker{Principal: "carol@example.com", Service: "gitlab", Username: "carol"}
+	file.SetSigners(other, []*Entry{NewEntry(other.Principal, third, nil, "")})
+
+	if added, removed := file.SetSigners(marker, entries(second, third)); added != 1 || removed != 1 {
+		t.Errorf("SetSigners() = %d added, %d removed; want 1, 1", added, removed)
+	}
+	if markers := file.Markers(); len(markers) != 2 || markers[0] != marker || markers[1] != other {
+		t.Errorf("Markers() = %v", markers)
+	}
+
+	want := []string{
+		"# manual",
+		"bob@example.com " + testKey,
+		"",
+		marker.String(),
+		NewEntry(marker.Principal, second, nil, "").String(),
+		NewEntry(marker.Principal, third, nil, "").String(),
+		"",
+		other.String(),
+		NewEntry(other.Principal, third, nil, "").String(),
+	}
+	if got := strings.TrimSuffix(string(file.Bytes()), "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("Bytes() =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+	for _, line := range file.Entries()[1:3] {
+		if m, ok := file.MarkerFor(line); !ok || m != marker {
+			t.Errorf("MarkerFor(%q) = %v, %v", line.Text(), m, ok)
+		}
+	}
+}
+
+func TestRemoveSigners(t *testing.T) {
+	key := newTestKey(t)
+	marker := Marker{Principal: "alice@example.com", Service: "github", Username: "alice"}
+	content := "alice@example.com,bob@example.com " + testKey + "\n"
+	file := Parse([]byte(content))
+	file.SetSigners(marker, []*Entry{NewEntry(marker.Principal, key, nil, "")})
+
+	if changed := file.RemovePrincipal("alice@example.com"); changed != 2 {
+		t.Errorf("RemovePrincipal() = %d; want 2", changed)
+	}
+	if got := string(file.Bytes()); got != "bob@example.com "+testKey+"\n" {
+		t.Errorf("Bytes() = %q; want bob kept and the empty block removed", got)
+	}
+	if changed := file.RemovePrincipal("alice@example.com"); changed != 0 {
+		t.Errorf("RemovePrincipal() again = %d; want 0", changed)
+	}
+
+	entry, err := ParseEntry("bob@example.com " + testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := entry.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed := file.RemoveKey(pub); removed != 1 || len(file.Lines) != 0 {
+		t.Errorf("RemoveKey() = %d, %d lines left", removed, len(file.Lines))
+	}
+}
@@ -0,0 +1,126 @@
+// Package audit reports security risks in an SSH client configuration and
+// the key material under ~/.ssh. Findings carry a severity and, where
+// possible, the file and line they were found at, and can be written as
+// text, JSON or SARIF.
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity ranks how serious a finding is
+type Severity string
+
+// Severities, from most to least serious
+const (
+	SeverityHigh   Severity = "high"
+	SeverityMedium Severity = "medium"
+	SeverityLow    Severity = "low"
+)
+
+// rank orders severities so higher values are more serious
+func (s Severity) rank() int {
+	switch s {
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	}
+	return 0
+}
+
+// AtLeast reports whether s is as serious as threshold
+func (s Severity) AtLeast(threshold Severity) bool {
+	return s.rank() >= threshold.rank()
+}
+
+// ParseSeverity parses a severity name
+func ParseSeverity(s string) (Severity, error) {
+	severity := Severity(strings.ToLower(s))
+	if severity.rank() == 0 {
+		return "", fmt.Errorf("invalid severity %q: use high, medium or low", s)
+	}
+	return severity, nil
+}
+
+// Rule describes a kind of finding
+type Rule struct {
+	ID          string
+	Severity    Severity
+	Description string
+}
+
+// Rules checked by the audit
+var (
+	RuleForwardAgentAll = Rule{"forward-agent-all-hosts", SeverityHigh,
+		"ForwardAgent is enabled for every host, exposing the agent to any server you connect to"}
+	RuleStrictHostKeyChecking = Rule{"strict-host-key-checking-disabled", SeverityHigh,
+		"StrictHostKeyChecking no accepts changed host keys, allowing man-in-the-middle attacks"}
+	RuleKnownHostsDevNull = Rule{"known-hosts-discarded", SeverityHigh,
+		"Host keys are written to /dev/null, so servers are never verified"}
+	RuleWeakAlgorithm = Rule{"weak-algorithm", SeverityMedium,
+		"A cipher, MAC, key exchange or key algorithm with known weaknesses is enabled"}
+	RuleWeakKey = Rule{"weak-key", SeverityHigh,
+		"A DSA key or an RSA key shorter than 2048 bits"}
+	RuleUnencryptedKey = Rule{"unencrypted-private-key", SeverityMedium,
+		"A private key is not protected by a passphrase"}
+	RuleFilePermissions = Rule{"insecure-permissions", SeverityHigh,
+		"A private key is readable, or an SSH file is writable, by other users"}
+	RulePasswordAuthentication = Rule{"password-authentication-internet", SeverityMedium,
+		"Password authentication is enabled for a host reachable from the internet"}
+)
+
+// AllRules lists every rule, in the order they are documented
+var AllRules = []Rule{
+	RuleForwardAgentAll,
+	RuleStrictHostKeyChecking,
+	RuleKnownHostsDevNull,
+	RuleWeakAlgorithm,
+	RuleWeakKey,
+	RuleUnencryptedKey,
+	RuleFilePermissions,
+	RulePasswordAuthentication,
+}
+
+// Finding is a single risk found by the audit
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+}
+
+// newFinding creates a finding for rule with the rule's default severity
+func newFinding(rule Rule, file string, line int, format string, args ...any) Finding {
+	return Finding{Rule: rule.ID, Severity: rule.Severity, Message: fmt.Sprintf(format, args...), File: file, Line: line}
+}
+
+// Sort orders findings by severity, then by location
+func Sort(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity.rank() > b.Severity.rank()
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+}
+
+// Count returns how many findings are at least as serious as threshold
+func Count(findings []Finding, threshold Severity) int {
+	n := 0
+	for _, f := range findings {
+		if f.Severity.AtLeast(threshold) {
+			n++
+		}
+	}
+	return n
+}
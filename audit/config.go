@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"net"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/sshconfig"
+)
+
+// weakAlgorithms lists, per option, the algorithms considered weak
+var weakAlgorithms = map[string]map[string]bool{
+	"ciphers": {
+		"3des-cbc": true, "aes128-cbc": true, "aes192-cbc": true, "aes256-cbc": true,
+		"arcfour": true, "arcfour128": true, "arcfour256": true,
+		"blowfish-cbc": true, "cast128-cbc": true, "rijndael-cbc@lysator.liu.se": true,
+	},
+	"macs": {
+		"hmac-md5": true, "hmac-md5-96": true, "hmac-md5-etm@openssh.com": true, "hmac-md5-96-etm@openssh.com": true,
+		"hmac-sha1-96": true, "hmac-sha1-96-etm@openssh.com": true,
+		"umac-64@openssh.com": true, "umac-64-etm@openssh.com": true,
+		"hmac-ripemd160": true, "hmac-ripemd160@openssh.com": true,
+	},
+	"kexalgorithms": {
+		"diffie-hellman-group1-sha1": true, "diffie-hellman-group14-sha1": true,
+		"diffie-hellman-group-exchange-sha1": true,
+	},
+	"hostkeyalgorithms": {
+		"ssh-dss": true, "ssh-rsa": true, "ssh-dss-cert-v01@openssh.com": true, "ssh-rsa-cert-v01@openssh.com": true,
+	},
+	"pubkeyacceptedalgorithms": {
+		"ssh-dss": true, "ssh-rsa": true, "ssh-dss-cert-v01@openssh.com": true, "ssh-rsa-cert-v01@openssh.com": true,
+	},
+	"pubkeyacceptedkeytypes": {
+		"ssh-dss": true, "ssh-rsa": true,
+	},
+}
+
+// internalSuffixes are domain suffixes that are not resolvable on the internet
+var internalSuffixes = []string{".local", ".localdomain", ".internal", ".lan", ".home.arpa", ".corp", ".intranet"}
+
+// CheckConfig reports risky options in a client configuration
+func CheckConfig(cfg *sshconfig.Config) []Finding {
+	var findings []Finding
+	for _, block := range cfg.Blocks {
+		for _, opt := range block.Options {
+			findings = append(findings, checkOption(block, opt)...)
+		}
+	}
+
+	// Password authentication depends on where a host really is, so it is
+	// judged on the resolved options of each alias
+	for _, alias := range cfg.Hosts() {
+		resolved := cfg.Resolve(alias)
+		if !strings.EqualFold(resolved.Get("PasswordAuthentication"), "yes") || !isInternetHost(resolved.HostName()) {
+			continue
+		}
+		opt, _ := resolved.Option("PasswordAuthentication")
+		findings = append(findings, newFinding(RulePasswordAuthentication, opt.File, opt.Line,
+			"PasswordAuthentication yes for %s (%s), which is reachable from the internet; use key authentication", alias, resolved.HostName()))
+	}
+	return findings
+}
+
+func checkOption(block *sshconfig.Block, opt sshconfig.Option) []Finding {
+	keyword := strings.ToLower(opt.Keyword)
+	value := strings.ToLower(opt.Value())
+
+	switch keyword {
+	case "forwardagent":
+		if value != "no" && appliesToAllHosts(block) {
+			return []Finding{newFinding(RuleForwardAgentAll, opt.File, opt.Line,
+				"ForwardAgent %s applies to every host; enable it only for the hosts that need it", opt.Value())}
+		}
+	case "stricthostkeychecking":
+		if value == "no" || value == "off" {
+			return []Finding{newFinding(RuleStrictHostKeyChecking, opt.File, opt.Line,
+				"StrictHostKeyChecking %s%s; use accept-new to trust new hosts without accepting changed keys", opt.Value(), describeScope(block))}
+		}
+	case "userknownhostsfile", "globalknownhostsfile":
+		for _, file := range opt.Args {
+			if file == "/dev/null" {
+				return []Finding{newFinding(RuleKnownHostsDevNull, opt.File, opt.Line,
+					"%s /dev/null%s discards host keys", opt.Keyword, describeScope(block))}
+			}
+		}
+	}
+
+	weak, ok := weakAlgorithms[keyword]
+	if !ok || strings.HasPrefix(value, "-") {
+		return nil
+	}
+	var found []string
+	for _, algorithm := range strings.Split(strings.TrimLeft(value, "+^"), ",") {
+		if weak[strings.TrimSpace(algorithm)] {
+			found = append(found, algorithm)
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	return []Finding{newFinding(RuleWeakAlgorithm, opt.File, opt.Line,
+		"%s enables weak algorithm(s) %s%s", opt.Keyword, strings.Join(found, ", "), describeScope(block))}
+}
+
+// appliesToAllHosts reports whether a block matches every host
+func appliesToAllHosts(block *sshconfig.Block) bool {
+	switch block.Kind {
+	case "":
+		return true
+	case "Host":
+		for _, pattern := range block.Patterns {
+			if pattern == "*" {
+				return true
+			}
+		}
+	case "Match":
+		return len(block.Patterns) == 1 && strings.EqualFold(block.Patterns[0], "all")
+	}
+	return false
+}
+
+func describeScope(block *sshconfig.Block) string {
+	if appliesToAllHosts(block) {
+		return " for every host"
+	}
+	return " for " + block.Kind + " " + strings.Join(block.Patterns, " ")
+}
+
+// isInternetHost guesses whether host is reachable from the internet: public
+// IP addresses, and names with a dot outside the well-known internal suffixes
+func isInternetHost(host string) bool {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified())
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !strings.Contains(host, ".") || strings.Contains(host, "%") {
+		return false
+	}
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/evberrypi/ssh-config/sshconfig"
+)
+
+func TestCheckConfig(t *testing.T) {
+	config := `Host *
+    ForwardAgent yes
+    Ciphers +aes128-cbc,aes256-gcm@openssh.com
+    KexAlgorithms -diffie-hellman-group1-sha1
+
+Host bastion
+    HostName 203.0.113.10
+    ForwardAgent yes
+    PasswordAuthentication yes
+
+Host lab
+    HostName 192.168.1.20
+    PasswordAuthentication yes
+    StrictHostKeyChecking no
+    UserKnownHostsFile /dev/null
+
+Host web
+    HostName web.example.com
+    StrictHostKeyChecking accept-new
+    MACs hmac-sha2-256,hmac-md5
+`
+	cfg, err := sshconfig.Parse(strings.NewReader(config), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := CheckConfig(cfg)
+	want := []struct {
+		rule string
+		line int
+	}{
+		{RuleForwardAgentAll.ID, 2},
+		{RuleWeakAlgorithm.ID, 3},
+		{RuleStrictHostKeyChecking.ID, 14},
+		{RuleKnownHostsDevNull.ID, 15},
+		{RuleWeakAlgorithm.ID, 20},
+		{RulePasswordAuthentication.ID, 9},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("CheckConfig() = %+v; want %d findings", findings, len(want))
+	}
+	for i, w := range want {
+		if findings[i].Rule != w.rule || findings[i].Line != w.line || findings[i].File != "config" {
+			t.Errorf("finding %d = %+v; want %s at line %d", i, findings[i], w.rule, w.line)
+		}
+	}
+	if !strings.Contains(findings[1].Message, "aes128-cbc") || strings.Contains(findings[1].Message, "gcm") {
+		t.Errorf("weak cipher message = %q", findings[1].Message)
+	}
+}
+
+func TestIsInternetHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"203.0.113.10", true},
+		{"10.0.0.1", false},
+		{"127.0.0.1", false},
+		{"fe80::1", false},
+		{"2001:db8::1", true},
+		{"github.com", true},
+		{"nas.local", false},
+		{"db.corp", false},
+		{"localhost", false},
+		{"%h.example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := isInternetHost(tt.host); got != tt.want {
+			t.Errorf("isInternetHost(%q) = %v; want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+// CheckKeys reports weak, unencrypted and exposed private keys
+func CheckKeys(keys []*sshkeys.LocalKey) []Finding {
+	var findings []Finding
+	for _, key := range keys {
+		path := key.Path()
+		switch {
+		case key.Type() == ssh.KeyAlgoDSA:
+			findings = append(findings, newFinding(RuleWeakKey, path, 0, "DSA key; replace it with an Ed25519 key"))
+		case key.Type() == ssh.KeyAlgoRSA && key.Bits() < 2048:
+			findings = append(findings, newFinding(RuleWeakKey, path, 0, "RSA key of %d bits; use at least 3072 bits or an Ed25519 key", key.Bits()))
+		}
+
+		if key.PrivatePath == "" {
+			continue
+		}
+		if !key.Encrypted {
+			findings = append(findings, newFinding(RuleUnencryptedKey, path, 0, "private key has no passphrase"))
+		}
+		if key.PrivateMode&0077 != 0 {
+			findings = append(findings, newFinding(RuleFilePermissions, path, 0,
+				"private key has permissions %04o; it must only be accessible by you (chmod 600)", key.PrivateMode))
+		}
+	}
+	return findings
+}
+
+// CheckFiles reports SSH files and directories under dir that other users
+// can modify, which ssh treats as untrustworthy
+func CheckFiles(dir string) []Finding {
+	var findings []Finding
+	paths := []string{dir}
+	for _, name := range []string{"config", "authorized_keys", "authorized_keys2", "known_hosts", "rc", "environment"} {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		perm := info.Mode().Perm()
+		if perm&0022 == 0 {
+			continue
+		}
+		kind := "file"
+		if info.IsDir() {
+			kind = "directory"
+		}
+		findings = append(findings, newFinding(RuleFilePermissions, path, 0,
+			"%s has permissions %04o and can be modified by other users (%s)", kind, perm, fixPermissions(info)))
+	}
+	return findings
+}
+
+func fixPermissions(info os.FileInfo) string {
+	perm := info.Mode().Perm() &^ 0022
+	return fmt.Sprintf("chmod %o", perm)
+}
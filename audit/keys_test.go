@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+)
+
+func TestCheckKeysAndFiles(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, k := range []struct {
+		name       string
+		passphrase string
+	}{
+		{"id_ed25519", "secret"},
+		{"id_plain", ""},
+	} {
+		pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Passphrase: []byte(k.passphrase)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pair.Write(filepath.Join(dir, k.name), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "id_plain"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := sshkeys.Scan(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := CheckKeys(keys)
+	if len(findings) != 2 {
+		t.Fatalf("CheckKeys() = %+v; want 2 findings", findings)
+	}
+	for _, f := range findings {
+		if filepath.Base(f.File) != "id_plain" {
+			t.Errorf("unexpected finding %+v", f)
+		}
+	}
+	if findings[0].Rule != RuleUnencryptedKey.ID || findings[1].Rule != RuleFilePermissions.ID {
+		t.Errorf("CheckKeys() rules = %s, %s", findings[0].Rule, findings[1].Rule)
+	}
+
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte("Host web\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if findings := CheckFiles(dir); len(findings) != 0 {
+		t.Errorf("CheckFiles() = %+v; want none", findings)
+	}
+	if err := os.Chmod(configPath, 0666); err != nil {
+		t.Fatal(err)
+	}
+	findings = CheckFiles(dir)
+	if len(findings) != 1 || findings[0].File != configPath || findings[0].Rule != RuleFilePermissions.ID {
+		t.Errorf("CheckFiles() = %+v; want world-writable config", findings)
+	}
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testFindings = []Finding{
+	{Rule: RuleUnencryptedKey.ID, Severity: SeverityMedium, Message: "private key has no passphrase", File: "/home/alice/.ssh/id_rsa"},
+	{Rule: RuleForwardAgentAll.ID, Severity: SeverityHigh, Message: "ForwardAgent yes applies to every host", File: "/repo/ssh/config", Line: 2},
+	{Rule: RuleWeakAlgorithm.ID, Severity: SeverityLow, Message: "weak", File: "/repo/ssh/config", Line: 9},
+}
+
+func TestSortAndCount(t *testing.T) {
+	findings := append([]Finding(nil), testFindings...)
+	Sort(findings)
+	if findings[0].Severity != SeverityHigh || findings[2].Severity != SeverityLow {
+		t.Errorf("Sort() = %+v", findings)
+	}
+
+	if n := Count(findings, SeverityMedium); n != 2 {
+		t.Errorf("Count(medium) = %d; want 2", n)
+	}
+	if _, err := ParseSeverity("critical"); err == nil {
+		t.Error("ParseSeverity() expected error")
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteText(&buf, testFindings[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	want := "HIGH   /repo/ssh/config:2: ForwardAgent yes applies to every host [forward-agent-all-hosts]\n\n1 issue(s): 1 high, 0 medium, 0 low\n"
+	if buf.String() != want {
+		t.Errorf("WriteText() = %q; want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteText(&buf, nil); err != nil || buf.String() != "No issues found.\n" {
+		t.Errorf("WriteText(nil) = %q, %v", buf.String(), err)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"findings": []`) {
+		t.Errorf("WriteJSON(nil) = %q; want empty findings array", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, testFindings); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Findings []Finding `json:"findings"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 3 || report.Findings[1].Line != 2 {
+		t.Errorf("WriteJSON() round trip = %+v", report.Findings)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, testFindings, "1.0.0", filepath.FromSlash("/repo")); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("WriteSARIF() = %+v", log)
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(AllRules) {
+		t.Errorf("rules = %d; want %d", len(run.Tool.Driver.Rules), len(AllRules))
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("results = %d; want 3", len(run.Results))
+	}
+
+	tests := []struct {
+		level string
+		uri   string
+		line  int
+	}{
+		{"warning", "file:///home/alice/.ssh/id_rsa", 0},
+		{"error", "ssh/config", 2},
+		{"note", "ssh/config", 9},
+	}
+	for i, tt := range tests {
+		result := run.Results[i]
+		location := result.Locations[0].PhysicalLocation
+		line := 0
+		if location.Region != nil {
+			line = location.Region.StartLine
+		}
+		if result.Level != tt.level || location.ArtifactLocation.URI != tt.uri || line != tt.line {
+			t.Errorf("result %d = %s %s:%d; want %s %s:%d", i, result.Level, location.ArtifactLocation.URI, line, tt.level, tt.uri, tt.line)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package authkeys parses and edits OpenSSH authorized_keys files.
+//
+// Parsing is lossless (see the linefile package): lines that are not modified
+// are written back exactly as they were read, so comments, blank lines and
+// entries this package does not understand survive a round trip.
+package authkeys
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/linefile"
+	"golang.org/x/crypto/ssh"
+)
+
+// keyTypes lists the public key algorithms that may start a key in authorized_keys
+var keyTypes = map[string]bool{
+	ssh.KeyAlgoRSA:            true,
+	ssh.KeyAlgoDSA:            true,
+	ssh.KeyAlgoECDSA256:       true,
+	ssh.KeyAlgoECDSA384:       true,
+	ssh.KeyAlgoECDSA521:       true,
+	ssh.KeyAlgoED25519:        true,
+	ssh.KeyAlgoSKECDSA256:     true,
+	ssh.KeyAlgoSKED25519:      true,
+	ssh.CertAlgoRSAv01:        true,
+	ssh.CertAlgoDSAv01:        true,
+	ssh.CertAlgoECDSA256v01:   true,
+	ssh.CertAlgoECDSA384v01:   true,
+	ssh.CertAlgoECDSA521v01:   true,
+	ssh.CertAlgoED25519v01:    true,
+	ssh.CertAlgoSKECDSA256v01: true,
+	ssh.CertAlgoSKED25519v01:  true,
+}
+
+// IsKeyType reports whether s names a public key algorithm
+func IsKeyType(s string) bool {
+	return keyTypes[s]
+}
+
+// Option is a single authorized_keys option such as no-pty or from="10.0.0.0/8"
+type Option struct {
+	Name     string
+	Value    string
+	HasValue bool
+}
+
+// String formats the option as it appears in authorized_keys, quoting the value
+func (o Option) String() string {
+	if !o.HasValue {
+		return o.Name
+	}
+	return fmt.Sprintf(`%s="%s"`, o.Name, strings.ReplaceAll(o.Value, `"`, `\"`))
+}
+
+// Entry is a public key line of an authorized_keys file
+type Entry struct {
+	Options []Option
+	KeyType string
+	KeyData string
+	Comment string
+}
+
+// ParseEntry parses a single authorized_keys key line
+func ParseEntry(line string) (*Entry, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, fmt.Errorf("not a key line")
+	}
+
+	entry := &Entry{}
+	rest := line
+	if first, _ := splitField(rest); !IsKeyType(first) {
+		optionsField, remaining, err := splitOptionsField(rest)
+		if err != nil {
+			return nil, err
+		}
+		entry.Options, err = ParseOptions(optionsField)
+		if err != nil {
+			return nil, err
+		}
+		rest = remaining
+	}
+
+	entry.KeyType, rest = splitField(rest)
+	if !IsKeyType(entry.KeyType) {
+		return nil, fmt.Errorf("unknown key type %q", entry.KeyType)
+	}
+	entry.KeyData, rest = splitField(rest)
+	if entry.KeyData == "" {
+		return nil, fmt.Errorf("missing key data")
+	}
+	entry.Comment = rest
+	return entry, nil
+}
+
+// PublicKey decodes the key of the entry
+func (e *Entry) PublicKey() (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(e.KeyType + " " + e.KeyData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return key, nil
+}
+
+// Option returns the first option named name
+func (e *Entry) Option(name string) (Option, bool) {
+	for _, opt := range e.Options {
+		if strings.EqualFold(opt.Name, name) {
+			return opt, true
+		}
+	}
+	return Option{}, false
+}
+
+// SetOption replaces every option named name with opt, appending it if absent
+func (e *Entry) SetOption(opt Option) {
+	options := make([]Option, 0, len(e.Options)+1)
+	replaced := false
+	for _, existing := range e.Options {
+		if !strings.EqualFold(existing.Name, opt.Name) {
+			options = append(options, existing)
+		} else if !replaced {
+			options = append(options, opt)
+			replaced = true
+		}
+	}
+	if !replaced {
+		options = append(options, opt)
+	}
+	e.Options = options
+}
+
+// String formats the entry as an authorized_keys line
+func (e *Entry) String() string {
+	fields := make([]string, 0, 4)
+	if len(e.Options) > 0 {
+		fields = append(fields, FormatOptions(e.Options))
+	}
+	fields = append(fields, e.KeyType, e.KeyData)
+	if e.Comment != "" {
+		fields = append(fields, e.Comment)
+	}
+	return strings.Join(fields, " ")
+}
+
+// Line is a single line of an authorized_keys file
+type Line = linefile.Line[*Entry]
+
+// File is a parsed authorized_keys file
+type File struct {
+	linefile.File[*Entry]
+}
+
+// Parse parses the contents of an authorized_keys file
+func Parse(data []byte) *File {
+	f := &File{}
+	f.Lines = linefile.Parse(data, ParseEntry)
+	return f
+}
+
+// Append adds raw lines to the end of the file
+func (f *File) Append(raw ...string) {
+	for _, text := range raw {
+		f.Lines = append(f.Lines, linefile.NewLine(text, ParseEntry))
+	}
+}
+
+// splitField returns the first whitespace separated field of s and the remainder
+func splitField(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t")
+	end := strings.IndexAny(s, " \t")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], strings.TrimLeft(s[end:], " \t")
+}
+
+// splitOptionsField splits off the leading options field, which ends at the
+// first whitespace outside double quotes.
+func splitOptionsField(s string) (string, string, error) {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && inQuotes && i+1 < len(s) && s[i+1] == '"':
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case (c == ' ' || c == '\t') && !inQuotes:
+			return s[:i], strings.TrimLeft(s[i:], " \t"), nil
+		}
+	}
+	if inQuotes {
+		return "", "", fmt.Errorf("unterminated quote in options")
+	}
+	return s, "", nil
+}
+
+// ParseOptions parses a comma separated authorized_keys options field
+func ParseOptions(field string) ([]Option, error) {
+	var options []Option
+	var current strings.Builder
+	inQuotes := false
+
+	flush := func() error {
+		text := current.String()
+		current.Reset()
+		if text == "" {
+			return fmt.Errorf("empty option")
+		}
+		name, value, hasValue := strings.Cut(text, "=")
+		if name == "" {
+			return fmt.Errorf("invalid option %q", text)
+		}
+		if hasValue {
+			if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+				return fmt.Errorf("option %s: value must be quoted", name)
+			}
+			value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+		}
+		options = append(options, Option{Name: name, Value: value, HasValue: hasValue})
+		return nil
+	}
+
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		switch {
+		case c == '\\' && inQuotes && i+1 < len(field) && field[i+1] == '"':
+			current.WriteString(`\"`)
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+			current.WriteByte(c)
+		case c == ',' && !inQuotes:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote in options")
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// FormatOptions joins options into an authorized_keys options field
+func FormatOptions(options []Option) string {
+	parts := make([]string, len(options))
+	for i, opt := range options {
+		parts[i] = opt.String()
+	}
+	return strings.Join(parts, ",")
+}
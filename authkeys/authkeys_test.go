@@ -0,0 +1,133 @@
+package authkeys
+
+import (
+	"testing"
+)
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		options []Option
+		keyType string
+		keyData string
+		comment string
+		wantErr bool
+	}{
+		{
+			name:    "Bare key",
+			line:    "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5 alice@laptop",
+			keyType: "ssh-ed25519",
+			keyData: "AAAAC3NzaC1lZDI1NTE5",
+			comment: "alice@laptop",
+		},
+		{
+			name:    "Key without comment",
+			line:    "ssh-rsa AAAAB3NzaC1yc2E",
+			keyType: "ssh-rsa",
+			keyData: "AAAAB3NzaC1yc2E",
+		},
+		{
+			name: "Options with quoted values",
+			line: `no-pty,from="10.0.0.0/8,!10.0.0.1",command="echo \"hi there\"" ssh-ed25519 AAAAC3 a b`,
+			options: []Option{
+				{Name: "no-pty"},
+				{Name: "from", Value: "10.0.0.0/8,!10.0.0.1", HasValue: true},
+				{Name: "command", Value: `echo "hi there"`, HasValue: true},
+			},
+			keyType: "ssh-ed25519",
+			keyData: "AAAAC3",
+			comment: "a b",
+		},
+		{
+			name:    "Comment line",
+			line:    "# not a key",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown key type",
+			line:    "ssh-foo AAAA",
+			wantErr: true,
+		},
+		{
+			name:    "Unterminated quote",
+			line:    `command="ls ssh-ed25519 AAAA`,
+			wantErr: true,
+		},
+		{
+			name:    "Missing key data",
+			line:    "ssh-ed25519",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := ParseEntry(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if entry.KeyType != tt.keyType || entry.KeyData != tt.keyData || entry.Comment != tt.comment {
+				t.Errorf("ParseEntry() = %q %q %q; want %q %q %q",
+					entry.KeyType, entry.KeyData, entry.Comment, tt.keyType, tt.keyData, tt.comment)
+			}
+			if len(entry.Options) != len(tt.options) {
+				t.Fatalf("ParseEntry() options = %v; want %v", entry.Options, tt.options)
+			}
+			for i := range tt.options {
+				if entry.Options[i] != tt.options[i] {
+					t.Errorf("option %d = %v; want %v", i, entry.Options[i], tt.options[i])
+				}
+			}
+			if got := entry.String(); got != tt.line {
+				t.Errorf("String() = %q; want %q", got, tt.line)
+			}
+		})
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	entry, err := ParseEntry(`no-pty,expiry-time="20250101" ssh-ed25519 AAAA`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry.SetOption(Option{Name: "expiry-time", Value: "20300101", HasValue: true})
+	entry.SetOption(Option{Name: "restrict"})
+
+	want := `no-pty,expiry-time="20300101",restrict ssh-ed25519 AAAA`
+	if got := entry.String(); got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	content := "# comment\n\nssh-ed25519   AAAA  spaced comment\nnot a key\n"
+	file := Parse([]byte(content))
+
+	if got := string(file.Bytes()); got != content {
+		t.Errorf("Bytes() = %q; want %q", got, content)
+	}
+	if entries := file.Entries(); len(entries) != 1 {
+		t.Fatalf("Entries() = %d; want 1", len(entries))
+	}
+
+	file.Entries()[0].Entry.Comment = "changed"
+	file.Entries()[0].Modified = true
+	want := "# comment\n\nssh-ed25519 AAAA changed\nnot a key\n"
+	if got := string(file.Bytes()); got != want {
+		t.Errorf("Bytes() = %q; want %q", got, want)
+	}
+
+	file.Append("ssh-rsa BBBB")
+	if removed := file.Remove(func(l *Line) bool { return l.Entry == nil }); removed != 3 {
+		t.Errorf("Remove() = %d; want 3", removed)
+	}
+	want = "ssh-ed25519 AAAA changed\nssh-rsa BBBB\n"
+	if got := string(file.Bytes()); got != want {
+		t.Errorf("Bytes() = %q; want %q", got, want)
+	}
+}
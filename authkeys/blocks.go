@@ -0,0 +1,129 @@
+package authkeys
+
+import "strings"
+
+// Block describes, for ReplaceBlock, the lines of a file holding provider
+// blocks: a marker comment followed by consecutive entry lines
+type Block[L any] struct {
+	// IsMarker reports whether a line that is not an entry marks the block
+	IsMarker func(L) bool
+	// Key returns the key type and data of an entry line, or "" for any other line
+	Key func(L) string
+	// Entry returns the text of an entry line as it would be written anew
+	Entry func(L) string
+	// Text returns the text of a line as it will be written
+	Text func(L) string
+	// Comment returns a new line holding raw, which is not an entry
+	Comment func(raw string) L
+}
+
+// ReplaceBlock replaces the entries of the block of lines that b marks with
+// entries, appending a new block under marker when there is none. Blocks
+// repeated for the same marker are merged into the first. The marker line is
+// rewritten when it differs from marker, and old lines are kept for entries
+// whose key and options are unchanged. It returns the new lines and the
+// number of keys added and removed.
+func ReplaceBlock[L any](lines []L, b Block[L], marker string, entries []L) ([]L, int, int) {
+	var starts []int
+	for i, line := range lines {
+		if b.Key(line) == "" && b.IsMarker(line) {
+			starts = append(starts, i)
+		}
+	}
+	if len(starts) == 0 {
+		if n := len(lines); n > 0 && strings.TrimSpace(b.Text(lines[n-1])) != "" {
+			lines = append(lines, b.Comment(""))
+		}
+		lines = append(append(lines, b.Comment(marker)), entries...)
+		return lines, len(entries), 0
+	}
+
+	end := func(start int) int {
+		i := start + 1
+		for i < len(lines) && b.Key(lines[i]) != "" {
+			i++
+		}
+		return i
+	}
+	blank := func(i int) bool {
+		return i == len(lines) || strings.TrimSpace(b.Text(lines[i])) == ""
+	}
+
+	// Drop the repeated blocks, last first so the earlier indexes hold,
+	// along with the blank line that separated them
+	var old []L
+	for k := len(starts) - 1; k > 0; k-- {
+		start, stop := starts[k], end(starts[k])
+		old = append(append([]L{}, lines[start+1:stop]...), old...)
+		if start > 0 && blank(start-1) && blank(stop) {
+			start--
+		}
+		lines = append(lines[:start], lines[stop:]...)
+	}
+	start, stop := starts[0], end(starts[0])
+	old = append(append([]L{}, lines[start+1:stop]...), old...)
+
+	oldKeys := make(map[string]bool)
+	for _, line := range old {
+		oldKeys[b.Key(line)] = true
+	}
+	added := 0
+	newKeys := make(map[string]bool)
+	block := []L{lines[start]}
+	if b.Text(lines[start]) != marker {
+		block[0] = b.Comment(marker)
+	}
+	for _, entry := range entries {
+		key := b.Key(entry)
+		newKeys[key] = true
+		if !oldKeys[key] {
+			added++
+		}
+		line := entry
+		for _, o := range old {
+			if b.Key(o) == key && b.Entry(o) == b.Entry(entry) {
+				line = o
+				break
+			}
+		}
+		block = append(block, line)
+	}
+	removed := 0
+	for key := range oldKeys {
+		if !newKeys[key] {
+			removed++
+		}
+	}
+
+	rest := append([]L{}, lines[stop:]...)
+	return append(append(lines[:start], block...), rest...), added, removed
+}
+
+// SetKeys replaces the keys in the block of the provider account named by
+// marker with entries, appending a new block when there is none. Blocks are
+// matched on the service and username, so the marker line is rewritten when
+// its expiry differs. Lines whose key and options are unchanged are kept as
+// they were. It returns the number of keys added and removed.
+func (f *File) SetKeys(marker Marker, entries []*Entry) (int, int) {
+	lines := make([]*Line, len(entries))
+	for i, entry := range entries {
+		lines[i] = &Line{Entry: entry, Modified: true}
+	}
+	var added, removed int
+	f.Lines, added, removed = ReplaceBlock(f.Lines, Block[*Line]{
+		IsMarker: func(line *Line) bool {
+			m, ok := ParseMarker(line.Raw)
+			return ok && m.Service == marker.Service && m.Username == marker.Username
+		},
+		Key: func(line *Line) string {
+			if line.Entry == nil {
+				return ""
+			}
+			return line.Entry.KeyType + " " + line.Entry.KeyData
+		},
+		Entry:   func(line *Line) string { return line.Entry.String() },
+		Text:    (*Line).Text,
+		Comment: func(raw string) *Line { return &Line{Raw: raw} },
+	}, marker.String(), lines)
+	return added, removed
+}
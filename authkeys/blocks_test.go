@@ -0,0 +1,91 @@
+package authkeys
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetKeys(t *testing.T) {
+	entry := func(line string) *Entry {
+		e, err := ParseEntry(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	alice := Marker{Service: "github", Username: "alice"}
+	bob := Marker{Service: "gitlab", Username: "bob"}
+
+	file := Parse([]byte("# manual\nssh-ed25519 AAAAmanual me@laptop\n"))
+	if added, removed := file.SetKeys(alice, []*Entry{entry("ssh-ed25519 AAAA1"), entry("ssh-ed25519 AAAA2")}); added != 2 || removed != 0 {
+		t.Errorf("SetKeys() = %d added, %d removed; want 2, 0", added, removed)
+	}
+	file.SetKeys(bob, []*Entry{entry("ssh-rsa AAAA3")})
+
+	// Syncing again replaces only the keys of the block and updates its expiry
+	alice.Expires = time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	if added, removed := file.SetKeys(alice, []*Entry{entry("ssh-ed25519 AAAA2"), entry("ssh-ed25519 AAAA4")}); added != 1 || removed != 1 {
+		t.Errorf("SetKeys() = %d added, %d removed; want 1, 1", added, removed)
+	}
+
+	want := []string{
+		"# manual",
+		"ssh-ed25519 AAAAmanual me@laptop",
+		"",
+		alice.String(),
+		"ssh-ed25519 AAAA2",
+		"ssh-ed25519 AAAA4",
+		"",
+		bob.String(),
+		"ssh-rsa AAAA3",
+	}
+	if got := strings.TrimSuffix(string(file.Bytes()), "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("Bytes() =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+
+	// An unchanged sync leaves the file as it was
+	before := string(file.Bytes())
+	if added, removed := file.SetKeys(bob, []*Entry{entry("ssh-rsa AAAA3")}); added != 0 || removed != 0 {
+		t.Errorf("SetKeys() = %d added, %d removed; want 0, 0", added, removed)
+	}
+	if got := string(file.Bytes()); got != before {
+		t.Errorf("Bytes() after an unchanged sync =\n%s\nwant\n%s", got, before)
+	}
+
+	// Blocks repeated for an account, as older versions appended on every
+	// add, are merged into the first
+	file = Parse([]byte(strings.Join([]string{
+		"# manual",
+		"",
+		alice.String(),
+		"ssh-ed25519 AAAA1",
+		"",
+		bob.String(),
+		"ssh-rsa AAAA3",
+		"",
+		alice.String(),
+		"ssh-ed25519 AAAA1",
+		"ssh-ed25519 AAAA2",
+		"",
+		"# trailing",
+	}, "\n") + "\n"))
+	if added, removed := file.SetKeys(alice, []*Entry{entry("ssh-ed25519 AAAA2"), entry("ssh-ed25519 AAAA5")}); added != 1 || removed != 1 {
+		t.Errorf("SetKeys() = %d added, %d removed; want 1, 1", added, removed)
+	}
+	want = []string{
+		"# manual",
+		"",
+		alice.String(),
+		"ssh-ed25519 AAAA2",
+		"ssh-ed25519 AAAA5",
+		"",
+		bob.String(),
+		"ssh-rsa AAAA3",
+		"",
+		"# trailing",
+	}
+	if got := strings.TrimSuffix(string(file.Bytes()), "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("Bytes() after merging =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,68 @@
+package authkeys
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CertAuthorityOption marks a key as a CA trusted to sign user certificates
+const CertAuthorityOption = "cert-authority"
+
+// IsCertAuthority reports whether the entry trusts its key as a user CA
+func (e *Entry) IsCertAuthority() bool {
+	_, ok := e.Option(CertAuthorityOption)
+	return ok
+}
+
+// CertAuthorities returns the cert-authority lines of the file
+func (f *File) CertAuthorities() []*Line {
+	var lines []*Line
+	for _, line := range f.Entries() {
+		if line.Entry.IsCertAuthority() {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// TrustCA trusts key to sign user certificates, restricted by options such
+// as principals="..." or from="...". An existing cert-authority line for the
+// key has its options replaced, so each CA appears once; otherwise a new
+// line is appended. It reports whether an existing line was replaced.
+func (f *File) TrustCA(key ssh.PublicKey, options []Option, comment string) bool {
+	entry := &Entry{
+		Options: append([]Option{{Name: CertAuthorityOption}}, options...),
+		KeyType: key.Type(),
+		KeyData: strings.Fields(string(ssh.MarshalAuthorizedKey(key)))[1],
+		Comment: comment,
+	}
+
+	for _, line := range f.CertAuthorities() {
+		if line.Entry.hasKey(key) {
+			if entry.Comment == "" {
+				entry.Comment = line.Entry.Comment
+			}
+			line.Entry = entry
+			line.Modified = true
+			return true
+		}
+	}
+	f.Lines = append(f.Lines, &Line{Entry: entry, Modified: true})
+	return false
+}
+
+// UntrustCA removes the cert-authority lines for key and returns how many were removed.
+// Lines authorizing the same key for direct login are kept.
+func (f *File) UntrustCA(key ssh.PublicKey) int {
+	return f.Remove(func(line *Line) bool {
+		return line.Entry != nil && line.Entry.IsCertAuthority() && line.Entry.hasKey(key)
+	})
+}
+
+// hasKey reports whether the entry holds key
+func (e *Entry) hasKey(key ssh.PublicKey) bool {
+	pub, err := e.PublicKey()
+	return err == nil && bytes.Equal(pub.Marshal(), key.Marshal())
+}
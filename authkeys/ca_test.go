@@ -0,0 +1,55 @@
+package authkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestTrustCA(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca)))
+
+	// The same key authorized directly is not a CA line
+	content := authorized + " alice@laptop\n"
+	file := Parse([]byte(content))
+	if len(file.CertAuthorities()) != 0 {
+		t.Fatal("CertAuthorities() found a plain key")
+	}
+
+	principals := Option{Name: "principals", Value: "alice,deploy", HasValue: true}
+	if replaced := file.TrustCA(ca, []Option{principals}, "user CA"); replaced {
+		t.Error("TrustCA() replaced a line for a new CA")
+	}
+	from := Option{Name: "from", Value: "10.0.0.0/8", HasValue: true}
+	if replaced := file.TrustCA(ca, []Option{principals, from}, ""); !replaced {
+		t.Error("TrustCA() did not replace the existing CA line")
+	}
+
+	file = Parse(file.Bytes())
+	cas := file.CertAuthorities()
+	if len(cas) != 1 {
+		t.Fatalf("CertAuthorities() = %d lines; want 1", len(cas))
+	}
+	want := `cert-authority,principals="alice,deploy",from="10.0.0.0/8" ` + authorized + " user CA"
+	if got := cas[0].Text(); got != want {
+		t.Errorf("CA line = %q; want %q", got, want)
+	}
+
+	if removed := file.UntrustCA(ca); removed != 1 {
+		t.Errorf("UntrustCA() = %d; want 1", removed)
+	}
+	if got := string(file.Bytes()); got != content {
+		t.Errorf("Bytes() = %q; want %q", got, content)
+	}
+}
@@ -0,0 +1,169 @@
+package authkeys
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ExpiryTimeOption is the option after which sshd stops accepting a key
+const ExpiryTimeOption = "expiry-time"
+
+// expiryLayouts are the timespecs accepted by sshd for expiry-time, most specific first
+var expiryLayouts = []string{"20060102150405", "200601021504", "20060102"}
+
+// FormatExpiryTime formats t as an expiry-time value. The value is written in
+// the local time zone without a Z suffix, which every OpenSSH release accepts.
+func FormatExpiryTime(t time.Time) string {
+	return t.Local().Format("200601021504")
+}
+
+// ParseExpiryTime parses an expiry-time value. Values ending in Z are UTC,
+// anything else is interpreted in the local time zone like sshd does.
+func ParseExpiryTime(value string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(value, "Z") {
+		loc = time.UTC
+		value = strings.TrimSuffix(value, "Z")
+	}
+	for _, layout := range expiryLayouts {
+		if len(value) == len(layout) {
+			t, err := time.ParseInLocation(layout, value, loc)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid expiry time %q: %w", value, err)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry time %q", value)
+}
+
+// ExpiresAt returns the expiry time of the entry, if it has one
+func (e *Entry) ExpiresAt() (time.Time, bool, error) {
+	opt, ok := e.Option(ExpiryTimeOption)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	t, err := ParseExpiryTime(opt.Value)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	return t, true, nil
+}
+
+// Expired reports whether sshd would no longer accept the entry at now
+func (e *Entry) Expired(now time.Time) bool {
+	t, ok, err := e.ExpiresAt()
+	return ok && err == nil && !now.Before(t)
+}
+
+// Marker is the comment ssh-config writes above keys imported from a provider.
+// It records where a grant came from so it can be listed and pruned later.
+type Marker struct {
+	Service  string
+	Username string
+	Expires  time.Time
+}
+
+var markerPattern = regexp.MustCompile(`^# Keys added from (\S+) user (\S+) via ssh-config(?: \(expires (\S+)\))?$`)
+
+// String formats the marker as a comment line
+func (m Marker) String() string {
+	text := fmt.Sprintf("# Keys added from %s user %s via ssh-config", m.Service, m.Username)
+	if !m.Expires.IsZero() {
+		text += fmt.Sprintf(" (expires %s)", m.Expires.UTC().Format(time.RFC3339))
+	}
+	return text
+}
+
+// ParseMarker parses a marker comment line
+func ParseMarker(line string) (Marker, bool) {
+	match := markerPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return Marker{}, false
+	}
+	marker := Marker{Service: match[1], Username: match[2]}
+	if match[3] != "" {
+		if t, err := time.Parse(time.RFC3339, match[3]); err == nil {
+			marker.Expires = t
+		}
+	}
+	return marker, true
+}
+
+// MarkerFor returns the marker of the block line belongs to. A block is a
+// marker comment followed by consecutive key lines.
+func (f *File) MarkerFor(line *Line) (Marker, bool) {
+	index := f.index(line)
+	for i := index - 1; i >= 0; i-- {
+		if f.Lines[i].Entry != nil {
+			continue
+		}
+		return ParseMarker(f.Lines[i].Raw)
+	}
+	return Marker{}, false
+}
+
+// PruneExpired removes the entries that expired at now, along with the
+// markers of blocks left without keys, and returns the removed entries.
+func (f *File) PruneExpired(now time.Time) []*Line {
+	var expired []*Line
+	emptied := make(map[*Line]bool)
+	var marker, separator *Line
+	remaining, pruned := 0, 0
+
+	// closeBlock drops the marker of a block whose keys all expired, along with
+	// the blank line ssh-config writes before it
+	closeBlock := func() {
+		if marker != nil && remaining == 0 && pruned > 0 {
+			emptied[marker] = true
+			if separator != nil {
+				emptied[separator] = true
+			}
+		}
+		marker, separator = nil, nil
+	}
+
+	for i, line := range f.Lines {
+		if line.Entry == nil {
+			closeBlock()
+			if _, ok := ParseMarker(line.Raw); ok {
+				marker, remaining, pruned = line, 0, 0
+				if i > 0 && strings.TrimSpace(f.Lines[i-1].Raw) == "" {
+					separator = f.Lines[i-1]
+				}
+			}
+			continue
+		}
+		if line.Entry.Expired(now) {
+			expired = append(expired, line)
+			pruned++
+			continue
+		}
+		remaining++
+	}
+	closeBlock()
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	removed := make(map[*Line]bool, len(expired))
+	for _, line := range expired {
+		removed[line] = true
+	}
+	f.Remove(func(line *Line) bool {
+		return removed[line] || emptied[line]
+	})
+	return expired
+}
+
+func (f *File) index(line *Line) int {
+	for i, l := range f.Lines {
+		if l == line {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,113 @@
+package authkeys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiryTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"20261019", time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local), false},
+		{"202610191230", time.Date(2026, 10, 19, 12, 30, 0, 0, time.Local), false},
+		{"20261019123045", time.Date(2026, 10, 19, 12, 30, 45, 0, time.Local), false},
+		{"202610191230Z", time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC), false},
+		{"2026-10-19", time.Time{}, true},
+		{"20261399", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseExpiryTime(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseExpiryTime(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseExpiryTime(%q) = %v; want %v", tt.value, got, tt.want)
+		}
+	}
+
+	expiry := time.Date(2026, 10, 19, 12, 30, 0, 0, time.Local)
+	got, err := ParseExpiryTime(FormatExpiryTime(expiry))
+	if err != nil || !got.Equal(expiry) {
+		t.Errorf("ParseExpiryTime(FormatExpiryTime()) = %v, %v; want %v", got, err, expiry)
+	}
+}
+
+func TestMarker(t *testing.T) {
+	marker := Marker{
+		Service:  "github",
+		Username: "alice",
+		Expires:  time.Date(2026, 10, 26, 12, 0, 0, 0, time.UTC),
+	}
+	line := marker.String()
+	if line != "# Keys added from github user alice via ssh-config (expires 2026-10-26T12:00:00Z)" {
+		t.Errorf("String() = %q", line)
+	}
+
+	parsed, ok := ParseMarker(line)
+	if !ok || parsed.Service != "github" || parsed.Username != "alice" || !parsed.Expires.Equal(marker.Expires) {
+		t.Errorf("ParseMarker(%q) = %v, %v; want %v", line, parsed, ok, marker)
+	}
+
+	parsed, ok = ParseMarker("# Keys added from gitlab user bob via ssh-config")
+	if !ok || parsed.Username != "bob" || !parsed.Expires.IsZero() {
+		t.Errorf("ParseMarker() = %v, %v; want bob without expiry", parsed, ok)
+	}
+
+	if _, ok := ParseMarker("# some other comment"); ok {
+		t.Error("ParseMarker() matched an unrelated comment")
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	content := `ssh-ed25519 PERMANENT owner
+
+# Keys added from github user alice via ssh-config (expires 2026-10-12T12:00:00Z)
+expiry-time="202610121200" ssh-ed25519 ALICE1
+expiry-time="202610121200" ssh-ed25519 ALICE2
+
+# Keys added from github user bob via ssh-config (expires 2026-10-26T12:00:00Z)
+expiry-time="202610261200" ssh-ed25519 BOB
+
+# Keys added from gitlab user carol via ssh-config
+expiry-time="202610011200" ssh-ed25519 CAROL1
+ssh-ed25519 CAROL2
+`
+	file := Parse([]byte(content))
+
+	var alice *Line
+	for _, line := range file.Entries() {
+		if line.Entry.KeyData == "ALICE2" {
+			alice = line
+		}
+	}
+	if marker, ok := file.MarkerFor(alice); !ok || marker.Username != "alice" {
+		t.Errorf("MarkerFor() = %v, %v; want alice", marker, ok)
+	}
+
+	removed := file.PruneExpired(now)
+	if len(removed) != 3 {
+		t.Fatalf("PruneExpired() removed %d entries; want 3", len(removed))
+	}
+
+	want := `ssh-ed25519 PERMANENT owner
+
+# Keys added from github user bob via ssh-config (expires 2026-10-26T12:00:00Z)
+expiry-time="202610261200" ssh-ed25519 BOB
+
+# Keys added from gitlab user carol via ssh-config
+ssh-ed25519 CAROL2
+`
+	if got := string(file.Bytes()); got != want {
+		t.Errorf("Bytes() = %q; want %q", got, want)
+	}
+
+	if removed := file.PruneExpired(now); removed != nil {
+		t.Errorf("PruneExpired() removed %d entries on second run; want 0", len(removed))
+	}
+}
@@ -0,0 +1,157 @@
+package authkeys
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// flagOptions are the options that take no value
+var flagOptions = map[string]bool{
+	"agent-forwarding":    true,
+	"cert-authority":      true,
+	"no-agent-forwarding": true,
+	"no-port-forwarding":  true,
+	"no-pty":              true,
+	"no-touch-required":   true,
+	"no-user-rc":          true,
+	"no-x11-forwarding":   true,
+	"port-forwarding":     true,
+	"pty":                 true,
+	"restrict":            true,
+	"user-rc":             true,
+	"verify-required":     true,
+	"x11-forwarding":      true,
+}
+
+// valueOptions are the options that require a value, mapped to their validators
+var valueOptions = map[string]func(string) error{
+	"command":      validateCommand,
+	"environment":  validateEnvironment,
+	"expiry-time":  validateExpiryTime,
+	"from":         validateFrom,
+	"permitlisten": validatePermitListen,
+	"permitopen":   validatePermitOpen,
+	"principals":   validatePrincipals,
+	"tunnel":       validateTunnel,
+}
+
+var hostPatternChars = regexp.MustCompile(`^[A-Za-z0-9.\-_*?:]+$`)
+
+// ValidateOption checks that opt is an option sshd understands and that its
+// value is well formed, so a typo cannot silently disable a key or a restriction.
+func ValidateOption(opt Option) error {
+	name := strings.ToLower(opt.Name)
+	if flagOptions[name] {
+		if opt.HasValue {
+			return fmt.Errorf("option %s does not take a value", opt.Name)
+		}
+		return nil
+	}
+
+	validate, ok := valueOptions[name]
+	if !ok {
+		return fmt.Errorf("unknown option %s", opt.Name)
+	}
+	if !opt.HasValue {
+		return fmt.Errorf("option %s requires a value", opt.Name)
+	}
+	if err := validate(opt.Value); err != nil {
+		return fmt.Errorf("option %s: %w", opt.Name, err)
+	}
+	return nil
+}
+
+func validateCommand(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("command must not be empty")
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("command must be a single line")
+	}
+	return nil
+}
+
+func validateEnvironment(value string) error {
+	name, _, found := strings.Cut(value, "=")
+	if !found || name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("expected NAME=value, got %q", value)
+	}
+	return nil
+}
+
+func validateExpiryTime(value string) error {
+	_, err := ParseExpiryTime(value)
+	return err
+}
+
+// validateFrom checks a comma separated list of address or host name
+// patterns, each optionally negated with !
+func validateFrom(value string) error {
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimPrefix(pattern, "!")
+		if pattern == "" {
+			return fmt.Errorf("empty pattern in %q", value)
+		}
+		if strings.Contains(pattern, "/") {
+			if _, _, err := net.ParseCIDR(pattern); err != nil {
+				return fmt.Errorf("invalid CIDR %q", pattern)
+			}
+			continue
+		}
+		if !hostPatternChars.MatchString(pattern) {
+			return fmt.Errorf("invalid host pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// validatePermitOpen checks a host:port destination where the host may be a
+// bracketed IPv6 address and either part may be the wildcard *
+func validatePermitOpen(value string) error {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return fmt.Errorf("expected host:port, got %q", value)
+	}
+	if host == "" || (host != "*" && !hostPatternChars.MatchString(host)) {
+		return fmt.Errorf("invalid host %q", host)
+	}
+	return validatePort(port)
+}
+
+// validatePermitListen checks a [host:]port listen address
+func validatePermitListen(value string) error {
+	if !strings.Contains(value, ":") {
+		return validatePort(value)
+	}
+	return validatePermitOpen(value)
+}
+
+func validatePort(port string) error {
+	if port == "*" {
+		return nil
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func validatePrincipals(value string) error {
+	for _, principal := range strings.Split(value, ",") {
+		if strings.TrimSpace(principal) == "" {
+			return fmt.Errorf("empty principal in %q", value)
+		}
+	}
+	return nil
+}
+
+func validateTunnel(value string) error {
+	if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+		return fmt.Errorf("invalid tunnel device %q", value)
+	}
+	return nil
+}
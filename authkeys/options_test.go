@@ -0,0 +1,45 @@
+package authkeys
+
+import (
+	"testing"
+)
+
+func TestValidateOption(t *testing.T) {
+	tests := []struct {
+		option  Option
+		wantErr bool
+	}{
+		{Option{Name: "restrict"}, false},
+		{Option{Name: "no-port-forwarding"}, false},
+		{Option{Name: "restrict", Value: "yes", HasValue: true}, true},
+		{Option{Name: "from", Value: "10.0.0.0/8,!10.0.0.1,*.example.com", HasValue: true}, false},
+		{Option{Name: "from", Value: "10.0.0.0/33", HasValue: true}, true},
+		{Option{Name: "from", Value: "10.0.0.1,,10.0.0.2", HasValue: true}, true},
+		{Option{Name: "from", Value: "bad host", HasValue: true}, true},
+		{Option{Name: "from"}, true},
+		{Option{Name: "command", Value: "/usr/bin/rsync --server", HasValue: true}, false},
+		{Option{Name: "command", Value: " ", HasValue: true}, true},
+		{Option{Name: "command", Value: "ls\nrm -rf /", HasValue: true}, true},
+		{Option{Name: "permitopen", Value: "db.internal:5432", HasValue: true}, false},
+		{Option{Name: "permitopen", Value: "[::1]:8080", HasValue: true}, false},
+		{Option{Name: "permitopen", Value: "*:*", HasValue: true}, false},
+		{Option{Name: "permitopen", Value: "db.internal", HasValue: true}, true},
+		{Option{Name: "permitopen", Value: "db.internal:99999", HasValue: true}, true},
+		{Option{Name: "permitlisten", Value: "8080", HasValue: true}, false},
+		{Option{Name: "permitlisten", Value: "localhost:8080", HasValue: true}, false},
+		{Option{Name: "expiry-time", Value: "20261019", HasValue: true}, false},
+		{Option{Name: "expiry-time", Value: "tomorrow", HasValue: true}, true},
+		{Option{Name: "environment", Value: "LANG=C", HasValue: true}, false},
+		{Option{Name: "environment", Value: "LANG", HasValue: true}, true},
+		{Option{Name: "principals", Value: "alice,bob", HasValue: true}, false},
+		{Option{Name: "tunnel", Value: "0", HasValue: true}, false},
+		{Option{Name: "no-such-option"}, true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateOption(tt.option)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateOption(%s) error = %v, wantErr %v", tt.option, err, tt.wantErr)
+		}
+	}
+}
@@ -3,23 +3,30 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/sshkeys"
 	"github.com/evberrypi/ssh-config/utils"
-	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 )
 
 // ConfigOptions represents the options for SSH configuration
 type ConfigOptions struct {
-	HostName  string
-	IPAddress string
-	Username  string
-	SSHKey    string
+	HostName    string
+	IPAddress   string
+	Username    string
+	SSHKey      string
+	Certificate string
+	Scan        bool
+	GenerateKey bool
 }
 
 // AddCmd represents the Cobra command for adding a new SSH configuration or keys.
@@ -28,7 +35,8 @@ var AddCmd = &cobra.Command{
 	Short: "Add a new SSH configuration or keys",
 	Long: `Add a new SSH configuration or keys to your SSH setup.
 This command can be used to:
-- Add a new SSH configuration to ~/.ssh/config
+- Add a new SSH configuration to ~/.ssh/config, optionally with a dedicated key
+  or a certificate
 - Add GitHub keys to ~/.ssh/authorized_keys
 - Add GitLab keys to ~/.ssh/authorized_keys`,
 }
@@ -36,19 +44,89 @@ This command can be used to:
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Add a new SSH configuration",
-	Long:  "Add a new SSH configuration to your ~/.ssh/config file",
-	RunE:  runConfigCmd,
+	Long: `Add a new SSH configuration to your ~/.ssh/config file.
+With --generate-key a dedicated Ed25519 key is created for the host and the
+configuration uses it exclusively through IdentityFile and IdentitiesOnly.
+With --certificate the host presents the given certificate through
+CertificateFile; it must certify the host's key.`,
+	RunE: runConfigCmd,
 }
 
 var configOptions ConfigOptions
 
+// KeyOptions represents the options applied to keys imported from GitHub or GitLab
+type KeyOptions struct {
+	Expires           string
+	Restrict          bool
+	From              string
+	Command           string
+	NoPortForwarding  bool
+	NoAgentForwarding bool
+	NoX11Forwarding   bool
+	NoPty             bool
+	PermitOpen        []string
+	RevokedKeys       string
+}
+
+// authorizedKeysOptions returns the validated authorized_keys options for the
+// flags that were set. restrict disables port forwarding, so with
+// --permitopen it is followed by port-forwarding, which the permitopen
+// destinations then limit.
+func (o KeyOptions) authorizedKeysOptions(expires time.Time) ([]authkeys.Option, error) {
+	if o.NoPortForwarding && len(o.PermitOpen) > 0 {
+		return nil, fmt.Errorf("--permitopen cannot be combined with --no-port-forwarding")
+	}
+	var options []authkeys.Option
+	flags := []struct {
+		set  bool
+		name string
+	}{
+		{o.Restrict, "restrict"},
+		{o.Restrict && len(o.PermitOpen) > 0, "port-forwarding"},
+		{o.NoPortForwarding, "no-port-forwarding"},
+		{o.NoAgentForwarding, "no-agent-forwarding"},
+		{o.NoX11Forwarding, "no-x11-forwarding"},
+		{o.NoPty, "no-pty"},
+	}
+	for _, flag := range flags {
+		if flag.set {
+			options = append(options, authkeys.Option{Name: flag.name})
+		}
+	}
+	if o.From != "" {
+		options = append(options, authkeys.Option{Name: "from", Value: o.From, HasValue: true})
+	}
+	if o.Command != "" {
+		options = append(options, authkeys.Option{Name: "command", Value: o.Command, HasValue: true})
+	}
+	for _, dest := range o.PermitOpen {
+		options = append(options, authkeys.Option{Name: "permitopen", Value: dest, HasValue: true})
+	}
+	if !expires.IsZero() {
+		options = append(options, authkeys.Option{
+			Name:     authkeys.ExpiryTimeOption,
+			Value:    authkeys.FormatExpiryTime(expires),
+			HasValue: true,
+		})
+	}
+
+	for _, opt := range options {
+		if err := authkeys.ValidateOption(opt); err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+var keyOptions KeyOptions
+
 var gitHubKeyCmd = &cobra.Command{
 	Use:   "github [username]",
 	Short: "Add GitHub keys to authorized_keys",
 	Long:  "Fetch and add public SSH keys from a GitHub user to your ~/.ssh/authorized_keys file",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return addServiceKey("github", args[0], afero.NewOsFs())
+		return addServiceKey("github", args[0])
 	},
 }
 
@@ -58,7 +136,7 @@ var gitLabKeyCmd = &cobra.Command{
 	Long:  "Fetch and add public SSH keys from a GitLab user to your ~/.ssh/authorized_keys file",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return addServiceKey("gitlab", args[0], afero.NewOsFs())
+		return addServiceKey("gitlab", args[0])
 	},
 }
 
@@ -92,16 +170,45 @@ var promptForExtraArgs = func(reader *bufio.Reader) (map[string]string, error) {
 func runConfigCmd(cmd *cobra.Command, args []string) error {
 	reader := bufio.NewReader(os.Stdin)
 
+	if configOptions.GenerateKey && configOptions.SSHKey != "" {
+		return fmt.Errorf("--generate-key cannot be combined with --key")
+	}
+	if configOptions.GenerateKey && configOptions.Certificate != "" {
+		return fmt.Errorf("--generate-key cannot be combined with --certificate; sign the new key first")
+	}
+
 	// Prompt for required information if not provided via flags
 	if err := promptForConfigOptions(reader); err != nil {
 		return fmt.Errorf("failed to get configuration options: %w", err)
 	}
 
+	if configOptions.GenerateKey {
+		path, err := generateKeyPair(cmd.OutOrStdout(), reader, KeygenOptions{
+			Type:    sshkeys.KeyTypeEd25519,
+			File:    hostKeyPath(sshkeys.KeyTypeEd25519, configOptions.HostName),
+			Comment: configOptions.Username + "@" + configOptions.HostName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		configOptions.SSHKey = path
+	}
+
 	// Get extra SSH arguments
 	extraArgs, err := promptForExtraArgs(reader)
 	if err != nil {
 		return fmt.Errorf("failed to get extra arguments: %w", err)
 	}
+	if configOptions.GenerateKey {
+		// Offer only the dedicated key instead of everything in the agent
+		extraArgs["IdentitiesOnly"] = "yes"
+	}
+	if configOptions.Certificate != "" {
+		if err := checkCertificateForKey(configOptions.Certificate, configOptions.SSHKey); err != nil {
+			return err
+		}
+		extraArgs["CertificateFile"] = configOptions.Certificate
+	}
 
 	// Format the configuration block
 	configBlock := utils.FormatSSHConfig(
@@ -129,6 +236,35 @@ func runConfigCmd(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Println("Configuration added successfully.")
+
+	if configOptions.Scan {
+		if err := scanHostKeys(cmd.OutOrStdout(), reader, configOptions.HostName, hostScanOptions); err != nil {
+			return fmt.Errorf("failed to record host keys: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkCertificateForKey checks that certPath is a user certificate for the
+// key at keyPath, if one is given
+func checkCertificateForKey(certPath, keyPath string) error {
+	cert, _, err := sshkeys.ReadCertificate(certPath)
+	if err != nil {
+		return err
+	}
+	if cert.CertType != ssh.UserCert {
+		return fmt.Errorf("%s is a host certificate; hosts need a user certificate", certPath)
+	}
+	if keyPath == "" {
+		return nil
+	}
+	pub, _, err := sshkeys.LoadPublicKey(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read key %s: %w", keyPath, err)
+	}
+	if !bytes.Equal(pub.Marshal(), cert.Key.Marshal()) {
+		return fmt.Errorf("certificate %s was not issued for key %s", certPath, keyPath)
+	}
 	return nil
 }
 
@@ -160,15 +296,16 @@ func promptForConfigOptions(reader *bufio.Reader) error {
 		configOptions.Username = strings.TrimSpace(user)
 	}
 
-	if configOptions.SSHKey == "" {
-		fmt.Print("Enter the SSH key path (leave empty for default): ")
+	if configOptions.SSHKey == "" && !configOptions.GenerateKey {
+		defaultKey := sshkeys.DefaultIdentity()
+		fmt.Printf("Enter the SSH key path (leave empty for %s): ", defaultKey)
 		key, err := reader.ReadString('\n')
 		if err != nil {
 			return fmt.Errorf("failed to read SSH key path: %w", err)
 		}
 		configOptions.SSHKey = strings.TrimSpace(key)
 		if configOptions.SSHKey == "" {
-			configOptions.SSHKey = "~/.ssh/id_rsa.pub"
+			configOptions.SSHKey = defaultKey
 		}
 	}
 	configOptions.SSHKey = utils.ExpandUser(configOptions.SSHKey)
@@ -176,54 +313,118 @@ func promptForConfigOptions(reader *bufio.Reader) error {
 	return nil
 }
 
-func addServiceKey(service, username string, fs afero.Fs) error {
-	url, found := utils.ServiceURLs[service]
-	if !found {
-		return fmt.Errorf("invalid service specified: %s", service)
-	}
+// hostKeyPath returns the path of the dedicated key of keyType generated for host
+func hostKeyPath(keyType, host string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, host)
+	return sshkeys.DefaultKeyPath(keyType) + "_" + name
+}
 
-	url = fmt.Sprintf(url, username)
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to fetch keys: %w", err)
+func addServiceKey(service, username string) error {
+	marker := authkeys.Marker{Service: service, Username: username}
+	if keyOptions.Expires != "" {
+		validity, err := utils.ParseDuration(keyOptions.Expires)
+		if err != nil {
+			return fmt.Errorf("invalid expiry: %w", err)
+		}
+		marker.Expires = time.Now().Add(validity).Truncate(time.Minute)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch keys: HTTP %d", resp.StatusCode)
+	options, err := keyOptions.authorizedKeysOptions(marker.Expires)
+	if err != nil {
+		return fmt.Errorf("invalid key options: %w", err)
 	}
 
-	keys, err := io.ReadAll(resp.Body)
+	keys, revoked, err := fetchProviderKeys(os.Stderr, service, username, keyOptions.RevokedKeys)
 	if err != nil {
-		return fmt.Errorf("failed to read keys: %w", err)
+		return err
 	}
 
-	if len(keys) == 0 {
+	entries := importedKeyEntries(keys, options)
+	if len(entries) == 0 {
+		if revoked > 0 {
+			return fmt.Errorf("every key of user %s is revoked", username)
+		}
 		return fmt.Errorf("no keys found for user %s", username)
 	}
 
 	// Ensure the authorized_keys file exists with correct permissions
-	if err := utils.EnsureFileExists(utils.SSHPaths.AuthorizedKeys, 0600); err != nil {
+	path, owner, err := authorizedKeysTarget()
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		err = utils.EnsureUserFile(owner, path, 0600)
+	} else {
+		err = utils.EnsureFileExists(utils.SSHPaths.AuthorizedKeys, 0600)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to ensure authorized_keys file exists: %w", err)
 	}
 
-	// Open the authorized_keys file for appending
-	file, err := fs.OpenFile(utils.ExpandUser(utils.SSHPaths.AuthorizedKeys), os.O_APPEND|os.O_WRONLY, 0600)
+	// Replace the keys added from the account before, if any
+	file, err := readAuthorizedKeys()
 	if err != nil {
-		return fmt.Errorf("failed to open authorized_keys file: %w", err)
+		return err
 	}
-	defer file.Close()
-
-	// Add a comment and the keys
-	comment := fmt.Sprintf("\n# Keys added from %s user %s via ssh-config\n", service, username)
-	if _, err := file.WriteString(comment + string(keys)); err != nil {
-		return fmt.Errorf("failed to write to authorized_keys: %w", err)
+	file.SetKeys(marker, entries)
+	if err := writeAuthorizedKeys(file); err != nil {
+		return err
 	}
 
-	fmt.Printf("Successfully added %s keys for user %s\n", service, username)
+	if owner != nil {
+		fmt.Printf("Successfully added %s keys for user %s to %s\n", service, username, path)
+	} else {
+		fmt.Printf("Successfully added %s keys for user %s\n", service, username)
+	}
+	if !marker.Expires.IsZero() {
+		fmt.Printf("Keys expire at %s\n", marker.Expires.Local().Format(time.RFC1123))
+	}
 	return nil
 }
 
+// fetchProviderKeys fetches the keys a user publishes on a provider, dropping
+// with a warning to errOut the keys revoked in the list at revokedKeysPath,
+// or in the default list when it is empty. It returns the remaining keys and
+// the number that were revoked.
+func fetchProviderKeys(errOut io.Writer, service, username, revokedKeysPath string) ([]byte, int, error) {
+	revokedKeys, err := loadRevokedKeys(revokedKeysPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, err := utils.FetchKeys(context.Background(), service, username)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, revoked := withoutRevokedKeys(keys, revokedKeys)
+	for _, fingerprint := range revoked {
+		fmt.Fprintf(errOut, "Warning: skipping revoked key %s\n", fingerprint)
+	}
+	return keys, len(revoked), nil
+}
+
+// importedKeyEntries returns the authorized_keys entries for keys fetched
+// from a provider with options applied. Options supplied by the provider are
+// discarded and lines that are not keys are dropped, so nothing can be written
+// without the restrictions that were asked for.
+func importedKeyEntries(keys []byte, options []authkeys.Option) []*authkeys.Entry {
+	var entries []*authkeys.Entry
+	for _, raw := range strings.Split(string(keys), "\n") {
+		entry, err := authkeys.ParseEntry(raw)
+		if err != nil {
+			continue
+		}
+		entry.Options = options
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
 func init() {
 	AddCmd.AddCommand(configCmd, gitHubKeyCmd, gitLabKeyCmd)
 
@@ -231,4 +432,21 @@ func init() {
 	configCmd.Flags().StringVarP(&configOptions.IPAddress, "ip", "I", "", "IP address")
 	configCmd.Flags().StringVarP(&configOptions.Username, "user", "U", "", "Username")
 	configCmd.Flags().StringVarP(&configOptions.SSHKey, "key", "K", "", "SSH key path")
+	configCmd.Flags().StringVar(&configOptions.Certificate, "certificate", "", "Certificate to present for the key (CertificateFile)")
+	configCmd.Flags().BoolVar(&configOptions.GenerateKey, "generate-key", false, "Generate a dedicated Ed25519 key for the host")
+	configCmd.Flags().BoolVar(&configOptions.Scan, "scan", false, "Scan the new host and record its keys in known_hosts")
+
+	for _, keyCmd := range []*cobra.Command{gitHubKeyCmd, gitLabKeyCmd} {
+		keyCmd.Flags().StringVar(&keyOptions.Expires, "expires", "", "Expire the keys after a duration such as 12h, 7d or 2w")
+		keyCmd.Flags().BoolVar(&keyOptions.Restrict, "restrict", false, "Disable all forwarding, PTY allocation and ~/.ssh/rc for the keys")
+		keyCmd.Flags().StringVar(&keyOptions.From, "from", "", "Only accept the keys from these comma separated addresses or patterns")
+		keyCmd.Flags().StringVar(&keyOptions.Command, "command", "", "Force this command whenever the keys are used")
+		keyCmd.Flags().BoolVar(&keyOptions.NoPortForwarding, "no-port-forwarding", false, "Disable port forwarding for the keys")
+		keyCmd.Flags().BoolVar(&keyOptions.NoAgentForwarding, "no-agent-forwarding", false, "Disable agent forwarding for the keys")
+		keyCmd.Flags().BoolVar(&keyOptions.NoX11Forwarding, "no-x11-forwarding", false, "Disable X11 forwarding for the keys")
+		keyCmd.Flags().BoolVar(&keyOptions.NoPty, "no-pty", false, "Disable PTY allocation for the keys")
+		keyCmd.Flags().StringArrayVar(&keyOptions.PermitOpen, "permitopen", nil, "Limit port forwarding to host:port (repeatable)")
+		keyCmd.Flags().StringVar(&keyOptions.RevokedKeys, "revoked-keys", "", "Refuse keys revoked in this KRL or key list (default "+utils.DefaultRevokedKeysPath+" if present)")
+		keyCmd.Flags().StringVar(&forUser, "for-user", "", "Add the keys to another local user's authorized_keys (requires root)")
+	}
 }
@@ -11,9 +11,13 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/knownhosts"
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+	"github.com/evberrypi/ssh-config/sshkeys"
 	"github.com/evberrypi/ssh-config/utils"
-	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
 
@@ -45,26 +49,13 @@ func TestAddServiceKey(t *testing.T) {
 	}
 	defer func() { utils.ServiceURLs = oldURLs }()
 
-	// Mock afero filesystem
-	fs := afero.NewMemMapFs()
-
-	// Create .ssh directory and authorized_keys file
-	sshDir := filepath.Join(tmpDir, ".ssh")
-	if err := fs.MkdirAll(sshDir, 0700); err != nil {
-		t.Fatal(err)
-	}
-
-	authorizedKeysPath := filepath.Join(sshDir, "authorized_keys")
-	if _, err := fs.Create(authorizedKeysPath); err != nil {
-		t.Fatal(err)
-	}
+	authorizedKeysPath := filepath.Join(tmpDir, ".ssh", "authorized_keys")
 
 	// Run & check ability to write comment and key
-	addServiceKey("github", "testuser", fs)
+	addServiceKey("github", "testuser")
 
 	// Check if the file contains the comment and key
-	aferoFs := afero.Afero{Fs: fs}
-	content, err := aferoFs.ReadFile(authorizedKeysPath)
+	content, err := os.ReadFile(authorizedKeysPath)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,6 +68,18 @@ func TestAddServiceKey(t *testing.T) {
 	if !strings.Contains(string(content), mockKey) {
 		t.Errorf("expected %q to contain %q", content, mockKey)
 	}
+
+	// Adding the account again replaces its block instead of appending another
+	if err := addServiceKey("github", "testuser"); err != nil {
+		t.Fatalf("addServiceKey() again error = %v", err)
+	}
+	again, err := os.ReadFile(authorizedKeysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(content) {
+		t.Errorf("authorized_keys after adding again =\n%s\nwant\n%s", again, content)
+	}
 }
 
 func TestAddServiceKeyErrors(t *testing.T) {
@@ -84,28 +87,25 @@ func TestAddServiceKeyErrors(t *testing.T) {
 		name     string
 		service  string
 		username string
-		fs       afero.Fs
 		wantErr  bool
 	}{
 		{
 			name:     "Invalid service",
 			service:  "invalid",
 			username: "testuser",
-			fs:       afero.NewMemMapFs(),
 			wantErr:  true,
 		},
 		{
 			name:     "Empty username",
 			service:  "github",
 			username: "",
-			fs:       afero.NewMemMapFs(),
 			wantErr:  true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := addServiceKey(tt.service, tt.username, tt.fs)
+			err := addServiceKey(tt.service, tt.username)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("addServiceKey() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -251,3 +251,453 @@ func TestAddConfigWithExtraArgs(t *testing.T) {
 		t.Errorf("Config content = %v; want %v", string(content), expected)
 	}
 }
+
+func TestAddServiceKeyExpires(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	mockKeys := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKey1\nnot a key\nssh-rsa AAAAB3NzaC1yc2EKey2\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, mockKeys)
+	}))
+	defer ts.Close()
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{"github": ts.URL + "/%s.keys"}
+	defer func() { utils.ServiceURLs = oldURLs }()
+
+	oldOptions := keyOptions
+	keyOptions = KeyOptions{Expires: "7d"}
+	defer func() { keyOptions = oldOptions }()
+
+	authorizedKeysPath := filepath.Join(tmpDir, ".ssh", "authorized_keys")
+
+	if err := addServiceKey("github", "contractor"); err != nil {
+		t.Fatalf("addServiceKey() error = %v", err)
+	}
+
+	content, err := os.ReadFile(authorizedKeysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(content), "# Keys added from github user contractor via ssh-config (expires ") {
+		t.Errorf("expected %q to contain the expiring marker", content)
+	}
+
+	file := authkeys.Parse(content)
+	entries := file.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 keys, got %d in %q", len(entries), content)
+	}
+	for _, line := range entries {
+		expires, ok, err := line.Entry.ExpiresAt()
+		if !ok || err != nil {
+			t.Fatalf("key %q has no valid expiry-time: %v", line.Raw, err)
+		}
+		if d := time.Until(expires); d < 7*24*time.Hour-2*time.Minute || d > 7*24*time.Hour {
+			t.Errorf("key expires in %v; want about 7 days", d)
+		}
+	}
+	if strings.Contains(string(content), "not a key") {
+		t.Errorf("expected %q to drop invalid lines", content)
+	}
+
+	keyOptions = KeyOptions{Expires: "soon"}
+	if err := addServiceKey("github", "contractor"); err == nil {
+		t.Error("addServiceKey() expected error for invalid expiry")
+	}
+}
+
+func TestAddServiceKeyRestrictions(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	// The provider response carries its own options, which must not survive
+	mockKey := `cert-authority ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKey1 alice@laptop`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, mockKey)
+	}))
+	defer ts.Close()
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{"gitlab": ts.URL + "/%s.keys"}
+	defer func() { utils.ServiceURLs = oldURLs }()
+
+	oldOptions := keyOptions
+	defer func() { keyOptions = oldOptions }()
+
+	authorizedKeysPath := filepath.Join(tmpDir, ".ssh", "authorized_keys")
+
+	keyOptions = KeyOptions{
+		Restrict:   true,
+		From:       "10.0.0.0/8",
+		Command:    `/usr/bin/rsync --server "quoted"`,
+		NoPty:      true,
+		PermitOpen: []string{"db.internal:5432", "cache.internal:6379"},
+	}
+	if err := addServiceKey("gitlab", "backup"); err != nil {
+		t.Fatalf("addServiceKey() error = %v", err)
+	}
+
+	content, err := os.ReadFile(authorizedKeysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `restrict,port-forwarding,no-pty,from="10.0.0.0/8",command="/usr/bin/rsync --server \"quoted\"",` +
+		`permitopen="db.internal:5432",permitopen="cache.internal:6379" ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKey1 alice@laptop`
+	if !strings.Contains(string(content), want) {
+		t.Errorf("expected %q to contain %q", content, want)
+	}
+	if strings.Contains(string(content), "cert-authority") {
+		t.Errorf("expected %q to drop provider options", content)
+	}
+
+	invalid := []KeyOptions{
+		{From: "10.0.0.0/40"},
+		{Command: " "},
+		{PermitOpen: []string{"db.internal"}},
+		{PermitOpen: []string{"db.internal:http"}},
+		{NoPortForwarding: true, PermitOpen: []string{"db.internal:5432"}},
+	}
+	for _, opts := range invalid {
+		keyOptions = opts
+		if err := addServiceKey("gitlab", "backup"); err == nil {
+			t.Errorf("addServiceKey() with %+v expected error", opts)
+		}
+	}
+}
+
+func TestAddServiceKeyForUser(t *testing.T) {
+	// Create temporary home directories for the caller and the target user
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.Setenv("HOME", filepath.Join(tmpDir, "root"))
+	targetHome := filepath.Join(tmpDir, "deploy")
+	if err := os.MkdirAll(targetHome, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mockKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKey1 alice@laptop\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, mockKey)
+	}))
+	defer ts.Close()
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{"github": ts.URL + "/%s.keys"}
+	oldLookup := utils.LookupUser
+	utils.LookupUser = func(name string) (*utils.TargetUser, error) {
+		if name != "deploy" {
+			return nil, fmt.Errorf("unknown user %s", name)
+		}
+		return &utils.TargetUser{Name: name, Home: targetHome, UID: os.Getuid(), GID: os.Getgid()}, nil
+	}
+	defer func() {
+		utils.ServiceURLs = oldURLs
+		utils.LookupUser = oldLookup
+		forUser = ""
+	}()
+
+	forUser = "deploy"
+	if err := addServiceKey("github", "alice"); err != nil {
+		t.Fatalf("addServiceKey() error = %v", err)
+	}
+
+	keysPath := filepath.Join(targetHome, ".ssh", "authorized_keys")
+	content, err := os.ReadFile(keysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), strings.TrimSpace(mockKey)) {
+		t.Errorf("expected %q to contain %q", content, mockKey)
+	}
+
+	info, err := os.Stat(filepath.Join(targetHome, ".ssh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf(".ssh permissions = %v; want 0700", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "root", ".ssh", "authorized_keys")); !os.IsNotExist(err) {
+		t.Errorf("expected the caller's authorized_keys to be untouched, stat error = %v", err)
+	}
+
+	forUser = "nobody-here"
+	if err := addServiceKey("github", "alice"); err == nil {
+		t.Error("addServiceKey() expected error for unknown user")
+	}
+}
+
+func TestAddConfigScan(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	server := remotetest.NewServer()
+	defer server.Close()
+
+	// Patch utils.SSHPaths to use temp dir
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	oldConfig := utils.SSHPaths.Config
+	oldKnownHosts := utils.SSHPaths.KnownHosts
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	utils.SSHPaths.KnownHosts = filepath.Join(sshDir, "known_hosts")
+	defer func() {
+		utils.SSHPaths.Config = oldConfig
+		utils.SSHPaths.KnownHosts = oldKnownHosts
+	}()
+
+	// Patch the prompts to avoid stdin
+	oldPrompt := promptForExtraArgs
+	promptForExtraArgs = func(reader *bufio.Reader) (map[string]string, error) {
+		return map[string]string{"Port": fmt.Sprint(server.Port())}, nil
+	}
+	defer func() { promptForExtraArgs = oldPrompt }()
+
+	oldConfirm := promptConfirm
+	promptConfirm = func(reader *bufio.Reader, question string) (bool, error) {
+		return true, nil
+	}
+	defer func() { promptConfirm = oldConfirm }()
+
+	configOptions = ConfigOptions{
+		HostName:  "test",
+		IPAddress: server.Host(),
+		Username:  "testuser",
+		SSHKey:    "~/.ssh/id_ed25519",
+		Scan:      true,
+	}
+	defer func() { configOptions = ConfigOptions{} }()
+
+	var buf bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&buf)
+
+	if err := runConfigCmd(cmd, []string{}); err != nil {
+		t.Fatalf("runConfigCmd() error = %v", err)
+	}
+
+	content, err := os.ReadFile(utils.SSHPaths.KnownHosts)
+	if err != nil {
+		t.Fatalf("Failed to read known_hosts file: %v", err)
+	}
+	found := knownhosts.Parse(content).Find(server.Host(), server.Port())
+	if len(found) != len(server.HostKeys) {
+		t.Errorf("known_hosts has %d keys for the new host; want %d", len(found), len(server.HostKeys))
+	}
+}
+
+func TestAddConfigGenerateKey(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	// Patch utils.SSHPaths to use temp dir
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	oldConfig := utils.SSHPaths.Config
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	defer func() { utils.SSHPaths.Config = oldConfig }()
+
+	// Patch the prompts to avoid stdin
+	oldPrompt := promptForExtraArgs
+	promptForExtraArgs = func(reader *bufio.Reader) (map[string]string, error) {
+		return map[string]string{}, nil
+	}
+	defer func() { promptForExtraArgs = oldPrompt }()
+
+	oldPassphrase := promptPassphrase
+	promptPassphrase = func(reader *bufio.Reader, prompt string) ([]byte, error) {
+		return nil, nil
+	}
+	defer func() { promptPassphrase = oldPassphrase }()
+
+	configOptions = ConfigOptions{
+		HostName:    "web.prod",
+		IPAddress:   "192.168.1.1",
+		Username:    "deploy",
+		GenerateKey: true,
+	}
+	defer func() { configOptions = ConfigOptions{} }()
+
+	var buf bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&buf)
+
+	if err := runConfigCmd(cmd, []string{}); err != nil {
+		t.Fatalf("runConfigCmd() error = %v", err)
+	}
+
+	keyPath := filepath.Join(sshDir, "id_ed25519_web.prod")
+	if _, err := os.Stat(keyPath); err != nil {
+		t.Errorf("expected generated key at %s: %v", keyPath, err)
+	}
+	public, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(public), " deploy@web.prod\n") {
+		t.Errorf("public key = %q; want deploy@web.prod comment", public)
+	}
+
+	content, err := os.ReadFile(utils.SSHPaths.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"IdentityFile " + keyPath + "\n", "IdentitiesOnly yes\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Config content = %q; want %q", content, want)
+		}
+	}
+
+	configOptions = ConfigOptions{HostName: "db", IPAddress: "10.0.0.2", Username: "deploy", SSHKey: "~/.ssh/id_rsa", GenerateKey: true}
+	if err := runConfigCmd(cmd, []string{}); err == nil {
+		t.Error("runConfigCmd() expected error combining --generate-key and --key")
+	}
+}
+
+func TestAddConfigCertificate(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	// Patch utils.SSHPaths to use temp dir
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	oldConfig := utils.SSHPaths.Config
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	defer func() { utils.SSHPaths.Config = oldConfig }()
+
+	// Patch the prompt to avoid stdin
+	oldPrompt := promptForExtraArgs
+	promptForExtraArgs = func(reader *bufio.Reader) (map[string]string, error) {
+		return map[string]string{}, nil
+	}
+	defer func() { promptForExtraArgs = oldPrompt }()
+
+	ca, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath := filepath.Join(tmpDir, "ca")
+	if err := ca.Write(caPath, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"id_ed25519", "id_other"} {
+		pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pair.Write(filepath.Join(sshDir, name), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sshDir, "id_broken"), []byte("not a key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	certPath := keyPath + "-cert.pub"
+	if err := signCertificates(io.Discard, nil, []string{keyPath}, CertSignOptions{CA: caPath, Principals: []string{"deploy"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    ConfigOptions
+		wantErr bool
+	}{
+		{
+			name: "certificate for the key",
+			opts: ConfigOptions{HostName: "web", IPAddress: "10.0.0.1", Username: "deploy", SSHKey: keyPath, Certificate: certPath},
+		},
+		{
+			name:    "certificate for another key",
+			opts:    ConfigOptions{HostName: "db", IPAddress: "10.0.0.2", Username: "deploy", SSHKey: filepath.Join(sshDir, "id_other"), Certificate: certPath},
+			wantErr: true,
+		},
+		{
+			name:    "not a certificate",
+			opts:    ConfigOptions{HostName: "db", IPAddress: "10.0.0.2", Username: "deploy", SSHKey: keyPath, Certificate: keyPath + ".pub"},
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			opts:    ConfigOptions{HostName: "db", IPAddress: "10.0.0.2", Username: "deploy", SSHKey: filepath.Join(sshDir, "id_missing"), Certificate: certPath},
+			wantErr: true,
+		},
+		{
+			name:    "unreadable key",
+			opts:    ConfigOptions{HostName: "db", IPAddress: "10.0.0.2", Username: "deploy", SSHKey: filepath.Join(sshDir, "id_broken"), Certificate: certPath},
+			wantErr: true,
+		},
+		{
+			name:    "missing certificate",
+			opts:    ConfigOptions{HostName: "db", IPAddress: "10.0.0.2", Username: "deploy", SSHKey: keyPath, Certificate: filepath.Join(sshDir, "missing-cert.pub")},
+			wantErr: true,
+		},
+		{
+			name:    "with generated key",
+			opts:    ConfigOptions{HostName: "db", IPAddress: "10.0.0.2", Username: "deploy", GenerateKey: true, Certificate: certPath},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configOptions = tt.opts
+			defer func() { configOptions = ConfigOptions{} }()
+
+			err := runConfigCmd(&cobra.Command{}, []string{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runConfigCmd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	content, err := os.ReadFile(utils.SSHPaths.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "CertificateFile "+certPath+"\n") {
+		t.Errorf("Config content = %q; want CertificateFile %s", content, certPath)
+	}
+	if strings.Contains(string(content), "Host db") {
+		t.Errorf("Config content = %q; want no db host", content)
+	}
+}
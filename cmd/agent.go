@@ -0,0 +1,356 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AgentOptions represents the options for adding and removing agent identities
+type AgentOptions struct {
+	Lifetime time.Duration
+	Confirm  bool
+	All      bool
+}
+
+var agentOptions AgentOptions
+
+// AgentCmd represents the Cobra command for managing the identities in ssh-agent.
+var AgentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Manage the identities loaded in ssh-agent",
+	Long: `List, add and remove the identities held by the running SSH agent, found
+through SSH_AUTH_SOCK, and lock or unlock the agent.`,
+}
+
+var agentListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the identities loaded in the agent",
+	Long: `List the identities loaded in the agent with their fingerprints, comments and
+the hosts in ~/.ssh/config that use them through IdentityFile.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAgent(func(client agent.ExtendedAgent) error {
+			return listAgentKeys(cmd.OutOrStdout(), client)
+		})
+	},
+}
+
+var agentAddCmd = &cobra.Command{
+	Use:   "add [key...]",
+	Short: "Add private keys to the agent",
+	Long: `Add private keys to the agent, asking for the passphrase of encrypted keys.
+Without arguments the default identity (such as ~/.ssh/id_ed25519) is added.
+Use --lifetime to have the agent forget the key after a while and --confirm
+to have it ask before each use of the key.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateLifetime(agentOptions.Lifetime); err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			args = []string{sshkeys.DefaultIdentity()}
+		}
+		return withAgent(func(client agent.ExtendedAgent) error {
+			reader := bufio.NewReader(os.Stdin)
+			for _, path := range args {
+				if err := addAgentKey(cmd.OutOrStdout(), reader, client, path, agentOptions); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	},
+}
+
+var agentRemoveCmd = &cobra.Command{
+	Use:   "remove [key|SHA256:fingerprint...]",
+	Short: "Remove identities from the agent",
+	Long: `Remove identities from the agent, given as key files or SHA256 fingerprints
+as shown by agent list. Use --all to remove every identity.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if agentOptions.All == (len(args) > 0) {
+			return fmt.Errorf("specify the keys to remove or --all")
+		}
+		return withAgent(func(client agent.ExtendedAgent) error {
+			return removeAgentKeys(cmd.OutOrStdout(), client, args, agentOptions.All)
+		})
+	},
+}
+
+var agentLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Lock the agent with a passphrase",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAgent(func(client agent.ExtendedAgent) error {
+			reader := bufio.NewReader(os.Stdin)
+			passphrase, err := promptPassphrase(reader, "Enter lock password: ")
+			if err != nil {
+				return err
+			}
+			confirm, err := promptPassphrase(reader, "Again: ")
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(passphrase, confirm) {
+				return fmt.Errorf("passwords do not match")
+			}
+			if err := client.Lock(passphrase); err != nil {
+				return fmt.Errorf("failed to lock agent: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Agent locked")
+			return nil
+		})
+	},
+}
+
+var agentUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock a locked agent",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAgent(func(client agent.ExtendedAgent) error {
+			passphrase, err := promptPassphrase(bufio.NewReader(os.Stdin), "Enter lock password: ")
+			if err != nil {
+				return err
+			}
+			if err := client.Unlock(passphrase); err != nil {
+				return fmt.Errorf("failed to unlock agent: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Agent unlocked")
+			return nil
+		})
+	},
+}
+
+var agentLoadForCmd = &cobra.Command{
+	Use:   "load-for <host>",
+	Short: "Load the keys a host needs into the agent",
+	Long: `Resolve a host through ~/.ssh/config and add the IdentityFile(s) it uses to
+the agent, skipping keys that are already loaded. Hosts without an
+IdentityFile use the default identities, as ssh does. --lifetime and
+--confirm apply as for agent add.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateLifetime(agentOptions.Lifetime); err != nil {
+			return err
+		}
+		return withAgent(func(client agent.ExtendedAgent) error {
+			return loadAgentKeysForHost(cmd.OutOrStdout(), bufio.NewReader(os.Stdin), client, args[0], agentOptions)
+		})
+	},
+}
+
+// validateLifetime checks that --lifetime fits the whole seconds, up to
+// 2^32-1, that the agent protocol carries. 0 means no lifetime.
+func validateLifetime(lifetime time.Duration) error {
+	switch {
+	case lifetime < 0:
+		return fmt.Errorf("--lifetime must not be negative")
+	case lifetime > 0 && lifetime < time.Second:
+		return fmt.Errorf("--lifetime must be at least 1s, or 0 for none")
+	case lifetime/time.Second > math.MaxUint32:
+		return fmt.Errorf("--lifetime must be at most %s", time.Duration(math.MaxUint32)*time.Second)
+	}
+	return nil
+}
+
+// withAgent connects to the agent at SSH_AUTH_SOCK and calls fn with a client
+func withAgent(fn func(client agent.ExtendedAgent) error) error {
+	sock := getenvFunc("SSH_AUTH_SOCK")
+	if sock == "" {
+		return fmt.Errorf("SSH_AUTH_SOCK is not set; start an agent with: eval \"$(ssh-agent)\"")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	defer conn.Close()
+	return fn(agent.NewClient(conn))
+}
+
+// listAgentKeys prints the identities in the agent and the hosts using them
+func listAgentKeys(out io.Writer, client agent.ExtendedAgent) error {
+	keys, err := client.List()
+	if err != nil {
+		return fmt.Errorf("failed to list agent identities: %w", err)
+	}
+	if len(keys) == 0 {
+		fmt.Fprintln(out, "The agent has no identities.")
+		return nil
+	}
+
+	hostsByFingerprint := make(map[string][]string)
+	if cfg, err := loadSSHConfig(); err == nil {
+		for _, ref := range identityReferences(cfg) {
+			pub, _, err := sshkeys.LoadPublicKey(ref.Path)
+			if err != nil {
+				continue
+			}
+			fp := ssh.FingerprintSHA256(pub)
+			hostsByFingerprint[fp] = appendUnique(hostsByFingerprint[fp], ref.Host)
+		}
+	}
+
+	for _, key := range keys {
+		fp := ssh.FingerprintSHA256(key)
+		// agent.Key only carries the wire format, which KeyBits cannot size
+		bits := 0
+		if pub, err := ssh.ParsePublicKey(key.Blob); err == nil {
+			bits = sshkeys.KeyBits(pub)
+		}
+		fmt.Fprintf(out, "%s %s (%d bits) %s\n", fp, key.Type(), bits, key.Comment)
+		if hosts := hostsByFingerprint[fp]; len(hosts) > 0 {
+			fmt.Fprintf(out, "  used by: %s\n", strings.Join(hosts, ", "))
+		}
+	}
+	return nil
+}
+
+// addAgentKey reads the private key at path, asking for its passphrase if
+// needed, and adds it to the agent with the constraints in opts
+func addAgentKey(out io.Writer, reader *bufio.Reader, client agent.ExtendedAgent, path string, opts AgentOptions) error {
+	path = utils.ExpandUser(strings.TrimSuffix(path, ".pub"))
+	key, err := sshkeys.ReadPrivateKey(path, func(path string) ([]byte, error) {
+		return promptPassphrase(reader, fmt.Sprintf("Enter passphrase for %s: ", path))
+	})
+	if err != nil {
+		return err
+	}
+
+	_, comment, _ := sshkeys.LoadPublicKey(path)
+	if comment == "" {
+		comment = path
+	}
+	added := agent.AddedKey{
+		PrivateKey:       key,
+		Comment:          comment,
+		LifetimeSecs:     uint32(opts.Lifetime / time.Second),
+		ConfirmBeforeUse: opts.Confirm,
+	}
+	if err := client.Add(added); err != nil {
+		return fmt.Errorf("failed to add %s to agent: %w", path, err)
+	}
+
+	fmt.Fprintf(out, "Identity added: %s (%s)\n", path, comment)
+	if opts.Lifetime > 0 {
+		fmt.Fprintf(out, "Lifetime set to %s\n", opts.Lifetime)
+	}
+	if opts.Confirm {
+		fmt.Fprintln(out, "The agent will ask for confirmation before each use")
+	}
+	return nil
+}
+
+// removeAgentKeys removes the identities named by key file or fingerprint, or all of them
+func removeAgentKeys(out io.Writer, client agent.ExtendedAgent, targets []string, all bool) error {
+	if all {
+		if err := client.RemoveAll(); err != nil {
+			return fmt.Errorf("failed to remove agent identities: %w", err)
+		}
+		fmt.Fprintln(out, "All identities removed")
+		return nil
+	}
+
+	keys, err := client.List()
+	if err != nil {
+		return fmt.Errorf("failed to list agent identities: %w", err)
+	}
+	for _, target := range targets {
+		var fp string
+		if strings.HasPrefix(target, "SHA256:") {
+			fp = target
+		} else {
+			pub, _, err := sshkeys.LoadPublicKey(target)
+			if err != nil {
+				return err
+			}
+			fp = ssh.FingerprintSHA256(pub)
+		}
+
+		var found *agent.Key
+		for _, key := range keys {
+			if ssh.FingerprintSHA256(key) == fp {
+				found = key
+				break
+			}
+		}
+		if found == nil {
+			return fmt.Errorf("identity %s is not loaded in the agent", target)
+		}
+		if err := client.Remove(found); err != nil {
+			return fmt.Errorf("failed to remove %s from agent: %w", target, err)
+		}
+		fmt.Fprintf(out, "Identity removed: %s (%s)\n", fp, found.Comment)
+	}
+	return nil
+}
+
+// loadAgentKeysForHost adds the identity files the resolved config uses for
+// host, skipping those already in the agent
+func loadAgentKeysForHost(out io.Writer, reader *bufio.Reader, client agent.ExtendedAgent, host string, opts AgentOptions) error {
+	cfg, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+	paths := cfg.Resolve(host).IdentityFiles()
+	if len(paths) == 0 {
+		sshDir := utils.ExpandUser("~/.ssh")
+		for _, name := range sshkeys.DefaultIdentityNames {
+			if _, err := os.Stat(filepath.Join(sshDir, name)); err == nil {
+				paths = append(paths, filepath.Join(sshDir, name))
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no identity files found for %s", host)
+	}
+
+	keys, err := client.List()
+	if err != nil {
+		return fmt.Errorf("failed to list agent identities: %w", err)
+	}
+	loaded := make(map[string]bool)
+	for _, key := range keys {
+		loaded[ssh.FingerprintSHA256(key)] = true
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			fmt.Fprintf(out, "Skipping %s: file does not exist\n", path)
+			continue
+		}
+		if pub, _, err := sshkeys.LoadPublicKey(path); err == nil && loaded[ssh.FingerprintSHA256(pub)] {
+			fmt.Fprintf(out, "Already loaded: %s\n", path)
+			continue
+		}
+		if err := addAgentKey(out, reader, client, path, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	AgentCmd.AddCommand(agentListCmd, agentAddCmd, agentRemoveCmd, agentLockCmd, agentUnlockCmd, agentLoadForCmd)
+
+	for _, cmd := range []*cobra.Command{agentAddCmd, agentLoadForCmd} {
+		cmd.Flags().DurationVarP(&agentOptions.Lifetime, "lifetime", "t", 0, "Remove the key from the agent after this long, such as 1h")
+		cmd.Flags().BoolVarP(&agentOptions.Confirm, "confirm", "c", false, "Ask for confirmation before each use of the key")
+	}
+	agentRemoveCmd.Flags().BoolVarP(&agentOptions.All, "all", "a", false, "Remove every identity")
+}
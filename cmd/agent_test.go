@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// recordingAgent is an in-process agent that remembers the constraints keys were added with
+type recordingAgent struct {
+	agent.Agent
+	added []agent.AddedKey
+}
+
+func (a *recordingAgent) Add(key agent.AddedKey) error {
+	a.added = append(a.added, key)
+	return a.Agent.Add(key)
+}
+
+// serveAgent serves a on a unix socket at path until the listener is closed
+func serveAgent(t *testing.T, a agent.Agent, path string) net.Listener {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(a, conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestAgentCommands(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+	sshDir := filepath.Join(tmpDir, ".ssh")
+
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	defer func() { utils.SSHPaths = oldPaths }()
+
+	work, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "work", Passphrase: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workPath := filepath.Join(sshDir, "id_work")
+	if err := work.Write(workPath, false); err != nil {
+		t.Fatal(err)
+	}
+	personal, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeECDSA, Comment: "personal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	personalPath := filepath.Join(sshDir, "id_ecdsa")
+	if err := personal.Write(personalPath, false); err != nil {
+		t.Fatal(err)
+	}
+
+	configContent := `Host web
+    HostName web.example.com
+    IdentityFile ~/.ssh/id_work
+
+Host db
+    IdentityFile ~/.ssh/id_work
+    IdentityFile ~/.ssh/id_missing
+`
+	if err := os.WriteFile(utils.SSHPaths.Config, []byte(configContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := &recordingAgent{Agent: agent.NewKeyring()}
+	sock := filepath.Join(tmpDir, "agent.sock")
+	listener := serveAgent(t, keyring, sock)
+	defer listener.Close()
+
+	oldGetenv := getenvFunc
+	getenvFunc = func(key string) string {
+		if key == "SSH_AUTH_SOCK" {
+			return sock
+		}
+		return ""
+	}
+	defer func() { getenvFunc = oldGetenv }()
+
+	var prompts []string
+	oldPrompt := promptPassphrase
+	promptPassphrase = func(reader *bufio.Reader, prompt string) ([]byte, error) {
+		prompts = append(prompts, prompt)
+		return []byte("secret"), nil
+	}
+	defer func() { promptPassphrase = oldPrompt }()
+
+	reader := bufio.NewReader(strings.NewReader(""))
+	run := func(fn func(out *bytes.Buffer, client agent.ExtendedAgent) error) (string, error) {
+		var out bytes.Buffer
+		err := withAgent(func(client agent.ExtendedAgent) error { return fn(&out, client) })
+		return out.String(), err
+	}
+
+	// An empty agent
+	output, err := run(func(out *bytes.Buffer, client agent.ExtendedAgent) error { return listAgentKeys(out, client) })
+	if err != nil || !strings.Contains(output, "no identities") {
+		t.Errorf("listAgentKeys() = %q, %v", output, err)
+	}
+
+	// Loading the keys for a host adds its existing identity files with their constraints
+	opts := AgentOptions{Lifetime: time.Hour, Confirm: true}
+	output, err = run(func(out *bytes.Buffer, client agent.ExtendedAgent) error {
+		return loadAgentKeysForHost(out, reader, client, "db", opts)
+	})
+	if err != nil {
+		t.Fatalf("loadAgentKeysForHost() error = %v", err)
+	}
+	if !strings.Contains(output, "Identity added: "+workPath+" (work)") || !strings.Contains(output, "id_missing: file does not exist") {
+		t.Errorf("loadAgentKeysForHost() output = %q", output)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], workPath) {
+		t.Errorf("passphrase prompts = %q, want one for %s", prompts, workPath)
+	}
+	if len(keyring.added) != 1 || keyring.added[0].LifetimeSecs != 3600 || !keyring.added[0].ConfirmBeforeUse {
+		t.Errorf("added keys = %+v, want one with a lifetime of 3600s and confirmation", keyring.added)
+	}
+
+	// Keys already in the agent are skipped
+	output, err = run(func(out *bytes.Buffer, client agent.ExtendedAgent) error {
+		return loadAgentKeysForHost(out, reader, client, "web", AgentOptions{})
+	})
+	if err != nil || !strings.Contains(output, "Already loaded: "+workPath) || len(keyring.added) != 1 {
+		t.Errorf("loadAgentKeysForHost() again = %q, %v", output, err)
+	}
+
+	// Hosts without IdentityFile load the default identities
+	output, err = run(func(out *bytes.Buffer, client agent.ExtendedAgent) error {
+		return loadAgentKeysForHost(out, reader, client, "other", AgentOptions{})
+	})
+	if err != nil || !strings.Contains(output, "Identity added: "+personalPath+" (personal)") {
+		t.Errorf("loadAgentKeysForHost() default = %q, %v", output, err)
+	}
+	if len(keyring.added) != 2 || keyring.added[1].LifetimeSecs != 0 || keyring.added[1].ConfirmBeforeUse {
+		t.Errorf("added keys = %+v, want the default identity without constraints", keyring.added)
+	}
+
+	// Listing shows fingerprints and the hosts using each key
+	output, err = run(func(out *bytes.Buffer, client agent.ExtendedAgent) error { return listAgentKeys(out, client) })
+	if err != nil {
+		t.Fatalf("listAgentKeys() error = %v", err)
+	}
+	for _, want := range []string{
+		ssh.FingerprintSHA256(work.Public) + " ssh-ed25519 (256 bits) work",
+		"used by: web, db",
+		ssh.FingerprintSHA256(personal.Public) + " ecdsa-sha2-nistp256 (256 bits) personal",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("listAgentKeys() output = %q, want %q", output, want)
+		}
+	}
+
+	// Removing by fingerprint and by key file
+	output, err = run(func(out *bytes.Buffer, client agent.ExtendedAgent) error {
+		return removeAgentKeys(out, client, []string{ssh.FingerprintSHA256(work.Public)}, false)
+	})
+	if err != nil || !strings.Contains(output, "Identity removed") {
+		t.Errorf("removeAgentKeys() by fingerprint = %q, %v", output, err)
+	}
+	if _, err := run(func(out *bytes.Buffer, client agent.ExtendedAgent) error {
+		return removeAgentKeys(out, client, []string{workPath}, false)
+	}); err == nil {
+		t.Error("removeAgentKeys() expected error for a key that is not loaded")
+	}
+	if _, err := run(func(out *bytes.Buffer, client agent.ExtendedAgent) error {
+		return removeAgentKeys(out, client, []string{personalPath + ".pub"}, false)
+	}); err != nil {
+		t.Errorf("removeAgentKeys() by key file error = %v", err)
+	}
+
+	// Adding a key explicitly, then removing everything
+	prompts = nil
+	if _, err := run(func(out *bytes.Buffer, client agent.ExtendedAgent) error {
+		return addAgentKey(out, reader, client, "~/.ssh/id_ecdsa", AgentOptions{})
+	}); err != nil || len(prompts) != 0 {
+		t.Errorf("addAgentKey() error = %v, prompts = %q", err, prompts)
+	}
+	if _, err := run(func(out *bytes.Buffer, client agent.ExtendedAgent) error {
+		return removeAgentKeys(out, client, nil, true)
+	}); err != nil {
+		t.Errorf("removeAgentKeys() --all error = %v", err)
+	}
+	if keys, _ := keyring.List(); len(keys) != 0 {
+		t.Errorf("agent still holds %d key(s)", len(keys))
+	}
+
+	// Without an agent
+	getenvFunc = func(string) string { return "" }
+	if _, err := run(func(out *bytes.Buffer, client agent.ExtendedAgent) error { return listAgentKeys(out, client) }); err == nil {
+		t.Error("withAgent() expected error when SSH_AUTH_SOCK is not set")
+	}
+}
+
+func TestValidateLifetime(t *testing.T) {
+	tests := []struct {
+		lifetime time.Duration
+		wantErr  bool
+	}{
+		{0, false},
+		{time.Second, false},
+		{90 * time.Minute, false},
+		{math.MaxUint32 * time.Second, false},
+		{-time.Hour, true},
+		{500 * time.Millisecond, true},
+		{(math.MaxUint32 + 1) * time.Second, true},
+	}
+	for _, tt := range tests {
+		if err := validateLifetime(tt.lifetime); (err != nil) != tt.wantErr {
+			t.Errorf("validateLifetime(%v) error = %v, wantErr %v", tt.lifetime, err, tt.wantErr)
+		}
+	}
+
+	// The commands refuse an invalid lifetime before reaching the agent
+	oldOptions := agentOptions
+	agentOptions = AgentOptions{Lifetime: -time.Minute}
+	defer func() { agentOptions = oldOptions }()
+	for _, cmd := range []*cobra.Command{agentAddCmd, agentLoadForCmd} {
+		if err := cmd.RunE(cmd, []string{"web"}); err == nil || !strings.Contains(err.Error(), "--lifetime") {
+			t.Errorf("%s error = %v; want the lifetime refused", cmd.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/evberrypi/ssh-config/audit"
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/evberrypi/ssh-config/version"
+	"github.com/spf13/cobra"
+)
+
+// AuditOptions represents the options for auditing the SSH setup
+type AuditOptions struct {
+	Format string
+	Config string
+	SSHDir string
+	FailOn string
+}
+
+var auditOptions = AuditOptions{Format: "text", SSHDir: "~/.ssh"}
+
+// AuditCmd represents the Cobra command for auditing the SSH configuration and keys.
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Report security risks in your SSH config and keys",
+	Long: `Inspect ~/.ssh/config, its includes and the keys in ~/.ssh for risks such as:
+- ForwardAgent enabled for every host
+- StrictHostKeyChecking no or known hosts written to /dev/null
+- Weak ciphers, MACs, key exchange and key algorithms
+- DSA keys, RSA keys shorter than 2048 bits and keys without a passphrase
+- Private keys readable, or SSH files writable, by other users
+- Password authentication to hosts on the internet
+
+Results are printed as text, JSON or SARIF. Use --fail-on to exit with an
+error when a finding of at least that severity is found, for example to gate
+a dotfiles repository in CI.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAudit(cmd.OutOrStdout(), auditOptions)
+	},
+}
+
+// runAudit audits the configuration and keys selected by opts and writes the report
+func runAudit(out io.Writer, opts AuditOptions) error {
+	var threshold audit.Severity
+	if opts.FailOn != "" {
+		var err error
+		if threshold, err = audit.ParseSeverity(opts.FailOn); err != nil {
+			return err
+		}
+	}
+
+	configPath := opts.Config
+	if configPath == "" {
+		configPath = utils.SSHPaths.Config
+	}
+	cfg, err := sshconfig.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config: %w", err)
+	}
+	findings := audit.CheckConfig(cfg)
+
+	// A missing key directory is normal when auditing a config file in CI
+	sshDir := utils.ExpandUser(opts.SSHDir)
+	if _, err := os.Stat(sshDir); err == nil {
+		keys, err := sshkeys.Scan(sshDir)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, audit.CheckKeys(keys)...)
+		findings = append(findings, audit.CheckFiles(sshDir)...)
+	}
+	audit.Sort(findings)
+
+	switch opts.Format {
+	case "text":
+		err = audit.WriteText(out, findings)
+	case "json":
+		err = audit.WriteJSON(out, findings)
+	case "sarif":
+		cwd, _ := os.Getwd()
+		err = audit.WriteSARIF(out, findings, version.Version, cwd)
+	default:
+		return fmt.Errorf("invalid format %q: use text, json or sarif", opts.Format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	if threshold != "" {
+		if n := audit.Count(findings, threshold); n > 0 {
+			return fmt.Errorf("audit found %d issue(s) of %s severity or above", n, threshold)
+		}
+	}
+	return nil
+}
+
+func init() {
+	AuditCmd.Flags().StringVarP(&auditOptions.Format, "format", "o", auditOptions.Format, "Output format: text, json or sarif")
+	AuditCmd.Flags().StringVar(&auditOptions.Config, "config", "", "SSH config file to audit (default ~/.ssh/config)")
+	AuditCmd.Flags().StringVar(&auditOptions.SSHDir, "ssh-dir", auditOptions.SSHDir, "Directory whose keys and file permissions are audited")
+	AuditCmd.Flags().StringVar(&auditOptions.FailOn, "fail-on", "", "Exit with an error if an issue of this severity or above is found: high, medium or low")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunAudit(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	configPath := filepath.Join(tmpDir, "dotfiles-config")
+	configContent := "Host *\n    ForwardAgent yes\n\nHost lab\n    Ciphers 3des-cbc\n"
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := AuditOptions{Format: "text", Config: configPath, SSHDir: filepath.Join(tmpDir, "missing")}
+
+	var out bytes.Buffer
+	if err := runAudit(&out, opts); err != nil {
+		t.Fatalf("runAudit() error = %v", err)
+	}
+	for _, want := range []string{"HIGH   " + configPath + ":2:", "MEDIUM " + configPath + ":5:", "2 issue(s): 1 high, 1 medium, 0 low"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output = %q; want %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	opts.Format = "json"
+	opts.FailOn = "high"
+	err = runAudit(&out, opts)
+	if err == nil || !strings.Contains(err.Error(), "1 issue(s) of high severity") {
+		t.Errorf("runAudit() error = %v; want --fail-on error", err)
+	}
+	var report struct {
+		Findings []struct {
+			Rule string `json:"rule"`
+		} `json:"findings"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil || len(report.Findings) != 2 {
+		t.Errorf("JSON report = %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	opts.Format = "sarif"
+	opts.FailOn = ""
+	if err := runAudit(&out, opts); err != nil {
+		t.Fatalf("runAudit() sarif error = %v", err)
+	}
+	if !strings.Contains(out.String(), `"version": "2.1.0"`) {
+		t.Errorf("SARIF output = %q", out.String())
+	}
+
+	opts.Format = "xml"
+	if err := runAudit(&out, opts); err == nil {
+		t.Error("runAudit() expected error for invalid format")
+	}
+	opts.Format = "text"
+	opts.FailOn = "critical"
+	if err := runAudit(&out, opts); err == nil {
+		t.Error("runAudit() expected error for invalid severity")
+	}
+}
@@ -0,0 +1,221 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/krl"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// defaultUserMapPath is the mapping file read when --map is not given
+	defaultUserMapPath = "/etc/ssh-config/users"
+	// defaultSystemKeyCacheDir is the cache used when running under sshd, where
+	// the command user usually has no home directory
+	defaultSystemKeyCacheDir = "/var/cache/ssh-config/keys"
+)
+
+// providerIdentity is an account on a key provider such as github:alice
+type providerIdentity struct {
+	Service  string
+	Username string
+}
+
+func (id providerIdentity) String() string {
+	return id.Service + ":" + id.Username
+}
+
+// AuthorizedKeysCommandOptions represents the options for the authorized-keys-command mode
+type AuthorizedKeysCommandOptions struct {
+	MapPath     string
+	CacheDir    string
+	Timeout     time.Duration
+	CacheMaxAge time.Duration
+	RevokedKeys string
+}
+
+var authorizedKeysCommandOptions AuthorizedKeysCommandOptions
+
+// AuthorizedKeysCommandCmd represents the Cobra command used as an sshd AuthorizedKeysCommand.
+var AuthorizedKeysCommandCmd = &cobra.Command{
+	Use:   "authorized-keys-command [user] [fingerprint]",
+	Short: "Print provider keys for a local user (sshd AuthorizedKeysCommand)",
+	Long: `Print the public keys of the provider identities mapped to a local user.
+Intended to be run by sshd as an AuthorizedKeysCommand:
+
+    AuthorizedKeysCommand /usr/local/bin/ssh-config authorized-keys-command %u %f
+    AuthorizedKeysCommandUser nobody
+
+Local users are mapped to provider identities in the mapping file, one user per line:
+
+    deploy  github:alice gitlab:bob
+
+Keys are fetched from the providers within the timeout and cached. When a provider
+cannot be reached, times out or fails with a server error, the cached keys are used
+instead if they are not older than --cache-max-age. An account the provider reports
+as not found has no keys and its cache entry is removed. Only valid key lines are written
+to stdout, diagnostics go to stderr. When a fingerprint is given only the matching
+key is printed. With --revoked-keys, keys revoked in the KRL are never printed;
+if the list cannot be read no keys are printed at all.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runAuthorizedKeysCommand,
+}
+
+func runAuthorizedKeysCommand(cmd *cobra.Command, args []string) error {
+	localUser := args[0]
+	fingerprint := ""
+	if len(args) == 2 {
+		fingerprint = args[1]
+	}
+
+	file, err := os.Open(utils.ExpandUser(authorizedKeysCommandOptions.MapPath))
+	if err != nil {
+		return fmt.Errorf("failed to open user map: %w", err)
+	}
+	defer file.Close()
+
+	userMap, err := parseUserMap(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse user map: %w", err)
+	}
+
+	var revokedKeys *krl.KRL
+	if authorizedKeysCommandOptions.RevokedKeys != "" {
+		revokedKeys, err = krl.Load(authorizedKeysCommandOptions.RevokedKeys)
+		if err != nil {
+			return err
+		}
+	}
+
+	identities, ok := userMap[localUser]
+	if !ok {
+		fmt.Fprintf(cmd.ErrOrStderr(), "ssh-config: no identities mapped to user %s\n", localUser)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), authorizedKeysCommandOptions.Timeout)
+	defer cancel()
+
+	for _, id := range identities {
+		keys, err := lookupIdentityKeys(ctx, id, authorizedKeysCommandOptions.CacheDir, authorizedKeysCommandOptions.CacheMaxAge)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "ssh-config: %s: %v\n", id, err)
+			continue
+		}
+		keys, revoked := withoutRevokedKeys(keys, revokedKeys)
+		for _, fingerprint := range revoked {
+			fmt.Fprintf(cmd.ErrOrStderr(), "ssh-config: %s: skipping revoked key %s\n", id, fingerprint)
+		}
+		writeValidKeys(cmd.OutOrStdout(), cmd.ErrOrStderr(), id, keys, fingerprint)
+	}
+	return nil
+}
+
+// lookupIdentityKeys fetches the keys of id from its provider, refreshing the
+// cache on success. The cache, if not older than maxAge, is only used when the
+// provider is unavailable: unreachable, too slow or failing with a 5xx status.
+// Any other answer is authoritative, and a 404 drops the cached keys.
+func lookupIdentityKeys(ctx context.Context, id providerIdentity, cacheDir string, maxAge time.Duration) ([]byte, error) {
+	keys, fetchErr := utils.FetchKeys(ctx, id.Service, id.Username)
+	if fetchErr == nil {
+		// Cache failures must not prevent logins, the fetched keys are still valid
+		_ = utils.WriteCachedKeys(cacheDir, id.Service, id.Username, keys)
+		return keys, nil
+	}
+
+	var statusErr *utils.HTTPStatusError
+	if errors.As(fetchErr, &statusErr) && statusErr.StatusCode < http.StatusInternalServerError {
+		if statusErr.StatusCode == http.StatusNotFound {
+			// The account was deleted or renamed, its old keys must stop working
+			if err := utils.RemoveCachedKeys(cacheDir, id.Service, id.Username); err != nil {
+				return nil, fmt.Errorf("account not found: %v", err)
+			}
+			return nil, nil
+		}
+		return nil, fetchErr
+	}
+
+	keys, err := utils.ReadCachedKeys(cacheDir, id.Service, id.Username, maxAge)
+	if err != nil {
+		return nil, fmt.Errorf("%v (no usable cache: %v)", fetchErr, err)
+	}
+	return keys, nil
+}
+
+// writeValidKeys writes every line of keys that parses as a public key to out,
+// optionally restricted to the key matching fingerprint. Invalid lines are
+// reported to errOut and never reach out.
+func writeValidKeys(out, errOut io.Writer, id providerIdentity, keys []byte, fingerprint string) {
+	scanner := bufio.NewScanner(strings.NewReader(string(keys)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil || len(options) > 0 {
+			fmt.Fprintf(errOut, "ssh-config: %s: skipping invalid key line\n", id)
+			continue
+		}
+		if fingerprint != "" && ssh.FingerprintSHA256(key) != fingerprint {
+			continue
+		}
+
+		fmt.Fprintf(out, "%s %s\n", strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))), id)
+	}
+}
+
+// parseUserMap parses a mapping file of local users to provider identities.
+// Each non-comment line holds a local user followed by service:username pairs.
+func parseUserMap(r io.Reader) (map[string][]providerIdentity, error) {
+	userMap := make(map[string][]providerIdentity)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a user followed by at least one identity", lineNum)
+		}
+
+		for _, field := range fields[1:] {
+			service, username, found := strings.Cut(field, ":")
+			if !found || username == "" {
+				return nil, fmt.Errorf("line %d: invalid identity %q, use service:username", lineNum, field)
+			}
+			if _, ok := utils.ServiceURLs[service]; !ok {
+				return nil, fmt.Errorf("line %d: unknown service %q", lineNum, service)
+			}
+			userMap[fields[0]] = append(userMap[fields[0]], providerIdentity{Service: service, Username: username})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return userMap, nil
+}
+
+func init() {
+	AuthorizedKeysCommandCmd.Flags().StringVar(&authorizedKeysCommandOptions.MapPath, "map", defaultUserMapPath, "File mapping local users to provider identities")
+	AuthorizedKeysCommandCmd.Flags().StringVar(&authorizedKeysCommandOptions.CacheDir, "cache-dir", defaultSystemKeyCacheDir, "Directory used to cache provider keys")
+	AuthorizedKeysCommandCmd.Flags().DurationVar(&authorizedKeysCommandOptions.Timeout, "timeout", 5*time.Second, "Maximum time spent fetching keys from providers")
+	AuthorizedKeysCommandCmd.Flags().DurationVar(&authorizedKeysCommandOptions.CacheMaxAge, "cache-max-age", 7*24*time.Hour, "Maximum age of cached keys used when a provider is unavailable, 0 for no limit")
+	AuthorizedKeysCommandCmd.Flags().StringVar(&authorizedKeysCommandOptions.RevokedKeys, "revoked-keys", "", "Never print keys revoked in this KRL or key list")
+}
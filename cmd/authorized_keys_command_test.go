@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestAuthorizedKey returns a freshly generated public key in authorized_keys format
+func newTestAuthorizedKey(t *testing.T) (ssh.PublicKey, string) {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestParseUserMap(t *testing.T) {
+	input := `# local user -> provider identities
+deploy  github:alice gitlab:bob
+
+alice github:alice
+`
+	userMap, err := parseUserMap(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseUserMap() error = %v", err)
+	}
+
+	want := []providerIdentity{{"github", "alice"}, {"gitlab", "bob"}}
+	if len(userMap["deploy"]) != len(want) {
+		t.Fatalf("deploy identities = %v; want %v", userMap["deploy"], want)
+	}
+	for i := range want {
+		if userMap["deploy"][i] != want[i] {
+			t.Errorf("deploy identity %d = %v; want %v", i, userMap["deploy"][i], want[i])
+		}
+	}
+	if len(userMap["alice"]) != 1 {
+		t.Errorf("alice identities = %v; want 1", userMap["alice"])
+	}
+
+	invalid := []string{
+		"deploy\n",
+		"deploy alice\n",
+		"deploy bitbucket:alice\n",
+		"deploy github:\n",
+	}
+	for _, input := range invalid {
+		if _, err := parseUserMap(strings.NewReader(input)); err == nil {
+			t.Errorf("parseUserMap(%q) expected error", input)
+		}
+	}
+}
+
+func TestAuthorizedKeysCommand(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	aliceKey, aliceLine := newTestAuthorizedKey(t)
+	_, bobLine := newTestAuthorizedKey(t)
+
+	// status, unless 200, is the answer of the provider to every request
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		switch r.URL.Path {
+		case "/github/alice.keys":
+			io.WriteString(w, aliceLine+"\nnot a key\n")
+		case "/gitlab/bob.keys":
+			io.WriteString(w, `command="/bin/sh" `+bobLine+"\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{
+		"github": ts.URL + "/github/%s.keys",
+		"gitlab": ts.URL + "/gitlab/%s.keys",
+	}
+	defer func() { utils.ServiceURLs = oldURLs }()
+
+	mapPath := filepath.Join(tmpDir, "users")
+	if err := os.WriteFile(mapPath, []byte("deploy github:alice gitlab:bob\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldOptions := authorizedKeysCommandOptions
+	authorizedKeysCommandOptions = AuthorizedKeysCommandOptions{
+		MapPath:     mapPath,
+		CacheDir:    filepath.Join(tmpDir, "cache"),
+		Timeout:     5 * time.Second,
+		CacheMaxAge: 24 * time.Hour,
+	}
+	defer func() { authorizedKeysCommandOptions = oldOptions }()
+
+	run := func(args ...string) (string, string) {
+		var stdout, stderr bytes.Buffer
+		cmd := &cobra.Command{}
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		if err := runAuthorizedKeysCommand(cmd, args); err != nil {
+			t.Fatalf("runAuthorizedKeysCommand() error = %v", err)
+		}
+		return stdout.String(), stderr.String()
+	}
+
+	t.Run("Fetch from provider", func(t *testing.T) {
+		stdout, stderr := run("deploy")
+		if stdout != aliceLine+" github:alice\n" {
+			t.Errorf("stdout = %q; want only alice's key", stdout)
+		}
+		if !strings.Contains(stderr, "skipping invalid key line") {
+			t.Errorf("stderr = %q; want invalid line warning", stderr)
+		}
+	})
+
+	t.Run("Fall back to cache", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		defer func() { status = http.StatusOK }()
+
+		stdout, _ := run("deploy")
+		if stdout != aliceLine+" github:alice\n" {
+			t.Errorf("stdout = %q; want cached key", stdout)
+		}
+	})
+
+	t.Run("Other errors do not use the cache", func(t *testing.T) {
+		status = http.StatusForbidden
+		defer func() { status = http.StatusOK }()
+
+		stdout, stderr := run("deploy")
+		if stdout != "" {
+			t.Errorf("stdout = %q; want no keys", stdout)
+		}
+		if !strings.Contains(stderr, "HTTP 403") {
+			t.Errorf("stderr = %q; want the provider error", stderr)
+		}
+	})
+
+	t.Run("Stale cache", func(t *testing.T) {
+		status = http.StatusBadGateway
+		defer func() { status = http.StatusOK }()
+		cachePath := filepath.Join(tmpDir, "cache", "github", "alice.keys")
+		old := time.Now().Add(-48 * time.Hour)
+		if err := os.Chtimes(cachePath, old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		stdout, stderr := run("deploy")
+		if stdout != "" {
+			t.Errorf("stdout = %q; want no keys from a stale cache", stdout)
+		}
+		if !strings.Contains(stderr, "more than the maximum") {
+			t.Errorf("stderr = %q; want the cache age reported", stderr)
+		}
+	})
+
+	t.Run("Deleted account", func(t *testing.T) {
+		// Refresh the cache entry made stale above
+		run("deploy")
+		cachePath := filepath.Join(tmpDir, "cache", "github", "alice.keys")
+		if _, err := os.Stat(cachePath); err != nil {
+			t.Fatalf("cache entry missing: %v", err)
+		}
+
+		status = http.StatusNotFound
+		stdout, _ := run("deploy")
+		if stdout != "" {
+			t.Errorf("stdout = %q; want no keys", stdout)
+		}
+		if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+			t.Errorf("cache entry still exists (%v); want it removed", err)
+		}
+
+		// Once removed, the old keys are not used when the provider is down
+		status = http.StatusServiceUnavailable
+		defer func() { status = http.StatusOK }()
+		if stdout, _ := run("deploy"); stdout != "" {
+			t.Errorf("stdout = %q; want no keys", stdout)
+		}
+	})
+
+	t.Run("Filter by fingerprint", func(t *testing.T) {
+		stdout, _ := run("deploy", ssh.FingerprintSHA256(aliceKey))
+		if !strings.HasPrefix(stdout, aliceLine) {
+			t.Errorf("stdout = %q; want alice's key", stdout)
+		}
+
+		stdout, _ = run("deploy", "SHA256:unknown")
+		if stdout != "" {
+			t.Errorf("stdout = %q; want no keys", stdout)
+		}
+	})
+
+	t.Run("Unmapped user", func(t *testing.T) {
+		stdout, stderr := run("mallory")
+		if stdout != "" {
+			t.Errorf("stdout = %q; want no keys", stdout)
+		}
+		if !strings.Contains(stderr, "no identities mapped") {
+			t.Errorf("stderr = %q; want unmapped user warning", stderr)
+		}
+	})
+}
+
+func TestAuthorizedKeysCommandTimeout(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	_, aliceLine := newTestAuthorizedKey(t)
+
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{"github": ts.URL + "/%s.keys"}
+	defer func() { utils.ServiceURLs = oldURLs }()
+
+	cacheDir := filepath.Join(tmpDir, "cache")
+	if err := utils.WriteCachedKeys(cacheDir, "github", "alice", []byte(aliceLine+"\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	mapPath := filepath.Join(tmpDir, "users")
+	if err := os.WriteFile(mapPath, []byte("deploy github:alice\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldOptions := authorizedKeysCommandOptions
+	authorizedKeysCommandOptions = AuthorizedKeysCommandOptions{
+		MapPath:  mapPath,
+		CacheDir: cacheDir,
+		Timeout:  100 * time.Millisecond,
+	}
+	defer func() { authorizedKeysCommandOptions = oldOptions }()
+
+	var stdout, stderr bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+
+	start := time.Now()
+	if err := runAuthorizedKeysCommand(cmd, []string{"deploy"}); err != nil {
+		t.Fatalf("runAuthorizedKeysCommand() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command took %v; want it bounded by the timeout", elapsed)
+	}
+	if stdout.String() != aliceLine+" github:alice\n" {
+		t.Errorf("stdout = %q; want cached key", stdout.String())
+	}
+}
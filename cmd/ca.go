@@ -0,0 +1,317 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// CATrustOptions represents the options for trusting a certificate authority
+type CATrustOptions struct {
+	Patterns   []string
+	Principals []string
+	From       string
+}
+
+var caTrustOptions CATrustOptions
+
+var hostsTrustCACmd = &cobra.Command{
+	Use:   "trust-ca --pattern <pattern> <ca.pub>",
+	Short: "Trust a CA to sign the host keys of matching hosts",
+	Long: `Add an @cert-authority line to ~/.ssh/known_hosts so that host certificates
+signed by the CA are accepted for hosts matching the patterns, such as *.corp.
+Patterns are added to the existing line when the CA is already trusted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return trustHostCA(cmd.OutOrStdout(), args[0], caTrustOptions.Patterns)
+	},
+}
+
+var hostsUntrustCACmd = &cobra.Command{
+	Use:   "untrust-ca <ca.pub|SHA256:fingerprint>",
+	Short: "Stop trusting a host CA",
+	Long: `Remove a CA's @cert-authority lines from ~/.ssh/known_hosts, or with --pattern
+only stop trusting it for those patterns. The CA may be given as its public
+key file or its SHA256 fingerprint as shown by hosts list-ca.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return untrustHostCA(cmd.OutOrStdout(), args[0], caTrustOptions.Patterns)
+	},
+}
+
+var hostsListCACmd = &cobra.Command{
+	Use:   "list-ca",
+	Short: "List the trusted host CAs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := readKnownHosts()
+		if err != nil {
+			return err
+		}
+		lines := file.CertAuthorities()
+		if len(lines) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No host CAs are trusted.")
+			return nil
+		}
+		for _, line := range lines {
+			entry := line.Entry
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", strings.Join(entry.Hosts, ","), describeCAKey(entry.KeyType, entry.KeyData, entry.Comment))
+		}
+		return nil
+	},
+}
+
+var keysTrustCACmd = &cobra.Command{
+	Use:   "trust-ca <ca.pub>",
+	Short: "Trust a CA to sign certificates for logging in",
+	Long: `Add a cert-authority line to ~/.ssh/authorized_keys so that user certificates
+signed by the CA can log in. --principals limits the certificates accepted to
+those naming one of the principals; without it a certificate must name the
+account being logged in to. --from limits the addresses they are accepted
+from. The options of an already trusted CA are replaced.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return trustUserCA(cmd.OutOrStdout(), args[0], caTrustOptions)
+	},
+}
+
+var keysUntrustCACmd = &cobra.Command{
+	Use:   "untrust-ca <ca.pub|SHA256:fingerprint>",
+	Short: "Stop trusting a user CA",
+	Long: `Remove a CA's cert-authority lines from ~/.ssh/authorized_keys. The CA may be
+given as its public key file or its SHA256 fingerprint as shown by keys list-ca.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return untrustUserCA(cmd.OutOrStdout(), args[0])
+	},
+}
+
+var keysListCACmd = &cobra.Command{
+	Use:   "list-ca",
+	Short: "List the trusted user CAs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := readAuthorizedKeys()
+		if err != nil {
+			return err
+		}
+		lines := file.CertAuthorities()
+		if len(lines) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No user CAs are trusted.")
+			return nil
+		}
+		for _, line := range lines {
+			entry := line.Entry
+			fmt.Fprintln(cmd.OutOrStdout(), describeCAKey(entry.KeyType, entry.KeyData, entry.Comment))
+			var restrictions []string
+			for _, opt := range entry.Options {
+				if !strings.EqualFold(opt.Name, authkeys.CertAuthorityOption) {
+					restrictions = append(restrictions, opt.String())
+				}
+			}
+			if len(restrictions) > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", strings.Join(restrictions, ","))
+			}
+		}
+		return nil
+	},
+}
+
+// describeCAKey summarises a CA key as its type, fingerprint and comment
+func describeCAKey(keyType, keyData, comment string) string {
+	description := keyType
+	if pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keyType + " " + keyData)); err == nil {
+		description += " " + ssh.FingerprintSHA256(pub)
+	} else {
+		description += " (invalid key)"
+	}
+	if comment != "" {
+		description += " " + comment
+	}
+	return description
+}
+
+// loadCAKey reads the public key of a CA from a key file
+func loadCAKey(path string) (ssh.PublicKey, string, error) {
+	key, comment, err := sshkeys.LoadPublicKey(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, ok := key.(*ssh.Certificate); ok {
+		return nil, "", fmt.Errorf("%s is a certificate; give the public key of the CA that signed it", path)
+	}
+	return key, comment, nil
+}
+
+// findCAKey returns the CA key named by a SHA256 fingerprint among keys, or
+// read from the key file ref
+func findCAKey(ref string, keys []ssh.PublicKey) (ssh.PublicKey, error) {
+	if !strings.HasPrefix(ref, "SHA256:") {
+		key, _, err := loadCAKey(ref)
+		return key, err
+	}
+	for _, key := range keys {
+		if ssh.FingerprintSHA256(key) == ref {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("CA %s is not trusted", ref)
+}
+
+// trustHostCA trusts the CA key at path for hosts matching patterns
+func trustHostCA(out io.Writer, path string, patterns []string) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("--pattern is required")
+	}
+	for _, pattern := range patterns {
+		if pattern == "" || strings.ContainsAny(pattern, ", \t") {
+			return fmt.Errorf("invalid host pattern %q", pattern)
+		}
+	}
+	key, comment, err := loadCAKey(path)
+	if err != nil {
+		return err
+	}
+	file, err := readKnownHosts()
+	if err != nil {
+		return err
+	}
+
+	added := file.TrustCA(patterns, key, comment)
+	if added == 0 {
+		fmt.Fprintf(out, "CA %s is already trusted for %s\n", ssh.FingerprintSHA256(key), strings.Join(patterns, ","))
+		return nil
+	}
+	if err := writeKnownHosts(file); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Trusted CA %s for host keys of %s\n", ssh.FingerprintSHA256(key), strings.Join(patterns, ","))
+	return nil
+}
+
+// untrustHostCA removes the CA named by ref for patterns, or for every host
+func untrustHostCA(out io.Writer, ref string, patterns []string) error {
+	file, err := readKnownHosts()
+	if err != nil {
+		return err
+	}
+	var keys []ssh.PublicKey
+	for _, line := range file.CertAuthorities() {
+		if pub, err := line.Entry.PublicKey(); err == nil {
+			keys = append(keys, pub)
+		}
+	}
+	key, err := findCAKey(ref, keys)
+	if err != nil {
+		return err
+	}
+
+	if file.UntrustCA(key, patterns) == 0 {
+		return fmt.Errorf("CA %s is not trusted for those hosts", ssh.FingerprintSHA256(key))
+	}
+	if err := writeKnownHosts(file); err != nil {
+		return err
+	}
+	if len(patterns) > 0 {
+		fmt.Fprintf(out, "CA %s is no longer trusted for %s\n", ssh.FingerprintSHA256(key), strings.Join(patterns, ","))
+	} else {
+		fmt.Fprintf(out, "CA %s is no longer trusted\n", ssh.FingerprintSHA256(key))
+	}
+	return nil
+}
+
+// trustUserCA trusts the CA key at path to sign certificates for logging in
+func trustUserCA(out io.Writer, path string, opts CATrustOptions) error {
+	var options []authkeys.Option
+	if len(opts.Principals) > 0 {
+		options = append(options, authkeys.Option{Name: "principals", Value: strings.Join(opts.Principals, ","), HasValue: true})
+	}
+	if opts.From != "" {
+		options = append(options, authkeys.Option{Name: "from", Value: opts.From, HasValue: true})
+	}
+	for _, opt := range options {
+		if err := authkeys.ValidateOption(opt); err != nil {
+			return err
+		}
+	}
+
+	key, comment, err := loadCAKey(path)
+	if err != nil {
+		return err
+	}
+	file, err := readAuthorizedKeys()
+	if errors.Is(err, fs.ErrNotExist) {
+		file = &authkeys.File{}
+		path, owner, err := authorizedKeysTarget()
+		if err != nil {
+			return err
+		}
+		if owner != nil {
+			err = utils.EnsureUserFile(owner, path, 0600)
+		} else {
+			err = utils.EnsureSSHDirectory()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to ensure authorized_keys file exists: %w", err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	replaced := file.TrustCA(key, options, comment)
+	if err := writeAuthorizedKeys(file); err != nil {
+		return err
+	}
+	if replaced {
+		fmt.Fprintf(out, "Updated the options of trusted CA %s\n", ssh.FingerprintSHA256(key))
+	} else {
+		fmt.Fprintf(out, "Trusted CA %s to sign certificates for logging in\n", ssh.FingerprintSHA256(key))
+	}
+	return nil
+}
+
+// untrustUserCA removes the CA named by ref from authorized_keys
+func untrustUserCA(out io.Writer, ref string) error {
+	file, err := readAuthorizedKeys()
+	if err != nil {
+		return err
+	}
+	var keys []ssh.PublicKey
+	for _, line := range file.CertAuthorities() {
+		if pub, err := line.Entry.PublicKey(); err == nil {
+			keys = append(keys, pub)
+		}
+	}
+	key, err := findCAKey(ref, keys)
+	if err != nil {
+		return err
+	}
+
+	if file.UntrustCA(key) == 0 {
+		return fmt.Errorf("CA %s is not trusted", ssh.FingerprintSHA256(key))
+	}
+	if err := writeAuthorizedKeys(file); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "CA %s is no longer trusted\n", ssh.FingerprintSHA256(key))
+	return nil
+}
+
+func init() {
+	HostsCmd.AddCommand(hostsTrustCACmd, hostsUntrustCACmd, hostsListCACmd)
+	KeysCmd.AddCommand(keysTrustCACmd, keysUntrustCACmd, keysListCACmd)
+
+	hostsTrustCACmd.Flags().StringSliceVar(&caTrustOptions.Patterns, "pattern", nil, "Host pattern the CA is trusted for, such as *.corp (repeatable)")
+	hostsUntrustCACmd.Flags().StringSliceVar(&caTrustOptions.Patterns, "pattern", nil, "Only stop trusting the CA for this pattern (repeatable)")
+	keysTrustCACmd.Flags().StringSliceVar(&caTrustOptions.Principals, "principals", nil, "Comma separated principals a certificate must name")
+	keysTrustCACmd.Flags().StringVar(&caTrustOptions.From, "from", "", "Restrict the addresses certificates are accepted from")
+}
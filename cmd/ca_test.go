@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHostsTrustCA(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.KnownHosts = filepath.Join(tmpDir, ".ssh", "known_hosts")
+	defer func() { utils.SSHPaths = oldPaths }()
+
+	ca, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "corp host CA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath := filepath.Join(tmpDir, "host_ca")
+	if err := ca.Write(caPath, false); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := ssh.FingerprintSHA256(ca.Public)
+
+	var buf bytes.Buffer
+	if err := trustHostCA(&buf, caPath+".pub", nil); err == nil {
+		t.Error("trustHostCA() expected error without patterns")
+	}
+	if err := trustHostCA(&buf, caPath+".pub", []string{"a.corp,b.corp"}); err == nil {
+		t.Error("trustHostCA() expected error for a pattern list")
+	}
+	if err := trustHostCA(&buf, caPath+".pub", []string{"*.corp"}); err != nil {
+		t.Fatalf("trustHostCA() error = %v", err)
+	}
+	if err := trustHostCA(&buf, caPath, []string{"*.corp", "*.lab"}); err != nil {
+		t.Fatalf("trustHostCA() again error = %v", err)
+	}
+
+	content, err := os.ReadFile(utils.SSHPaths.KnownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "@cert-authority *.corp,*.lab " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.Public))) + " corp host CA\n"
+	if string(content) != want {
+		t.Errorf("known_hosts = %q; want %q", content, want)
+	}
+
+	buf.Reset()
+	hostsListCACmd.SetOut(&buf)
+	if err := hostsListCACmd.RunE(hostsListCACmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "*.corp,*.lab ssh-ed25519 "+fingerprint+" corp host CA\n" {
+		t.Errorf("hosts list-ca = %q", got)
+	}
+
+	if err := untrustHostCA(&buf, fingerprint, []string{"*.lab"}); err != nil {
+		t.Fatalf("untrustHostCA() error = %v", err)
+	}
+	if err := untrustHostCA(&buf, fingerprint, []string{"*.lab"}); err == nil {
+		t.Error("untrustHostCA() expected error for a pattern no longer trusted")
+	}
+	if err := untrustHostCA(&buf, "SHA256:unknown", nil); err == nil {
+		t.Error("untrustHostCA() expected error for an unknown fingerprint")
+	}
+	if err := untrustHostCA(&buf, caPath+".pub", nil); err != nil {
+		t.Fatalf("untrustHostCA() of every pattern error = %v", err)
+	}
+
+	buf.Reset()
+	if err := hostsListCACmd.RunE(hostsListCACmd, nil); err != nil || buf.String() != "No host CAs are trusted.\n" {
+		t.Errorf("hosts list-ca = %q, %v", buf.String(), err)
+	}
+}
+
+func TestKeysTrustCA(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.AuthorizedKeys = filepath.Join(tmpDir, ".ssh", "authorized_keys")
+	defer func() { utils.SSHPaths = oldPaths }()
+
+	ca, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "user CA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath := filepath.Join(tmpDir, "user_ca")
+	if err := ca.Write(caPath, false); err != nil {
+		t.Fatal(err)
+	}
+	user, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userPath := filepath.Join(tmpDir, "id_ed25519")
+	if err := user.Write(userPath, false); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := ssh.FingerprintSHA256(ca.Public)
+
+	var buf bytes.Buffer
+	// authorized_keys is created when missing
+	if err := trustUserCA(&buf, caPath+".pub", CATrustOptions{Principals: []string{"alice", "deploy"}}); err != nil {
+		t.Fatalf("trustUserCA() error = %v", err)
+	}
+	if err := trustUserCA(&buf, caPath+".pub", CATrustOptions{Principals: []string{"alice"}, From: "10.0.0.0/8"}); err != nil {
+		t.Fatalf("trustUserCA() again error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "Updated the options of trusted CA "+fingerprint) {
+		t.Errorf("trustUserCA() output = %q", buf.String())
+	}
+	if err := trustUserCA(&buf, caPath+".pub", CATrustOptions{Principals: []string{"alice", ""}}); err == nil {
+		t.Error("trustUserCA() expected error for an empty principal")
+	}
+
+	// A certificate is not a CA
+	if err := signCertificates(&buf, nil, []string{userPath}, CertSignOptions{CA: caPath}); err != nil {
+		t.Fatal(err)
+	}
+	if err := trustUserCA(&buf, userPath+"-cert.pub", CATrustOptions{}); err == nil {
+		t.Error("trustUserCA() expected error for a certificate")
+	}
+
+	content, err := os.ReadFile(utils.SSHPaths.AuthorizedKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `cert-authority,principals="alice",from="10.0.0.0/8" ` + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.Public))) + " user CA\n"
+	if string(content) != want {
+		t.Errorf("authorized_keys = %q; want %q", content, want)
+	}
+	info, err := os.Stat(utils.SSHPaths.AuthorizedKeys)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("authorized_keys mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	buf.Reset()
+	keysListCACmd.SetOut(&buf)
+	if err := keysListCACmd.RunE(keysListCACmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "ssh-ed25519 "+fingerprint+" user CA\n  principals=\"alice\",from=\"10.0.0.0/8\"\n" {
+		t.Errorf("keys list-ca = %q", got)
+	}
+
+	if err := untrustUserCA(&buf, fingerprint); err != nil {
+		t.Fatalf("untrustUserCA() error = %v", err)
+	}
+	if err := untrustUserCA(&buf, caPath+".pub"); err == nil {
+		t.Error("untrustUserCA() expected error for a CA no longer trusted")
+	}
+	buf.Reset()
+	if err := keysListCACmd.RunE(keysListCACmd, nil); err != nil || buf.String() != "No user CAs are trusted.\n" {
+		t.Errorf("keys list-ca = %q, %v", buf.String(), err)
+	}
+}
+
+func TestKeysTrustCAForUser(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.Setenv("HOME", filepath.Join(tmpDir, "root"))
+	targetHome := filepath.Join(tmpDir, "deploy")
+	if err := os.MkdirAll(targetHome, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldLookup := utils.LookupUser
+	utils.LookupUser = func(name string) (*utils.TargetUser, error) {
+		return &utils.TargetUser{Name: name, Home: targetHome, UID: os.Getuid(), GID: os.Getgid()}, nil
+	}
+	defer func() {
+		utils.LookupUser = oldLookup
+		forUser = ""
+	}()
+
+	ca, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "user CA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath := filepath.Join(tmpDir, "user_ca")
+	if err := ca.Write(caPath, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The target account has no ~/.ssh yet
+	forUser = "deploy"
+	var buf bytes.Buffer
+	if err := trustUserCA(&buf, caPath+".pub", CATrustOptions{Principals: []string{"deploy"}}); err != nil {
+		t.Fatalf("trustUserCA() error = %v", err)
+	}
+
+	keysPath := filepath.Join(targetHome, ".ssh", "authorized_keys")
+	content, err := os.ReadFile(keysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), `cert-authority,principals="deploy" `) {
+		t.Errorf("authorized_keys = %q; want the CA trusted", content)
+	}
+	for path, perm := range map[string]os.FileMode{filepath.Dir(keysPath): 0700, keysPath: 0600} {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != perm {
+			t.Errorf("%s mode = %v, %v; want %v", path, info.Mode().Perm(), err, perm)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "root", ".ssh")); !os.IsNotExist(err) {
+		t.Errorf("expected the caller's ~/.ssh to be untouched, stat error = %v", err)
+	}
+}
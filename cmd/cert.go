@@ -0,0 +1,213 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// CertSignOptions represents the options for signing a certificate
+type CertSignOptions struct {
+	CA         string
+	KeyID      string
+	Principals []string
+	Validity   string
+	Host       bool
+	Serial     uint64
+	Options    []string
+	Force      bool
+}
+
+var certSignOptions CertSignOptions
+
+// CertCmd represents the Cobra command for working with SSH certificates.
+var CertCmd = &cobra.Command{
+	Use:   "cert",
+	Short: "Inspect and sign SSH certificates",
+	Long: `Inspect OpenSSH certificates and sign user or host keys with a certificate
+authority (CA) key.`,
+}
+
+var certInspectCmd = &cobra.Command{
+	Use:   "inspect <file>...",
+	Short: "Show the contents of certificates",
+	Long: `Show the type, key, signing CA, key ID, serial, validity window, principals,
+critical options and extensions of certificates, and whether they are
+currently valid. A key file may be given instead of its -cert.pub file.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for i, path := range args {
+			if i > 0 {
+				fmt.Fprintln(cmd.OutOrStdout())
+			}
+			if err := inspectCertificate(cmd.OutOrStdout(), path); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var certSignCmd = &cobra.Command{
+	Use:   "sign --ca <key> <pubkey>...",
+	Short: "Sign public keys with a CA key",
+	Long: `Sign public keys with a CA private key, writing each certificate next to the
+key with a -cert.pub suffix. --validity takes ssh-keygen -V intervals such as
+8h, +52w, -5m:+1h or 20260101:20260201; certificates are valid forever
+without it. Use --host to sign host keys, whose principals are host names.
+
+--option takes ssh-keygen -O certificate options and may be repeated: clear,
+force-command=<command>, source-address=<cidr,...>, verify-required,
+no-x11-forwarding, no-agent-forwarding, no-port-forwarding, no-pty,
+no-user-rc and the matching permit-* options.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return signCertificates(cmd.OutOrStdout(), bufio.NewReader(os.Stdin), args, certSignOptions)
+	},
+}
+
+// inspectCertificate prints the contents of the certificate at path
+func inspectCertificate(out io.Writer, path string) error {
+	path = utils.ExpandUser(path)
+	if !strings.HasSuffix(path, "-cert.pub") {
+		if _, err := os.Stat(sshkeys.CertificatePath(path)); err == nil {
+			path = sshkeys.CertificatePath(path)
+		}
+	}
+	cert, comment, err := sshkeys.ReadCertificate(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, path)
+	fmt.Fprintf(out, "  type:        %s %s certificate\n", cert.Type(), certificateKind(cert))
+	fmt.Fprintf(out, "  public key:  %s %s\n", cert.Key.Type(), ssh.FingerprintSHA256(cert.Key))
+	fmt.Fprintf(out, "  signing CA:  %s %s\n", cert.SignatureKey.Type(), ssh.FingerprintSHA256(cert.SignatureKey))
+	if comment != "" {
+		fmt.Fprintf(out, "  comment:     %s\n", comment)
+	}
+	fmt.Fprintf(out, "  key ID:      %q\n", cert.KeyId)
+	fmt.Fprintf(out, "  serial:      %d\n", cert.Serial)
+	fmt.Fprintf(out, "  valid:       %s (%s)\n", sshkeys.CertificateValidity(cert), sshkeys.CertificateStatus(cert, nowFunc()))
+
+	principals := "(any)"
+	if len(cert.ValidPrincipals) > 0 {
+		principals = strings.Join(cert.ValidPrincipals, ", ")
+	}
+	fmt.Fprintf(out, "  principals:  %s\n", principals)
+	printCertificateMap(out, "critical:", cert.CriticalOptions)
+	printCertificateMap(out, "extensions:", cert.Extensions)
+	return nil
+}
+
+// certificateKind returns "user" or "host"
+func certificateKind(cert *ssh.Certificate) string {
+	if cert.CertType == ssh.HostCert {
+		return "host"
+	}
+	return "user"
+}
+
+// printCertificateMap prints certificate options or extensions one per line
+func printCertificateMap(out io.Writer, label string, m map[string]string) {
+	names := sshkeys.SortedKeys(m)
+	if len(names) == 0 {
+		fmt.Fprintf(out, "  %-12s (none)\n", label)
+		return
+	}
+	for i, name := range names {
+		if i > 0 {
+			label = ""
+		}
+		if m[name] != "" {
+			name += " " + m[name]
+		}
+		fmt.Fprintf(out, "  %-12s %s\n", label, name)
+	}
+}
+
+// signCertificates signs each public key with the CA and writes its certificate
+func signCertificates(out io.Writer, reader *bufio.Reader, paths []string, opts CertSignOptions) error {
+	if opts.CA == "" {
+		return fmt.Errorf("--ca is required")
+	}
+	after, before, err := sshkeys.ParseValidity(opts.Validity, nowFunc())
+	if err != nil {
+		return err
+	}
+	signOpts := sshkeys.SignOptions{
+		Principals:  opts.Principals,
+		Host:        opts.Host,
+		Serial:      opts.Serial,
+		ValidAfter:  after,
+		ValidBefore: before,
+	}
+	for _, option := range opts.Options {
+		if err := signOpts.SetOption(option); err != nil {
+			return err
+		}
+	}
+
+	caKey, err := sshkeys.ReadPrivateKey(opts.CA, func(path string) ([]byte, error) {
+		return promptPassphrase(reader, fmt.Sprintf("Enter passphrase for CA key %s: ", path))
+	})
+	if err != nil {
+		return err
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		return fmt.Errorf("failed to use CA key: %w", err)
+	}
+
+	for _, path := range paths {
+		path = utils.ExpandUser(path)
+		pub, comment, err := sshkeys.LoadPublicKey(path)
+		if err != nil {
+			return err
+		}
+		certPath := sshkeys.CertificatePath(path)
+		if _, err := os.Stat(certPath); err == nil && !opts.Force {
+			return fmt.Errorf("%s already exists; use --force to replace it", certPath)
+		}
+
+		signOpts.KeyID = opts.KeyID
+		if signOpts.KeyID == "" {
+			signOpts.KeyID = comment
+		}
+		if signOpts.KeyID == "" {
+			signOpts.KeyID = strings.TrimSuffix(filepath.Base(path), ".pub")
+		}
+		cert, err := sshkeys.SignCertificate(ca, pub, signOpts)
+		if err != nil {
+			return err
+		}
+		if err := sshkeys.WriteCertificate(certPath, cert, comment); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Signed %s certificate %s with key ID %q, valid %s\n",
+			certificateKind(cert), certPath, cert.KeyId, sshkeys.CertificateValidity(cert))
+	}
+	return nil
+}
+
+func init() {
+	CertCmd.AddCommand(certInspectCmd, certSignCmd)
+
+	certSignCmd.Flags().StringVar(&certSignOptions.CA, "ca", "", "CA private key to sign with")
+	certSignCmd.Flags().StringVarP(&certSignOptions.KeyID, "identity", "I", "", "Key ID recorded in the certificate (default the key comment)")
+	certSignCmd.Flags().StringSliceVarP(&certSignOptions.Principals, "principals", "n", nil, "Comma separated user or host names the certificate is valid for")
+	certSignCmd.Flags().StringVarP(&certSignOptions.Validity, "validity", "V", "", "Validity interval, such as 8h or -5m:+1h (default forever)")
+	certSignCmd.Flags().BoolVar(&certSignOptions.Host, "host", false, "Sign host keys instead of user keys")
+	certSignCmd.Flags().Uint64VarP(&certSignOptions.Serial, "serial", "z", 0, "Serial number of the certificate")
+	certSignCmd.Flags().StringArrayVarP(&certSignOptions.Options, "option", "O", nil, "Certificate option, such as force-command=... or no-pty")
+	certSignCmd.Flags().BoolVar(&certSignOptions.Force, "force", false, "Replace existing certificates")
+}
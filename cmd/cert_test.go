@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCertSignAndInspect(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldNow := nowFunc
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = oldNow }()
+
+	var prompts []string
+	oldPrompt := promptPassphrase
+	promptPassphrase = func(reader *bufio.Reader, prompt string) ([]byte, error) {
+		prompts = append(prompts, prompt)
+		return []byte("ca secret"), nil
+	}
+	defer func() { promptPassphrase = oldPrompt }()
+
+	caPair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Passphrase: []byte("ca secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath := filepath.Join(tmpDir, "ca")
+	if err := caPair.Write(caPath, false); err != nil {
+		t.Fatal(err)
+	}
+	user, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "alice@laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(tmpDir, ".ssh", "id_ed25519")
+	if err := user.Write(keyPath, false); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(strings.NewReader(""))
+	opts := CertSignOptions{
+		CA:         caPath,
+		Principals: []string{"alice", "deploy"},
+		Validity:   "8h",
+		Serial:     42,
+		Options:    []string{"no-pty", "force-command=/usr/bin/backup"},
+	}
+	var buf bytes.Buffer
+	if err := signCertificates(&buf, reader, []string{"~/.ssh/id_ed25519.pub"}, opts); err != nil {
+		t.Fatalf("signCertificates() error = %v", err)
+	}
+	certPath := keyPath + "-cert.pub"
+	if !strings.Contains(buf.String(), "Signed user certificate "+certPath+` with key ID "alice@laptop"`) {
+		t.Errorf("signCertificates() output = %q", buf.String())
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], caPath) {
+		t.Errorf("passphrase prompts = %q, want one for the CA key", prompts)
+	}
+
+	cert, _, err := sshkeys.ReadCertificate(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.SignatureKey.Marshal(), caPair.Public.Marshal()) || cert.ValidBefore != uint64(now.Add(8*time.Hour).Unix()) {
+		t.Errorf("certificate signed by %s valid before %d", ssh.FingerprintSHA256(cert.SignatureKey), cert.ValidBefore)
+	}
+
+	// Signing again requires --force
+	if err := signCertificates(&buf, reader, []string{keyPath}, opts); err == nil {
+		t.Error("signCertificates() expected error replacing a certificate without --force")
+	}
+	opts.Force = true
+	opts.KeyID = "alice-2026"
+	if err := signCertificates(&buf, reader, []string{keyPath}, opts); err != nil {
+		t.Errorf("signCertificates() with --force error = %v", err)
+	}
+
+	for _, bad := range []CertSignOptions{
+		{Principals: []string{"alice"}},
+		{CA: caPath, Validity: "soon"},
+		{CA: caPath, Options: []string{"no-such-option"}},
+		{CA: caPath, Host: true, Force: true},
+	} {
+		if err := signCertificates(&buf, reader, []string{keyPath}, bad); err == nil {
+			t.Errorf("signCertificates(%+v) expected error", bad)
+		}
+	}
+
+	// Inspecting the certificate, also through the key path
+	for _, path := range []string{certPath, keyPath} {
+		buf.Reset()
+		if err := inspectCertificate(&buf, path); err != nil {
+			t.Fatalf("inspectCertificate(%s) error = %v", path, err)
+		}
+		output := buf.String()
+		for _, want := range []string{
+			certPath + "\n",
+			"type:        ssh-ed25519-cert-v01@openssh.com user certificate",
+			"public key:  ssh-ed25519 " + ssh.FingerprintSHA256(user.Public),
+			"signing CA:  ssh-ed25519 " + ssh.FingerprintSHA256(caPair.Public),
+			`key ID:      "alice-2026"`,
+			"serial:      42",
+			"(valid)",
+			"principals:  alice, deploy",
+			"critical:    force-command /usr/bin/backup",
+			"extensions:  permit-X11-forwarding\n               permit-agent-forwarding",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("inspectCertificate() output = %q, want %q", output, want)
+			}
+		}
+		if strings.Contains(output, "permit-pty") {
+			t.Errorf("inspectCertificate() output = %q, want no permit-pty", output)
+		}
+	}
+
+	nowFunc = func() time.Time { return now.Add(9 * time.Hour) }
+	buf.Reset()
+	if err := inspectCertificate(&buf, certPath); err != nil || !strings.Contains(buf.String(), "(expired)") {
+		t.Errorf("inspectCertificate() after expiry = %q, %v", buf.String(), err)
+	}
+	if err := inspectCertificate(&buf, caPath+".pub"); err == nil {
+		t.Error("inspectCertificate() expected error for a plain public key")
+	}
+}
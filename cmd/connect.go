@@ -0,0 +1,343 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// pickerHeight is the number of hosts the picker lists at a time
+const pickerHeight = 10
+
+// frecencyBonus caps how much a host's frecency adds to its match score
+const frecencyBonus = 8
+
+// ConnectCmd represents the Cobra command for picking a host and connecting to it.
+var ConnectCmd = &cobra.Command{
+	Use:   "connect [query]",
+	Short: "Pick a host from your SSH config and connect to it",
+	Long: `List the host aliases of ~/.ssh/config and its includes, filter them as you
+type and run ssh with the one you pick. The options the highlighted host
+resolves to are shown below the list. Hosts you connect to often and
+recently are listed first; see 'ssh-config recent'.
+
+Keys:
+  Up/Down, Ctrl-P/Ctrl-N  move the selection
+  Enter                   connect
+  Ctrl-U                  clear the query
+  Esc, Ctrl-C             quit
+
+A query that matches a host alias exactly, or fuzzy-matches only one host,
+connects straight away.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := ""
+		if len(args) > 0 {
+			query = args[0]
+		}
+		return runConnect(cmd.OutOrStdout(), cmd.ErrOrStderr(), query)
+	},
+}
+
+// openPickerTerminal puts the terminal in raw mode for the picker and
+// returns its input and a function restoring the terminal. It is a function
+// variable for testability.
+var openPickerTerminal = func() (io.Reader, func(), error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, nil, fmt.Errorf("the host picker needs a terminal; give a query that matches one host")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up the terminal: %w", err)
+	}
+	return os.Stdin, func() { term.Restore(fd, state) }, nil
+}
+
+// runConnect picks the host matching query, interactively unless the query
+// names a single host, and runs ssh with it
+func runConnect(out, errOut io.Writer, query string) error {
+	cfg, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+	hosts := cfg.Hosts()
+	if len(hosts) == 0 {
+		return fmt.Errorf("no hosts in the SSH config")
+	}
+
+	// Without a readable history the hosts are simply not ranked by use
+	var scores map[string]float64
+	if h, err := readHistory(); err == nil {
+		scores = h.Scores(nowFunc())
+	}
+
+	host := ""
+	if query != "" {
+		matches := rankHosts(hosts, query, scores)
+		for _, alias := range hosts {
+			if alias == query {
+				host = alias
+			}
+		}
+		if host == "" && len(matches) == 1 {
+			host = matches[0]
+		}
+	}
+	if host == "" {
+		in, restore, err := openPickerTerminal()
+		if err != nil {
+			return err
+		}
+		host, err = pickHost(in, errOut, cfg, hosts, scores, query)
+		restore()
+		if err != nil {
+			return err
+		}
+		if host == "" {
+			return nil
+		}
+	}
+
+	if err := recordConnection(host); err != nil {
+		fmt.Fprintf(errOut, "Warning: failed to record the connection: %v\n", err)
+	}
+	command := execCommand("ssh", host)
+	command.Stdin = os.Stdin
+	command.Stdout = out
+	command.Stderr = errOut
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("ssh %s: %w", host, err)
+	}
+	return nil
+}
+
+// rankHosts returns the hosts that fuzzy-match query, best match first.
+// Hosts used often and recently, by their frecency in scores, rank higher,
+// though by no more than frecencyBonus so a much closer match still wins.
+// Hosts that rank the same keep their config order.
+func rankHosts(hosts []string, query string, scores map[string]float64) []string {
+	type match struct {
+		host     string
+		score    float64
+		frecency float64
+	}
+	var matches []match
+	for _, host := range hosts {
+		if score, ok := fuzzyScore(query, host); ok {
+			frecency := scores[host]
+			matches = append(matches, match{host, float64(score) + min(frecency, frecencyBonus), frecency})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].frecency > matches[j].frecency
+	})
+	ranked := make([]string, len(matches))
+	for i, m := range matches {
+		ranked[i] = m.host
+	}
+	return ranked
+}
+
+// fuzzyScore reports whether the letters of query appear in candidate in
+// order, ignoring case, and scores the best way they do: letters that follow
+// each other or start a word, such as the d of prod-db, score higher, and so
+// does a match near the start.
+func fuzzyScore(query, candidate string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	c := []rune(strings.ToLower(candidate))
+	if len(q) == 0 {
+		return 0, true
+	}
+
+	// prev[j] is the best score of the query so far with its last letter at
+	// c[j], or none if it cannot end there
+	const none = math.MinInt
+	prev := make([]int, len(c))
+	for i := range q {
+		cur := make([]int, len(c))
+		// best is the best score of prev ending at least two letters back
+		best := none
+		for j := range c {
+			if i > 0 && j >= 2 {
+				best = max(best, prev[j-2])
+			}
+			cur[j] = none
+			if c[j] != q[i] {
+				continue
+			}
+			bonus := 0
+			if j == 0 || !unicode.IsLetter(c[j-1]) && !unicode.IsDigit(c[j-1]) {
+				bonus = 3
+			}
+			if i == 0 {
+				cur[j] = 1 + bonus - min(j, 5)
+				continue
+			}
+			if best != none {
+				cur[j] = best + 1 + bonus
+			}
+			if j >= 1 && prev[j-1] != none {
+				cur[j] = max(cur[j], prev[j-1]+6)
+			}
+		}
+		prev = cur
+	}
+
+	score := none
+	for _, s := range prev {
+		score = max(score, s)
+	}
+	return score, score != none
+}
+
+// hostPicker is the state of the interactive host picker
+type hostPicker struct {
+	cfg      *sshconfig.Config
+	hosts    []string
+	scores   map[string]float64
+	query    []rune
+	matches  []string
+	selected int
+	// lines is the number of lines the last render drew
+	lines int
+}
+
+// pickHost runs the picker, reading keys from in and drawing on out, and
+// returns the chosen host, or an empty string if the picker was closed
+func pickHost(in io.Reader, out io.Writer, cfg *sshconfig.Config, hosts []string, scores map[string]float64, query string) (string, error) {
+	p := &hostPicker{cfg: cfg, hosts: hosts, scores: scores, query: []rune(query)}
+	p.filter()
+	defer p.clear(out)
+
+	reader := bufio.NewReader(in)
+	for {
+		p.render(out)
+		r, _, err := reader.ReadRune()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read key: %w", err)
+		}
+
+		switch r {
+		case '\r', '\n':
+			if len(p.matches) > 0 {
+				return p.matches[p.selected], nil
+			}
+		case 0x03, 0x07: // Ctrl-C, Ctrl-G
+			return "", nil
+		case 0x04: // Ctrl-D
+			if len(p.query) == 0 {
+				return "", nil
+			}
+		case 0x1b: // Esc, or the start of an arrow key
+			if reader.Buffered() == 0 {
+				return "", nil
+			}
+			seq := make([]byte, 2)
+			if _, err := io.ReadFull(reader, seq); err != nil {
+				return "", nil
+			}
+			if seq[0] == '[' || seq[0] == 'O' {
+				switch seq[1] {
+				case 'A':
+					p.move(-1)
+				case 'B':
+					p.move(1)
+				}
+			}
+		case 0x10: // Ctrl-P
+			p.move(-1)
+		case 0x0e: // Ctrl-N
+			p.move(1)
+		case 0x7f, 0x08: // Backspace
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.filter()
+			}
+		case 0x15: // Ctrl-U
+			p.query = nil
+			p.filter()
+		default:
+			if unicode.IsPrint(r) {
+				p.query = append(p.query, r)
+				p.filter()
+			}
+		}
+	}
+}
+
+// filter ranks the hosts against the query, or by frecency alone when the
+// query is empty, and selects the best match
+func (p *hostPicker) filter() {
+	p.matches = rankHosts(p.hosts, string(p.query), p.scores)
+	p.selected = 0
+}
+
+// move moves the selection by delta, wrapping around the matches
+func (p *hostPicker) move(delta int) {
+	if len(p.matches) == 0 {
+		return
+	}
+	p.selected = (p.selected + delta + len(p.matches)) % len(p.matches)
+}
+
+// render redraws the picker over the previous frame: the query, the
+// matching hosts around the selection and the options of the selected host
+func (p *hostPicker) render(out io.Writer) {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("  %d/%d", len(p.matches), len(p.hosts)))
+
+	first := 0
+	if p.selected >= pickerHeight {
+		first = p.selected - pickerHeight + 1
+	}
+	for i := first; i < len(p.matches) && i < first+pickerHeight; i++ {
+		if i == p.selected {
+			lines = append(lines, "\x1b[7m> "+p.matches[i]+"\x1b[0m")
+		} else {
+			lines = append(lines, "  "+p.matches[i])
+		}
+	}
+
+	if len(p.matches) > 0 {
+		resolved := p.cfg.Resolve(p.matches[p.selected])
+		lines = append(lines, "", "  Host "+resolved.Host)
+		for _, opt := range resolved.Options() {
+			lines = append(lines, "      "+opt.Keyword+" "+opt.Value())
+		}
+	}
+
+	p.clear(out)
+	// Raw mode does not turn \n into \r\n, so return the cursor explicitly
+	fmt.Fprintf(out, "%s\r\n", strings.Join(lines, "\r\n"))
+	fmt.Fprintf(out, "> %s", string(p.query))
+	p.lines = len(lines) + 1
+}
+
+// clear erases the lines drawn by the last render
+func (p *hostPicker) clear(out io.Writer) {
+	if p.lines == 0 {
+		return
+	}
+	if p.lines > 1 {
+		fmt.Fprintf(out, "\x1b[%dA", p.lines-1)
+	}
+	fmt.Fprint(out, "\r\x1b[J")
+	p.lines = 0
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/evberrypi/ssh-config/utils"
+)
+
+func TestRankHosts(t *testing.T) {
+	hosts := []string{"prod-web", "prod-db", "staging-db", "dev", "bastion"}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", hosts},
+		{"db", []string{"prod-db", "staging-db", "prod-web"}},
+		{"pdb", []string{"prod-db", "prod-web"}},
+		{"sdb", []string{"staging-db"}},
+		{"DEV", []string{"dev"}},
+		{"web", []string{"prod-web"}},
+		{"b", []string{"bastion", "prod-web", "prod-db", "staging-db"}},
+		{"xyz", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := rankHosts(hosts, tt.query, nil); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankHosts(%q) = %q; want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	// Hosts used often rank first, but not above a much closer match
+	scores := map[string]float64{"staging-db": 40, "dev": 2, "bastion": 10}
+	frecencyTests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"staging-db", "bastion", "dev", "prod-web", "prod-db"}},
+		{"db", []string{"staging-db", "prod-db", "prod-web"}},
+		{"pdb", []string{"prod-db", "prod-web"}},
+	}
+	for _, tt := range frecencyTests {
+		if got := rankHosts(hosts, tt.query, scores); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rankHosts(%q) with history = %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPickHost(t *testing.T) {
+	cfg, err := sshconfig.Parse(strings.NewReader("Host web\n    HostName web.example.com\n    User deploy\n\nHost db\n    HostName db.example.com\n\nHost *\n    Port 2222\n"), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := cfg.Hosts()
+
+	tests := []struct {
+		name  string
+		query string
+		keys  string
+		want  string
+	}{
+		{"Enter picks the first host", "", "\r", "web"},
+		{"Typing filters", "", "db\r", "db"},
+		{"Query given", "d", "\r", "db"},
+		{"Down arrow", "", "\x1b[B\r", "db"},
+		{"Up arrow wraps", "", "\x1b[A\r", "db"},
+		{"Ctrl-N and Ctrl-P", "", "\x0e\x0e\x10\r", "db"},
+		{"Backspace", "", "dbx\x7f\x7f\x7f\r", "web"},
+		{"Ctrl-U", "db", "\x15\r", "web"},
+		{"No match ignores Enter", "", "zz\r\x15\r", "web"},
+		{"Esc quits", "", "\x1b", ""},
+		{"Ctrl-C quits", "", "\x03", ""},
+		{"End of input quits", "", "w", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := pickHost(strings.NewReader(tt.keys), &out, cfg, hosts, nil, tt.query)
+			if err != nil {
+				t.Fatalf("pickHost() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("pickHost() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The preview shows the options the selected host resolves to
+	var out bytes.Buffer
+	if _, err := pickHost(strings.NewReader("\x1b[B\r"), &out, cfg, hosts, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"2/2", "> db", "HostName db.example.com", "Port 2222", "HostName web.example.com", "User deploy"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("picker output lacks %q:\n%q", want, out.String())
+		}
+	}
+}
+
+func TestRunConnect(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := "Host prod-web\n    HostName 10.0.0.1\n\nHost prod-db\n    HostName 10.0.0.2\n\nHost staging-db\n    HostName 10.0.1.2\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "config"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.Config = filepath.Join(tmpDir, "config")
+	utils.SSHPaths.History = filepath.Join(tmpDir, "history")
+	defer func() { utils.SSHPaths = oldPaths }()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	oldNow := nowFunc
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = oldNow }()
+
+	// Record the command instead of running ssh
+	var ran []string
+	oldExec := execCommand
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		ran = append([]string{command}, args...)
+		return exec.Command("true")
+	}
+	defer func() { execCommand = oldExec }()
+
+	keys := ""
+	opened := false
+	oldOpen := openPickerTerminal
+	openPickerTerminal = func() (io.Reader, func(), error) {
+		opened = true
+		return strings.NewReader(keys), func() {}, nil
+	}
+	defer func() { openPickerTerminal = oldOpen }()
+
+	tests := []struct {
+		name       string
+		query      string
+		keys       string
+		want       []string
+		wantPicker bool
+	}{
+		{"Exact alias", "prod-db", "", []string{"ssh", "prod-db"}, false},
+		{"Single fuzzy match", "pweb", "", []string{"ssh", "prod-web"}, false},
+		{"Several matches open the picker", "db", "\x1b[B\r", []string{"ssh", "staging-db"}, true},
+		{"No query opens the picker", "", "\r", []string{"ssh", "prod-web"}, true},
+		{"Quitting the picker runs nothing", "", "\x1b", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran, opened, keys = nil, false, tt.keys
+			if err := runConnect(io.Discard, io.Discard, tt.query); err != nil {
+				t.Fatalf("runConnect() error = %v", err)
+			}
+			if !reflect.DeepEqual(ran, tt.want) {
+				t.Errorf("ran %q; want %q", ran, tt.want)
+			}
+			if opened != tt.wantPicker {
+				t.Errorf("picker opened = %v; want %v", opened, tt.wantPicker)
+			}
+		})
+	}
+
+	// Every connection is recorded, and the picker lists the hosts used most first
+	h, err := readHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Get("prod-web"); got == nil || got.Count != 2 || !got.Last.Equal(now) {
+		t.Errorf("history of prod-web = %+v; want 2 connections", got)
+	}
+	if got := h.Get("staging-db"); got == nil || got.Count != 1 {
+		t.Errorf("history of staging-db = %+v; want 1 connection", got)
+	}
+	ran, keys = nil, "\r"
+	if err := runConnect(io.Discard, io.Discard, ""); err != nil {
+		t.Fatalf("runConnect() error = %v", err)
+	}
+	if want := []string{"ssh", "prod-web"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %q; want the most used host %q", ran, want)
+	}
+	if err := runConnect(io.Discard, io.Discard, "staging-db"); err != nil {
+		t.Fatalf("runConnect() error = %v", err)
+	}
+	ran, keys = nil, "db\r"
+	if err := runConnect(io.Discard, io.Discard, ""); err != nil {
+		t.Fatalf("runConnect() error = %v", err)
+	}
+	if want := []string{"ssh", "staging-db"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %q; want the db host used most %q", ran, want)
+	}
+
+	// A failing ssh is reported
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		return exec.Command("false")
+	}
+	if err := runConnect(io.Discard, io.Discard, "prod-db"); err == nil || !strings.Contains(err.Error(), "ssh prod-db") {
+		t.Errorf("runConnect() error = %v; want the ssh failure", err)
+	}
+
+	// Without a terminal the picker cannot open
+	openPickerTerminal = func() (io.Reader, func(), error) {
+		return nil, nil, fmt.Errorf("the host picker needs a terminal")
+	}
+	if err := runConnect(io.Discard, io.Discard, "db"); err == nil {
+		t.Error("runConnect() expected error without a terminal")
+	}
+}
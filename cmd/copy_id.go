@@ -0,0 +1,272 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/remote"
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// CopyIDOptions represents the options for installing keys on a remote host
+type CopyIDOptions struct {
+	Identities []string
+	DryRun     bool
+	Timeout    time.Duration
+}
+
+var copyIDOptions = CopyIDOptions{Timeout: 30 * time.Second}
+
+// CopyIDCmd represents the Cobra command for installing public keys on a remote host.
+var CopyIDCmd = &cobra.Command{
+	Use:   "copy-id <host>",
+	Short: "Install public keys in the authorized_keys of a remote host",
+	Long: `Install public keys in ~/.ssh/authorized_keys on a remote host, like
+ssh-copy-id. The host is resolved through the SSH config, so its HostName,
+Port and User apply, and its host key must already be in known_hosts (see
+hosts scan).
+
+By default the host's IdentityFile is installed; name other keys with -i.
+Keys already in the remote file are skipped, and the file and ~/.ssh are
+given the permissions sshd requires.
+
+copy-id logs in with keys from the SSH agent, then the host's unencrypted
+identity files, then a password you are asked for.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return copyIDs(cmd.OutOrStdout(), bufio.NewReader(os.Stdin), args[0], copyIDOptions)
+	},
+}
+
+// publicKeyFile is a public key to install and the file it came from
+type publicKeyFile struct {
+	path    string
+	key     ssh.PublicKey
+	comment string
+}
+
+// AuthorizedKey returns the key as an authorized_keys line with its comment
+func (k publicKeyFile) AuthorizedKey() string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.key)))
+	if k.comment != "" {
+		line += " " + k.comment
+	}
+	return line
+}
+
+// copyIDs installs the keys chosen by opts on host
+func copyIDs(out io.Writer, reader *bufio.Reader, host string, opts CopyIDOptions) error {
+	cfg, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+	resolved := cfg.Resolve(host)
+
+	paths := opts.Identities
+	if len(paths) == 0 {
+		path, err := currentIdentity(resolved, "")
+		if err != nil {
+			return fmt.Errorf("%w, or name the keys to install with -i", err)
+		}
+		paths = []string{path}
+	}
+	revoked, err := loadRevokedKeys("")
+	if err != nil {
+		return err
+	}
+	var keys []publicKeyFile
+	for _, path := range paths {
+		key, comment, err := sshkeys.LoadPublicKey(path)
+		if err != nil {
+			return err
+		}
+		if revoked != nil && revoked.IsRevoked(key) {
+			return fmt.Errorf("%s (%s) is revoked in the key revocation list", path, ssh.FingerprintSHA256(key))
+		}
+		keys = append(keys, publicKeyFile{path: path, key: key, comment: comment})
+	}
+
+	client, err := dialHost(reader, cfg, resolved, opts.Timeout, false)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	current, err := client.ReadAuthorizedKeys()
+	if err != nil {
+		return err
+	}
+	file := authkeys.Parse(current)
+	var installed []publicKeyFile
+	for _, k := range keys {
+		if hasAuthorizedKey(file, k.key) {
+			fmt.Fprintf(out, "Already installed: %s %s (%s)\n", k.key.Type(), ssh.FingerprintSHA256(k.key), k.path)
+			continue
+		}
+		file.Append(k.AuthorizedKey())
+		installed = append(installed, k)
+	}
+
+	if len(installed) == 0 {
+		fmt.Fprintf(out, "All %d key(s) are already installed on %s.\n", len(keys), host)
+		return nil
+	}
+	verb := "Installed"
+	if opts.DryRun {
+		verb = "Would install"
+	} else if err := client.WriteAuthorizedKeys(file.Bytes()); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s %d key(s) on %s:\n", verb, len(installed), host)
+	for _, k := range installed {
+		fmt.Fprintf(out, "  %s %s (%s)\n", k.key.Type(), ssh.FingerprintSHA256(k.key), k.path)
+	}
+	if !opts.DryRun {
+		fmt.Fprintf(out, "Try logging in with: ssh %s\n", host)
+	}
+	return nil
+}
+
+// hasAuthorizedKey reports whether file lists key, whatever its options
+func hasAuthorizedKey(file *authkeys.File, key ssh.PublicKey) bool {
+	for _, line := range file.Entries() {
+		if listed, err := line.Entry.PublicKey(); err == nil && bytes.Equal(listed.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialHost logs in to the host resolved from the SSH config, through its
+// ProxyJump hosts if any, verifying its host key against known_hosts and
+// authenticating as hostAuthMethods describes
+func dialHost(reader *bufio.Reader, cfg *sshconfig.Config, resolved *sshconfig.Resolved, timeout time.Duration, batch bool) (*remote.Client, error) {
+	t := newHostTarget(resolved, resolved.Port())
+	callback, algorithms, err := hostKeyVerifier(t)
+	if err != nil {
+		return nil, err
+	}
+	auth, closeAuth := hostAuthMethods(reader, resolved, batch)
+	defer closeAuth()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return dialTarget(ctx, cfg, resolvedProxyJump(resolved), remote.Target{
+		Addr:              t.Addr,
+		User:              resolved.User(),
+		Auth:              auth,
+		HostKeyCallback:   callback,
+		HostKeyAlgorithms: algorithms,
+	})
+}
+
+// dialTarget logs in to t through the comma separated jump hosts of
+// proxyJump, or directly when there are none. The jump host connections
+// are closed with the returned client.
+func dialTarget(ctx context.Context, cfg *sshconfig.Config, proxyJump string, t remote.Target) (*remote.Client, error) {
+	conn, closeJumps, err := dialProxyJump(ctx, cfg, proxyJump, t.Addr)
+	if err != nil {
+		closeJumps()
+		return nil, err
+	}
+	client, err := dialRemote(ctx, conn, t)
+	if err != nil {
+		closeJumps()
+		return nil, err
+	}
+	client.OnClose(closeJumps)
+	return client, nil
+}
+
+// hostAuthMethods returns the ways to log in to a host in the order ssh
+// tries them: keys in the agent, the host's identity files, then a password.
+// No password is asked for when PasswordAuthentication is off or in batch
+// mode, which BatchMode yes also selects. Without an IdentityFile the default
+// identities are tried, as ssh does. Encrypted identity files are skipped;
+// load them into the agent to use them. The returned function releases the
+// agent connection once logged in.
+func hostAuthMethods(reader *bufio.Reader, resolved *sshconfig.Resolved, batch bool) ([]ssh.AuthMethod, func()) {
+	paths := resolved.IdentityFiles()
+	if len(paths) == 0 {
+		sshDir := utils.ExpandUser("~/.ssh")
+		for _, name := range sshkeys.DefaultIdentityNames {
+			paths = append(paths, filepath.Join(sshDir, name))
+		}
+	}
+	var fileSigners []ssh.Signer
+	for _, path := range paths {
+		key, err := sshkeys.ReadPrivateKey(path, nil)
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.NewSignerFromKey(key); err == nil {
+			fileSigners = append(fileSigners, signer)
+		}
+	}
+
+	var agentClient agent.ExtendedAgent
+	closeAuth := func() {}
+	if sock := getenvFunc("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentClient = agent.NewClient(conn)
+			closeAuth = func() { conn.Close() }
+		}
+	}
+
+	// The client tries each method name once, so agent and file keys are
+	// offered through a single public key method
+	methods := []ssh.AuthMethod{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+		if agentClient != nil {
+			if agentSigners, err := agentClient.Signers(); err == nil {
+				signers = agentSigners
+			}
+		}
+		return append(signers, fileSigners...), nil
+	})}
+
+	batch = batch || strings.EqualFold(resolved.Get("BatchMode"), "yes")
+	if !batch && !strings.EqualFold(resolved.Get("PasswordAuthentication"), "no") {
+		prompt := fmt.Sprintf("%s@%s's password: ", resolved.User(), resolved.HostName())
+		askPassword := func() (string, error) {
+			password, err := promptPassphrase(reader, prompt)
+			return string(password), err
+		}
+		methods = append(methods,
+			ssh.PasswordCallback(askPassword),
+			ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i, question := range questions {
+					answer, err := promptPassphrase(reader, question)
+					if err != nil {
+						return nil, err
+					}
+					answers[i] = string(answer)
+				}
+				return answers, nil
+			}),
+		)
+	}
+	return methods, closeAuth
+}
+
+func init() {
+	CopyIDCmd.Flags().StringArrayVarP(&copyIDOptions.Identities, "identity", "i", nil, "Public key to install; may be repeated (default the host's IdentityFile)")
+	CopyIDCmd.Flags().BoolVarP(&copyIDOptions.DryRun, "dry-run", "n", false, "Show which keys would be installed without changing anything")
+	CopyIDCmd.Flags().DurationVar(&copyIDOptions.Timeout, "timeout", copyIDOptions.Timeout, "Time allowed for connecting and the key exchange")
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/krl"
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestCopyIDs(t *testing.T) {
+	f := newRemoteFixture(t)
+	sshDir := f.sshDir
+	remoteHome := filepath.Join(f.dir, "remote")
+	remoteKeys := filepath.Join(remoteHome, ".ssh", "authorized_keys")
+	if err := os.MkdirAll(remoteHome, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	server := f.startServer(t, remotetest.Options{Home: remoteHome, Password: "secret"})
+
+	keys := make(map[string]*sshkeys.KeyPair)
+	for _, name := range []string{"id_ed25519", "extra", "revoked"} {
+		pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pair.Write(filepath.Join(sshDir, name), false); err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = pair
+	}
+
+	f.writeConfig(t, fmt.Sprintf("Host web\n    HostName %s\n    Port %d\n    User deploy\n\nHost nopass\n    HostName %s\n    Port %d\n    PasswordAuthentication no\n",
+		server.Host(), server.Port(), server.Host(), server.Port()))
+
+	list := &krl.KRL{}
+	list.RevokeKey(keys["revoked"].Public)
+	if err := list.Write(utils.SSHPaths.RevokedKeys); err != nil {
+		t.Fatal(err)
+	}
+
+	// Count password prompts, answering with the server's password
+	prompts := 0
+	oldPrompt := promptPassphrase
+	promptPassphrase = func(reader *bufio.Reader, prompt string) ([]byte, error) {
+		prompts++
+		return []byte("secret"), nil
+	}
+	defer func() { promptPassphrase = oldPrompt }()
+
+	opts := CopyIDOptions{Timeout: 10 * time.Second}
+	var out bytes.Buffer
+
+	// A host nothing is installed on yet needs the password
+	if err := copyIDs(&out, nil, "web", opts); err != nil {
+		t.Fatalf("copyIDs() error = %v", err)
+	}
+	if prompts != 1 {
+		t.Errorf("asked for the password %d times; want 1", prompts)
+	}
+	if !strings.Contains(out.String(), "Installed 1 key(s) on web") {
+		t.Errorf("output = %q; want the default identity installed", out.String())
+	}
+	content, err := os.ReadFile(remoteKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(keys["id_ed25519"].AuthorizedKey()) {
+		t.Errorf("remote authorized_keys = %q; want the default identity", content)
+	}
+	for path, want := range map[string]os.FileMode{filepath.Dir(remoteKeys): 0700, remoteKeys: 0600} {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != want {
+			t.Errorf("%s has mode %v (%v); want %o", path, info.Mode().Perm(), err, want)
+		}
+	}
+
+	// Once installed, the key logs in and is not added twice
+	prompts = 0
+	out.Reset()
+	opts.Identities = []string{"~/.ssh/id_ed25519.pub", "~/.ssh/extra"}
+	if err := copyIDs(&out, nil, "web", opts); err != nil {
+		t.Fatalf("copyIDs() error = %v", err)
+	}
+	if prompts != 0 {
+		t.Errorf("asked for the password %d times; want the installed key used", prompts)
+	}
+	if !strings.Contains(out.String(), "Already installed") || !strings.Contains(out.String(), "Installed 1 key(s)") {
+		t.Errorf("output = %q; want one key skipped and one installed", out.String())
+	}
+	installed, err := sshkeys.ReadPublicKeys(remoteKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 2 {
+		t.Errorf("remote authorized_keys has %d keys; want 2", len(installed))
+	}
+
+	out.Reset()
+	if err := copyIDs(&out, nil, "web", opts); err != nil {
+		t.Fatalf("copyIDs() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "All 2 key(s) are already installed") {
+		t.Errorf("output = %q; want nothing to install", out.String())
+	}
+
+	// A dry run reports the new key without installing it
+	other, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Write(filepath.Join(sshDir, "other"), false); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(remoteKeys)
+	out.Reset()
+	if err := copyIDs(&out, nil, "web", CopyIDOptions{Identities: []string{"~/.ssh/other.pub"}, DryRun: true, Timeout: 10 * time.Second}); err != nil {
+		t.Fatalf("copyIDs() dry run error = %v", err)
+	}
+	if after, _ := os.ReadFile(remoteKeys); string(after) != string(before) {
+		t.Error("dry run changed the remote authorized_keys")
+	}
+	if !strings.Contains(out.String(), "Would install 1 key(s)") {
+		t.Errorf("output = %q; want the key reported", out.String())
+	}
+
+	// A key in the agent logs in too
+	os.Remove(filepath.Join(sshDir, "id_ed25519"))
+	keyring := agent.NewKeyring()
+	extra, err := sshkeys.ReadPrivateKey(filepath.Join(sshDir, "extra"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: extra}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(f.dir, "agent.sock")
+	listener := serveAgent(t, keyring, sock)
+	defer listener.Close()
+	getenvFunc = func(key string) string {
+		if key == "SSH_AUTH_SOCK" {
+			return sock
+		}
+		return ""
+	}
+	prompts = 0
+	if err := copyIDs(&bytes.Buffer{}, nil, "web", CopyIDOptions{Identities: []string{"~/.ssh/other.pub"}, Timeout: 10 * time.Second}); err != nil {
+		t.Fatalf("copyIDs() with agent error = %v", err)
+	}
+	if prompts != 0 {
+		t.Errorf("asked for the password %d times; want the agent key used", prompts)
+	}
+
+	// Revoked keys are refused before connecting
+	if err := copyIDs(&bytes.Buffer{}, nil, "web", CopyIDOptions{Identities: []string{"~/.ssh/revoked.pub"}, Timeout: 10 * time.Second}); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("copyIDs() error = %v; want revoked key refusal", err)
+	}
+
+	// PasswordAuthentication no skips the prompt
+	getenvFunc = func(key string) string { return "" }
+	prompts = 0
+	os.Remove(remoteKeys)
+	if err := copyIDs(&bytes.Buffer{}, nil, "nopass", CopyIDOptions{Identities: []string{"~/.ssh/other.pub"}, Timeout: 10 * time.Second}); err == nil {
+		t.Error("copyIDs() expected error without a usable key or password")
+	}
+	if prompts != 0 {
+		t.Errorf("asked for the password %d times with PasswordAuthentication no", prompts)
+	}
+}
+
+func TestCopyIDsProxyJump(t *testing.T) {
+	f := newRemoteFixture(t)
+	login, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := login.Write(filepath.Join(f.sshDir, "id_ed25519"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bastion accepts the login key and forwards to the inner host,
+	// which only takes a password
+	bastionHome := filepath.Join(f.dir, "bastion")
+	innerHome := filepath.Join(f.dir, "inner")
+	innerKeys := filepath.Join(innerHome, ".ssh", "authorized_keys")
+	if err := os.MkdirAll(filepath.Join(bastionHome, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(innerHome, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bastionHome, ".ssh", "authorized_keys"), login.AuthorizedKey(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bastion := f.startServer(t, remotetest.Options{Home: bastionHome, Forward: true})
+	inner := f.startServer(t, remotetest.Options{Home: innerHome, Password: "secret"})
+	f.writeConfig(t, fmt.Sprintf("Host bastion\n    HostName %s\n    Port %d\n    User deploy\n\nHost inner\n    HostName %s\n    Port %d\n    User deploy\n    ProxyJump bastion\n\nHost direct\n    HostName %s\n    Port %d\n    User deploy\n",
+		bastion.Host(), bastion.Port(), inner.Host(), inner.Port(), inner.Host(), inner.Port()))
+
+	delay := time.Duration(0)
+	oldPrompt := promptPassphrase
+	promptPassphrase = func(reader *bufio.Reader, prompt string) ([]byte, error) {
+		time.Sleep(delay)
+		return []byte("secret"), nil
+	}
+	defer func() { promptPassphrase = oldPrompt }()
+
+	if err := copyIDs(&bytes.Buffer{}, nil, "inner", CopyIDOptions{Timeout: 10 * time.Second}); err != nil {
+		t.Fatalf("copyIDs() through the bastion error = %v", err)
+	}
+	if bastion.Forwarded() != 1 {
+		t.Errorf("bastion forwarded %d connections; want 1", bastion.Forwarded())
+	}
+	content, err := os.ReadFile(innerKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(login.AuthorizedKey()) {
+		t.Errorf("inner authorized_keys = %q; want the default identity", content)
+	}
+
+	// Typing the password may take longer than --timeout, which only
+	// bounds connecting and the key exchange
+	os.Remove(innerKeys)
+	delay = 1500 * time.Millisecond
+	if err := copyIDs(&bytes.Buffer{}, nil, "direct", CopyIDOptions{Timeout: time.Second}); err != nil {
+		t.Fatalf("copyIDs() with a slow password error = %v", err)
+	}
+}
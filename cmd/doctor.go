@@ -0,0 +1,295 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+)
+
+// lookPath is a function variable for testability
+var lookPath = exec.LookPath
+
+var doctorFix bool
+
+// utf8BOM is the byte order mark some Windows editors put at the start of files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// DoctorCmd represents the Cobra command for checking the SSH environment.
+var DoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check SSH file permissions and environment",
+	Long: `Check the problems that commonly make ssh or sshd refuse to work:
+- Ownership and modes of your home directory, ~/.ssh, config, keys,
+  authorized_keys and known_hosts (sshd StrictModes)
+- CRLF line endings and byte order marks in config files
+- Whether $EDITOR can be found for the edit command
+- Whether SSH_AUTH_SOCK points to a running agent
+
+Use --fix to repair modes, ownership (as root) and line endings.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDoctor(cmd.OutOrStdout(), doctorFix)
+	},
+}
+
+// doctorCheck is the result of a single doctor check
+type doctorCheck struct {
+	Message string
+	// Problem marks a failed check; Warning marks one that does not stop ssh working
+	Problem bool
+	Warning bool
+	// Fix repairs the problem, nil when it cannot be repaired automatically
+	Fix func() error
+}
+
+// runDoctor runs every check, repairs problems when fix is set and returns
+// an error if problems remain
+func runDoctor(out io.Writer, fix bool) error {
+	home := utils.ExpandUser("~")
+	sshDir := utils.ExpandUser("~/.ssh")
+
+	owner := homeOwner(home)
+	var checks []doctorCheck
+	checks = append(checks, checkPermissions(home, "home directory", 0022, owner)...)
+	if _, err := os.Stat(sshDir); os.IsNotExist(err) {
+		checks = append(checks, doctorCheck{
+			Message: sshDir + " does not exist",
+			Problem: true,
+			Fix:     utils.EnsureSSHDirectory,
+		})
+	} else {
+		checks = append(checks, checkPermissions(sshDir, "", 0077, owner)...)
+	}
+
+	configFiles := []string{utils.ExpandUser(utils.SSHPaths.Config)}
+	if cfg, err := sshconfig.Load(utils.SSHPaths.Config); err == nil {
+		configFiles = configFileNames(cfg)
+	}
+	for _, path := range configFiles {
+		checks = append(checks, checkPermissions(path, "", 0022, owner)...)
+	}
+	for _, path := range []string{utils.SSHPaths.AuthorizedKeys, utils.SSHPaths.KnownHosts} {
+		checks = append(checks, checkPermissions(utils.ExpandUser(path), "", 0022, owner)...)
+	}
+
+	if keys, err := sshkeys.Scan(sshDir); err == nil {
+		for _, key := range keys {
+			if key.PrivatePath != "" {
+				checks = append(checks, checkPermissions(key.PrivatePath, "private key "+key.PrivatePath, 0077, owner)...)
+			}
+			if key.PublicPath != "" {
+				checks = append(checks, checkPermissions(key.PublicPath, "", 0022, owner)...)
+			}
+		}
+	}
+
+	for _, path := range append(configFiles, utils.ExpandUser(utils.SSHPaths.AuthorizedKeys), utils.ExpandUser(utils.SSHPaths.KnownHosts)) {
+		if check, ok := checkLineEndings(path); ok {
+			checks = append(checks, check)
+		}
+	}
+	checks = append(checks, checkEditor(), checkAgent())
+
+	problems := 0
+	for _, check := range checks {
+		status := "ok"
+		switch {
+		case !check.Problem:
+		case fix && check.Fix != nil:
+			if err := check.Fix(); err != nil {
+				status = "fail"
+				check.Message += fmt.Sprintf(" (fix failed: %v)", err)
+				problems++
+			} else {
+				status = "fixed"
+			}
+		case check.Warning:
+			status = "warn"
+		default:
+			status = "fail"
+			if check.Fix != nil {
+				check.Message += " (fixable with --fix)"
+			}
+			problems++
+		}
+		fmt.Fprintf(out, "%-6s %s\n", status, check.Message)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", problems)
+	}
+	return nil
+}
+
+// fileOwner is the account the checked files should belong to
+type fileOwner struct {
+	uid int
+	gid int
+}
+
+// homeOwner returns the owner of home, whose files are checked even when
+// doctor runs as root through sudo with HOME kept, or the current user if
+// home cannot be examined
+func homeOwner(home string) fileOwner {
+	if info, err := os.Stat(home); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			return fileOwner{uid: int(stat.Uid), gid: int(stat.Gid)}
+		}
+	}
+	return fileOwner{uid: os.Getuid(), gid: os.Getgid()}
+}
+
+// checkPermissions checks that path is owned by owner (or root) and has none
+// of the forbidden mode bits. Symbolic links are followed, as ssh does, and
+// missing paths are skipped.
+func checkPermissions(path, label string, forbidden os.FileMode, owner fileOwner) []doctorCheck {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if label == "" {
+		label = path
+	}
+
+	var checks []doctorCheck
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != owner.uid && stat.Uid != 0 {
+		checks = append(checks, doctorCheck{
+			Message: fmt.Sprintf("%s is owned by uid %d instead of the home directory's owner (uid %d)", label, stat.Uid, owner.uid),
+			Problem: true,
+			Fix:     func() error { return os.Chown(path, owner.uid, owner.gid) },
+		})
+	}
+
+	perm := info.Mode().Perm()
+	if perm&forbidden != 0 {
+		want := perm &^ forbidden
+		checks = append(checks, doctorCheck{
+			Message: fmt.Sprintf("%s has mode %04o; it should be %04o", label, perm, want),
+			Problem: true,
+			Fix:     func() error { return os.Chmod(path, want) },
+		})
+	} else if len(checks) == 0 {
+		checks = append(checks, doctorCheck{Message: fmt.Sprintf("%s has mode %04o", label, perm)})
+	}
+	return checks
+}
+
+// configFileNames returns the main config file and every file it includes
+func configFileNames(cfg *sshconfig.Config) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, block := range cfg.Blocks {
+		path := utils.ExpandUser(block.File)
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		files = append(files, path)
+	}
+	return files
+}
+
+// checkLineEndings reports CRLF line endings and byte order marks, which
+// ssh does not strip and which break option parsing. ok is false when the
+// file does not exist.
+func checkLineEndings(path string) (doctorCheck, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return doctorCheck{}, false
+	}
+
+	var issues []string
+	if bytes.HasPrefix(data, utf8BOM) {
+		issues = append(issues, "a byte order mark")
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		issues = append(issues, "CRLF line endings")
+	}
+	if len(issues) == 0 {
+		return doctorCheck{Message: path + " has Unix line endings"}, true
+	}
+
+	message := path + " has " + issues[0]
+	if len(issues) == 2 {
+		message += " and " + issues[1]
+	}
+	return doctorCheck{
+		Message: message,
+		Problem: true,
+		Fix: func() error {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			fixed := bytes.ReplaceAll(bytes.TrimPrefix(data, utf8BOM), []byte("\r\n"), []byte("\n"))
+			if err := utils.WriteFileAtomic(path, fixed, info.Mode().Perm()); err != nil {
+				return err
+			}
+			// The rewritten file belongs to whoever runs doctor; give it back
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+				return os.Chown(path, int(stat.Uid), int(stat.Gid))
+			}
+			return nil
+		},
+	}, true
+}
+
+// checkEditor checks that the editor used by the edit command can be found
+func checkEditor() doctorCheck {
+	editor := getenvFunc("EDITOR")
+	source := "$EDITOR"
+	if editor == "" {
+		editor = "vim"
+		source = "default editor"
+	}
+	path, err := lookPath(editor)
+	if err != nil {
+		return doctorCheck{
+			Message: fmt.Sprintf("%s %q was not found; set EDITOR to an installed editor for the edit command", source, editor),
+			Problem: true,
+			Warning: true,
+		}
+	}
+	return doctorCheck{Message: fmt.Sprintf("%s %q resolves to %s", source, editor, filepath.Clean(path))}
+}
+
+// checkAgent checks that SSH_AUTH_SOCK points to an agent accepting connections
+func checkAgent() doctorCheck {
+	sock := getenvFunc("SSH_AUTH_SOCK")
+	problem := func(message string) doctorCheck {
+		return doctorCheck{Message: message, Problem: true, Warning: true}
+	}
+	if sock == "" {
+		return problem("SSH_AUTH_SOCK is not set; no SSH agent is available")
+	}
+
+	info, err := os.Stat(sock)
+	if err != nil {
+		return problem(fmt.Sprintf("SSH_AUTH_SOCK points to %s, which does not exist; the agent is not running", sock))
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return problem(fmt.Sprintf("SSH_AUTH_SOCK points to %s, which is not a socket", sock))
+	}
+	conn, err := net.DialTimeout("unix", sock, 2*time.Second)
+	if err != nil {
+		return problem(fmt.Sprintf("the agent at %s is not accepting connections: %v", sock, err))
+	}
+	conn.Close()
+	return doctorCheck{Message: "SSH agent is reachable at " + sock}
+}
+
+func init() {
+	DoctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Repair modes, ownership and line endings")
+}
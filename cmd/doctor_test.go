@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+)
+
+func TestRunDoctor(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(sshDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	if err := pair.Write(keyPath, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	utils.SSHPaths.AuthorizedKeys = filepath.Join(sshDir, "authorized_keys")
+	utils.SSHPaths.KnownHosts = filepath.Join(sshDir, "known_hosts")
+	defer func() { utils.SSHPaths = oldPaths }()
+
+	configContent := "\xEF\xBB\xBFHost web\r\n    HostName web.example.com\r\n"
+	if err := os.WriteFile(utils.SSHPaths.Config, []byte(configContent), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(utils.SSHPaths.Config, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// An agent socket that accepts connections
+	sock := filepath.Join(tmpDir, "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	oldGetenv := getenvFunc
+	getenvFunc = func(key string) string {
+		switch key {
+		case "EDITOR":
+			return "missing-editor"
+		case "SSH_AUTH_SOCK":
+			return sock
+		}
+		return ""
+	}
+	defer func() { getenvFunc = oldGetenv }()
+
+	oldLookPath := lookPath
+	lookPath = func(file string) (string, error) {
+		return "", fmt.Errorf("%s: not found", file)
+	}
+	defer func() { lookPath = oldLookPath }()
+
+	var out bytes.Buffer
+	err = runDoctor(&out, false)
+	if err == nil || !strings.Contains(err.Error(), "4 problem(s)") {
+		t.Errorf("runDoctor() error = %v; want 4 problems", err)
+	}
+	for _, want := range []string{
+		"ok     home directory has mode 0755",
+		"fail   " + sshDir + " has mode 0755; it should be 0700 (fixable with --fix)",
+		"fail   " + utils.SSHPaths.Config + " has mode 0666; it should be 0644",
+		"fail   private key " + keyPath + " has mode 0644; it should be 0600",
+		"fail   " + utils.SSHPaths.Config + " has a byte order mark and CRLF line endings",
+		"warn   $EDITOR \"missing-editor\" was not found",
+		"ok     SSH agent is reachable at " + sock,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output = %q; want %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	if err := runDoctor(&out, true); err != nil {
+		t.Fatalf("runDoctor() with fix error = %v\n%s", err, out.String())
+	}
+	if strings.Count(out.String(), "fixed  ") != 4 {
+		t.Errorf("output = %q; want 4 fixed problems", out.String())
+	}
+
+	for path, want := range map[string]os.FileMode{sshDir: 0700, utils.SSHPaths.Config: 0644, keyPath: 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s mode = %04o; want %04o", path, info.Mode().Perm(), want)
+		}
+	}
+	content, err := os.ReadFile(utils.SSHPaths.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Host web\n    HostName web.example.com\n" {
+		t.Errorf("config = %q; want BOM and CRLF removed", content)
+	}
+
+	// Problems that are only warnings do not fail the command
+	out.Reset()
+	listener.Close()
+	if err := runDoctor(&out, false); err != nil {
+		t.Errorf("runDoctor() after fix error = %v", err)
+	}
+	if !strings.Contains(out.String(), "warn   the agent at "+sock) && !strings.Contains(out.String(), "warn   SSH_AUTH_SOCK points to "+sock) {
+		t.Errorf("output = %q; want agent warning", out.String())
+	}
+}
+
+func TestRunDoctorAsRootForHome(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing owners requires root")
+	}
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	os.Setenv("HOME", tmpDir)
+
+	// sudo with HOME kept: the files belong to the user, not root
+	const uid, gid, otherUID = 1000, 1000, 2000
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	utils.SSHPaths.AuthorizedKeys = filepath.Join(sshDir, "authorized_keys")
+	utils.SSHPaths.KnownHosts = filepath.Join(sshDir, "known_hosts")
+	defer func() { utils.SSHPaths = oldPaths }()
+	if err := os.WriteFile(utils.SSHPaths.Config, []byte("Host web\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	if err := pair.Write(keyPath, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{tmpDir, sshDir, utils.SSHPaths.Config, keyPath + ".pub"} {
+		if err := os.Chown(path, uid, gid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chown(keyPath, otherUID, otherUID); err != nil {
+		t.Fatal(err)
+	}
+
+	oldGetenv := getenvFunc
+	getenvFunc = func(key string) string { return "" }
+	defer func() { getenvFunc = oldGetenv }()
+
+	var out bytes.Buffer
+	runDoctor(&out, false)
+	if strings.Count(out.String(), "is owned by uid") != 1 || !strings.Contains(out.String(), keyPath+" is owned by uid 2000 instead of the home directory's owner (uid 1000)") {
+		t.Errorf("output = %q; want only the key flagged as not the user's", out.String())
+	}
+
+	out.Reset()
+	runDoctor(&out, true)
+	for _, path := range []string{keyPath, utils.SSHPaths.Config} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat := info.Sys().(*syscall.Stat_t); stat.Uid != uid || stat.Gid != gid {
+			t.Errorf("%s is owned by %d:%d after --fix; want %d:%d", path, stat.Uid, stat.Gid, uid, gid)
+		}
+	}
+}
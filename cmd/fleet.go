@@ -0,0 +1,298 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+)
+
+// FleetPushOptions represents the options for pushing keys to many hosts
+type FleetPushOptions struct {
+	Hosts       string
+	Keys        []string
+	Jobs        int
+	DryRun      bool
+	RevokedKeys string
+	Timeout     time.Duration
+}
+
+var fleetPushOptions = FleetPushOptions{Jobs: 8, Timeout: 30 * time.Second}
+
+// FleetCmd represents the Cobra command for managing many hosts at once.
+var FleetCmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "Manage access on many hosts at once",
+	Long: `Manage access on the hosts of your SSH config in bulk. Hosts are selected
+by matching their aliases against ssh patterns such as 'prod-*' or
+'web-*,!web-old'.
+
+This command can be used to:
+- Push the keys of GitHub and GitLab users to authorized_keys on every host`,
+}
+
+var fleetPushCmd = &cobra.Command{
+	Use:   "push --hosts <patterns> --keys <service:user>...",
+	Short: "Sync provider keys into authorized_keys on matching hosts",
+	Long: `Fetch the keys of provider users, such as github:alice, and write them to
+~/.ssh/authorized_keys on every matching host. Each user's keys go in a
+block marked with a comment, like add github does; pushing again replaces
+the block, so keys the user removed are removed from the hosts too. Other
+lines of the file are left alone.
+
+Hosts are updated concurrently, --jobs at a time, logging in with keys from
+the agent or the hosts' identity files; no password is asked for. Host keys
+must already be in known_hosts. --dry-run shows the changes without making
+them.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fleetPush(cmd.OutOrStdout(), cmd.ErrOrStderr(), fleetPushOptions)
+	},
+}
+
+// fleetResult is the outcome of pushing keys to one host
+type fleetResult struct {
+	Host    string
+	Changed bool
+	Added   int
+	Removed int
+	Diff    []string
+	Err     error
+}
+
+// fleetBlock is a provider block to write to every host
+type fleetBlock struct {
+	marker  authkeys.Marker
+	entries []*authkeys.Entry
+}
+
+// fleetPush syncs the keys of the users in opts.Keys to the matching hosts
+func fleetPush(out, errOut io.Writer, opts FleetPushOptions) error {
+	if opts.Hosts == "" {
+		return fmt.Errorf("--hosts is required")
+	}
+	if len(opts.Keys) == 0 {
+		return fmt.Errorf("--keys is required")
+	}
+	if opts.Jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+
+	cfg, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+	hosts := matchingHosts(cfg, opts.Hosts)
+	if len(hosts) == 0 {
+		return fmt.Errorf("no hosts in the SSH config match %s", opts.Hosts)
+	}
+
+	// Fetch every user's keys once, before touching any host
+	var blocks []fleetBlock
+	for _, source := range opts.Keys {
+		id, ok := parseProviderIdentity(source)
+		if !ok {
+			return fmt.Errorf("invalid key source %q: use service:username, such as github:alice", source)
+		}
+		keys, revoked, err := fetchProviderKeys(errOut, id.Service, id.Username, opts.RevokedKeys)
+		if err != nil {
+			return err
+		}
+		entries := importedKeyEntries(keys, nil)
+		if len(entries) == 0 {
+			if revoked > 0 {
+				return fmt.Errorf("every key of %s is revoked", id)
+			}
+			return fmt.Errorf("no keys found for %s", id)
+		}
+		blocks = append(blocks, fleetBlock{authkeys.Marker{Service: id.Service, Username: id.Username}, entries})
+	}
+
+	results := make([]fleetResult, len(hosts))
+	runJobs(len(hosts), opts.Jobs, func(i int) {
+		results[i] = pushToHost(cfg, cfg.Resolve(hosts[i]), blocks, opts)
+	})
+
+	return printFleetResults(out, results, opts.DryRun)
+}
+
+// matchingHosts returns the aliases in cfg that match the comma separated patterns
+func matchingHosts(cfg *sshconfig.Config, patterns string) []string {
+	list := strings.Split(patterns, ",")
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	var hosts []string
+	for _, alias := range cfg.Hosts() {
+		if utils.MatchPatternList(list, alias) {
+			hosts = append(hosts, alias)
+		}
+	}
+	return hosts
+}
+
+// runJobs calls fn for 0 to n-1, running up to jobs calls at a time, and
+// returns once all have finished
+func runJobs(n, jobs int, fn func(i int)) {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// pushToHost writes blocks to the authorized_keys of the resolved host
+func pushToHost(cfg *sshconfig.Config, resolved *sshconfig.Resolved, blocks []fleetBlock, opts FleetPushOptions) fleetResult {
+	result := fleetResult{Host: resolved.Host}
+	client, err := dialHost(nil, cfg, resolved, opts.Timeout, true)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer client.Close()
+
+	current, err := client.ReadAuthorizedKeys()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	// Compare against the file as it would be written, so line endings
+	// alone never count as a change
+	current = authkeys.Parse(current).Bytes()
+	file := authkeys.Parse(current)
+	for _, block := range blocks {
+		added, removed := file.SetKeys(block.marker, block.entries)
+		result.Added += added
+		result.Removed += removed
+	}
+	updated := file.Bytes()
+	if bytes.Equal(updated, current) {
+		return result
+	}
+
+	result.Changed = true
+	if opts.DryRun {
+		result.Diff = lineDiff(splitLines(current), splitLines(updated))
+		return result
+	}
+	result.Err = client.WriteAuthorizedKeys(updated)
+	return result
+}
+
+// printFleetResults prints a line per host, the diffs of a dry run and a
+// total, and fails if any host did
+func printFleetResults(out io.Writer, results []fleetResult, dryRun bool) error {
+	changedLabel := "changed"
+	if dryRun {
+		changedLabel = "would change"
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	changed, unchanged, failed := 0, 0, 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Fprintf(w, "%s\tfailed\t%v\n", result.Host, result.Err)
+		case result.Changed:
+			changed++
+			fmt.Fprintf(w, "%s\t%s\t+%d -%d keys\n", result.Host, changedLabel, result.Added, result.Removed)
+		default:
+			unchanged++
+			fmt.Fprintf(w, "%s\tunchanged\t\n", result.Host)
+		}
+	}
+	w.Flush()
+
+	for _, result := range results {
+		if len(result.Diff) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n--- %s:~/.ssh/authorized_keys\n+++ %s:~/.ssh/authorized_keys (pushed)\n", result.Host, result.Host)
+		for _, line := range result.Diff {
+			fmt.Fprintln(out, line)
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d %s, %d unchanged, %d failed\n", changed, changedLabel, unchanged, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d host(s) failed", failed, len(results))
+	}
+	return nil
+}
+
+// splitLines splits data into lines without their newlines
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// lineDiff returns the lines removed from a, prefixed with -, and added in b,
+// prefixed with +, in file order. Unchanged lines are left out.
+func lineDiff(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "-"+a[i])
+			i++
+		default:
+			diff = append(diff, "+"+b[j])
+			j++
+		}
+	}
+	return diff
+}
+
+func init() {
+	FleetCmd.AddCommand(fleetPushCmd)
+
+	fleetPushCmd.Flags().StringVar(&fleetPushOptions.Hosts, "hosts", "", "Comma separated host patterns to push to, such as 'prod-*'")
+	fleetPushCmd.Flags().StringSliceVar(&fleetPushOptions.Keys, "keys", nil, "Comma separated provider users whose keys to push, such as github:alice,gitlab:bob")
+	fleetPushCmd.Flags().IntVarP(&fleetPushOptions.Jobs, "jobs", "j", fleetPushOptions.Jobs, "Number of hosts updated at the same time")
+	fleetPushCmd.Flags().BoolVarP(&fleetPushOptions.DryRun, "dry-run", "n", false, "Show the changes for each host without making them")
+	fleetPushCmd.Flags().StringVar(&fleetPushOptions.RevokedKeys, "revoked-keys", "", "Refuse keys revoked in this KRL or key list (default "+utils.DefaultRevokedKeysPath+" if present)")
+	fleetPushCmd.Flags().DurationVar(&fleetPushOptions.Timeout, "timeout", fleetPushOptions.Timeout, "Time allowed for connecting to each host and the key exchange")
+}
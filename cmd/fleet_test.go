@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+)
+
+func TestFleetPush(t *testing.T) {
+	f := newRemoteFixture(t)
+	sshDir := f.sshDir
+	login, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := login.Write(filepath.Join(sshDir, "id_ed25519"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two servers that accept the login key, and an address nothing listens on
+	var config strings.Builder
+	remoteKeys := make(map[string]string)
+	for _, name := range []string{"prod-1", "prod-2"} {
+		home := filepath.Join(f.dir, name)
+		remoteKeys[name] = filepath.Join(home, ".ssh", "authorized_keys")
+		if err := os.MkdirAll(filepath.Dir(remoteKeys[name]), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(remoteKeys[name], login.AuthorizedKey(), 0600); err != nil {
+			t.Fatal(err)
+		}
+		server := f.startServer(t, remotetest.Options{Home: home})
+		fmt.Fprintf(&config, "Host %s\n    HostName %s\n    Port %d\n\n", name, server.Host(), server.Port())
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	fmt.Fprintf(&config, "Host prod-down\n    HostName 127.0.0.1\n    Port %d\n\nHost staging\n    HostName staging.example.com\n", closedPort)
+	f.writeConfig(t, config.String())
+
+	_, aliceFirst := newTestAuthorizedKey(t)
+	_, aliceSecond := newTestAuthorizedKey(t)
+	served := aliceFirst + "\n" + aliceSecond + "\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/alice.keys" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, served)
+	}))
+	defer ts.Close()
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{"github": ts.URL + "/%s.keys"}
+	defer func() { utils.ServiceURLs = oldURLs }()
+
+	opts := FleetPushOptions{Hosts: "prod-*", Keys: []string{"github:alice"}, Jobs: 2, Timeout: 10 * time.Second}
+	var out bytes.Buffer
+
+	// A dry run shows the diff of each reachable host and changes nothing
+	opts.DryRun = true
+	if err := fleetPush(&out, io.Discard, opts); err == nil || !strings.Contains(err.Error(), "1 of 3 host(s) failed") {
+		t.Errorf("fleetPush() dry run error = %v; want prod-down failed", err)
+	}
+	for _, want := range []string{"would change  +2 -0 keys", "prod-down", "failed", "+# Keys added from github user alice via ssh-config", "+" + aliceFirst, "2 would change, 0 unchanged, 1 failed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("dry run output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "staging") {
+		t.Errorf("dry run output includes a host that does not match:\n%s", out.String())
+	}
+	for name, path := range remoteKeys {
+		if content, _ := os.ReadFile(path); string(content) != string(login.AuthorizedKey()) {
+			t.Errorf("dry run changed %s: %q", name, content)
+		}
+	}
+
+	// Pushing writes the block after the existing keys
+	opts.DryRun = false
+	opts.Hosts = "prod-*,!prod-down"
+	out.Reset()
+	if err := fleetPush(&out, io.Discard, opts); err != nil {
+		t.Fatalf("fleetPush() error = %v\n%s", err, out.String())
+	}
+	want := string(login.AuthorizedKey()) + "\n# Keys added from github user alice via ssh-config\n" + aliceFirst + "\n" + aliceSecond + "\n"
+	for name, path := range remoteKeys {
+		if content, _ := os.ReadFile(path); string(content) != want {
+			t.Errorf("%s authorized_keys = %q; want %q", name, content, want)
+		}
+	}
+	if !strings.Contains(out.String(), "2 changed, 0 unchanged, 0 failed") {
+		t.Errorf("output = %q; want both hosts changed", out.String())
+	}
+
+	// Pushing again changes nothing
+	out.Reset()
+	if err := fleetPush(&out, io.Discard, opts); err != nil {
+		t.Fatalf("fleetPush() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "0 changed, 2 unchanged, 0 failed") {
+		t.Errorf("output = %q; want both hosts unchanged", out.String())
+	}
+
+	// A key the user removed is removed from the hosts
+	served = aliceSecond + "\n"
+	out.Reset()
+	opts.Jobs = 1
+	if err := fleetPush(&out, io.Discard, opts); err != nil {
+		t.Fatalf("fleetPush() error = %v", err)
+	}
+	want = string(login.AuthorizedKey()) + "\n# Keys added from github user alice via ssh-config\n" + aliceSecond + "\n"
+	for name, path := range remoteKeys {
+		if content, _ := os.ReadFile(path); string(content) != want {
+			t.Errorf("%s authorized_keys = %q; want %q", name, content, want)
+		}
+	}
+	if !strings.Contains(out.String(), "+0 -1 keys") {
+		t.Errorf("output = %q; want a removed key reported", out.String())
+	}
+
+	invalid := []FleetPushOptions{
+		{Keys: []string{"github:alice"}, Jobs: 1},
+		{Hosts: "prod-*", Jobs: 1},
+		{Hosts: "prod-*", Keys: []string{"github:alice"}},
+		{Hosts: "nothing-*", Keys: []string{"github:alice"}, Jobs: 1},
+		{Hosts: "prod-*", Keys: []string{"alice"}, Jobs: 1},
+		{Hosts: "prod-*", Keys: []string{"github:nobody"}, Jobs: 1},
+	}
+	for _, opts := range invalid {
+		if err := fleetPush(io.Discard, io.Discard, opts); err == nil {
+			t.Errorf("fleetPush(%+v) expected error", opts)
+		}
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{"Equal", []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"Added", []string{"a"}, []string{"a", "b", "c"}, []string{"+b", "+c"}},
+		{"Removed", []string{"a", "b", "c"}, []string{"a", "c"}, []string{"-b"}},
+		{"Replaced", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []string{"-b", "+x"}},
+		{"From empty", nil, []string{"a"}, []string{"+a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineDiff(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lineDiff() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
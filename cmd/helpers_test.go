@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/knownhosts"
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// remoteFixture is a local home for commands that log in to in-process
+// servers. HOME is dir/local and the SSH paths point into its ~/.ssh, the
+// clock is fixed, and SSH_AUTH_SOCK is hidden so only identity files are
+// used. Everything is restored when the test ends.
+type remoteFixture struct {
+	dir    string
+	sshDir string
+}
+
+func newRemoteFixture(t *testing.T) *remoteFixture {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	f := &remoteFixture{dir: dir, sshDir: filepath.Join(dir, "local", ".ssh")}
+	if err := os.MkdirAll(f.sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", filepath.Join(dir, "local"))
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.Config = filepath.Join(f.sshDir, "config")
+	utils.SSHPaths.KnownHosts = filepath.Join(f.sshDir, "known_hosts")
+	utils.SSHPaths.RevokedKeys = filepath.Join(f.sshDir, "revoked_keys")
+	oldNow := nowFunc
+	nowFunc = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	oldGetenv := getenvFunc
+	getenvFunc = func(key string) string { return "" }
+	t.Cleanup(func() {
+		os.Setenv("HOME", oldHome)
+		utils.SSHPaths = oldPaths
+		nowFunc = oldNow
+		getenvFunc = oldGetenv
+	})
+	return f
+}
+
+// startServer starts a server with opts, stopped when the test ends, and
+// records its host keys in known_hosts
+func (f *remoteFixture) startServer(t *testing.T, opts remotetest.Options) *remotetest.Server {
+	t.Helper()
+	server := remotetest.NewServerWithOptions(opts)
+	t.Cleanup(server.Close)
+	f.trustHostKeys(t, server)
+	return server
+}
+
+// trustHostKeys appends the host keys of server to known_hosts
+func (f *remoteFixture) trustHostKeys(t *testing.T, server *remotetest.Server) {
+	t.Helper()
+	file, err := os.OpenFile(utils.SSHPaths.KnownHosts, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, hostKey := range server.HostKeys {
+		line := knownhosts.Normalize(server.Host(), server.Port()) + " " + string(ssh.MarshalAuthorizedKey(hostKey.PublicKey()))
+		if _, err := file.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeConfig replaces ~/.ssh/config with config
+func (f *remoteFixture) writeConfig(t *testing.T, config string) {
+	t.Helper()
+	if err := os.WriteFile(utils.SSHPaths.Config, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,449 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/knownhosts"
+	"github.com/evberrypi/ssh-config/remote"
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHostsCmd(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	_, webKey := newTestAuthorizedKey(t)
+	_, dbKey := newTestAuthorizedKey(t)
+	_, caKey := newTestAuthorizedKey(t)
+
+	knownHostsContent := "web.example.com,10.0.0.5 " + webKey + "\n" +
+		"[db.example.com]:2222 " + dbKey + "\n" +
+		"@cert-authority *.example.com " + caKey + "\n"
+
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	knownHostsPath := filepath.Join(sshDir, "known_hosts")
+	if err := os.WriteFile(knownHostsPath, []byte(knownHostsContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldKnownHosts := utils.SSHPaths.KnownHosts
+	utils.SSHPaths.KnownHosts = knownHostsPath
+	defer func() { utils.SSHPaths.KnownHosts = oldKnownHosts }()
+
+	run := func(c *cobra.Command, args ...string) (string, error) {
+		var buf bytes.Buffer
+		cmd := &cobra.Command{}
+		cmd.SetOut(&buf)
+		err := c.RunE(cmd, args)
+		return buf.String(), err
+	}
+
+	output, err := run(hostsListCmd)
+	if err != nil {
+		t.Fatalf("hosts list error = %v", err)
+	}
+	for _, want := range []string{"web.example.com,10.0.0.5 ssh-ed25519 SHA256:", "[db.example.com]:2222 ssh-ed25519", "@cert-authority *.example.com"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("hosts list output = %q; want %q", output, want)
+		}
+	}
+
+	if _, err := run(hostsHashCmd); err != nil {
+		t.Fatalf("hosts hash error = %v", err)
+	}
+	content, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "web.example.com") || strings.Contains(string(content), "db.example.com") {
+		t.Errorf("known_hosts = %q; want host names hashed", content)
+	}
+	if info, err := os.Stat(knownHostsPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("known_hosts permissions changed: %v, %v", info.Mode().Perm(), err)
+	}
+	if _, err := os.Stat(knownHostsPath + ".old"); err != nil {
+		t.Errorf("expected known_hosts.old backup: %v", err)
+	}
+
+	output, err = run(hostsFindCmd, "db.example.com:2222")
+	if err != nil {
+		t.Fatalf("hosts find error = %v", err)
+	}
+	if !strings.Contains(output, "# Host [db.example.com]:2222 found: line 3") {
+		t.Errorf("hosts find output = %q", output)
+	}
+
+	output, err = run(hostsRemoveCmd, "10.0.0.5")
+	if err != nil {
+		t.Fatalf("hosts remove error = %v", err)
+	}
+	if !strings.Contains(output, "Removed 1 key(s) for 10.0.0.5") {
+		t.Errorf("hosts remove output = %q", output)
+	}
+	if _, err := run(hostsFindCmd, "10.0.0.5"); err == nil {
+		t.Error("hosts find expected error after removal")
+	}
+	if _, err := run(hostsFindCmd, "web.example.com"); err != nil {
+		t.Errorf("hosts find web.example.com error = %v; want the other hashed name kept", err)
+	}
+	if _, err := run(hostsRemoveCmd, "unknown.example.com"); err == nil {
+		t.Error("hosts remove expected error for unknown host")
+	}
+}
+
+func TestHostsScan(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	server := remotetest.NewServer()
+	defer server.Close()
+
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	configContent := fmt.Sprintf("Host web\n    HostName %s\n    Port %d\n", server.Host(), server.Port())
+	if err := os.WriteFile(filepath.Join(sshDir, "config"), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfig := utils.SSHPaths.Config
+	oldKnownHosts := utils.SSHPaths.KnownHosts
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	utils.SSHPaths.KnownHosts = filepath.Join(sshDir, "known_hosts")
+	defer func() {
+		utils.SSHPaths.Config = oldConfig
+		utils.SSHPaths.KnownHosts = oldKnownHosts
+	}()
+
+	// Patch promptConfirm to answer from a queue
+	answers := []bool{false, true}
+	oldPrompt := promptConfirm
+	promptConfirm = func(reader *bufio.Reader, question string) (bool, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+	defer func() { promptConfirm = oldPrompt }()
+
+	opts := HostScanOptions{Timeout: 10 * time.Second}
+	var out bytes.Buffer
+
+	// Declining the prompt records nothing
+	if err := scanHostKeys(&out, nil, "web", opts); err == nil {
+		t.Error("scanHostKeys() expected error when declined")
+	}
+	if _, err := os.Stat(utils.SSHPaths.KnownHosts); !os.IsNotExist(err) {
+		t.Errorf("known_hosts written after declining: %v", err)
+	}
+
+	out.Reset()
+	if err := scanHostKeys(&out, nil, "web", opts); err != nil {
+		t.Fatalf("scanHostKeys() error = %v", err)
+	}
+	for _, hostKey := range server.HostKeys {
+		if !strings.Contains(out.String(), ssh.FingerprintSHA256(hostKey.PublicKey())) {
+			t.Errorf("output = %q; want fingerprint of the %s key", out.String(), hostKey.PublicKey().Type())
+		}
+	}
+
+	file, err := readKnownHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hostKey := range server.HostKeys {
+		if status := file.CheckKey(server.Host(), server.Port(), hostKey.PublicKey()); status != knownhosts.KeyKnown {
+			t.Errorf("CheckKey(%s) = %v; want known", hostKey.PublicKey().Type(), status)
+		}
+	}
+
+	// Scanning again finds nothing new and does not prompt
+	out.Reset()
+	if err := scanHostKeys(&out, nil, server.Addr, opts); err != nil {
+		t.Fatalf("scanHostKeys() second run error = %v", err)
+	}
+	if !strings.Contains(out.String(), "already known") {
+		t.Errorf("output = %q; want keys reported as already known", out.String())
+	}
+
+	// A different key recorded for the host is refused
+	_, otherKey := newTestAuthorizedKey(t)
+	conflicting := knownhosts.Parse([]byte(knownhosts.Normalize(server.Host(), server.Port()) + " " + otherKey + "\n"))
+	if err := writeKnownHosts(conflicting); err != nil {
+		t.Fatal(err)
+	}
+	opts.Yes = true
+	if err := scanHostKeys(&out, nil, "web", opts); err == nil || !strings.Contains(err.Error(), "hosts remove") {
+		t.Errorf("scanHostKeys() error = %v; want changed key refusal", err)
+	}
+
+	// Hashed entries still match the host
+	os.Remove(utils.SSHPaths.KnownHosts)
+	opts.Hash = true
+	if err := scanHostKeys(&out, nil, "web", opts); err != nil {
+		t.Fatalf("scanHostKeys() hashed error = %v", err)
+	}
+	content, err := os.ReadFile(utils.SSHPaths.KnownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), server.Host()) {
+		t.Errorf("known_hosts = %q; want hashed host names", content)
+	}
+	if found := knownhosts.Parse(content).Find(server.Host(), server.Port()); len(found) != len(server.HostKeys) {
+		t.Errorf("Find() = %d entries; want %d", len(found), len(server.HostKeys))
+	}
+}
+
+func TestHostsCheck(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	configContent := "Host web\n    HostName web.example.com\n\nHost db\n    HostName db.example.com\n    Port 2222\n"
+	if err := os.WriteFile(filepath.Join(sshDir, "config"), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, oldKey := newTestAuthorizedKey(t)
+	_, newKey := newTestAuthorizedKey(t)
+	_, dbKey := newTestAuthorizedKey(t)
+	_, staleKey := newTestAuthorizedKey(t)
+	knownHostsContent := "web.example.com " + oldKey + "\n" +
+		"[db.example.com]:2222 " + dbKey + "\n" +
+		"web.example.com " + newKey + "\n" +
+		"[db.example.com]:2222 " + dbKey + "\n" +
+		"retired.example.com " + staleKey + "\n"
+
+	oldConfig := utils.SSHPaths.Config
+	oldKnownHosts := utils.SSHPaths.KnownHosts
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	utils.SSHPaths.KnownHosts = filepath.Join(sshDir, "known_hosts")
+	defer func() {
+		utils.SSHPaths.Config = oldConfig
+		utils.SSHPaths.KnownHosts = oldKnownHosts
+	}()
+
+	tests := []struct {
+		name    string
+		opts    HostCheckOptions
+		answers []bool
+		want    string
+	}{
+		{
+			name: "fix keeps stale entries",
+			opts: HostCheckOptions{Fix: true},
+			want: "[db.example.com]:2222 " + dbKey + "\n" +
+				"web.example.com " + newKey + "\n" +
+				"retired.example.com " + staleKey + "\n",
+		},
+		{
+			name: "fix with prune",
+			opts: HostCheckOptions{Fix: true, Prune: true},
+			want: "[db.example.com]:2222 " + dbKey + "\n" +
+				"web.example.com " + newKey + "\n",
+		},
+		{
+			name:    "interactive",
+			answers: []bool{true, false, true},
+			want: "[db.example.com]:2222 " + dbKey + "\n" +
+				"web.example.com " + newKey + "\n" +
+				"[db.example.com]:2222 " + dbKey + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(utils.SSHPaths.KnownHosts, []byte(knownHostsContent), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			answers := tt.answers
+			oldPrompt := promptConfirm
+			promptConfirm = func(reader *bufio.Reader, question string) (bool, error) {
+				if len(answers) == 0 {
+					t.Fatalf("unexpected prompt %q", question)
+				}
+				answer := answers[0]
+				answers = answers[1:]
+				return answer, nil
+			}
+			defer func() { promptConfirm = oldPrompt }()
+
+			var out bytes.Buffer
+			if err := checkKnownHosts(&out, nil, tt.opts); err != nil {
+				t.Fatalf("checkKnownHosts() error = %v", err)
+			}
+			for _, want := range []string{
+				"line 1: web.example.com has a different ssh-ed25519 key than line 3",
+				"line 4: ssh-ed25519 key for [db.example.com]:2222 is already recorded on line 2",
+				"line 5: retired.example.com is not used by any host in your SSH config",
+			} {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output = %q; want %q", out.String(), want)
+				}
+			}
+
+			content, err := os.ReadFile(utils.SSHPaths.KnownHosts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("known_hosts = %q; want %q", content, tt.want)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := checkKnownHosts(&out, nil, HostCheckOptions{Fix: true, Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := checkKnownHosts(&out, nil, HostCheckOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No problems found") {
+		t.Errorf("output = %q; want no problems after fixing", out.String())
+	}
+}
+
+func TestHostKeyVerifierCertificates(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldKnownHosts := utils.SSHPaths.KnownHosts
+	utils.SSHPaths.KnownHosts = filepath.Join(tmpDir, "known_hosts")
+	defer func() { utils.SSHPaths.KnownHosts = oldKnownHosts }()
+
+	newSigner := func() ssh.Signer {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	}
+	ca := newSigner()
+	caLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+
+	server := remotetest.NewServerWithOptions(remotetest.Options{Password: "secret", HostCA: ca})
+	defer server.Close()
+	wrongName := remotetest.NewServerWithOptions(remotetest.Options{Password: "secret", HostCA: ca, HostPrincipals: []string{"other.example.com"}})
+	defer wrongName.Close()
+
+	dial := func(s *remotetest.Server, knownHosts string) ([]string, error) {
+		if err := os.WriteFile(utils.SSHPaths.KnownHosts, []byte(knownHosts), 0600); err != nil {
+			t.Fatal(err)
+		}
+		target := hostTarget{Addr: s.Addr, KeyHost: s.Host(), KeyPort: s.Port()}
+		callback, algorithms, err := hostKeyVerifier(target)
+		if err != nil {
+			t.Fatalf("hostKeyVerifier() error = %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		client, err := remote.Dial(ctx, remote.Target{
+			Addr:              s.Addr,
+			User:              "deploy",
+			Auth:              []ssh.AuthMethod{ssh.Password("secret")},
+			HostKeyCallback:   callback,
+			HostKeyAlgorithms: algorithms,
+		})
+		if err == nil {
+			client.Close()
+		}
+		return algorithms, err
+	}
+
+	var revokedHostKeys string
+	for _, key := range server.HostKeys {
+		revokedHostKeys += "@revoked * " + string(ssh.MarshalAuthorizedKey(key.PublicKey()))
+	}
+	tests := []struct {
+		name       string
+		server     *remotetest.Server
+		knownHosts string
+		wantErr    string
+	}{
+		{"Trusted CA", server, "@cert-authority 127.0.0.1 " + caLine + "\n", ""},
+		{"Trusted CA for a pattern", server, "@cert-authority 127.0.0.* " + caLine + "\n", ""},
+		{"Host not a principal", wrongName, "@cert-authority * " + caLine + "\n", "host certificate of"},
+		{"CA for other hosts", server, "@cert-authority *.example.com " + caLine + "\n", "not in known_hosts"},
+		{"Revoked CA", server, "@cert-authority * " + caLine + "\n@revoked * " + caLine + "\n", "not in known_hosts"},
+		{"Revoked host key", server, "@cert-authority * " + caLine + "\n" + revokedHostKeys, "host certificate of"},
+		{"CA key as a host key", server, "127.0.0.1 " + caLine + "\n", "does not match known_hosts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			knownHosts := strings.ReplaceAll(tt.knownHosts, "127.0.0.1", knownhosts.Normalize(tt.server.Host(), tt.server.Port()))
+			knownHosts = strings.ReplaceAll(knownHosts, "127.0.0.*", "[127.0.0.*]:"+strconv.Itoa(tt.server.Port()))
+			algorithms, err := dial(tt.server, knownHosts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Dial() error = %v", err)
+				}
+				if len(algorithms) == 0 || algorithms[0] != ssh.CertAlgoED25519v01 {
+					t.Errorf("algorithms = %q; want certificates first", algorithms)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Dial() error = %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Without a trusted CA the certified key itself can be recorded
+	plain := knownhosts.Normalize(server.Host(), server.Port()) + " " + string(ssh.MarshalAuthorizedKey(server.HostKeys[0].PublicKey()))
+	if _, err := dial(server, plain); err != nil {
+		t.Errorf("Dial() with the plain host key error = %v", err)
+	}
+}
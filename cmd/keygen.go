@@ -0,0 +1,137 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// KeygenOptions represents the options for generating a key pair
+type KeygenOptions struct {
+	Type         string
+	Bits         int
+	Comment      string
+	File         string
+	NoPassphrase bool
+	Force        bool
+}
+
+var keygenOptions KeygenOptions
+
+// KeygenCmd represents the Cobra command for generating SSH key pairs.
+var KeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a new SSH key pair",
+	Long: `Generate a new Ed25519, ECDSA or RSA key pair in the OpenSSH format.
+The private key is written with 0600 permissions and the public key, next to
+it with a .pub suffix, with 0644 permissions. You are asked for a passphrase
+to encrypt the private key; leave it empty for no passphrase.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := generateKeyPair(cmd.OutOrStdout(), bufio.NewReader(os.Stdin), keygenOptions)
+		return err
+	},
+}
+
+// promptPassphrase is a function variable for testability. The prompt goes to
+// stderr so it never mixes with keys or signatures written to stdout.
+var promptPassphrase = func(reader *bufio.Reader, prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		passphrase, err := term.ReadPassword(fd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		return passphrase, nil
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// promptNewPassphrase asks for a passphrase twice and checks both entries match
+func promptNewPassphrase(reader *bufio.Reader) ([]byte, error) {
+	passphrase, err := promptPassphrase(reader, "Enter passphrase (empty for no passphrase): ")
+	if err != nil {
+		return nil, err
+	}
+	confirm, err := promptPassphrase(reader, "Enter same passphrase again: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, confirm) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// generateKeyPair creates a key pair as described by opts and returns the
+// path of the private key
+func generateKeyPair(out io.Writer, reader *bufio.Reader, opts KeygenOptions) (string, error) {
+	path := opts.File
+	if path == "" {
+		path = sshkeys.DefaultKeyPath(opts.Type)
+	}
+	path = utils.ExpandUser(path)
+	if !opts.Force {
+		if _, err := os.Stat(path); err == nil {
+			return "", fmt.Errorf("%s already exists; use --force to overwrite it", path)
+		}
+	}
+
+	comment := opts.Comment
+	if comment == "" {
+		comment = sshkeys.DefaultComment()
+	}
+
+	var passphrase []byte
+	if !opts.NoPassphrase {
+		var err error
+		if passphrase, err = promptNewPassphrase(reader); err != nil {
+			return "", err
+		}
+	}
+
+	pair, err := sshkeys.Generate(sshkeys.GenerateOptions{
+		Type:       opts.Type,
+		Bits:       opts.Bits,
+		Comment:    comment,
+		Passphrase: passphrase,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	if err := pair.Write(path, opts.Force); err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(out, "Your identification has been saved in %s\n", path)
+	fmt.Fprintf(out, "Your public key has been saved in %s.pub\n", path)
+	fmt.Fprintf(out, "The key fingerprint is %s %s\n", ssh.FingerprintSHA256(pair.Public), comment)
+	return path, nil
+}
+
+func init() {
+	KeygenCmd.Flags().StringVarP(&keygenOptions.Type, "type", "t", sshkeys.KeyTypeEd25519, "Key type: ed25519, ecdsa or rsa")
+	KeygenCmd.Flags().IntVarP(&keygenOptions.Bits, "bits", "b", 0, "Key size: 256, 384 or 521 for ecdsa, at least 2048 for rsa (default 3072)")
+	KeygenCmd.Flags().StringVarP(&keygenOptions.Comment, "comment", "C", "", "Key comment (default user@hostname)")
+	KeygenCmd.Flags().StringVarP(&keygenOptions.File, "file", "f", "", "Private key path (default ~/.ssh/id_<type>)")
+	KeygenCmd.Flags().BoolVar(&keygenOptions.NoPassphrase, "no-passphrase", false, "Do not encrypt the private key and skip the passphrase prompt")
+	KeygenCmd.Flags().BoolVar(&keygenOptions.Force, "force", false, "Overwrite an existing key")
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	// Patch promptPassphrase to answer from a queue
+	var answers []string
+	oldPrompt := promptPassphrase
+	promptPassphrase = func(reader *bufio.Reader, prompt string) ([]byte, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return []byte(answer), nil
+	}
+	defer func() { promptPassphrase = oldPrompt }()
+
+	var out bytes.Buffer
+
+	answers = []string{"secret", "different"}
+	if _, err := generateKeyPair(&out, nil, KeygenOptions{Type: "ed25519"}); err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Errorf("generateKeyPair() error = %v; want passphrase mismatch", err)
+	}
+
+	answers = []string{"secret", "secret"}
+	path, err := generateKeyPair(&out, nil, KeygenOptions{Type: "ed25519", Comment: "alice@laptop"})
+	if err != nil {
+		t.Fatalf("generateKeyPair() error = %v", err)
+	}
+	if want := filepath.Join(tmpDir, ".ssh", "id_ed25519"); path != want {
+		t.Errorf("generateKeyPair() path = %q; want %q", path, want)
+	}
+
+	private, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(private, []byte("secret")); err != nil {
+		t.Errorf("private key does not decrypt with the passphrase: %v", err)
+	}
+	public, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(public), "ssh-ed25519 ") || !strings.HasSuffix(string(public), " alice@laptop\n") {
+		t.Errorf("public key = %q", public)
+	}
+	if !strings.Contains(out.String(), "SHA256:") {
+		t.Errorf("output = %q; want fingerprint", out.String())
+	}
+
+	// Existing keys are only replaced with --force
+	if _, err := generateKeyPair(&out, nil, KeygenOptions{Type: "ed25519", NoPassphrase: true}); err == nil {
+		t.Error("generateKeyPair() expected error for existing key")
+	}
+	if _, err := generateKeyPair(&out, nil, KeygenOptions{Type: "ed25519", NoPassphrase: true, Force: true}); err != nil {
+		t.Errorf("generateKeyPair() with force error = %v", err)
+	}
+	private, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssh.ParsePrivateKey(private); err != nil {
+		t.Errorf("key generated with --no-passphrase is encrypted: %v", err)
+	}
+}
+
+func TestPromptPassphraseStderr(t *testing.T) {
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdoutW, stderrW
+	passphrase, err := promptPassphrase(bufio.NewReader(strings.NewReader("secret\n")), "Enter passphrase: ")
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		t.Fatalf("promptPassphrase() error = %v", err)
+	}
+	if string(passphrase) != "secret" {
+		t.Errorf("passphrase = %q; want secret", passphrase)
+	}
+
+	var stdout, stderr bytes.Buffer
+	stdout.ReadFrom(stdoutR)
+	stderr.ReadFrom(stderrR)
+	if stdout.Len() != 0 {
+		t.Errorf("stdout = %q; want the prompt kept off it", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Enter passphrase: ") {
+		t.Errorf("stderr = %q; want the prompt", stderr.String())
+	}
+}
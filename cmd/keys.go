@@ -0,0 +1,173 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// nowFunc returns the current time and can be replaced in tests
+var nowFunc = time.Now
+
+// KeysCmd represents the Cobra command for managing keys in ~/.ssh/authorized_keys.
+var KeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage keys in authorized_keys and ~/.ssh",
+	Long: `Manage the keys in your ~/.ssh/authorized_keys file and your own key pairs.
+This command can be used to:
+- List key grants that have expired
+- Remove expired key grants
+- Trust certificate authorities to sign certificates for logging in
+- Report on the key pairs in ~/.ssh and the hosts using them
+- Convert keys between OpenSSH, PEM, PKCS#8, RFC 4716 and PuTTY formats
+- Add, change or remove the passphrase of a private key`,
+}
+
+var keysExpiredCmd = &cobra.Command{
+	Use:   "expired",
+	Short: "List expired keys in authorized_keys",
+	Long:  "List the keys in ~/.ssh/authorized_keys whose expiry-time has passed",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := readAuthorizedKeys()
+		if err != nil {
+			return err
+		}
+
+		now := nowFunc()
+		found := 0
+		for _, line := range file.Entries() {
+			if line.Entry.Expired(now) {
+				fmt.Fprintln(cmd.OutOrStdout(), describeKeyGrant(file, line))
+				found++
+			}
+		}
+		if found == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No expired keys found.")
+		}
+		return nil
+	},
+}
+
+var keysPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove expired keys from authorized_keys",
+	Long:  "Remove the keys in ~/.ssh/authorized_keys whose expiry-time has passed",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := readAuthorizedKeys()
+		if err != nil {
+			return err
+		}
+
+		// Describe the grants before pruning removes their markers
+		var descriptions []string
+		now := nowFunc()
+		for _, line := range file.Entries() {
+			if line.Entry.Expired(now) {
+				descriptions = append(descriptions, describeKeyGrant(file, line))
+			}
+		}
+
+		removed := file.PruneExpired(now)
+		if len(removed) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No expired keys found.")
+			return nil
+		}
+
+		if err := writeAuthorizedKeys(file); err != nil {
+			return err
+		}
+		for _, description := range descriptions {
+			fmt.Fprintln(cmd.OutOrStdout(), "Removed", description)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed %d expired key(s).\n", len(removed))
+		return nil
+	},
+}
+
+// forUser names the local account whose authorized_keys is managed, set by --for-user
+var forUser string
+
+// authorizedKeysTarget returns the authorized_keys file to manage. With
+// --for-user it is resolved from the target account's home directory and
+// the account is returned so files can be handed over to it.
+func authorizedKeysTarget() (string, *utils.TargetUser, error) {
+	if forUser == "" {
+		return utils.ExpandUser(utils.SSHPaths.AuthorizedKeys), nil, nil
+	}
+
+	owner, err := utils.LookupUser(forUser)
+	if err != nil {
+		return "", nil, err
+	}
+	path := owner.Path("authorized_keys")
+	if err := utils.CheckUserPath(owner, path); err != nil {
+		return "", nil, err
+	}
+	return path, owner, nil
+}
+
+// readAuthorizedKeys reads and parses the authorized_keys file
+func readAuthorizedKeys() (*authkeys.File, error) {
+	path, _, err := authorizedKeysTarget()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorized_keys file: %w", err)
+	}
+	return authkeys.Parse(content), nil
+}
+
+// writeAuthorizedKeys replaces the authorized_keys file with the contents of file
+func writeAuthorizedKeys(file *authkeys.File) error {
+	path, owner, err := authorizedKeysTarget()
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		err = utils.WriteUserFile(owner, path, file.Bytes(), 0600)
+	} else {
+		err = utils.WriteFileAtomic(path, file.Bytes(), 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write authorized_keys file: %w", err)
+	}
+	return nil
+}
+
+// describeKeyGrant summarises a key line as its origin, key and expiry
+func describeKeyGrant(file *authkeys.File, line *authkeys.Line) string {
+	origin := "unknown"
+	if marker, ok := file.MarkerFor(line); ok {
+		origin = marker.Service + ":" + marker.Username
+	}
+
+	key := line.Entry.KeyType
+	if pub, err := line.Entry.PublicKey(); err == nil {
+		key += " " + ssh.FingerprintSHA256(pub)
+	}
+
+	expiry := "never expires"
+	if t, ok, err := line.Entry.ExpiresAt(); ok && err == nil {
+		expiry = "expired " + t.Format("2006-01-02 15:04")
+		if t.After(nowFunc()) {
+			expiry = "expires " + t.Format("2006-01-02 15:04")
+		}
+	}
+	return fmt.Sprintf("%s %s (%s)", origin, key, expiry)
+}
+
+func init() {
+	KeysCmd.AddCommand(keysExpiredCmd, keysPruneCmd)
+
+	KeysCmd.PersistentFlags().StringVar(&forUser, "for-user", "", "Manage the authorized_keys of another local user (requires root)")
+}
@@ -0,0 +1,172 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/keyformat"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+)
+
+// KeysConvertOptions represents the options for converting a key file
+type KeysConvertOptions struct {
+	To           string
+	Output       string
+	Public       bool
+	Comment      string
+	Passphrase   bool
+	NoPassphrase bool
+	PPKVersion   int
+	Force        bool
+}
+
+var keysConvertOptions KeysConvertOptions
+
+var keysConvertCmd = &cobra.Command{
+	Use:   "convert <file> --to <format>",
+	Short: "Convert a key between OpenSSH, PEM, PKCS#8, RFC 4716 and PuTTY formats",
+	Long: `Convert a public or private key to another format. The input format is
+detected; --to selects the output format:
+
+  openssh  OpenSSH private key, or authorized_keys line for public keys
+  pem      PKCS#1 (RSA) or SEC 1 (ECDSA) private key, PKCS#1 or PKIX public key
+  pkcs8    PKCS#8 private key, encrypted with PBES2, or PKIX public key
+  rfc4716  SSH2 public key, as used by PuTTY and commercial SSH servers
+  ppk      PuTTY private key, version 3 or, with --ppk-version 2, version 2
+
+You are asked for the passphrase of an encrypted input. The output keeps the
+same passphrase unless --passphrase asks for a new one or --no-passphrase
+writes it unencrypted. Comments are kept by the formats that hold one; the
+comment of an encrypted OpenSSH key is read from its .pub file.
+
+The key is written to stdout, or with --output to a file: 0600 for private
+keys and 0644 for public keys.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if forUser != "" {
+			return fmt.Errorf("keys convert does not support --for-user")
+		}
+		return convertKey(cmd.OutOrStdout(), cmd.ErrOrStderr(), bufio.NewReader(os.Stdin), args[0], keysConvertOptions)
+	},
+}
+
+// readKeyFile decodes the key at path in any supported format, asking for
+// its passphrase if it is encrypted, and returns it with its format and
+// passphrase. A private key that stores no comment, such as an encrypted
+// OpenSSH key, takes the comment of its .pub file.
+func readKeyFile(reader *bufio.Reader, path string) (*keyformat.Key, string, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	var passphrase []byte
+	key, format, err := keyformat.Decode(data, func() ([]byte, error) {
+		secret, err := promptPassphrase(reader, fmt.Sprintf("Enter passphrase for %s: ", path))
+		passphrase = secret
+		return secret, err
+	})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to read key %s: %w", path, err)
+	}
+
+	if key.Comment == "" && key.Private != nil {
+		if pub, comment, err := sshkeys.LoadPublicKey(path); err == nil && bytes.Equal(pub.Marshal(), key.Public.Marshal()) {
+			key.Comment = comment
+		}
+	}
+	return key, format, passphrase, nil
+}
+
+// convertKey converts the key at path as described by opts
+func convertKey(out, errOut io.Writer, reader *bufio.Reader, path string, opts KeysConvertOptions) error {
+	opts.To = strings.ToLower(opts.To)
+	if opts.To == "" {
+		return fmt.Errorf("--to is required")
+	}
+	if !keyformat.ValidFormat(opts.To) {
+		return fmt.Errorf("unsupported format %q: use %s", opts.To, strings.Join(keyformat.Formats, ", "))
+	}
+	if opts.Passphrase && opts.NoPassphrase {
+		return fmt.Errorf("--passphrase and --no-passphrase cannot be used together")
+	}
+	if opts.Output != "" && !opts.Force {
+		if _, err := os.Stat(utils.ExpandUser(opts.Output)); err == nil {
+			return fmt.Errorf("%s already exists; use --force to overwrite it", opts.Output)
+		}
+	}
+
+	path = utils.ExpandUser(path)
+	key, format, passphrase, err := readKeyFile(reader, path)
+	if err != nil {
+		return err
+	}
+	if opts.Comment != "" {
+		key.Comment = opts.Comment
+	}
+
+	// RFC 4716 only holds public keys, so it implies --public as in ssh-keygen -e
+	public := key.Private == nil || opts.Public || opts.To == keyformat.FormatRFC4716
+	encodeOpts := keyformat.EncodeOptions{Public: public, PPKVersion: opts.PPKVersion}
+	if !public {
+		switch {
+		case opts.NoPassphrase:
+		case opts.Passphrase:
+			if encodeOpts.Passphrase, err = promptNewPassphrase(reader); err != nil {
+				return err
+			}
+		case len(passphrase) > 0 && opts.To == keyformat.FormatPEM:
+			return fmt.Errorf("%s is encrypted but PEM keys are written without a passphrase; use --no-passphrase, or convert to pkcs8 to keep it encrypted", path)
+		default:
+			encodeOpts.Passphrase = passphrase
+		}
+	} else if opts.Passphrase {
+		return fmt.Errorf("--passphrase only applies to private keys")
+	}
+
+	converted, err := keyformat.Encode(key, opts.To, encodeOpts)
+	if err != nil {
+		return fmt.Errorf("failed to convert %s: %w", path, err)
+	}
+	keepsComment := opts.To == keyformat.FormatOpenSSH || opts.To == keyformat.FormatRFC4716 || (opts.To == keyformat.FormatPPK && !public)
+	if key.Comment != "" && !keepsComment {
+		fmt.Fprintf(errOut, "Note: the %s format has no comment; %q is not kept\n", opts.To, key.Comment)
+	}
+
+	if opts.Output == "" {
+		_, err := out.Write(converted)
+		return err
+	}
+	perm := os.FileMode(0600)
+	if public {
+		perm = 0644
+	}
+	if err := utils.WriteFileAtomic(utils.ExpandUser(opts.Output), converted, perm); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	kind := "private"
+	if public {
+		kind = "public"
+	}
+	fmt.Fprintf(out, "Converted %s (%s) to the %s %s key %s\n", path, format, opts.To, kind, opts.Output)
+	return nil
+}
+
+func init() {
+	KeysCmd.AddCommand(keysConvertCmd)
+
+	keysConvertCmd.Flags().StringVarP(&keysConvertOptions.To, "to", "m", "", "Output format: "+strings.Join(keyformat.Formats, ", "))
+	keysConvertCmd.Flags().StringVarP(&keysConvertOptions.Output, "output", "o", "", "Write the key to this file instead of stdout")
+	keysConvertCmd.Flags().BoolVar(&keysConvertOptions.Public, "public", false, "Write only the public key of a private key")
+	keysConvertCmd.Flags().StringVarP(&keysConvertOptions.Comment, "comment", "C", "", "Replace the key comment")
+	keysConvertCmd.Flags().BoolVar(&keysConvertOptions.Passphrase, "passphrase", false, "Ask for a new passphrase for the output")
+	keysConvertCmd.Flags().BoolVar(&keysConvertOptions.NoPassphrase, "no-passphrase", false, "Write the private key without a passphrase")
+	keysConvertCmd.Flags().IntVar(&keysConvertOptions.PPKVersion, "ppk-version", 3, "PuTTY key file version: 2 or 3")
+	keysConvertCmd.Flags().BoolVar(&keysConvertOptions.Force, "force", false, "Overwrite an existing output file")
+}
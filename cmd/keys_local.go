@@ -0,0 +1,304 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeysLocalOptions represents the options for reporting on local keys
+type KeysLocalOptions struct {
+	Orphaned    bool
+	Missing     bool
+	Unencrypted bool
+}
+
+var keysLocalOptions KeysLocalOptions
+
+var keysLocalCmd = &cobra.Command{
+	Use:   "local",
+	Short: "Report on the key pairs in ~/.ssh",
+	Long: `Scan ~/.ssh for private and public keys and report, for each key pair, its
+type and size, SHA256 and MD5 fingerprints, comment, whether the private key is
+protected by a passphrase, file permissions and the hosts in ~/.ssh/config that
+use it through IdentityFile. Problems such as permissions ssh would reject or
+a .pub file that does not match its private key are flagged.
+
+Use --orphaned to list only keys no host uses, and --missing to list only
+hosts whose IdentityFile does not exist.
+
+Use --unencrypted to list the private keys without a passphrase, including
+those outside ~/.ssh that the config references. It fails when a key used by
+the config is unencrypted, so it can enforce that all of them are protected.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if forUser != "" {
+			return fmt.Errorf("keys local does not support --for-user")
+		}
+		return reportLocalKeys(cmd.OutOrStdout(), utils.ExpandUser("~/.ssh"), keysLocalOptions)
+	},
+}
+
+// identityReference is a host using a key file through IdentityFile
+type identityReference struct {
+	Host string
+	Path string
+}
+
+// reportLocalKeys prints the inventory of the keys in dir
+func reportLocalKeys(out io.Writer, dir string, opts KeysLocalOptions) error {
+	keys, err := sshkeys.Scan(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	cfg, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+
+	refs := identityReferences(cfg)
+	usedBy := make(map[string][]string)
+	for _, ref := range refs {
+		usedBy[ref.Path] = appendUnique(usedBy[ref.Path], ref.Host)
+	}
+	if opts.Unencrypted {
+		return reportUnencryptedKeys(out, dir, keys, usedBy)
+	}
+
+	if !opts.Missing {
+		shown := 0
+		for _, key := range keys {
+			hosts := usedBy[filepath.Clean(key.Path())]
+			if key.PrivatePath == "" {
+				hosts = usedBy[filepath.Clean(key.PublicPath)]
+			}
+			isDefault := isDefaultIdentity(dir, key.Path())
+			if opts.Orphaned && (len(hosts) > 0 || isDefault) {
+				continue
+			}
+			describeLocalKey(out, key, hosts, isDefault)
+			shown++
+		}
+		if shown == 0 && opts.Orphaned {
+			fmt.Fprintln(out, "No orphaned keys found.")
+		} else if shown == 0 {
+			fmt.Fprintf(out, "No keys found in %s.\n", dir)
+		}
+	}
+
+	if opts.Orphaned {
+		return nil
+	}
+	problems := identityProblems(refs)
+	if len(problems) > 0 {
+		if !opts.Missing {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintln(out, "Hosts with IdentityFile problems:")
+		for _, problem := range problems {
+			fmt.Fprintf(out, "  %s\n", problem)
+		}
+	} else if opts.Missing {
+		fmt.Fprintln(out, "No hosts reference missing key files.")
+	}
+	return nil
+}
+
+// reportUnencryptedKeys lists the private keys in dir, and those the config
+// references elsewhere, that have no passphrase. It returns an error when
+// any of them is used by a host.
+func reportUnencryptedKeys(out io.Writer, dir string, keys []*sshkeys.LocalKey, usedBy map[string][]string) error {
+	type unencryptedKey struct {
+		path  string
+		key   string
+		hosts []string
+	}
+	var found []unencryptedKey
+	scanned := make(map[string]bool)
+	for _, key := range keys {
+		if key.PrivatePath == "" {
+			continue
+		}
+		scanned[filepath.Clean(key.PrivatePath)] = true
+		if key.Encrypted {
+			continue
+		}
+		hosts := append([]string(nil), usedBy[filepath.Clean(key.PrivatePath)]...)
+		if isDefaultIdentity(dir, key.PrivatePath) {
+			hosts = append(hosts, "default identity")
+		}
+		description := key.Type()
+		if key.Public != nil {
+			description += " " + ssh.FingerprintSHA256(key.Public)
+		}
+		found = append(found, unencryptedKey{key.PrivatePath, description, hosts})
+	}
+
+	var external []string
+	for path := range usedBy {
+		if !scanned[path] {
+			external = append(external, path)
+		}
+	}
+	sort.Strings(external)
+	for _, path := range external {
+		data, err := os.ReadFile(path)
+		if err != nil || !sshkeys.IsPrivateKey(data) {
+			continue
+		}
+		if encrypted, err := sshkeys.IsEncrypted(data); err != nil || encrypted {
+			continue
+		}
+		description := "unknown"
+		if pub, _, err := sshkeys.LoadPublicKey(path); err == nil {
+			description = pub.Type() + " " + ssh.FingerprintSHA256(pub)
+		}
+		found = append(found, unencryptedKey{path, description, usedBy[path]})
+	}
+
+	if len(found) == 0 {
+		fmt.Fprintln(out, "All private keys are protected by a passphrase.")
+		return nil
+	}
+	used := 0
+	fmt.Fprintln(out, "Private keys without a passphrase:")
+	for _, key := range found {
+		usage := "not used by any host"
+		if len(key.hosts) > 0 {
+			usage = "used by " + strings.Join(key.hosts, ", ")
+			used++
+		}
+		fmt.Fprintf(out, "  %s (%s) %s\n", key.path, key.key, usage)
+	}
+	fmt.Fprintln(out, "Add a passphrase with: ssh-config keys passphrase <file>")
+	if used > 0 {
+		return fmt.Errorf("%d key(s) used by the SSH config are not protected by a passphrase", used)
+	}
+	return nil
+}
+
+// describeLocalKey prints the details and problems of a key
+func describeLocalKey(out io.Writer, key *sshkeys.LocalKey, hosts []string, isDefault bool) {
+	fmt.Fprintln(out, key.Path())
+	if key.Public != nil {
+		fmt.Fprintf(out, "  type:        %s (%d bits)\n", key.Type(), key.Bits())
+		fmt.Fprintf(out, "  fingerprint: %s\n", ssh.FingerprintSHA256(key.Public))
+		fmt.Fprintf(out, "               MD5:%s\n", ssh.FingerprintLegacyMD5(key.Public))
+	} else {
+		fmt.Fprintln(out, "  type:        unknown (encrypted key without a .pub file)")
+	}
+	if key.Comment != "" {
+		fmt.Fprintf(out, "  comment:     %s\n", key.Comment)
+	}
+	if key.PrivatePath != "" {
+		passphrase := "no"
+		if key.Encrypted {
+			passphrase = "yes"
+		}
+		fmt.Fprintf(out, "  passphrase:  %s\n", passphrase)
+	}
+
+	var perms []string
+	if key.PrivatePath != "" {
+		perms = append(perms, fmt.Sprintf("private %04o", key.PrivateMode))
+	}
+	if key.PublicPath != "" {
+		perms = append(perms, fmt.Sprintf("public %04o", key.PublicMode))
+	}
+	fmt.Fprintf(out, "  permissions: %s\n", strings.Join(perms, ", "))
+
+	switch {
+	case len(hosts) > 0:
+		fmt.Fprintf(out, "  used by:     %s\n", strings.Join(hosts, ", "))
+	case isDefault:
+		fmt.Fprintln(out, "  used by:     any host without IdentityFile (default identity)")
+	default:
+		fmt.Fprintln(out, "  used by:     no host (orphaned)")
+	}
+	for _, problem := range key.Problems() {
+		fmt.Fprintf(out, "  warning:     %s\n", problem)
+	}
+}
+
+// identityReferences returns every IdentityFile used by the hosts in the SSH
+// config, including those set by wildcard blocks that no alias matches
+func identityReferences(cfg *sshconfig.Config) []identityReference {
+	var refs []identityReference
+	for _, alias := range cfg.Hosts() {
+		for _, path := range cfg.Resolve(alias).IdentityFiles() {
+			refs = append(refs, identityReference{Host: alias, Path: filepath.Clean(path)})
+		}
+	}
+	for _, block := range cfg.Blocks {
+		if !strings.ContainsAny(strings.Join(block.Patterns, " "), "*?") {
+			continue
+		}
+		for _, opt := range block.Options {
+			if !strings.EqualFold(opt.Keyword, "IdentityFile") || strings.Contains(opt.Value(), "%") {
+				continue
+			}
+			host := block.Kind + " " + strings.Join(block.Patterns, " ")
+			refs = append(refs, identityReference{Host: host, Path: filepath.Clean(utils.ExpandUser(opt.Value()))})
+		}
+	}
+	return refs
+}
+
+// identityProblems describes the IdentityFile references that ssh cannot use
+func identityProblems(refs []identityReference) []string {
+	var problems []string
+	seen := make(map[identityReference]bool)
+	for _, ref := range refs {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		switch _, err := os.Stat(ref.Path); {
+		case os.IsNotExist(err):
+			problems = append(problems, fmt.Sprintf("%s: IdentityFile %s does not exist", ref.Host, ref.Path))
+		case strings.HasSuffix(ref.Path, ".pub"):
+			problems = append(problems, fmt.Sprintf("%s: IdentityFile %s is a public key; use the private key %s", ref.Host, ref.Path, strings.TrimSuffix(ref.Path, ".pub")))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func isDefaultIdentity(dir, path string) bool {
+	for _, name := range sshkeys.DefaultIdentityNames {
+		if filepath.Clean(path) == filepath.Join(dir, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func init() {
+	KeysCmd.AddCommand(keysLocalCmd)
+
+	keysLocalCmd.Flags().BoolVar(&keysLocalOptions.Orphaned, "orphaned", false, "Only list keys not used by any host")
+	keysLocalCmd.Flags().BoolVar(&keysLocalOptions.Missing, "missing", false, "Only list hosts whose IdentityFile does not exist")
+	keysLocalCmd.Flags().BoolVar(&keysLocalOptions.Unencrypted, "unencrypted", false, "Only list private keys without a passphrase; fail if the config uses one")
+}
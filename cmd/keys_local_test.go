@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+)
+
+func TestReportLocalKeys(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	for _, name := range []string{"id_ed25519", "id_work", "id_unused"} {
+		pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: name + "@laptop"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pair.Write(filepath.Join(sshDir, name), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configContent := `Host web
+    IdentityFile ~/.ssh/id_work
+
+Host db
+    IdentityFile ~/.ssh/id_missing
+
+Host legacy
+    IdentityFile ~/.ssh/id_work.pub
+`
+	oldConfig := utils.SSHPaths.Config
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	defer func() { utils.SSHPaths.Config = oldConfig }()
+	if err := os.WriteFile(utils.SSHPaths.Config, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := reportLocalKeys(&out, sshDir, KeysLocalOptions{}); err != nil {
+		t.Fatalf("reportLocalKeys() error = %v", err)
+	}
+	for _, want := range []string{
+		filepath.Join(sshDir, "id_work") + "\n  type:        ssh-ed25519 (256 bits)",
+		"MD5:",
+		"comment:     id_work@laptop",
+		"passphrase:  no",
+		"permissions: private 0600, public 0644",
+		"used by:     web\n",
+		"used by:     any host without IdentityFile (default identity)",
+		"used by:     no host (orphaned)",
+		"db: IdentityFile " + filepath.Join(sshDir, "id_missing") + " does not exist",
+		"legacy: IdentityFile " + filepath.Join(sshDir, "id_work.pub") + " is a public key",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output = %q; want %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	if err := reportLocalKeys(&out, sshDir, KeysLocalOptions{Orphaned: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "id_unused") || strings.Contains(out.String(), "id_work") || strings.Contains(out.String(), "id_missing") {
+		t.Errorf("--orphaned output = %q; want only id_unused", out.String())
+	}
+
+	out.Reset()
+	if err := reportLocalKeys(&out, sshDir, KeysLocalOptions{Missing: true}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "type:") || !strings.Contains(out.String(), "id_missing does not exist") {
+		t.Errorf("--missing output = %q; want only IdentityFile problems", out.String())
+	}
+}
+
+func TestReportLocalKeysWithoutSSHDir(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	os.Setenv("HOME", tmpDir)
+
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	oldConfig := utils.SSHPaths.Config
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	defer func() { utils.SSHPaths.Config = oldConfig }()
+
+	var out bytes.Buffer
+	if err := reportLocalKeys(&out, sshDir, KeysLocalOptions{}); err != nil {
+		t.Fatalf("reportLocalKeys() without ~/.ssh error = %v", err)
+	}
+	if !strings.Contains(out.String(), "No keys found") {
+		t.Errorf("output = %q; want no keys reported", out.String())
+	}
+}
+
+func TestReportUnencryptedKeys(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	keys := map[string]string{
+		filepath.Join(sshDir, "id_work"):       "secret",
+		filepath.Join(sshDir, "id_unused"):     "",
+		filepath.Join(tmpDir, "keys", "id_ci"): "",
+	}
+	for path, passphrase := range keys {
+		pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Passphrase: []byte(passphrase)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pair.Write(path, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldConfig := utils.SSHPaths.Config
+	utils.SSHPaths.Config = filepath.Join(sshDir, "config")
+	defer func() { utils.SSHPaths.Config = oldConfig }()
+	writeConfig := func(content string) {
+		if err := os.WriteFile(utils.SSHPaths.Config, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the unused key is unencrypted
+	writeConfig("Host web\n    IdentityFile ~/.ssh/id_work\n")
+	var out bytes.Buffer
+	if err := reportLocalKeys(&out, sshDir, KeysLocalOptions{Unencrypted: true}); err != nil {
+		t.Fatalf("reportLocalKeys() error = %v", err)
+	}
+	if !strings.Contains(out.String(), filepath.Join(sshDir, "id_unused")+" (ssh-ed25519 SHA256:") || !strings.Contains(out.String(), "not used by any host") || strings.Contains(out.String(), "id_work") {
+		t.Errorf("--unencrypted output = %q", out.String())
+	}
+
+	// A host using an unencrypted key outside ~/.ssh fails the check
+	writeConfig("Host web\n    IdentityFile ~/.ssh/id_work\n\nHost ci\n    IdentityFile ~/keys/id_ci\n")
+	out.Reset()
+	err = reportLocalKeys(&out, sshDir, KeysLocalOptions{Unencrypted: true})
+	if err == nil || !strings.Contains(err.Error(), "1 key(s) used by the SSH config") {
+		t.Errorf("reportLocalKeys() error = %v; want the ci key reported", err)
+	}
+	if !strings.Contains(out.String(), filepath.Join(tmpDir, "keys", "id_ci")+" (ssh-ed25519 SHA256:") || !strings.Contains(out.String(), "used by ci") {
+		t.Errorf("--unencrypted output = %q", out.String())
+	}
+
+	// Once every key has a passphrase the check passes
+	os.Remove(filepath.Join(sshDir, "id_unused"))
+	writeConfig("Host web\n    IdentityFile ~/.ssh/id_work\n")
+	out.Reset()
+	if err := reportLocalKeys(&out, sshDir, KeysLocalOptions{Unencrypted: true}); err != nil || !strings.Contains(out.String(), "All private keys are protected") {
+		t.Errorf("reportLocalKeys() = %q, %v", out.String(), err)
+	}
+}
@@ -0,0 +1,96 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/evberrypi/ssh-config/keyformat"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+)
+
+// KeysPassphraseOptions represents the options for changing a key passphrase
+type KeysPassphraseOptions struct {
+	Remove bool
+}
+
+var keysPassphraseOptions KeysPassphraseOptions
+
+var keysPassphraseCmd = &cobra.Command{
+	Use:   "passphrase <file>",
+	Short: "Add, change or remove the passphrase of a private key",
+	Long: `Add, change or remove the passphrase of an OpenSSH private key, like
+ssh-keygen -p. You are asked for the current passphrase if the key has one,
+then for the new passphrase; leave it empty, or use --remove, to store the key
+unencrypted. The key and its comment are unchanged.
+
+Keys in other formats can be converted first with keys convert --to openssh.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if forUser != "" {
+			return fmt.Errorf("keys passphrase does not support --for-user")
+		}
+		return changeKeyPassphrase(cmd.OutOrStdout(), bufio.NewReader(os.Stdin), args[0], keysPassphraseOptions)
+	},
+}
+
+// changeKeyPassphrase re-encrypts the OpenSSH private key at path with a new passphrase
+func changeKeyPassphrase(out io.Writer, reader *bufio.Reader, path string, opts KeysPassphraseOptions) error {
+	path = utils.ExpandUser(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key: %w", err)
+	}
+	key, format, old, err := readKeyFile(reader, path)
+	if err != nil {
+		return err
+	}
+	if key.Private == nil {
+		return fmt.Errorf("%s is a public key; name the private key", path)
+	}
+	if format != keyformat.FormatOpenSSH {
+		return fmt.Errorf("%s is a %s key; convert it with keys convert --to openssh first", path, format)
+	}
+	if opts.Remove && len(old) == 0 {
+		fmt.Fprintf(out, "%s has no passphrase.\n", path)
+		return nil
+	}
+
+	var passphrase []byte
+	if !opts.Remove {
+		if passphrase, err = promptNewPassphrase(reader); err != nil {
+			return err
+		}
+		if len(passphrase) == 0 && len(old) == 0 {
+			fmt.Fprintf(out, "%s has no passphrase; nothing changed.\n", path)
+			return nil
+		}
+	}
+
+	data, err := keyformat.Encode(key, keyformat.FormatOpenSSH, keyformat.EncodeOptions{Passphrase: passphrase})
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	if err := utils.WriteFileAtomic(path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	switch {
+	case len(passphrase) == 0:
+		fmt.Fprintf(out, "Removed the passphrase from %s; the key is now stored unencrypted.\n", path)
+	case len(old) == 0:
+		fmt.Fprintf(out, "Added a passphrase to %s.\n", path)
+	default:
+		fmt.Fprintf(out, "Changed the passphrase of %s.\n", path)
+	}
+	return nil
+}
+
+func init() {
+	KeysCmd.AddCommand(keysPassphraseCmd)
+
+	keysPassphraseCmd.Flags().BoolVar(&keysPassphraseOptions.Remove, "remove", false, "Remove the passphrase without asking for a new one")
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/evberrypi/ssh-config/keyformat"
+	"github.com/evberrypi/ssh-config/sshkeys"
+)
+
+func TestChangeKeyPassphrase(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	// Patch promptPassphrase to answer from a queue
+	var answers []string
+	oldPrompt := promptPassphrase
+	promptPassphrase = func(reader *bufio.Reader, prompt string) ([]byte, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return []byte(answer), nil
+	}
+	defer func() { promptPassphrase = oldPrompt }()
+
+	pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "alice@laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(tmpDir, "id_ed25519")
+	if err := pair.Write(keyPath, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// checkKey decodes the key with passphrase and checks it is unchanged
+	checkKey := func(t *testing.T, passphrase string) {
+		t.Helper()
+		data, err := os.ReadFile(keyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := sshkeys.IsEncrypted(data)
+		if err != nil || encrypted != (passphrase != "") {
+			t.Errorf("IsEncrypted() = %v, %v; want %v", encrypted, err, passphrase != "")
+		}
+		key, _, err := keyformat.Decode(data, func() ([]byte, error) { return []byte(passphrase), nil })
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if !bytes.Equal(key.Public.Marshal(), pair.Public.Marshal()) {
+			t.Error("the key changed")
+		}
+		if key.Comment != "alice@laptop" {
+			t.Errorf("Comment = %q; want alice@laptop", key.Comment)
+		}
+		if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("key mode = %v, %v; want 0600", info, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		answers    []string
+		opts       KeysPassphraseOptions
+		want       string
+		passphrase string
+	}{
+		{"Nothing to remove", nil, KeysPassphraseOptions{Remove: true}, "has no passphrase", ""},
+		{"Nothing to change", []string{"", ""}, KeysPassphraseOptions{}, "nothing changed", ""},
+		{"Add", []string{"first", "first"}, KeysPassphraseOptions{}, "Added a passphrase to " + keyPath, "first"},
+		{"Change", []string{"first", "second", "second"}, KeysPassphraseOptions{}, "Changed the passphrase of " + keyPath, "second"},
+		{"Remove with --remove", []string{"second"}, KeysPassphraseOptions{Remove: true}, "Removed the passphrase from " + keyPath, ""},
+		{"Add again", []string{"third", "third"}, KeysPassphraseOptions{}, "Added a passphrase", "third"},
+		{"Remove with an empty passphrase", []string{"third", "", ""}, KeysPassphraseOptions{}, "Removed the passphrase", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answers = tt.answers
+			var out bytes.Buffer
+			if err := changeKeyPassphrase(&out, nil, keyPath, tt.opts); err != nil {
+				t.Fatalf("changeKeyPassphrase() error = %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output = %q; want %q", out.String(), tt.want)
+			}
+			checkKey(t, tt.passphrase)
+		})
+	}
+
+	answers = []string{"fourth", "fourth"}
+	var out bytes.Buffer
+	if err := changeKeyPassphrase(&out, nil, keyPath, KeysPassphraseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pemPath := filepath.Join(tmpDir, "key.pem")
+	key, err := keyformat.NewKey(mustPrivate(t, keyPath, "fourth"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, err := keyformat.Encode(key, keyformat.FormatPKCS8, keyformat.EncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pemPath, pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := []struct {
+		name    string
+		path    string
+		answers []string
+	}{
+		{"Wrong passphrase", keyPath, []string{"wrong"}},
+		{"Mismatched new passphrase", keyPath, []string{"fourth", "a", "b"}},
+		{"Missing key", keyPath + ".missing", nil},
+		{"Public key", keyPath + ".pub", nil},
+		{"Other format", pemPath, nil},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			answers = tt.answers
+			if err := changeKeyPassphrase(&out, nil, tt.path, KeysPassphraseOptions{}); err == nil {
+				t.Error("changeKeyPassphrase() expected error")
+			}
+		})
+	}
+	checkKey(t, "fourth")
+
+	// Without a .pub the comment is read from the decrypted key
+	if err := os.Remove(keyPath + ".pub"); err != nil {
+		t.Fatal(err)
+	}
+	answers = []string{"fourth", "fifth", "fifth"}
+	if err := changeKeyPassphrase(&out, nil, keyPath, KeysPassphraseOptions{}); err != nil {
+		t.Fatalf("changeKeyPassphrase() without a public key error = %v", err)
+	}
+	checkKey(t, "fifth")
+	answers = []string{"fifth"}
+	if err := changeKeyPassphrase(&out, nil, keyPath, KeysPassphraseOptions{Remove: true}); err != nil {
+		t.Fatalf("changeKeyPassphrase() without a public key error = %v", err)
+	}
+	checkKey(t, "")
+}
+
+// mustPrivate decrypts the private key at path
+func mustPrivate(t *testing.T, path, passphrase string) any {
+	t.Helper()
+	key, err := sshkeys.ReadPrivateKey(path, func(string) ([]byte, error) { return []byte(passphrase), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+)
+
+func TestKeysExpiredAndPrune(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	_, aliceKey := newTestAuthorizedKey(t)
+	_, bobKey := newTestAuthorizedKey(t)
+	_, ownerKey := newTestAuthorizedKey(t)
+
+	keysContent := ownerKey + ` owner
+
+# Keys added from github user alice via ssh-config (expires 2026-10-12T12:00:00Z)
+expiry-time="202610121200" ` + aliceKey + `
+
+# Keys added from gitlab user bob via ssh-config (expires 2026-10-26T12:00:00Z)
+expiry-time="202610261200" ` + bobKey + `
+`
+	keysPath := filepath.Join(tmpDir, "authorized_keys")
+	if err := os.WriteFile(keysPath, []byte(keysContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Patch utils.SSHPaths and the clock
+	oldKeys := utils.SSHPaths.AuthorizedKeys
+	utils.SSHPaths.AuthorizedKeys = keysPath
+	oldNow := nowFunc
+	nowFunc = func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local) }
+	defer func() {
+		utils.SSHPaths.AuthorizedKeys = oldKeys
+		nowFunc = oldNow
+	}()
+
+	var buf bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&buf)
+
+	if err := keysExpiredCmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("keys expired error = %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "github:alice ssh-ed25519 SHA256:") || !strings.Contains(output, "expired 2026-10-12 12:00") {
+		t.Errorf("keys expired output = %q; want alice's grant", output)
+	}
+	if strings.Contains(output, "bob") {
+		t.Errorf("keys expired output = %q; want bob's grant omitted", output)
+	}
+
+	buf.Reset()
+	if err := keysPruneCmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("keys prune error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "Removed 1 expired key(s).") {
+		t.Errorf("keys prune output = %q", buf.String())
+	}
+
+	content, err := os.ReadFile(keysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "alice") || strings.Contains(string(content), aliceKey) {
+		t.Errorf("authorized_keys = %q; want alice's grant removed", content)
+	}
+	if !strings.Contains(string(content), bobKey) || !strings.Contains(string(content), ownerKey) {
+		t.Errorf("authorized_keys = %q; want remaining keys kept", content)
+	}
+
+	info, err := os.Stat(keysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("authorized_keys permissions = %v; want 0600", info.Mode().Perm())
+	}
+
+	buf.Reset()
+	if err := keysExpiredCmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("keys expired error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "No expired keys found.") {
+		t.Errorf("keys expired output = %q; want no expired keys", buf.String())
+	}
+}
@@ -0,0 +1,226 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/krl"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// KRLOptions represents the options for creating and updating revocation lists
+type KRLOptions struct {
+	Comment string
+	CA      string
+	Serials []string
+	KeyIDs  []string
+	Force   bool
+}
+
+var krlOptions KRLOptions
+
+// KRLCmd represents the Cobra command for managing key revocation lists.
+var KRLCmd = &cobra.Command{
+	Use:   "krl",
+	Short: "Create and check key revocation lists",
+	Long: `Create, update and check OpenSSH key revocation lists (KRLs).
+
+A KRL revokes keys everywhere it is installed: point sshd's RevokedKeys option
+at it to refuse logins, or list it in ssh_config's RevokedHostKeys. Keys can be
+revoked by public key file, by SHA256 fingerprint, or for certificates by
+serial number or key ID with --ca.
+
+By default imports from GitHub and GitLab skip keys revoked in ` + utils.DefaultRevokedKeysPath + `.`,
+}
+
+var krlCreateCmd = &cobra.Command{
+	Use:   "create <krl> [key.pub|SHA256:fingerprint...]",
+	Short: "Create a revocation list",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !krlOptions.Force {
+			if _, err := os.Stat(utils.ExpandUser(args[0])); err == nil {
+				return fmt.Errorf("%s already exists, use krl add to update it or --force to replace it", args[0])
+			}
+		}
+		list := &krl.KRL{}
+		return updateKRL(cmd.OutOrStdout(), args[0], list, args[1:], krlOptions)
+	},
+}
+
+var krlAddCmd = &cobra.Command{
+	Use:   "add <krl> [key.pub|SHA256:fingerprint...]",
+	Short: "Revoke more keys in an existing revocation list",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := krl.Load(args[0])
+		if err != nil {
+			return err
+		}
+		return updateKRL(cmd.OutOrStdout(), args[0], list, args[1:], krlOptions)
+	},
+}
+
+var krlCheckCmd = &cobra.Command{
+	Use:   "check <krl> <key.pub...>",
+	Short: "Check whether keys are revoked",
+	Long: `Check keys and certificates against a revocation list, like ssh-keygen -Q.
+Exits with an error when any of the keys is revoked.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := krl.Load(args[0])
+		if err != nil {
+			return err
+		}
+		return checkKRL(cmd.OutOrStdout(), list, args[1:])
+	},
+}
+
+// updateKRL revokes refs and the certificates described by opts in list and
+// writes it to path with a new version
+func updateKRL(out io.Writer, path string, list *krl.KRL, refs []string, opts KRLOptions) error {
+	if len(refs) == 0 && len(opts.Serials) == 0 && len(opts.KeyIDs) == 0 {
+		return fmt.Errorf("nothing to revoke: give keys, fingerprints, --serial or --id")
+	}
+
+	var ca ssh.PublicKey
+	if opts.CA != "" {
+		key, _, err := loadCAKey(opts.CA)
+		if err != nil {
+			return err
+		}
+		ca = key
+	} else if len(opts.Serials) > 0 {
+		return fmt.Errorf("--serial requires --ca; serials are only unique per CA")
+	}
+
+	for _, ref := range refs {
+		if strings.HasPrefix(ref, "SHA256:") || strings.HasPrefix(ref, "SHA1:") {
+			if err := list.RevokeFingerprint(ref); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Revoked %s\n", ref)
+			continue
+		}
+		keys, err := sshkeys.ReadPublicKeys(ref)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			list.RevokeKey(key)
+			fmt.Fprintf(out, "Revoked %s\n", describeRevokedKey(key))
+		}
+	}
+	for _, serials := range opts.Serials {
+		min, max, err := krl.ParseSerials(serials)
+		if err != nil {
+			return err
+		}
+		list.RevokeSerials(ca, min, max)
+		fmt.Fprintf(out, "Revoked certificates with serial %s signed by %s\n", serials, ssh.FingerprintSHA256(ca))
+	}
+	for _, id := range opts.KeyIDs {
+		list.RevokeKeyID(ca, id)
+		if ca != nil {
+			fmt.Fprintf(out, "Revoked certificates with key ID %q signed by %s\n", id, ssh.FingerprintSHA256(ca))
+		} else {
+			fmt.Fprintf(out, "Revoked certificates with key ID %q signed by any CA\n", id)
+		}
+	}
+
+	list.Version++
+	list.Generated = time.Now()
+	if opts.Comment != "" {
+		list.Comment = opts.Comment
+	}
+	if err := list.Write(path); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %s (version %d)\n", path, list.Version)
+	return nil
+}
+
+// describeRevokedKey names a key by fingerprint, or a certificate by serial and key ID
+func describeRevokedKey(key ssh.PublicKey) string {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return fmt.Sprintf("certificate serial %d %q signed by %s", cert.Serial, cert.KeyId, ssh.FingerprintSHA256(cert.SignatureKey))
+	}
+	return ssh.FingerprintSHA256(key)
+}
+
+// checkKRL reports whether each key in the files at paths is revoked
+func checkKRL(out io.Writer, list *krl.KRL, paths []string) error {
+	revoked := 0
+	for _, path := range paths {
+		keys, err := sshkeys.ReadPublicKeys(path)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if list.IsRevoked(key) {
+				fmt.Fprintf(out, "%s: REVOKED %s\n", path, describeRevokedKey(key))
+				revoked++
+			} else {
+				fmt.Fprintf(out, "%s: ok %s\n", path, describeRevokedKey(key))
+			}
+		}
+	}
+	if revoked > 0 {
+		return fmt.Errorf("%d key(s) are revoked", revoked)
+	}
+	return nil
+}
+
+// loadRevokedKeys loads the revocation list at path, or the default list
+// when path is empty. A missing default list means nothing is revoked, but a
+// list that was asked for must be readable.
+func loadRevokedKeys(path string) (*krl.KRL, error) {
+	if path != "" {
+		return krl.Load(path)
+	}
+	list, err := krl.Load(utils.SSHPaths.RevokedKeys)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return list, err
+}
+
+// withoutRevokedKeys drops the lines of keys holding a key revoked in list
+// and returns the fingerprints of the keys that were dropped
+func withoutRevokedKeys(keys []byte, list *krl.KRL) ([]byte, []string) {
+	if list == nil {
+		return keys, nil
+	}
+	var kept []string
+	var revoked []string
+	for _, line := range strings.Split(string(keys), "\n") {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err == nil && list.IsRevoked(key) {
+			revoked = append(revoked, ssh.FingerprintSHA256(key))
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return []byte(strings.Join(kept, "\n")), revoked
+}
+
+func init() {
+	KRLCmd.AddCommand(krlCreateCmd, krlAddCmd, krlCheckCmd)
+
+	for _, c := range []*cobra.Command{krlCreateCmd, krlAddCmd} {
+		c.Flags().StringVar(&krlOptions.Comment, "comment", "", "Comment stored in the revocation list")
+		c.Flags().StringVar(&krlOptions.CA, "ca", "", "Public key of the CA whose certificates --serial and --id revoke")
+		c.Flags().StringSliceVar(&krlOptions.Serials, "serial", nil, "Revoke certificates by serial number or range such as 100-200 (repeatable)")
+		c.Flags().StringArrayVar(&krlOptions.KeyIDs, "id", nil, "Revoke certificates by key ID (repeatable)")
+	}
+	krlCreateCmd.Flags().BoolVar(&krlOptions.Force, "force", false, "Replace an existing revocation list")
+}
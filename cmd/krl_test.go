@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/krl"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKRLCommands(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	writeKey := func(name string) (*sshkeys.KeyPair, string) {
+		pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(tmpDir, name)
+		if err := pair.Write(path, false); err != nil {
+			t.Fatal(err)
+		}
+		return pair, path
+	}
+	laptop, laptopPath := writeKey("laptop")
+	_, desktopPath := writeKey("desktop")
+	_, phonePath := writeKey("phone")
+	caPair, caPath := writeKey("ca")
+	_, certKeyPath := writeKey("contractor")
+
+	caSigner, err := ssh.ParsePrivateKey(caPair.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certKey, _, err := sshkeys.LoadPublicKey(certKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := sshkeys.SignCertificate(caSigner, certKey, sshkeys.SignOptions{KeyID: "contractor", Principals: []string{"deploy"}, Serial: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sshkeys.WriteCertificate(sshkeys.CertificatePath(certKeyPath), cert, ""); err != nil {
+		t.Fatal(err)
+	}
+	phone, _, err := sshkeys.LoadPublicKey(phonePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	krlPath := filepath.Join(tmpDir, "revoked_keys")
+	var buf bytes.Buffer
+
+	if err := updateKRL(&buf, krlPath, &krl.KRL{}, nil, KRLOptions{}); err == nil {
+		t.Error("updateKRL() expected error with nothing to revoke")
+	}
+	if err := updateKRL(&buf, krlPath, &krl.KRL{}, nil, KRLOptions{Serials: []string{"1-5"}}); err == nil {
+		t.Error("updateKRL() expected error for --serial without --ca")
+	}
+
+	krlOptions = KRLOptions{Comment: "lost laptop"}
+	defer func() { krlOptions = KRLOptions{} }()
+	krlCreateCmd.SetOut(&buf)
+	if err := krlCreateCmd.RunE(krlCreateCmd, []string{krlPath, laptopPath + ".pub"}); err != nil {
+		t.Fatalf("krl create error = %v", err)
+	}
+	if err := krlCreateCmd.RunE(krlCreateCmd, []string{krlPath, laptopPath}); err == nil {
+		t.Error("krl create expected error for an existing list without --force")
+	}
+
+	krlOptions = KRLOptions{CA: caPath + ".pub", Serials: []string{"5-9"}}
+	krlAddCmd.SetOut(&buf)
+	if err := krlAddCmd.RunE(krlAddCmd, []string{krlPath, ssh.FingerprintSHA256(phone)}); err != nil {
+		t.Fatalf("krl add error = %v", err)
+	}
+
+	list, err := krl.Load(krlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Version != 2 || list.Comment != "lost laptop" {
+		t.Errorf("version %d comment %q; want version 2 and the comment kept", list.Version, list.Comment)
+	}
+	if !list.IsRevoked(laptop.Public) || !list.IsRevoked(phone) || !list.IsRevoked(cert) {
+		t.Error("expected laptop, phone and certificate to be revoked")
+	}
+
+	buf.Reset()
+	if err := checkKRL(&buf, list, []string{desktopPath + ".pub"}); err != nil {
+		t.Errorf("checkKRL() error = %v for a key that is not revoked", err)
+	}
+	if !strings.Contains(buf.String(), "ok SHA256:") {
+		t.Errorf("check output = %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := checkKRL(&buf, list, []string{desktopPath, laptopPath, sshkeys.CertificatePath(certKeyPath)}); err == nil {
+		t.Error("checkKRL() expected error for revoked keys")
+	}
+	if got := strings.Count(buf.String(), "REVOKED"); got != 2 {
+		t.Errorf("check output = %q; want 2 revoked", buf.String())
+	}
+	if !strings.Contains(buf.String(), `certificate serial 7 "contractor"`) {
+		t.Errorf("check output = %q; want the certificate described", buf.String())
+	}
+}
+
+func TestAddServiceKeyRevoked(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	revokedKey, revokedLine := newTestAuthorizedKey(t)
+	_, keptLine := newTestAuthorizedKey(t)
+	served := revokedLine + " lost-laptop\n" + keptLine + " desktop\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, served)
+	}))
+	defer ts.Close()
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{"github": ts.URL + "/%s.keys"}
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.AuthorizedKeys = filepath.Join(tmpDir, ".ssh", "authorized_keys")
+	utils.SSHPaths.RevokedKeys = filepath.Join(tmpDir, ".ssh", "revoked_keys")
+	defer func() {
+		utils.ServiceURLs = oldURLs
+		utils.SSHPaths = oldPaths
+		keyOptions = KeyOptions{}
+	}()
+	if err := utils.EnsureSSHDirectory(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An explicit list must exist
+	keyOptions = KeyOptions{RevokedKeys: filepath.Join(tmpDir, "missing.krl")}
+	if err := addServiceKey("github", "alice"); err == nil {
+		t.Error("addServiceKey() expected error for a missing --revoked-keys list")
+	}
+	keyOptions = KeyOptions{}
+
+	list := &krl.KRL{}
+	list.RevokeKey(revokedKey)
+	if err := list.Write(utils.SSHPaths.RevokedKeys); err != nil {
+		t.Fatal(err)
+	}
+	if err := addServiceKey("github", "alice"); err != nil {
+		t.Fatalf("addServiceKey() error = %v", err)
+	}
+	content, err := os.ReadFile(utils.SSHPaths.AuthorizedKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), revokedLine) {
+		t.Error("revoked key was imported")
+	}
+	if !strings.Contains(string(content), keptLine) {
+		t.Error("key that is not revoked was not imported")
+	}
+
+	served = revokedLine + "\n"
+	if err := addServiceKey("github", "alice"); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("addServiceKey() error = %v; want every key revoked", err)
+	}
+}
+
+func TestAuthorizedKeysCommandRevoked(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	revokedKey, revokedLine := newTestAuthorizedKey(t)
+	_, keptLine := newTestAuthorizedKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, revokedLine+"\n"+keptLine+"\n")
+	}))
+	defer ts.Close()
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{"github": ts.URL + "/%s.keys"}
+	defer func() { utils.ServiceURLs = oldURLs }()
+
+	mapPath := filepath.Join(tmpDir, "users")
+	if err := os.WriteFile(mapPath, []byte("deploy github:alice\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	krlPath := filepath.Join(tmpDir, "revoked.krl")
+	list := &krl.KRL{}
+	list.RevokeKey(revokedKey)
+	if err := list.Write(krlPath); err != nil {
+		t.Fatal(err)
+	}
+
+	oldOptions := authorizedKeysCommandOptions
+	authorizedKeysCommandOptions = AuthorizedKeysCommandOptions{
+		MapPath:     mapPath,
+		CacheDir:    filepath.Join(tmpDir, "cache"),
+		Timeout:     5 * time.Second,
+		RevokedKeys: krlPath,
+	}
+	defer func() { authorizedKeysCommandOptions = oldOptions }()
+
+	var stdout, stderr bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	if err := runAuthorizedKeysCommand(cmd, []string{"deploy"}); err != nil {
+		t.Fatalf("runAuthorizedKeysCommand() error = %v", err)
+	}
+	if stdout.String() != keptLine+" github:alice\n" {
+		t.Errorf("stdout = %q; want only the key that is not revoked", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "skipping revoked key "+ssh.FingerprintSHA256(revokedKey)) {
+		t.Errorf("stderr = %q; want revoked key diagnostic", stderr.String())
+	}
+
+	// An unreadable list prints nothing
+	stdout.Reset()
+	authorizedKeysCommandOptions.RevokedKeys = filepath.Join(tmpDir, "missing.krl")
+	if err := runAuthorizedKeysCommand(cmd, []string{"deploy"}); err == nil {
+		t.Error("runAuthorizedKeysCommand() expected error for a missing revocation list")
+	}
+	if stdout.String() != "" {
+		t.Errorf("stdout = %q; want no keys", stdout.String())
+	}
+}
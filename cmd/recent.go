@@ -0,0 +1,155 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/evberrypi/ssh-config/history"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+)
+
+// RecentOptions represents the options for listing recently used hosts
+type RecentOptions struct {
+	Limit int
+	// StaleAfter is the number of months after which an unused host is
+	// flagged, 0 to flag none
+	StaleAfter int
+}
+
+var recentOptions = RecentOptions{Limit: 20, StaleAfter: 6}
+
+// RecentCmd represents the Cobra command for listing the hosts used most.
+var RecentCmd = &cobra.Command{
+	Use:   "recent",
+	Short: "List the hosts you connect to most and those left unused",
+	Long: `List the hosts you connected to with 'ssh-config connect', ranked by
+frecency: how often you use each host, weighted towards the last hour, day
+and week. The connect picker uses the same ranking.
+
+Hosts in ~/.ssh/config that have not been used for --stale-after months are
+listed as candidates for cleanup, including hosts never connected to since
+the history began.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listRecent(cmd.OutOrStdout(), recentOptions)
+	},
+}
+
+// listRecent prints the ranked history and the hosts unused for opts.StaleAfter months
+func listRecent(out io.Writer, opts RecentOptions) error {
+	if opts.Limit < 0 {
+		return fmt.Errorf("--limit must not be negative")
+	}
+	if opts.StaleAfter < 0 {
+		return fmt.Errorf("--stale-after must not be negative")
+	}
+
+	h, err := readHistory()
+	if err != nil {
+		return err
+	}
+	now := nowFunc()
+	ranked := h.Ranked(now)
+	if len(ranked) == 0 {
+		fmt.Fprintln(out, "No connections recorded yet; hosts are recorded when you use 'ssh-config connect'.")
+	} else {
+		if opts.Limit > 0 && len(ranked) > opts.Limit {
+			ranked = ranked[:opts.Limit]
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "HOST\tCONNECTIONS\tLAST USED")
+		for _, e := range ranked {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", e.Host, e.Count, timeAgo(now, e.Last))
+		}
+		w.Flush()
+	}
+
+	if opts.StaleAfter == 0 {
+		return nil
+	}
+	cfg, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+	cutoff := now.AddDate(0, -opts.StaleAfter, 0)
+	var stale [][2]string
+	for _, host := range cfg.Hosts() {
+		e := h.Get(host)
+		switch {
+		case e != nil && e.Last.Before(cutoff):
+			stale = append(stale, [2]string{host, "last used " + timeAgo(now, e.Last)})
+		case e == nil && !h.Since.IsZero() && h.Since.Before(cutoff):
+			stale = append(stale, [2]string{host, "never used since " + h.Since.Local().Format("2006-01-02")})
+		}
+	}
+	if len(stale) > 0 {
+		fmt.Fprintf(out, "\nNot used in %d months, candidates for cleanup:\n", opts.StaleAfter)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, host := range stale {
+			fmt.Fprintf(w, "  %s\t%s\n", host[0], host[1])
+		}
+		w.Flush()
+	}
+	return nil
+}
+
+// timeAgo describes how long before now t was, such as "3 days ago"
+func timeAgo(now, t time.Time) string {
+	age := now.Sub(t)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return plural(int(age/time.Minute), "minute")
+	case age < 24*time.Hour:
+		return plural(int(age/time.Hour), "hour")
+	case age < 60*24*time.Hour:
+		return plural(int(age/(24*time.Hour)), "day")
+	default:
+		return plural(int(age/(30*24*time.Hour)), "month")
+	}
+}
+
+// readHistory reads the history of connected hosts, which is empty if the
+// file does not exist yet
+func readHistory() (*history.History, error) {
+	content, err := os.ReadFile(utils.ExpandUser(utils.SSHPaths.History))
+	if os.IsNotExist(err) {
+		return &history.History{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	return history.Parse(content), nil
+}
+
+// recordConnection adds a connection to host to the history
+func recordConnection(host string) error {
+	h, err := readHistory()
+	if err != nil {
+		return err
+	}
+	h.Record(host, nowFunc())
+
+	path := utils.ExpandUser(utils.SSHPaths.History)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return utils.WriteFileAtomic(path, h.Bytes(), 0600)
+}
+
+func init() {
+	RecentCmd.Flags().IntVarP(&recentOptions.Limit, "limit", "n", recentOptions.Limit, "Number of hosts to list, 0 for all")
+	RecentCmd.Flags().IntVar(&recentOptions.StaleAfter, "stale-after", recentOptions.StaleAfter, "Flag hosts in the SSH config unused for this many months, 0 to flag none")
+}
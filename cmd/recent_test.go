@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/history"
+	"github.com/evberrypi/ssh-config/utils"
+)
+
+func TestListRecent(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := "Host web\n    HostName 10.0.0.1\n\nHost db\n    HostName 10.0.0.2\n\nHost legacy\n    HostName 10.0.0.3\n\nHost unused\n    HostName 10.0.0.4\n\nHost *\n    User deploy\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "config"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.Config = filepath.Join(tmpDir, "config")
+	utils.SSHPaths.History = filepath.Join(tmpDir, "state", "history")
+	defer func() { utils.SSHPaths = oldPaths }()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	oldNow := nowFunc
+	defer func() { nowFunc = oldNow }()
+
+	// Nothing recorded yet
+	nowFunc = func() time.Time { return now }
+	var out bytes.Buffer
+	if err := listRecent(&out, RecentOptions{Limit: 20, StaleAfter: 6}); err != nil {
+		t.Fatalf("listRecent() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "No connections recorded yet") || strings.Contains(out.String(), "cleanup") {
+		t.Errorf("output = %q; want an empty history and nothing flagged", out.String())
+	}
+
+	// legacy was used long ago, unused never; a host since removed from
+	// the config stays in the history
+	for _, conn := range []struct {
+		host string
+		at   time.Time
+	}{
+		{"legacy", now.AddDate(-1, 0, 0)},
+		{"legacy", now.AddDate(-1, 0, 0)},
+		{"legacy", now.AddDate(0, -8, 0)},
+		{"removed", now.AddDate(0, -7, 0)},
+		{"db", now.AddDate(0, 0, -3)},
+		{"web", now.Add(-5 * time.Minute)},
+	} {
+		nowFunc = func() time.Time { return conn.at }
+		if err := recordConnection(conn.host); err != nil {
+			t.Fatalf("recordConnection() error = %v", err)
+		}
+	}
+	nowFunc = func() time.Time { return now }
+	if info, err := os.Stat(utils.SSHPaths.History); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("history file mode = %v (%v); want 0600", info.Mode().Perm(), err)
+	}
+
+	out.Reset()
+	if err := listRecent(&out, RecentOptions{Limit: 20, StaleAfter: 6}); err != nil {
+		t.Fatalf("listRecent() error = %v", err)
+	}
+	want := []string{
+		"HOST     CONNECTIONS  LAST USED",
+		"web      1            5 minutes ago",
+		"legacy   3            8 months ago",
+		"db       1            3 days ago",
+		"removed  1            7 months ago",
+		"",
+		"Not used in 6 months, candidates for cleanup:",
+		"  legacy  last used 8 months ago",
+		"  unused  never used since " + now.AddDate(-1, 0, 0).Local().Format("2006-01-02"),
+	}
+	if got := strings.TrimSuffix(out.String(), "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("listRecent() =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+
+	// A limit shortens the ranking, and a longer period flags fewer hosts
+	out.Reset()
+	if err := listRecent(&out, RecentOptions{Limit: 1, StaleAfter: 10}); err != nil {
+		t.Fatalf("listRecent() error = %v", err)
+	}
+	if strings.Contains(out.String(), "db ") || strings.Contains(out.String(), "legacy") || !strings.Contains(out.String(), "unused") {
+		t.Errorf("output = %q; want only web listed and unused flagged", out.String())
+	}
+
+	// --stale-after 0 flags nothing
+	out.Reset()
+	if err := listRecent(&out, RecentOptions{StaleAfter: 0}); err != nil {
+		t.Fatalf("listRecent() error = %v", err)
+	}
+	if strings.Contains(out.String(), "cleanup") || !strings.Contains(out.String(), "removed") {
+		t.Errorf("output = %q; want every host and nothing flagged", out.String())
+	}
+
+	// The history file can be read back
+	content, err := os.ReadFile(utils.SSHPaths.History)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := history.Parse(content); len(h.Entries) != 4 || !h.Since.Equal(now.AddDate(-1, 0, 0)) {
+		t.Errorf("history = %+v; want 4 hosts since the first connection", h)
+	}
+
+	for _, opts := range []RecentOptions{{Limit: -1}, {StaleAfter: -1}} {
+		if err := listRecent(&bytes.Buffer{}, opts); err == nil {
+			t.Errorf("listRecent(%+v) expected error", opts)
+		}
+	}
+}
+
+func TestTimeAgo(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{10 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{45 * time.Minute, "45 minutes ago"},
+		{3 * time.Hour, "3 hours ago"},
+		{24 * time.Hour, "1 day ago"},
+		{40 * 24 * time.Hour, "40 days ago"},
+		{200 * 24 * time.Hour, "6 months ago"},
+	}
+	for _, tt := range tests {
+		if got := timeAgo(now, now.Add(-tt.age)); got != tt.want {
+			t.Errorf("timeAgo(%v) = %q; want %q", tt.age, got, tt.want)
+		}
+	}
+}
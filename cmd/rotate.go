@@ -0,0 +1,461 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/remote"
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultArchiveDir is where rotated keys are moved once they are replaced
+const defaultArchiveDir = "~/.ssh/archive"
+
+// RotateOptions represents the options for rotating the key of a host
+type RotateOptions struct {
+	Key          string
+	File         string
+	Type         string
+	Bits         int
+	Comment      string
+	NoPassphrase bool
+	Timeout      time.Duration
+}
+
+var rotateOptions = RotateOptions{Timeout: 30 * time.Second}
+
+// dialRemote logs in over an established connection; tests replace it to
+// inject failures
+var dialRemote = remote.NewClient
+
+// RotateCmd represents the Cobra command for replacing the key used for a host.
+var RotateCmd = &cobra.Command{
+	Use:   "rotate <host>",
+	Short: "Replace the key used for a host with a new one",
+	Long: `Replace the key a configured host logs in with. rotate:
+
+  1. generates a new key pair
+  2. logs in with the current key and adds the new key to the remote
+     ~/.ssh/authorized_keys
+  3. logs in again with the new key to prove it works
+  4. points the IdentityFile of the host's Host block at the new key
+  5. removes the current key from the remote authorized_keys
+  6. moves the current key to ` + defaultArchiveDir + `, unless other hosts use it
+
+If any step fails, the steps already taken are undone: the remote
+authorized_keys and the config are restored and the new key is deleted.
+
+The server's host key must already be in known_hosts; see hosts scan. The
+current key is the first IdentityFile of the host that exists, or --key.
+The new key is written to ~/.ssh/id_<type>_<host> unless --file is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rotateKey(cmd.OutOrStdout(), bufio.NewReader(os.Stdin), args[0], rotateOptions)
+	},
+}
+
+// rotation undoes the completed steps of a key rotation when a later one
+// fails. It keeps its connections open until then, since undoing remote
+// changes needs the login that made them.
+type rotation struct {
+	out     io.Writer
+	undo    []rotationStep
+	clients []*remote.Client
+}
+
+// rotationStep reverts one change
+type rotationStep struct {
+	description string
+	revert      func() error
+}
+
+// onRollback registers revert to run if the rotation fails
+func (r *rotation) onRollback(description string, revert func() error) {
+	r.undo = append(r.undo, rotationStep{description, revert})
+}
+
+// close closes the connections of the rotation
+func (r *rotation) close() {
+	for _, client := range r.clients {
+		client.Close()
+	}
+}
+
+// rollback reverts the completed steps in reverse order and returns cause
+// annotated with whether every change could be undone
+func (r *rotation) rollback(cause error) error {
+	if len(r.undo) == 0 {
+		return cause
+	}
+	fmt.Fprintf(r.out, "Rotation failed: %v\nRolling back:\n", cause)
+	failed := 0
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		step := r.undo[i]
+		if err := step.revert(); err != nil {
+			failed++
+			fmt.Fprintf(r.out, "  FAILED to %s: %v\n", step.description, err)
+			continue
+		}
+		fmt.Fprintf(r.out, "  %s\n", step.description)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w; %d rollback step(s) failed, see above", cause, failed)
+	}
+	return fmt.Errorf("%w; all changes were rolled back", cause)
+}
+
+// rotateKey replaces the key used for host as described by opts
+func rotateKey(out io.Writer, reader *bufio.Reader, host string, opts RotateOptions) error {
+	cfg, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+	block := hostBlock(cfg, host)
+	if block == nil {
+		return fmt.Errorf("no Host block names %s in the SSH config", host)
+	}
+	resolved := cfg.Resolve(host)
+
+	oldPath, err := currentIdentity(resolved, opts.Key)
+	if err != nil {
+		return err
+	}
+	oldPub, _, err := sshkeys.LoadPublicKey(oldPath)
+	if err != nil {
+		return err
+	}
+
+	if opts.Type == "" {
+		opts.Type = sshkeys.KeyTypeEd25519
+	}
+	newPath := opts.File
+	if newPath == "" {
+		if newPath, err = rotatedKeyPath(opts.Type, host); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(utils.ExpandUser(newPath)); err == nil {
+		return fmt.Errorf("%s already exists; choose another path with --file", newPath)
+	}
+
+	t := newHostTarget(resolved, resolved.Port())
+	callback, algorithms, err := hostKeyVerifier(t)
+	if err != nil {
+		return err
+	}
+
+	return withSigner(reader, oldPath, func(oldSigner ssh.Signer) error {
+		var passphrase []byte
+		if !opts.NoPassphrase {
+			if passphrase, err = promptNewPassphrase(reader); err != nil {
+				return err
+			}
+		}
+		comment := opts.Comment
+		if comment == "" {
+			comment = sshkeys.DefaultComment()
+		}
+		pair, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: opts.Type, Bits: opts.Bits, Comment: comment, Passphrase: passphrase})
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		var newSigner ssh.Signer
+		if len(passphrase) > 0 {
+			newSigner, err = ssh.ParsePrivateKeyWithPassphrase(pair.Private, passphrase)
+		} else {
+			newSigner, err = ssh.ParsePrivateKey(pair.Private)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load new key: %w", err)
+		}
+
+		target := remote.Target{
+			Addr:              t.Addr,
+			User:              resolved.User(),
+			HostKeyCallback:   callback,
+			HostKeyAlgorithms: algorithms,
+		}
+		r := &rotation{out: out}
+		defer r.close()
+		if err := r.run(cfg, block, host, target, rotationKeys{
+			oldPath:   oldPath,
+			oldPub:    oldPub,
+			oldSigner: oldSigner,
+			newPath:   newPath,
+			newPair:   pair,
+			newSigner: newSigner,
+		}, opts.Timeout); err != nil {
+			return r.rollback(err)
+		}
+		return nil
+	})
+}
+
+// rotationKeys are the keys a rotation replaces and installs
+type rotationKeys struct {
+	oldPath   string
+	oldPub    ssh.PublicKey
+	oldSigner ssh.Signer
+	// newPath is the new key path as written to the config, possibly with ~
+	newPath   string
+	newPair   *sshkeys.KeyPair
+	newSigner ssh.Signer
+}
+
+// run performs the rotation steps, registering how to undo each one
+func (r *rotation) run(cfg *sshconfig.Config, block *sshconfig.Block, host string, target remote.Target, keys rotationKeys, timeout time.Duration) error {
+	dial := func(signer ssh.Signer) (*remote.Client, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		t := target
+		t.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+		client, err := dialTarget(ctx, cfg, resolvedProxyJump(cfg.Resolve(host)), t)
+		if err == nil {
+			r.clients = append(r.clients, client)
+		}
+		return client, err
+	}
+
+	fmt.Fprintf(r.out, "Logging in to %s as %s with %s\n", target.Addr, target.User, keys.oldPath)
+	oldClient, err := dial(keys.oldSigner)
+	if err != nil {
+		return err
+	}
+
+	original, err := oldClient.ReadAuthorizedKeys()
+	if err != nil {
+		return err
+	}
+	file := authkeys.Parse(original)
+	file.Append(strings.TrimSpace(string(keys.newPair.AuthorizedKey())))
+	if err := oldClient.WriteAuthorizedKeys(file.Bytes()); err != nil {
+		return err
+	}
+	r.onRollback("restore the remote authorized_keys", func() error {
+		return oldClient.WriteAuthorizedKeys(original)
+	})
+	fmt.Fprintf(r.out, "Installed the new key %s on %s\n", ssh.FingerprintSHA256(keys.newPair.Public), host)
+
+	newClient, err := dial(keys.newSigner)
+	if err != nil {
+		return fmt.Errorf("the new key does not work: %w", err)
+	}
+	if _, err := newClient.Run("true", nil); err != nil {
+		return fmt.Errorf("the new key does not work: %w", err)
+	}
+	fmt.Fprintf(r.out, "Logged in with the new key\n")
+
+	newPath := utils.ExpandUser(keys.newPath)
+	if err := keys.newPair.Write(newPath, false); err != nil {
+		return err
+	}
+	r.onRollback("delete the new key "+newPath, func() error {
+		if err := os.Remove(newPath); err != nil {
+			return err
+		}
+		return os.Remove(newPath + ".pub")
+	})
+	fmt.Fprintf(r.out, "Saved the new key in %s\n", newPath)
+
+	if err := r.setIdentityFile(block, keys.oldPath, keys.newPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "Set the IdentityFile of %s to %s\n", host, keys.newPath)
+
+	current, err := newClient.ReadAuthorizedKeys()
+	if err != nil {
+		return err
+	}
+	file = authkeys.Parse(current)
+	removed := file.Remove(func(line *authkeys.Line) bool {
+		key, err := line.Entry.PublicKey()
+		return err == nil && bytes.Equal(key.Marshal(), keys.oldPub.Marshal())
+	})
+	if removed > 0 {
+		if err := newClient.WriteAuthorizedKeys(file.Bytes()); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "Removed the old key %s from %s\n", ssh.FingerprintSHA256(keys.oldPub), host)
+	} else {
+		fmt.Fprintf(r.out, "The old key %s was not listed in the remote authorized_keys\n", ssh.FingerprintSHA256(keys.oldPub))
+	}
+
+	if users := otherIdentityUsers(cfg, host, keys.oldPath); len(users) > 0 {
+		fmt.Fprintf(r.out, "Kept %s: it is still used by %s\n", keys.oldPath, strings.Join(users, ", "))
+		return nil
+	}
+	return r.archiveKey(keys.oldPath)
+}
+
+// setIdentityFile points the IdentityFile of block that selects oldPath at
+// newPath, or adds an IdentityFile line to block when the old key came from
+// another block or from ssh's defaults
+func (r *rotation) setIdentityFile(block *sshconfig.Block, oldPath, newPath string) error {
+	path := block.File
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config: %w", err)
+	}
+
+	lines := strings.SplitAfter(string(previous), "\n")
+	value := newPath
+	if strings.ContainsAny(value, " \t") {
+		value = `"` + value + `"`
+	}
+
+	replaced := false
+	for _, opt := range block.Options {
+		if !strings.EqualFold(opt.Keyword, "IdentityFile") || opt.File != path || opt.Line > len(lines) {
+			continue
+		}
+		if filepath.Clean(utils.ExpandUser(opt.Value())) != filepath.Clean(oldPath) {
+			continue
+		}
+		line := lines[opt.Line-1]
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		lines[opt.Line-1] = indent + opt.Keyword + " " + value + "\n"
+		replaced = true
+		break
+	}
+	if !replaced {
+		if block.Line > len(lines) {
+			return fmt.Errorf("failed to update SSH config: Host %s is not at line %d of %s", strings.Join(block.Patterns, " "), block.Line, path)
+		}
+		indent := "    "
+		if len(block.Options) > 0 && block.Options[0].File == path && block.Options[0].Line <= len(lines) {
+			first := lines[block.Options[0].Line-1]
+			indent = first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+		}
+		if !strings.HasSuffix(lines[block.Line-1], "\n") {
+			lines[block.Line-1] += "\n"
+		}
+		lines = append(lines[:block.Line], append([]string{indent + "IdentityFile " + value + "\n"}, lines[block.Line:]...)...)
+	}
+
+	if err := utils.WriteFileAtomic(path, []byte(strings.Join(lines, "")), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write SSH config: %w", err)
+	}
+	r.onRollback("restore "+path, func() error {
+		return utils.WriteFileAtomic(path, previous, info.Mode().Perm())
+	})
+	return nil
+}
+
+// archiveKey moves the key pair at path into the archive directory with a
+// timestamp, so it can be restored if something still needs it
+func (r *rotation) archiveKey(path string) error {
+	dir := utils.ExpandUser(defaultArchiveDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	archived := filepath.Join(dir, filepath.Base(path)+"."+nowFunc().Format("20060102-150405"))
+
+	var moved [][2]string
+	for _, suffix := range []string{"", ".pub", "-cert.pub"} {
+		from, to := path+suffix, archived+suffix
+		if _, err := os.Stat(from); os.IsNotExist(err) && suffix != "" {
+			continue
+		}
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", from, err)
+		}
+		pair := [2]string{from, to}
+		moved = append(moved, pair)
+		r.onRollback("restore "+from, func() error {
+			return os.Rename(pair[1], pair[0])
+		})
+	}
+	fmt.Fprintf(r.out, "Archived the old key to %s\n", archived)
+	return nil
+}
+
+// hostBlock returns the Host block that names host literally, where its IdentityFile belongs
+func hostBlock(cfg *sshconfig.Config, host string) *sshconfig.Block {
+	for _, block := range cfg.Blocks {
+		if block.Kind != "Host" {
+			continue
+		}
+		for _, pattern := range block.Patterns {
+			if pattern == host {
+				return block
+			}
+		}
+	}
+	return nil
+}
+
+// currentIdentity returns the private key host logs in with: key if given,
+// else the first configured identity file that exists, else the first of
+// ssh's default identities that exists
+func currentIdentity(resolved *sshconfig.Resolved, key string) (string, error) {
+	if key != "" {
+		return utils.ExpandUser(key), nil
+	}
+	paths := resolved.IdentityFiles()
+	sshDir := utils.ExpandUser("~/.ssh")
+	for _, name := range sshkeys.DefaultIdentityNames {
+		paths = append(paths, filepath.Join(sshDir, name))
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no identity file found for %s; name the current key with --key", resolved.Host)
+}
+
+// rotatedKeyPath returns where the new key for host goes: the dedicated key
+// path for host, or when that is the key being replaced, the same with today's date
+func rotatedKeyPath(keyType, host string) (string, error) {
+	path := hostKeyPath(keyType, host)
+	if _, err := os.Stat(utils.ExpandUser(path)); os.IsNotExist(err) {
+		return path, nil
+	}
+	dated := path + "_" + nowFunc().Format("20060102")
+	if _, err := os.Stat(utils.ExpandUser(dated)); os.IsNotExist(err) {
+		return dated, nil
+	}
+	return "", fmt.Errorf("%s and %s already exist; choose a path with --file", path, dated)
+}
+
+// otherIdentityUsers lists the hosts other than host that use the key at
+// path. ssh's default identities are assumed to be in use elsewhere.
+func otherIdentityUsers(cfg *sshconfig.Config, host, path string) []string {
+	var users []string
+	for _, ref := range identityReferences(cfg) {
+		if ref.Host != host && ref.Path == filepath.Clean(path) {
+			users = appendUnique(users, ref.Host)
+		}
+	}
+	if isDefaultIdentity(utils.ExpandUser("~/.ssh"), path) {
+		users = appendUnique(users, "hosts without an IdentityFile")
+	}
+	return users
+}
+
+func init() {
+	RotateCmd.Flags().StringVarP(&rotateOptions.Key, "key", "k", "", "Current private key (default the host's first IdentityFile)")
+	RotateCmd.Flags().StringVarP(&rotateOptions.File, "file", "f", "", "New private key path (default ~/.ssh/id_<type>_<host>)")
+	RotateCmd.Flags().StringVarP(&rotateOptions.Type, "type", "t", sshkeys.KeyTypeEd25519, "New key type: ed25519, ecdsa or rsa")
+	RotateCmd.Flags().IntVarP(&rotateOptions.Bits, "bits", "b", 0, "New key size: 256, 384 or 521 for ecdsa, at least 2048 for rsa (default 3072)")
+	RotateCmd.Flags().StringVarP(&rotateOptions.Comment, "comment", "C", "", "New key comment (default user@hostname)")
+	RotateCmd.Flags().BoolVar(&rotateOptions.NoPassphrase, "no-passphrase", false, "Do not encrypt the new private key and skip the passphrase prompt")
+	RotateCmd.Flags().DurationVar(&rotateOptions.Timeout, "timeout", rotateOptions.Timeout, "Time allowed for connecting and the key exchange of each login")
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/remote"
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+)
+
+// rotateFixture is a local ~/.ssh using a key for the host web, served by
+// an in-process server whose authorized_keys lists that key
+type rotateFixture struct {
+	*remoteFixture
+	remoteKeys     string
+	config         string
+	authorizedKeys string
+	oldKey         *sshkeys.KeyPair
+	server         *remotetest.Server
+}
+
+func newRotateFixture(t *testing.T) *rotateFixture {
+	t.Helper()
+	f := &rotateFixture{remoteFixture: newRemoteFixture(t)}
+	remoteHome := filepath.Join(f.dir, "remote")
+	f.remoteKeys = filepath.Join(remoteHome, ".ssh", "authorized_keys")
+	if err := os.MkdirAll(filepath.Dir(f.remoteKeys), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	f.server = f.startServer(t, remotetest.Options{Home: remoteHome})
+
+	var err error
+	if f.oldKey, err = sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "old"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.oldKey.Write(filepath.Join(f.sshDir, "id_ed25519_web"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherKey := newTestAuthorizedKey(t)
+	f.authorizedKeys = otherKey + "\n" + string(f.oldKey.AuthorizedKey())
+	if err := os.WriteFile(f.remoteKeys, []byte(f.authorizedKeys), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f.config = fmt.Sprintf("Host web\n    HostName %s\n    Port %d\n    User deploy\n    IdentityFile ~/.ssh/id_ed25519_web\n\nHost other\n    HostName other.example.com\n",
+		f.server.Host(), f.server.Port())
+	f.writeConfig(t, f.config)
+	return f
+}
+
+// unchanged checks that a failed rotation left everything as it was
+func (f *rotateFixture) unchanged(t *testing.T) {
+	t.Helper()
+	if content, _ := os.ReadFile(filepath.Join(f.sshDir, "config")); string(content) != f.config {
+		t.Errorf("config = %q; want it restored", content)
+	}
+	if content, _ := os.ReadFile(f.remoteKeys); string(content) != f.authorizedKeys {
+		t.Errorf("remote authorized_keys = %q; want it restored", content)
+	}
+	if _, err := os.Stat(filepath.Join(f.sshDir, "id_ed25519_web")); err != nil {
+		t.Errorf("old key was not restored: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(f.sshDir, "id_ed25519_web_*"))
+	if len(matches) > 0 {
+		t.Errorf("new key files were left behind: %v", matches)
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	f := newRotateFixture(t)
+
+	var out bytes.Buffer
+	opts := RotateOptions{NoPassphrase: true, Comment: "new", Timeout: 10 * time.Second}
+	if err := rotateKey(&out, nil, "web", opts); err != nil {
+		t.Fatalf("rotateKey() error = %v\n%s", err, out.String())
+	}
+
+	newPath := filepath.Join(f.sshDir, "id_ed25519_web_20260301")
+	newPub, comment, err := sshkeys.LoadPublicKey(newPath)
+	if err != nil {
+		t.Fatalf("new key was not saved: %v", err)
+	}
+	if comment != "new" {
+		t.Errorf("new key comment = %q; want new", comment)
+	}
+
+	content, err := os.ReadFile(filepath.Join(f.sshDir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(f.config, "IdentityFile ~/.ssh/id_ed25519_web\n", "IdentityFile ~/.ssh/id_ed25519_web_20260301\n", 1)
+	if string(content) != want {
+		t.Errorf("config = %q; want %q", content, want)
+	}
+
+	remoteKeys, err := os.ReadFile(f.remoteKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := sshkeys.ReadPublicKeys(f.remoteKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !bytes.Equal(keys[1].Marshal(), newPub.Marshal()) {
+		t.Errorf("remote authorized_keys = %q; want the other key and the new key", remoteKeys)
+	}
+	if !strings.HasPrefix(string(remoteKeys), strings.SplitN(f.authorizedKeys, "\n", 2)[0]) {
+		t.Errorf("remote authorized_keys = %q; want the unrelated key kept", remoteKeys)
+	}
+
+	if _, err := os.Stat(filepath.Join(f.sshDir, "id_ed25519_web")); !os.IsNotExist(err) {
+		t.Error("old key was not moved")
+	}
+	for _, name := range []string{"id_ed25519_web.20260301-120000", "id_ed25519_web.20260301-120000.pub"} {
+		if _, err := os.Stat(filepath.Join(f.sshDir, "archive", name)); err != nil {
+			t.Errorf("old key was not archived: %v", err)
+		}
+	}
+	if !strings.Contains(out.String(), "Archived the old key") {
+		t.Errorf("output = %q; want the archive reported", out.String())
+	}
+}
+
+func TestRotateKeySharedIdentity(t *testing.T) {
+	f := newRotateFixture(t)
+
+	// Another host uses the same key, and web sets no IdentityFile of its own
+	shared := strings.Replace(f.config, "    IdentityFile ~/.ssh/id_ed25519_web\n", "", 1) +
+		"\nHost *\n    IdentityFile ~/.ssh/id_ed25519_web\n"
+	if err := os.WriteFile(utils.SSHPaths.Config, []byte(shared), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	opts := RotateOptions{NoPassphrase: true, File: "~/.ssh/web_key", Timeout: 10 * time.Second}
+	if err := rotateKey(&out, nil, "web", opts); err != nil {
+		t.Fatalf("rotateKey() error = %v\n%s", err, out.String())
+	}
+
+	content, err := os.ReadFile(utils.SSHPaths.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(shared, "Host web\n", "Host web\n    IdentityFile ~/.ssh/web_key\n", 1)
+	if string(content) != want {
+		t.Errorf("config = %q; want %q", content, want)
+	}
+	if _, err := os.Stat(filepath.Join(f.sshDir, "id_ed25519_web")); err != nil {
+		t.Errorf("shared key was archived: %v", err)
+	}
+	if !strings.Contains(out.String(), "still used by other, Host *") {
+		t.Errorf("output = %q; want the shared key reported", out.String())
+	}
+}
+
+func TestRotateKeyRollback(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, f *rotateFixture)
+		want  string
+	}{
+		{
+			name: "New key rejected",
+			setup: func(t *testing.T, f *rotateFixture) {
+				dials := 0
+				oldDial := dialRemote
+				dialRemote = func(ctx context.Context, conn net.Conn, target remote.Target) (*remote.Client, error) {
+					if dials++; dials == 2 {
+						conn.Close()
+						return nil, fmt.Errorf("permission denied")
+					}
+					return oldDial(ctx, conn, target)
+				}
+				t.Cleanup(func() { dialRemote = oldDial })
+			},
+			want: "the new key does not work",
+		},
+		{
+			name: "Archive fails",
+			setup: func(t *testing.T, f *rotateFixture) {
+				// A file where the archive directory belongs makes the last step fail
+				if err := os.WriteFile(filepath.Join(f.sshDir, "archive"), nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "archive",
+		},
+		{
+			name: "Old key removed remotely before the rotation",
+			setup: func(t *testing.T, f *rotateFixture) {
+				f.authorizedKeys = strings.SplitN(f.authorizedKeys, "\n", 2)[0] + "\n"
+				if err := os.WriteFile(f.remoteKeys, []byte(f.authorizedKeys), 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "failed to log in",
+		},
+		{
+			name: "Unknown host key",
+			setup: func(t *testing.T, f *rotateFixture) {
+				os.Remove(utils.SSHPaths.KnownHosts)
+			},
+			want: "hosts scan",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRotateFixture(t)
+			tt.setup(t, f)
+
+			var out bytes.Buffer
+			err := rotateKey(&out, nil, "web", RotateOptions{NoPassphrase: true, Timeout: 10 * time.Second})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("rotateKey() error = %v; want %q\n%s", err, tt.want, out.String())
+			}
+			if strings.Contains(out.String(), "FAILED") {
+				t.Errorf("rollback failed:\n%s", out.String())
+			}
+			f.unchanged(t)
+		})
+	}
+}
+
+func TestRotateKeyErrors(t *testing.T) {
+	f := newRotateFixture(t)
+	opts := RotateOptions{NoPassphrase: true, Timeout: 10 * time.Second}
+
+	if err := rotateKey(&bytes.Buffer{}, nil, "missing", opts); err == nil || !strings.Contains(err.Error(), "no Host block") {
+		t.Errorf("rotateKey() error = %v; want missing host refusal", err)
+	}
+
+	opts.File = "~/.ssh/id_ed25519_web"
+	if err := rotateKey(&bytes.Buffer{}, nil, "web", opts); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("rotateKey() error = %v; want existing file refusal", err)
+	}
+	f.unchanged(t)
+}
@@ -0,0 +1,220 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/allowedsigners"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/sshsig"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// defaultSignNamespace is the namespace ssh-keygen -Y uses for files
+const defaultSignNamespace = "file"
+
+// SignOptions represents the options for signing files
+type SignOptions struct {
+	Key       string
+	Namespace string
+}
+
+// VerifyOptions represents the options for verifying file signatures
+type VerifyOptions struct {
+	Signature      string
+	Identity       string
+	Namespace      string
+	AllowedSigners string
+	RevokedKeys    string
+}
+
+var signOptions SignOptions
+var verifyOptions VerifyOptions
+
+// SignCmd represents the Cobra command for signing files with SSH keys.
+var SignCmd = &cobra.Command{
+	Use:   "sign <file>...",
+	Short: "Sign files with an SSH key",
+	Long: `Sign files with an SSH key, writing the signature to <file>.sig in the SSHSIG
+format used by ssh-keygen -Y sign. Use - to sign stdin and write the signature
+to stdout.
+
+--key names a private key, or a public key whose private half is in the SSH
+agent. Signatures are bound to a namespace, "file" by default; verifiers must
+use the same namespace.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return signFiles(cmd.OutOrStdout(), cmd.InOrStdin(), bufio.NewReader(os.Stdin), args, signOptions)
+	},
+}
+
+// VerifyCmd represents the Cobra command for verifying file signatures.
+var VerifyCmd = &cobra.Command{
+	Use:   "verify <file> --identity <email>",
+	Short: "Verify a file signature against allowed_signers",
+	Long: `Verify an SSHSIG signature made by ssh-config sign or ssh-keygen -Y sign. The
+signature must be valid, made for the namespace, and made by a key that
+~/.ssh/allowed_signers allows to sign as the identity. Keys revoked in
+` + utils.DefaultRevokedKeysPath + ` are rejected. Use - to verify stdin.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return verifyFile(cmd.OutOrStdout(), cmd.InOrStdin(), args[0], verifyOptions)
+	},
+}
+
+// withSigner calls fn with a signer for the key at path. A private key is
+// read from disk, asking for its passphrase if needed; for a public key, or a
+// private key that does not exist, the matching identity in the agent is used.
+func withSigner(reader *bufio.Reader, path string, fn func(ssh.Signer) error) error {
+	path = utils.ExpandUser(path)
+	if !strings.HasSuffix(path, ".pub") {
+		key, err := sshkeys.ReadPrivateKey(path, func(p string) ([]byte, error) {
+			return promptPassphrase(reader, fmt.Sprintf("Enter passphrase for %s: ", p))
+		})
+		if err == nil {
+			signer, err := ssh.NewSignerFromKey(key)
+			if err != nil {
+				return fmt.Errorf("failed to use key %s: %w", path, err)
+			}
+			return fn(signer)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	pub, _, err := sshkeys.LoadPublicKey(path)
+	if err != nil {
+		return err
+	}
+	return withAgent(func(client agent.ExtendedAgent) error {
+		signers, err := client.Signers()
+		if err != nil {
+			return fmt.Errorf("failed to list agent identities: %w", err)
+		}
+		for _, signer := range signers {
+			if bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()) {
+				return fn(signer)
+			}
+		}
+		return fmt.Errorf("the private key of %s is not in the agent", ssh.FingerprintSHA256(pub))
+	})
+}
+
+// signFiles signs each file in paths, writing the armored signatures next to them
+func signFiles(out io.Writer, stdin io.Reader, reader *bufio.Reader, paths []string, opts SignOptions) error {
+	if opts.Key == "" {
+		opts.Key = sshkeys.DefaultIdentity()
+	}
+	if opts.Namespace == "" {
+		return fmt.Errorf("--namespace must not be empty")
+	}
+
+	return withSigner(reader, opts.Key, func(signer ssh.Signer) error {
+		for _, path := range paths {
+			if path == "-" {
+				sig, err := sshsig.Sign(signer, stdin, opts.Namespace)
+				if err != nil {
+					return err
+				}
+				out.Write(sig.Armor())
+				continue
+			}
+
+			file, err := os.Open(utils.ExpandUser(path))
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", path, err)
+			}
+			sig, err := sshsig.Sign(signer, file, opts.Namespace)
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("failed to sign %s: %w", path, err)
+			}
+			if err := utils.WriteFileAtomic(utils.ExpandUser(path)+".sig", sig.Armor(), 0644); err != nil {
+				return fmt.Errorf("failed to write signature: %w", err)
+			}
+			fmt.Fprintf(out, "Signed %s with %s, signature written to %s.sig\n", path, ssh.FingerprintSHA256(signer.PublicKey()), path)
+		}
+		return nil
+	})
+}
+
+// verifyFile checks the signature of the file at path against allowed_signers
+func verifyFile(out io.Writer, stdin io.Reader, path string, opts VerifyOptions) error {
+	if opts.Identity == "" {
+		return fmt.Errorf("--identity is required")
+	}
+	sigPath := opts.Signature
+	if sigPath == "" {
+		if path == "-" {
+			return fmt.Errorf("--signature is required when verifying stdin")
+		}
+		sigPath = path + ".sig"
+	}
+	data, err := os.ReadFile(utils.ExpandUser(sigPath))
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	sig, err := sshsig.Parse(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse signature %s: %w", sigPath, err)
+	}
+
+	message := stdin
+	if path != "-" {
+		file, err := os.Open(utils.ExpandUser(path))
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer file.Close()
+		message = file
+	}
+	if err := sig.Verify(message, opts.Namespace); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	revokedKeys, err := loadRevokedKeys(opts.RevokedKeys)
+	if err != nil {
+		return err
+	}
+	if revokedKeys != nil && revokedKeys.IsRevoked(sig.PublicKey) {
+		return fmt.Errorf("signature verification failed: key %s is revoked", ssh.FingerprintSHA256(sig.PublicKey))
+	}
+
+	allowedSignersPath := opts.AllowedSigners
+	if allowedSignersPath == "" {
+		allowedSignersPath = utils.SSHPaths.AllowedSigners
+	}
+	content, err := os.ReadFile(utils.ExpandUser(allowedSignersPath))
+	if err != nil {
+		return fmt.Errorf("failed to read allowed signers: %w", err)
+	}
+	signers := allowedsigners.Parse(content)
+	if err := signers.Authorize(opts.Identity, opts.Namespace, sig.PublicKey, nowFunc()); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	fmt.Fprintf(out, "Good %q signature for %s with %s key %s\n", opts.Namespace, opts.Identity, strings.ToUpper(strings.TrimPrefix(sig.PublicKey.Type(), "ssh-")), ssh.FingerprintSHA256(sig.PublicKey))
+	return nil
+}
+
+func init() {
+	SignCmd.Flags().StringVarP(&signOptions.Key, "key", "k", "", "Private key, or public key of an agent identity, to sign with (default the first of ~/.ssh/id_*)")
+	SignCmd.Flags().StringVarP(&signOptions.Namespace, "namespace", "n", defaultSignNamespace, "Namespace the signature is made for, such as file or git")
+
+	VerifyCmd.Flags().StringVarP(&verifyOptions.Signature, "signature", "s", "", "Signature file (default <file>.sig)")
+	VerifyCmd.Flags().StringVarP(&verifyOptions.Identity, "identity", "I", "", "Identity, such as an email address, the signer must be allowed to sign as")
+	VerifyCmd.Flags().StringVarP(&verifyOptions.Namespace, "namespace", "n", defaultSignNamespace, "Namespace the signature must be made for")
+	VerifyCmd.Flags().StringVarP(&verifyOptions.AllowedSigners, "allowed-signers", "f", "", "allowed_signers file (default "+utils.DefaultAllowedSignersPath+")")
+	VerifyCmd.Flags().StringVar(&verifyOptions.RevokedKeys, "revoked-keys", "", "Reject keys revoked in this KRL or key list (default "+utils.DefaultRevokedKeysPath+" if present)")
+}
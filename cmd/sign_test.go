@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/krl"
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.AllowedSigners = filepath.Join(tmpDir, ".ssh", "allowed_signers")
+	utils.SSHPaths.RevokedKeys = filepath.Join(tmpDir, ".ssh", "revoked_keys")
+	defer func() { utils.SSHPaths = oldPaths }()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldNow := nowFunc
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = oldNow }()
+
+	// A key on disk and a key that is only in the agent
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(tmpDir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, agentPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: agentPriv}); err != nil {
+		t.Fatal(err)
+	}
+	agentSigner, err := ssh.NewSignerFromKey(agentPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentPubPath := filepath.Join(tmpDir, "id_agent.pub")
+	if err := os.WriteFile(agentPubPath, ssh.MarshalAuthorizedKey(agentSigner.PublicKey()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(tmpDir, "agent.sock")
+	listener := serveAgent(t, keyring, sock)
+	defer listener.Close()
+	oldGetenv := getenvFunc
+	getenvFunc = func(key string) string {
+		if key == "SSH_AUTH_SOCK" {
+			return sock
+		}
+		return ""
+	}
+	defer func() { getenvFunc = oldGetenv }()
+
+	releasePath := filepath.Join(tmpDir, "release.tar.gz")
+	if err := os.WriteFile(releasePath, []byte("release contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(tmpDir, "bundle.tar.gz")
+	if err := os.WriteFile(bundlePath, []byte("bundle contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	reader := bufio.NewReader(strings.NewReader(""))
+	if err := signFiles(&out, nil, reader, []string{releasePath}, SignOptions{Key: keyPath, Namespace: "file"}); err != nil {
+		t.Fatalf("signFiles() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "signature written to "+releasePath+".sig") {
+		t.Errorf("sign output = %q", out.String())
+	}
+	if err := signFiles(&out, nil, reader, []string{bundlePath}, SignOptions{Key: agentPubPath, Namespace: "file"}); err != nil {
+		t.Fatalf("signFiles() with agent key error = %v", err)
+	}
+
+	// Verifying without allowed_signers fails
+	opts := VerifyOptions{Identity: "alice@example.com", Namespace: "file"}
+	if err := verifyFile(&out, nil, releasePath, opts); err == nil {
+		t.Error("verifyFile() expected error without allowed_signers")
+	}
+
+	signers := "alice@example.com " + string(ssh.MarshalAuthorizedKey(signer.PublicKey())) +
+		`ci@example.com namespaces="file" ` + string(ssh.MarshalAuthorizedKey(agentSigner.PublicKey()))
+	if err := os.MkdirAll(filepath.Dir(utils.SSHPaths.AllowedSigners), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(utils.SSHPaths.AllowedSigners, []byte(signers), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := verifyFile(&out, nil, releasePath, opts); err != nil {
+		t.Fatalf("verifyFile() error = %v", err)
+	}
+	want := `Good "file" signature for alice@example.com with ED25519 key ` + ssh.FingerprintSHA256(signer.PublicKey())
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("verify output = %q; want %q", out.String(), want)
+	}
+	ciOpts := VerifyOptions{Identity: "ci@example.com", Namespace: "file"}
+	if err := verifyFile(&out, nil, bundlePath, ciOpts); err != nil {
+		t.Errorf("verifyFile() of agent signature error = %v", err)
+	}
+
+	// Stdin with an explicit signature file
+	stdinOpts := VerifyOptions{Identity: "alice@example.com", Namespace: "file", Signature: releasePath + ".sig"}
+	if err := verifyFile(&out, strings.NewReader("release contents"), "-", stdinOpts); err != nil {
+		t.Errorf("verifyFile() of stdin error = %v", err)
+	}
+
+	failures := []struct {
+		name string
+		path string
+		opts VerifyOptions
+	}{
+		{"Wrong identity", releasePath, VerifyOptions{Identity: "ci@example.com", Namespace: "file"}},
+		{"Wrong namespace", releasePath, VerifyOptions{Identity: "alice@example.com", Namespace: "git"}},
+		{"Wrong signature", releasePath, VerifyOptions{Identity: "alice@example.com", Namespace: "file", Signature: bundlePath + ".sig"}},
+		{"No identity", releasePath, VerifyOptions{Namespace: "file"}},
+		{"Stdin without signature", "-", VerifyOptions{Identity: "alice@example.com", Namespace: "file"}},
+		{"Missing signature", filepath.Join(tmpDir, "missing"), VerifyOptions{Identity: "alice@example.com", Namespace: "file"}},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyFile(&out, strings.NewReader(""), tt.path, tt.opts); err == nil {
+				t.Error("verifyFile() expected error")
+			}
+		})
+	}
+
+	// A modified file no longer verifies
+	if err := os.WriteFile(releasePath, []byte("tampered contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFile(&out, nil, releasePath, opts); err == nil {
+		t.Error("verifyFile() accepted a modified file")
+	}
+
+	// A revoked key no longer verifies
+	list := &krl.KRL{}
+	list.RevokeKey(agentSigner.PublicKey())
+	if err := list.Write(utils.SSHPaths.RevokedKeys); err != nil {
+		t.Fatal(err)
+	}
+	err = verifyFile(&out, nil, bundlePath, ciOpts)
+	if err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("verifyFile() error = %v; want the key reported as revoked", err)
+	}
+
+	// Signing fails for a key that is neither on disk nor in the agent
+	if err := signFiles(&out, nil, reader, []string{bundlePath}, SignOptions{Key: filepath.Join(tmpDir, "missing"), Namespace: "file"}); err == nil {
+		t.Error("signFiles() expected error for a missing key")
+	}
+}
@@ -0,0 +1,379 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/allowedsigners"
+	"github.com/evberrypi/ssh-config/authkeys"
+	"github.com/evberrypi/ssh-config/sshkeys"
+	"github.com/evberrypi/ssh-config/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultSignerNamespaces limits imported signers to git signatures
+var defaultSignerNamespaces = []string{"git"}
+
+// SignersOptions represents the options for adding signers to allowed_signers
+type SignersOptions struct {
+	Namespaces  []string
+	Validity    string
+	RevokedKeys string
+}
+
+var signersOptions SignersOptions
+
+// SignersCmd represents the Cobra command for managing ~/.ssh/allowed_signers.
+var SignersCmd = &cobra.Command{
+	Use:   "signers",
+	Short: "Manage allowed_signers for verifying SSH signatures",
+	Long: `Manage the ~/.ssh/allowed_signers file that ssh-keygen -Y verify and git use to
+check SSH signatures such as signed commits. Signers can be imported from GitHub
+and GitLab and kept up to date with signers sync.
+
+Tell git to use the file with:
+
+    git config --global gpg.ssh.allowedSignersFile ~/.ssh/allowed_signers`,
+}
+
+var signersAddCmd = &cobra.Command{
+	Use:   "add <email> <github:user|gitlab:user|key.pub>...",
+	Short: "Allow keys to sign as an email address",
+	Long: `Allow the keys published by a GitHub or GitLab user, or read from public key
+files, to sign as the given email address. Signers are limited to git signatures
+unless --namespaces says otherwise. --validity limits when signatures are
+accepted: a single time such as +52w or 20270101 sets when the signer expires,
+and from:to such as 20260101:20270101 sets both ends. Adding a provider user
+again replaces the keys imported before.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return addSigners(cmd.OutOrStdout(), cmd.ErrOrStderr(), args[0], args[1:], signersOptions)
+	},
+}
+
+var signersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the allowed signers",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := readAllowedSigners()
+		if err != nil {
+			return err
+		}
+		lines := file.Entries()
+		if len(lines) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No allowed signers found.")
+			return nil
+		}
+		for _, line := range lines {
+			fmt.Fprintln(cmd.OutOrStdout(), describeSigner(file, line))
+		}
+		return nil
+	},
+}
+
+var signersRemoveCmd = &cobra.Command{
+	Use:   "remove <email|SHA256:fingerprint>",
+	Short: "Stop accepting signatures from an email address or key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return removeSigners(cmd.OutOrStdout(), args[0])
+	},
+}
+
+var signersSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Refresh signers imported from GitHub and GitLab",
+	Long: `Fetch the keys of every provider user imported with signers add again, adding
+their new keys and removing the keys they no longer publish. The options of the
+existing signers, such as namespaces and validity, are kept.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return syncSigners(cmd.OutOrStdout(), cmd.ErrOrStderr(), signersOptions.RevokedKeys)
+	},
+}
+
+// readAllowedSigners reads and parses the allowed_signers file, which may not exist yet
+func readAllowedSigners() (*allowedsigners.File, error) {
+	content, err := os.ReadFile(utils.ExpandUser(utils.SSHPaths.AllowedSigners))
+	if os.IsNotExist(err) {
+		return &allowedsigners.File{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read allowed_signers file: %w", err)
+	}
+	return allowedsigners.Parse(content), nil
+}
+
+// writeAllowedSigners replaces the allowed_signers file with the contents of file
+func writeAllowedSigners(file *allowedsigners.File) error {
+	if err := utils.EnsureSSHDirectory(); err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(utils.ExpandUser(utils.SSHPaths.AllowedSigners), file.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write allowed_signers file: %w", err)
+	}
+	return nil
+}
+
+// signerOptions returns the validated allowed_signers options for opts
+func signerOptions(opts SignersOptions) ([]authkeys.Option, error) {
+	var options []authkeys.Option
+	if len(opts.Namespaces) > 0 {
+		options = append(options, authkeys.Option{Name: allowedsigners.OptionNamespaces, Value: strings.Join(opts.Namespaces, ","), HasValue: true})
+	}
+	if opts.Validity != "" {
+		// Unlike certificates a single time only ends the interval, so
+		// signatures made before the signer was added stay valid
+		validity := opts.Validity
+		if !strings.Contains(validity, ":") {
+			validity = "always:" + validity
+		}
+		after, before, err := sshkeys.ParseValidity(validity, nowFunc())
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, allowedsigners.ValidityOptions(after, before)...)
+	}
+	for _, opt := range options {
+		if err := allowedsigners.ValidateOption(opt); err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+// providerSigners returns the signer entries for the keys a provider user
+// publishes. Lines that are not plain keys are dropped.
+func providerSigners(errOut io.Writer, principal string, id providerIdentity, options []authkeys.Option, revokedKeysPath string) ([]*allowedsigners.Entry, error) {
+	keys, revoked, err := fetchProviderKeys(errOut, id.Service, id.Username, revokedKeysPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*allowedsigners.Entry
+	for _, raw := range strings.Split(string(keys), "\n") {
+		key, _, keyOptions, _, err := ssh.ParseAuthorizedKey([]byte(raw))
+		if err != nil || len(keyOptions) > 0 {
+			continue
+		}
+		if _, ok := key.(*ssh.Certificate); ok {
+			continue
+		}
+		entries = append(entries, allowedsigners.NewEntry(principal, key, options, ""))
+	}
+	if len(entries) == 0 {
+		if revoked > 0 {
+			return nil, fmt.Errorf("every key of %s is revoked", id)
+		}
+		return nil, fmt.Errorf("no keys found for %s", id)
+	}
+	return entries, nil
+}
+
+// parseProviderIdentity parses a service:username source such as github:alice
+func parseProviderIdentity(source string) (providerIdentity, bool) {
+	service, username, found := strings.Cut(source, ":")
+	if !found || username == "" {
+		return providerIdentity{}, false
+	}
+	if _, ok := utils.ServiceURLs[service]; !ok {
+		return providerIdentity{}, false
+	}
+	return providerIdentity{Service: service, Username: username}, true
+}
+
+// addSigners allows the keys of sources to sign as principal
+func addSigners(out, errOut io.Writer, principal string, sources []string, opts SignersOptions) error {
+	if principal == "" || strings.ContainsAny(principal, ", \t\"") {
+		return fmt.Errorf("invalid principal %q: give a single email address", principal)
+	}
+	options, err := signerOptions(opts)
+	if err != nil {
+		return fmt.Errorf("invalid signer options: %w", err)
+	}
+	file, err := readAllowedSigners()
+	if err != nil {
+		return err
+	}
+
+	for _, source := range sources {
+		if id, ok := parseProviderIdentity(source); ok {
+			entries, err := providerSigners(errOut, principal, id, options, opts.RevokedKeys)
+			if err != nil {
+				return err
+			}
+			added, removed := file.SetSigners(allowedsigners.Marker{Principal: principal, Service: id.Service, Username: id.Username}, entries)
+			fmt.Fprintf(out, "Allowed %d key(s) of %s to sign as %s", len(entries), id, principal)
+			if removed > 0 || added < len(entries) {
+				fmt.Fprintf(out, " (%d new, %d removed)", added, removed)
+			}
+			fmt.Fprintln(out)
+			continue
+		}
+
+		keys, err := sshkeys.ReadPublicKeys(source)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, ok := key.(*ssh.Certificate); ok {
+				return fmt.Errorf("%s is a certificate; add the key it certifies instead", source)
+			}
+			if signerAllowed(file, principal, key) {
+				fmt.Fprintf(out, "%s can already sign as %s\n", ssh.FingerprintSHA256(key), principal)
+				continue
+			}
+			entry := allowedsigners.NewEntry(principal, key, options, "")
+			file.AddSigner(entry)
+			fmt.Fprintf(out, "Allowed %s to sign as %s\n", ssh.FingerprintSHA256(key), principal)
+		}
+	}
+	return writeAllowedSigners(file)
+}
+
+// signerAllowed reports whether a line already allows key to sign as principal
+func signerAllowed(file *allowedsigners.File, principal string, key ssh.PublicKey) bool {
+	for _, line := range file.Entries() {
+		if !line.Entry.HasPrincipal(principal) {
+			continue
+		}
+		if pub, err := line.Entry.PublicKey(); err == nil && ssh.FingerprintSHA256(pub) == ssh.FingerprintSHA256(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSigners removes a principal, or the key with a SHA256 fingerprint
+func removeSigners(out io.Writer, ref string) error {
+	file, err := readAllowedSigners()
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(ref, "SHA256:") {
+		for _, line := range file.Entries() {
+			pub, err := line.Entry.PublicKey()
+			if err != nil || ssh.FingerprintSHA256(pub) != ref {
+				continue
+			}
+			removed := file.RemoveKey(pub)
+			if err := writeAllowedSigners(file); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Removed %d signer line(s) for %s\n", removed, ref)
+			return nil
+		}
+		return fmt.Errorf("no signer uses key %s", ref)
+	}
+
+	changed := file.RemovePrincipal(ref)
+	if changed == 0 {
+		return fmt.Errorf("%s is not an allowed signer", ref)
+	}
+	if err := writeAllowedSigners(file); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Removed %s from %d signer line(s)\n", ref, changed)
+	return nil
+}
+
+// syncSigners refreshes every provider block of the allowed_signers file.
+// Users whose keys cannot be fetched keep their current keys.
+func syncSigners(out, errOut io.Writer, revokedKeysPath string) error {
+	file, err := readAllowedSigners()
+	if err != nil {
+		return err
+	}
+	markers := file.Markers()
+	if len(markers) == 0 {
+		fmt.Fprintln(out, "No signers imported from providers.")
+		return nil
+	}
+
+	failed, changed := 0, false
+	for _, marker := range markers {
+		id := providerIdentity{Service: marker.Service, Username: marker.Username}
+		options := []authkeys.Option{{Name: allowedsigners.OptionNamespaces, Value: strings.Join(defaultSignerNamespaces, ","), HasValue: true}}
+		for _, line := range file.Entries() {
+			if m, ok := file.MarkerFor(line); ok && m == marker {
+				options = line.Entry.Options
+				break
+			}
+		}
+
+		entries, err := providerSigners(errOut, marker.Principal, id, options, revokedKeysPath)
+		if err != nil {
+			fmt.Fprintf(errOut, "Warning: %s for %s: %v\n", id, marker.Principal, err)
+			failed++
+			continue
+		}
+		added, removed := file.SetSigners(marker, entries)
+		if added == 0 && removed == 0 {
+			fmt.Fprintf(out, "%s for %s is up to date\n", id, marker.Principal)
+			continue
+		}
+		changed = true
+		fmt.Fprintf(out, "%s for %s: %d added, %d removed\n", id, marker.Principal, added, removed)
+	}
+
+	if changed {
+		if err := writeAllowedSigners(file); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to sync %d of %d provider user(s)", failed, len(markers))
+	}
+	return nil
+}
+
+// describeSigner summarises a signer line as its principals, key, origin and restrictions
+func describeSigner(file *allowedsigners.File, line *allowedsigners.Line) string {
+	entry := line.Entry
+	description := strings.Join(entry.Principals, ",") + " " + entry.KeyType
+	if pub, err := entry.PublicKey(); err == nil {
+		description += " " + ssh.FingerprintSHA256(pub)
+	}
+	if marker, ok := file.MarkerFor(line); ok {
+		description += fmt.Sprintf(" (%s:%s)", marker.Service, marker.Username)
+	}
+
+	var details []string
+	if _, ok := entry.Option(allowedsigners.OptionCertAuthority); ok {
+		details = append(details, "cert-authority")
+	}
+	if namespaces := entry.Namespaces(); namespaces != nil {
+		details = append(details, "namespaces "+strings.Join(namespaces, ","))
+	}
+	after, before, err := entry.Validity()
+	now := nowFunc()
+	switch {
+	case err != nil:
+		details = append(details, "invalid validity")
+	case !before.IsZero() && !before.After(now):
+		details = append(details, "expired "+before.Local().Format("2006-01-02 15:04"))
+	case !after.IsZero() && after.After(now):
+		details = append(details, "valid from "+after.Local().Format("2006-01-02 15:04"))
+	case !before.IsZero():
+		details = append(details, "valid until "+before.Local().Format("2006-01-02 15:04"))
+	}
+	if len(details) > 0 {
+		description += " [" + strings.Join(details, "; ") + "]"
+	}
+	return description
+}
+
+func init() {
+	SignersCmd.AddCommand(signersAddCmd, signersListCmd, signersRemoveCmd, signersSyncCmd)
+
+	signersAddCmd.Flags().StringSliceVar(&signersOptions.Namespaces, "namespaces", defaultSignerNamespaces, "Namespaces the keys may sign for; empty allows any")
+	signersAddCmd.Flags().StringVarP(&signersOptions.Validity, "validity", "V", "", "Only accept signatures made within this interval, such as +52w or 20260101:20270101")
+	for _, c := range []*cobra.Command{signersAddCmd, signersSyncCmd} {
+		c.Flags().StringVar(&signersOptions.RevokedKeys, "revoked-keys", "", "Refuse keys revoked in this KRL or key list (default "+utils.DefaultRevokedKeysPath+" if present)")
+	}
+}
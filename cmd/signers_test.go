@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSigners(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldNow := nowFunc
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = oldNow }()
+
+	laptopKey, laptopLine := newTestAuthorizedKey(t)
+	_, desktopLine := newTestAuthorizedKey(t)
+	served := laptopLine + " laptop\n"
+	available := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/alice.keys" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, served)
+	}))
+	defer ts.Close()
+
+	oldURLs := utils.ServiceURLs
+	utils.ServiceURLs = map[string]string{"github": ts.URL + "/%s.keys"}
+	oldPaths := utils.SSHPaths
+	utils.SSHPaths.AllowedSigners = filepath.Join(tmpDir, ".ssh", "allowed_signers")
+	utils.SSHPaths.RevokedKeys = filepath.Join(tmpDir, ".ssh", "revoked_keys")
+	defer func() {
+		utils.ServiceURLs = oldURLs
+		utils.SSHPaths = oldPaths
+	}()
+
+	workKey, workLine := newTestAuthorizedKey(t)
+	workPath := filepath.Join(tmpDir, "work.pub")
+	if err := os.WriteFile(workPath, []byte(workLine+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	opts := SignersOptions{Namespaces: []string{"git"}, Validity: "20270101Z"}
+	if err := addSigners(&out, &errOut, "alice@example.com", []string{"github:alice", workPath}, opts); err != nil {
+		t.Fatalf("addSigners() error = %v", err)
+	}
+
+	content, err := os.ReadFile(utils.SSHPaths.AllowedSigners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := `namespaces="git",valid-before="20270101000000Z"`
+	want := "# Signers for alice@example.com from github user alice via ssh-config\n" +
+		"alice@example.com " + options + " " + laptopLine + "\n\n" +
+		"alice@example.com " + options + " " + workLine + "\n"
+	if string(content) != want {
+		t.Errorf("allowed_signers = %q; want %q", content, want)
+	}
+
+	// Adding a key file again does not duplicate it
+	out.Reset()
+	if err := addSigners(&out, &errOut, "alice@example.com", []string{workPath}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "can already sign") {
+		t.Errorf("output = %q; want the key reported as present", out.String())
+	}
+
+	invalid := []struct {
+		principal string
+		sources   []string
+		opts      SignersOptions
+	}{
+		{"alice@example.com bob", []string{"github:alice"}, SignersOptions{}},
+		{"alice@example.com", []string{"github:nobody"}, SignersOptions{}},
+		{"alice@example.com", []string{"github:alice"}, SignersOptions{Validity: "soon"}},
+		{"alice@example.com", []string{filepath.Join(tmpDir, "missing.pub")}, SignersOptions{}},
+	}
+	for _, tt := range invalid {
+		if err := addSigners(&out, &errOut, tt.principal, tt.sources, tt.opts); err == nil {
+			t.Errorf("addSigners(%q, %v, %+v) expected error", tt.principal, tt.sources, tt.opts)
+		}
+	}
+
+	signersListCmd.SetOut(&out)
+	out.Reset()
+	if err := signersListCmd.RunE(signersListCmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "alice@example.com ssh-ed25519 "+ssh.FingerprintSHA256(laptopKey)+" (github:alice) [namespaces git; valid until") {
+		t.Errorf("signers list = %q", out.String())
+	}
+
+	// Sync picks up the new key, drops the old one and keeps the options
+	served = desktopLine + "\n"
+	out.Reset()
+	if err := syncSigners(&out, &errOut, ""); err != nil {
+		t.Fatalf("syncSigners() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "github:alice for alice@example.com: 1 added, 1 removed") {
+		t.Errorf("sync output = %q", out.String())
+	}
+	content, _ = os.ReadFile(utils.SSHPaths.AllowedSigners)
+	if strings.Contains(string(content), laptopLine) || !strings.Contains(string(content), "alice@example.com "+options+" "+desktopLine) {
+		t.Errorf("allowed_signers after sync = %q", content)
+	}
+
+	out.Reset()
+	if err := syncSigners(&out, &errOut, ""); err != nil || !strings.Contains(out.String(), "up to date") {
+		t.Errorf("second sync = %q, %v", out.String(), err)
+	}
+
+	// A provider failure keeps the current keys
+	available = false
+	if err := syncSigners(&out, &errOut, ""); err == nil {
+		t.Error("syncSigners() expected error when the provider fails")
+	}
+	available = true
+	content, _ = os.ReadFile(utils.SSHPaths.AllowedSigners)
+	if !strings.Contains(string(content), desktopLine) {
+		t.Error("sync failure removed the existing keys")
+	}
+
+	out.Reset()
+	if err := removeSigners(&out, ssh.FingerprintSHA256(workKey)); err != nil {
+		t.Fatalf("removeSigners() by fingerprint error = %v", err)
+	}
+	if err := removeSigners(&out, "alice@example.com"); err != nil {
+		t.Fatalf("removeSigners() error = %v", err)
+	}
+	if err := removeSigners(&out, "alice@example.com"); err == nil {
+		t.Error("removeSigners() expected error for a removed principal")
+	}
+	content, _ = os.ReadFile(utils.SSHPaths.AllowedSigners)
+	if strings.TrimSpace(string(content)) != "" {
+		t.Errorf("allowed_signers = %q; want no signers left", content)
+	}
+}
@@ -0,0 +1,390 @@
+// Package cmd provides command-line interfaces for interacting with SSH configurations.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/evberrypi/ssh-config/remote"
+	"github.com/evberrypi/ssh-config/sshconfig"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// TestOptions represents the options for testing connections to hosts
+type TestOptions struct {
+	Format  string
+	Jobs    int
+	Timeout time.Duration
+}
+
+var testOptions = TestOptions{Format: "text", Jobs: 8, Timeout: 10 * time.Second}
+
+// testStageNames are the steps of connecting to a host, in order
+var testStageNames = []string{"tcp", "handshake", "hostkey", "auth"}
+
+// TestCmd represents the Cobra command for checking connections to hosts.
+var TestCmd = &cobra.Command{
+	Use:   "test <alias|pattern>",
+	Short: "Check that hosts can be reached and logged in to",
+	Long: `Connect to a host, or every host alias matching a pattern such as 'prod-*',
+and report each step with its timing and the reason it failed:
+- tcp: the port can be reached, through the ProxyJump hosts if any
+- handshake: the SSH key exchange completes
+- hostkey: the host key matches known_hosts
+- auth: a key from the agent or the host's identity files is accepted
+
+The effective HostName, Port, User, IdentityFile and ProxyJump are shown
+too. No password is asked for. Hosts are tested concurrently, --jobs at a
+time, and --format json prints the results for scripts.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return testHosts(cmd.OutOrStdout(), args[0], testOptions)
+	},
+}
+
+// hostTest is the result of testing the connection to one host
+type hostTest struct {
+	Host          string       `json:"host"`
+	HostName      string       `json:"hostname"`
+	Port          int          `json:"port"`
+	User          string       `json:"user"`
+	IdentityFiles []string     `json:"identity_files"`
+	ProxyJump     string       `json:"proxy_jump,omitempty"`
+	OK            bool         `json:"ok"`
+	Stages        []*testStage `json:"stages"`
+	// Error is set when the test could not start, such as for an
+	// unreadable known_hosts
+	Error string `json:"error,omitempty"`
+}
+
+// testStage is the outcome of one step of connecting
+type testStage struct {
+	Name string `json:"name"`
+	// Status is ok, failed or skipped
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Detail     string  `json:"detail,omitempty"`
+	Error      string  `json:"error,omitempty"`
+
+	start    time.Time
+	duration time.Duration
+}
+
+// begin starts timing the stage called name
+func (h *hostTest) begin(name string) *testStage {
+	stage := &testStage{Name: name, start: time.Now()}
+	h.Stages = append(h.Stages, stage)
+	return stage
+}
+
+// end records how long the stage took and whether it failed
+func (s *testStage) end(err error, detail string) {
+	s.duration = time.Since(s.start)
+	s.DurationMS = float64(s.duration.Microseconds()) / 1000
+	s.Detail = detail
+	s.Status = "ok"
+	if err != nil {
+		s.Status = "failed"
+		s.Error = err.Error()
+	}
+}
+
+// finish marks the stages that were not reached as skipped and sets OK
+func (h *hostTest) finish() {
+	for _, name := range testStageNames[len(h.Stages):] {
+		h.Stages = append(h.Stages, &testStage{Name: name, Status: "skipped"})
+	}
+	h.OK = h.Error == ""
+	for _, stage := range h.Stages {
+		if stage.Status != "ok" {
+			h.OK = false
+		}
+	}
+}
+
+// testHosts tests the hosts matching target and prints the results
+func testHosts(out io.Writer, target string, opts TestOptions) error {
+	if opts.Jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	if opts.Format != "text" && opts.Format != "json" {
+		return fmt.Errorf("invalid format %q: use text or json", opts.Format)
+	}
+
+	cfg, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+	hosts := matchingHosts(cfg, target)
+	if len(hosts) == 0 {
+		// Like ssh, a name that is not an alias is still resolved
+		if strings.ContainsAny(target, "*?!,") {
+			return fmt.Errorf("no hosts in the SSH config match %s", target)
+		}
+		hosts = []string{target}
+	}
+
+	results := make([]*hostTest, len(hosts))
+	runJobs(len(hosts), opts.Jobs, func(i int) {
+		results[i] = testHost(cfg, cfg.Resolve(hosts[i]), opts.Timeout)
+	})
+
+	if opts.Format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Hosts []*hostTest `json:"hosts"`
+		}{results}); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+	} else {
+		printHostTests(out, results)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.OK {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d host(s) failed", failed, len(results))
+	}
+	return nil
+}
+
+// testHost connects to the resolved host one stage at a time
+func testHost(cfg *sshconfig.Config, resolved *sshconfig.Resolved, timeout time.Duration) *hostTest {
+	result := &hostTest{
+		Host:          resolved.Host,
+		HostName:      resolved.HostName(),
+		Port:          resolved.Port(),
+		User:          resolved.User(),
+		IdentityFiles: resolved.IdentityFiles(),
+		ProxyJump:     resolvedProxyJump(resolved),
+	}
+	if result.IdentityFiles == nil {
+		result.IdentityFiles = []string{}
+	}
+	defer result.finish()
+
+	t := newHostTarget(resolved, result.Port)
+	callback, algorithms, err := hostKeyVerifier(t)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stage := result.begin("tcp")
+	conn, closeJumps, err := dialProxyJump(ctx, cfg, result.ProxyJump, t.Addr)
+	defer closeJumps()
+	if err != nil {
+		stage.end(err, "")
+		return result
+	}
+	defer conn.Close()
+	if result.ProxyJump != "" {
+		stage.end(nil, "via "+result.ProxyJump)
+	} else {
+		stage.end(nil, conn.RemoteAddr().String())
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// The host key callback runs once the key exchange is done, which
+	// splits the login into its stages
+	handshake := result.begin("handshake")
+	var hostKey, auth *testStage
+	verify := func(hostname string, addr net.Addr, key ssh.PublicKey) error {
+		handshake.end(nil, "")
+		hostKey = result.begin("hostkey")
+		err := callback(hostname, addr, key)
+		hostKey.end(err, key.Type()+" "+ssh.FingerprintSHA256(key))
+		if err == nil {
+			auth = result.begin("auth")
+		}
+		return err
+	}
+	methods, closeAuth := hostAuthMethods(nil, resolved, true)
+	defer closeAuth()
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, t.Addr, &ssh.ClientConfig{
+		User:              result.User,
+		Auth:              methods,
+		HostKeyCallback:   verify,
+		HostKeyAlgorithms: algorithms,
+	})
+	switch {
+	case hostKey == nil:
+		handshake.end(err, "")
+	case auth != nil && err != nil:
+		auth.end(err, "")
+	case auth != nil:
+		auth.end(nil, "logged in as "+result.User)
+		ssh.NewClient(clientConn, chans, reqs).Close()
+	}
+	return result
+}
+
+// dialProxyJump connects to addr through the comma separated jump hosts of
+// a ProxyJump value, logging in to each like dialHost does, or directly
+// when there are none. The ProxyJump of the jump hosts themselves is not
+// followed. The returned function closes the jump host connections.
+func dialProxyJump(ctx context.Context, cfg *sshconfig.Config, proxyJump, addr string) (net.Conn, func(), error) {
+	var clients []*remote.Client
+	closeJumps := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+	dial := func(addr string) (net.Conn, error) {
+		if len(clients) == 0 {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+			}
+			return conn, nil
+		}
+		return clients[len(clients)-1].DialTCP(ctx, addr)
+	}
+
+	if proxyJump != "" {
+		for _, hop := range strings.Split(proxyJump, ",") {
+			user, host, port, err := parseJumpHost(strings.TrimSpace(hop))
+			if err != nil {
+				return nil, closeJumps, err
+			}
+			resolved := cfg.Resolve(host)
+			if port == 0 {
+				port = resolved.Port()
+			}
+			if user == "" {
+				user = resolved.User()
+			}
+			t := newHostTarget(resolved, port)
+			callback, algorithms, err := hostKeyVerifier(t)
+			if err != nil {
+				return nil, closeJumps, err
+			}
+			conn, err := dial(t.Addr)
+			if err != nil {
+				return nil, closeJumps, fmt.Errorf("jump host %s: %w", host, err)
+			}
+			auth, closeAuth := hostAuthMethods(nil, resolved, true)
+			client, err := remote.NewClient(ctx, conn, remote.Target{
+				Addr:              t.Addr,
+				User:              user,
+				Auth:              auth,
+				HostKeyCallback:   callback,
+				HostKeyAlgorithms: algorithms,
+			})
+			closeAuth()
+			if err != nil {
+				return nil, closeJumps, fmt.Errorf("jump host %s: %w", host, err)
+			}
+			clients = append(clients, client)
+		}
+	}
+
+	conn, err := dial(addr)
+	return conn, closeJumps, err
+}
+
+// resolvedProxyJump returns the ProxyJump of the resolved host, which is
+// empty when none is set
+func resolvedProxyJump(resolved *sshconfig.Resolved) string {
+	if proxyJump := resolved.Get("ProxyJump"); !strings.EqualFold(proxyJump, "none") {
+		return proxyJump
+	}
+	return ""
+}
+
+// parseJumpHost splits a ProxyJump hop of the form [user@]host[:port] or
+// ssh://[user@]host[:port]. The port is 0 when not given.
+func parseJumpHost(hop string) (string, string, int, error) {
+	rest := strings.TrimPrefix(hop, "ssh://")
+	user := ""
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		user, rest = rest[:i], rest[i+1:]
+	}
+	host, port := rest, 0
+	if h, p, err := net.SplitHostPort(rest); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 || n > 65535 {
+			return "", "", 0, fmt.Errorf("invalid port in ProxyJump host %q", hop)
+		}
+		host, port = h, n
+	}
+	if host == "" {
+		return "", "", 0, fmt.Errorf("invalid ProxyJump host %q", hop)
+	}
+	return user, host, port, nil
+}
+
+// printHostTests prints the configuration and stages of each tested host
+func printHostTests(out io.Writer, results []*hostTest) {
+	passed := 0
+	for i, result := range results {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		status := "FAILED"
+		if result.OK {
+			status = "ok"
+			passed++
+		}
+		fmt.Fprintf(out, "%s: %s\n", result.Host, status)
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "  HostName\t%s\n", result.HostName)
+		fmt.Fprintf(w, "  Port\t%d\n", result.Port)
+		fmt.Fprintf(w, "  User\t%s\n", result.User)
+		if len(result.IdentityFiles) > 0 {
+			fmt.Fprintf(w, "  IdentityFile\t%s\n", strings.Join(result.IdentityFiles, ", "))
+		} else {
+			fmt.Fprintf(w, "  IdentityFile\t(default identities)\n")
+		}
+		if result.ProxyJump != "" {
+			fmt.Fprintf(w, "  ProxyJump\t%s\n", result.ProxyJump)
+		}
+		w.Flush()
+
+		if result.Error != "" {
+			fmt.Fprintf(out, "  Error: %s\n", result.Error)
+			continue
+		}
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, stage := range result.Stages {
+			if stage.Status == "skipped" {
+				fmt.Fprintf(w, "  %s\tskipped\t\t\n", stage.Name)
+				continue
+			}
+			info := stage.Detail
+			if stage.Error != "" {
+				info = stage.Error
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", stage.Name, stage.Status, stage.duration.Round(100*time.Microsecond), info)
+		}
+		w.Flush()
+	}
+	fmt.Fprintf(out, "\n%d of %d host(s) ok\n", passed, len(results))
+}
+
+func init() {
+	TestCmd.Flags().StringVarP(&testOptions.Format, "format", "o", testOptions.Format, "Output format: text or json")
+	TestCmd.Flags().IntVarP(&testOptions.Jobs, "jobs", "j", testOptions.Jobs, "Number of hosts tested at the same time")
+	TestCmd.Flags().DurationVar(&testOptions.Timeout, "timeout", testOptions.Timeout, "Time allowed for connecting to and logging in to each host")
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+	"github.com/evberrypi/ssh-config/sshkeys"
+)
+
+func TestTestHosts(t *testing.T) {
+	f := newRemoteFixture(t)
+	sshDir := f.sshDir
+	login, err := sshkeys.Generate(sshkeys.GenerateOptions{Type: sshkeys.KeyTypeEd25519, Comment: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := login.Write(filepath.Join(sshDir, "id_ed25519"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Servers that accept the login key unless denied; the bastion forwards
+	// connections and the unknown server's keys are not in known_hosts
+	var config strings.Builder
+	for _, name := range []string{"web", "denied", "unknown", "bastion", "inner"} {
+		home := filepath.Join(f.dir, name)
+		if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if name != "denied" {
+			if err := os.WriteFile(filepath.Join(home, ".ssh", "authorized_keys"), login.AuthorizedKey(), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		server := remotetest.NewServerWithOptions(remotetest.Options{Home: home, Forward: name == "bastion"})
+		t.Cleanup(server.Close)
+		if name != "unknown" {
+			f.trustHostKeys(t, server)
+		}
+		fmt.Fprintf(&config, "Host %s\n    HostName %s\n    Port %d\n    User deploy\n", name, server.Host(), server.Port())
+		if name == "inner" {
+			config.WriteString("    ProxyJump bastion\n")
+		}
+		config.WriteString("\n")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	fmt.Fprintf(&config, "Host down\n    HostName 127.0.0.1\n    Port %d\n", closedPort)
+	f.writeConfig(t, config.String())
+
+	opts := TestOptions{Format: "json", Jobs: 3, Timeout: 10 * time.Second}
+	var out bytes.Buffer
+	if err := testHosts(&out, "*", opts); err == nil || !strings.Contains(err.Error(), "3 of 6 host(s) failed") {
+		t.Errorf("testHosts() error = %v; want 3 of 6 failed", err)
+	}
+	var report struct {
+		Hosts []hostTest `json:"hosts"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+
+	// The status of tcp, handshake, hostkey and auth for each host
+	want := map[string][]string{
+		"web":     {"ok", "ok", "ok", "ok"},
+		"bastion": {"ok", "ok", "ok", "ok"},
+		"inner":   {"ok", "ok", "ok", "ok"},
+		"denied":  {"ok", "ok", "ok", "failed"},
+		"unknown": {"ok", "ok", "failed", "skipped"},
+		"down":    {"failed", "skipped", "skipped", "skipped"},
+	}
+	if len(report.Hosts) != len(want) {
+		t.Fatalf("tested %d hosts; want %d", len(report.Hosts), len(want))
+	}
+	for _, result := range report.Hosts {
+		var got []string
+		for _, stage := range result.Stages {
+			got = append(got, stage.Status)
+		}
+		if strings.Join(got, " ") != strings.Join(want[result.Host], " ") {
+			t.Errorf("%s stages = %v; want %v", result.Host, got, want[result.Host])
+		}
+		if result.OK != (want[result.Host][3] == "ok") {
+			t.Errorf("%s ok = %v", result.Host, result.OK)
+		}
+		switch result.Host {
+		case "web":
+			if result.User != "deploy" || result.Port == 22 || len(result.IdentityFiles) != 0 {
+				t.Errorf("web config = %+v; want the resolved options", result)
+			}
+			if !strings.Contains(result.Stages[2].Detail, " SHA256:") {
+				t.Errorf("hostkey detail = %q; want the key fingerprint", result.Stages[2].Detail)
+			}
+		case "inner":
+			if result.ProxyJump != "bastion" || result.Stages[0].Detail != "via bastion" {
+				t.Errorf("inner = %+v; want reached via bastion", result)
+			}
+		case "unknown":
+			if !strings.Contains(result.Stages[2].Error, "not in known_hosts") {
+				t.Errorf("unknown hostkey error = %q", result.Stages[2].Error)
+			}
+		case "denied":
+			if !strings.Contains(result.Stages[3].Error, "unable to authenticate") {
+				t.Errorf("denied auth error = %q", result.Stages[3].Error)
+			}
+		}
+	}
+
+	// Text output for a single host
+	out.Reset()
+	opts.Format = "text"
+	if err := testHosts(&out, "inner", opts); err != nil {
+		t.Fatalf("testHosts() error = %v\n%s", err, out.String())
+	}
+	for _, want := range []string{"inner: ok", "User          deploy", "ProxyJump     bastion", "tcp", "via bastion", "logged in as deploy", "1 of 1 host(s) ok"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("text output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := testHosts(&out, "down", opts); err == nil {
+		t.Error("testHosts() expected error for an unreachable host")
+	}
+	if !strings.Contains(out.String(), "down: FAILED") || !strings.Contains(out.String(), "handshake  skipped") {
+		t.Errorf("text output = %q; want the failure and skipped stages", out.String())
+	}
+
+	invalid := []struct {
+		target string
+		opts   TestOptions
+	}{
+		{"web", TestOptions{Format: "yaml", Jobs: 1, Timeout: time.Second}},
+		{"web", TestOptions{Format: "text", Timeout: time.Second}},
+		{"nothing-*", TestOptions{Format: "text", Jobs: 1, Timeout: time.Second}},
+	}
+	for _, tt := range invalid {
+		if err := testHosts(&bytes.Buffer{}, tt.target, tt.opts); err == nil {
+			t.Errorf("testHosts(%q, %+v) expected error", tt.target, tt.opts)
+		}
+	}
+}
+
+func TestParseJumpHost(t *testing.T) {
+	tests := []struct {
+		hop     string
+		user    string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{"bastion", "", "bastion", 0, false},
+		{"admin@bastion", "admin", "bastion", 0, false},
+		{"admin@bastion:2222", "admin", "bastion", 2222, false},
+		{"ssh://admin@bastion:2222", "admin", "bastion", 2222, false},
+		{"[2001:db8::1]:22", "", "2001:db8::1", 22, false},
+		{"bastion:ssh", "", "", 0, true},
+		{"admin@", "", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hop, func(t *testing.T) {
+			user, host, port, err := parseJumpHost(tt.hop)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJumpHost(%q) error = %v; wantErr %v", tt.hop, err, tt.wantErr)
+			}
+			if !tt.wantErr && (user != tt.user || host != tt.host || port != tt.port) {
+				t.Errorf("parseJumpHost(%q) = %q, %q, %d; want %q, %q, %d", tt.hop, user, host, port, tt.user, tt.host, tt.port)
+			}
+		})
+	}
+}
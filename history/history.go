@@ -0,0 +1,153 @@
+// Package history records the hosts connected to through ssh-config and
+// ranks them by frecency, a mix of how often and how recently each host was
+// used, in the way of shell directory jumpers such as z and zoxide.
+//
+// The history file has a header recording when it was started, followed by
+// a line per host with its alias, number of connections and the time of the
+// last one, separated by tabs:
+//
+//	# ssh-config history since 2026-01-02T15:04:05Z
+//	prod-db	12	2026-10-19T09:30:00Z
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// header starts the first line of a history file, followed by its start time
+const header = "# ssh-config history since "
+
+// Entry records the connections to one host
+type Entry struct {
+	Host  string
+	Count int
+	Last  time.Time
+}
+
+// Score returns the frecency of the entry at now: the number of connections
+// weighted by how long ago the last one was
+func (e *Entry) Score(now time.Time) float64 {
+	age := now.Sub(e.Last)
+	weight := 0.25
+	switch {
+	case age < time.Hour:
+		weight = 4
+	case age < 24*time.Hour:
+		weight = 2
+	case age < 7*24*time.Hour:
+		weight = 0.5
+	}
+	return float64(e.Count) * weight
+}
+
+// History is a parsed history file
+type History struct {
+	// Since is when recording started, zero for an empty history
+	Since   time.Time
+	Entries []*Entry
+}
+
+// Parse parses the contents of a history file. Lines that cannot be parsed
+// are dropped, since losing one host's count is better than failing to
+// connect.
+func Parse(data []byte) *History {
+	h := &History{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if since, ok := strings.CutPrefix(line, header); ok {
+			h.Since, _ = time.Parse(time.RFC3339, since)
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[0] == "" || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil || count < 1 {
+			continue
+		}
+		last, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			continue
+		}
+		if e := h.Get(fields[0]); e != nil {
+			e.Count += count
+			if last.After(e.Last) {
+				e.Last = last
+			}
+			continue
+		}
+		h.Entries = append(h.Entries, &Entry{Host: fields[0], Count: count, Last: last})
+	}
+	if h.Since.IsZero() {
+		for _, e := range h.Entries {
+			if h.Since.IsZero() || e.Last.Before(h.Since) {
+				h.Since = e.Last
+			}
+		}
+	}
+	return h
+}
+
+// Get returns the entry of host, or nil if it was never connected to
+func (h *History) Get(host string) *Entry {
+	for _, e := range h.Entries {
+		if e.Host == host {
+			return e
+		}
+	}
+	return nil
+}
+
+// Record counts a connection to host at now
+func (h *History) Record(host string, now time.Time) {
+	if h.Since.IsZero() {
+		h.Since = now
+	}
+	if e := h.Get(host); e != nil {
+		e.Count++
+		e.Last = now
+		return
+	}
+	h.Entries = append(h.Entries, &Entry{Host: host, Count: 1, Last: now})
+}
+
+// Ranked returns the entries by frecency at now, highest first. Entries that
+// score the same are ordered by their last use, most recent first.
+func (h *History) Ranked(now time.Time) []*Entry {
+	ranked := append([]*Entry{}, h.Entries...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		si, sj := ranked[i].Score(now), ranked[j].Score(now)
+		if si != sj {
+			return si > sj
+		}
+		return ranked[i].Last.After(ranked[j].Last)
+	})
+	return ranked
+}
+
+// Scores returns the frecency of every host at now
+func (h *History) Scores(now time.Time) map[string]float64 {
+	scores := make(map[string]float64, len(h.Entries))
+	for _, e := range h.Entries {
+		scores[e.Host] = e.Score(now)
+	}
+	return scores
+}
+
+// Bytes formats the history file
+func (h *History) Bytes() []byte {
+	var buf bytes.Buffer
+	if !h.Since.IsZero() {
+		fmt.Fprintf(&buf, "%s%s\n", header, h.Since.UTC().Format(time.RFC3339))
+	}
+	for _, e := range h.Entries {
+		fmt.Fprintf(&buf, "%s\t%d\t%s\n", e.Host, e.Count, e.Last.UTC().Format(time.RFC3339))
+	}
+	return buf.Bytes()
+}
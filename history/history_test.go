@@ -0,0 +1,80 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		age  time.Duration
+		want float64
+	}{
+		{"Last hour", 10 * time.Minute, 40},
+		{"Last day", 5 * time.Hour, 20},
+		{"Last week", 3 * 24 * time.Hour, 5},
+		{"Older", 60 * 24 * time.Hour, 2.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Entry{Host: "web", Count: 10, Last: now.Add(-tt.age)}
+			if got := e.Score(now); got != tt.want {
+				t.Errorf("Score() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	h := Parse(nil)
+	if !h.Since.IsZero() || len(h.Entries) != 0 {
+		t.Fatalf("Parse(nil) = %+v; want an empty history", h)
+	}
+
+	// A host used often long ago ranks below one used a few times today
+	for i := 0; i < 10; i++ {
+		h.Record("old", now.AddDate(0, -3, 0))
+	}
+	h.Record("web", now.Add(-2*time.Hour))
+	h.Record("web", now.Add(-2*time.Hour))
+	h.Record("db", now.Add(-30*time.Minute))
+	h.Record("db", now.Add(-10*time.Minute))
+
+	if got := h.Get("old"); got == nil || got.Count != 10 {
+		t.Errorf("Get(old) = %+v; want 10 connections", got)
+	}
+	if !h.Since.Equal(now.AddDate(0, -3, 0)) {
+		t.Errorf("Since = %v; want the first connection", h.Since)
+	}
+	var ranked []string
+	for _, e := range h.Ranked(now) {
+		ranked = append(ranked, e.Host)
+	}
+	if want := []string{"db", "web", "old"}; !reflect.DeepEqual(ranked, want) {
+		t.Errorf("Ranked() = %q; want %q", ranked, want)
+	}
+	if scores := h.Scores(now); scores["db"] != 8 || scores["web"] != 4 || scores["old"] != 2.5 {
+		t.Errorf("Scores() = %v", scores)
+	}
+
+	// The file round trips, and malformed lines are dropped
+	data := string(h.Bytes()) + "broken line\nweb\tnot-a-number\t2026-10-19T00:00:00Z\n\ndb\t1\t2026-10-19T11:55:00Z\n"
+	parsed := Parse([]byte(data))
+	if !parsed.Since.Equal(h.Since) || len(parsed.Entries) != 3 {
+		t.Fatalf("Parse() = %+v; want the recorded history", parsed)
+	}
+	if db := parsed.Get("db"); db.Count != 3 || !db.Last.Equal(now.Add(-5*time.Minute)) {
+		t.Errorf("Get(db) = %+v; want duplicate lines merged", db)
+	}
+
+	// A file without a header starts at its oldest entry
+	parsed = Parse([]byte("web\t2\t2026-10-01T00:00:00Z\ndb\t1\t2026-09-01T00:00:00Z\n"))
+	if want := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC); !parsed.Since.Equal(want) {
+		t.Errorf("Since = %v; want %v", parsed.Since, want)
+	}
+}
@@ -0,0 +1,483 @@
+// Package keyformat converts SSH keys between the file formats used by
+// different tools: OpenSSH, PEM (PKCS#1 and SEC 1), PKCS#8, RFC 4716 (the
+// SSH2 public key format) and PuTTY's PPK.
+//
+// Keys are decoded into a Key holding the crypto key, its SSH public key and
+// its comment, and encoded from one. Formats that have no place for a comment
+// drop it, so converting through them loses it.
+package keyformat
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Formats understood by Decode and Encode
+const (
+	FormatOpenSSH = "openssh"
+	FormatPEM     = "pem"
+	FormatPKCS8   = "pkcs8"
+	FormatRFC4716 = "rfc4716"
+	FormatPPK     = "ppk"
+)
+
+// Formats lists the supported formats
+var Formats = []string{FormatOpenSSH, FormatPEM, FormatPKCS8, FormatRFC4716, FormatPPK}
+
+// PEM block types
+const (
+	pemOpenSSHPrivate   = "OPENSSH PRIVATE KEY"
+	pemRSAPrivate       = "RSA PRIVATE KEY"
+	pemECPrivate        = "EC PRIVATE KEY"
+	pemPrivate          = "PRIVATE KEY"
+	pemEncryptedPrivate = "ENCRYPTED PRIVATE KEY"
+	pemRSAPublic        = "RSA PUBLIC KEY"
+	pemPublic           = "PUBLIC KEY"
+)
+
+const (
+	rfc4716Begin = "---- BEGIN SSH2 PUBLIC KEY ----"
+	rfc4716End   = "---- END SSH2 PUBLIC KEY ----"
+)
+
+// ErrPassphrase is returned when an encrypted key is decoded with the wrong passphrase
+var ErrPassphrase = errors.New("incorrect passphrase")
+
+// Key is a decoded key. Private is nil for a public key.
+type Key struct {
+	Private crypto.PrivateKey
+	Public  ssh.PublicKey
+	Comment string
+}
+
+// PassphraseFunc returns the passphrase of an encrypted key. It is only
+// called for encrypted keys.
+type PassphraseFunc func() ([]byte, error)
+
+// EncodeOptions represents the options for encoding a key
+type EncodeOptions struct {
+	// Public encodes only the public half of a private key
+	Public bool
+	// Passphrase encrypts a private key when not empty
+	Passphrase []byte
+	// PPKVersion selects PuTTY-User-Key-File-2 or -3; 0 means 3
+	PPKVersion int
+}
+
+// ValidFormat reports whether format is one of Formats
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect returns the format of data and whether it holds a private key
+func Detect(data []byte) (string, bool, error) {
+	text := strings.TrimSpace(string(data))
+	switch {
+	case strings.HasPrefix(text, ppkHeaderPrefix):
+		return FormatPPK, true, nil
+	case strings.HasPrefix(text, rfc4716Begin):
+		return FormatRFC4716, false, nil
+	case strings.HasPrefix(text, "-----BEGIN "):
+		block, _ := pem.Decode([]byte(text))
+		if block == nil {
+			return "", false, fmt.Errorf("malformed PEM data")
+		}
+		switch block.Type {
+		case pemOpenSSHPrivate:
+			return FormatOpenSSH, true, nil
+		case pemRSAPrivate, pemECPrivate:
+			return FormatPEM, true, nil
+		case pemPrivate, pemEncryptedPrivate:
+			return FormatPKCS8, true, nil
+		case pemRSAPublic:
+			return FormatPEM, false, nil
+		case pemPublic:
+			return FormatPKCS8, false, nil
+		}
+		return "", false, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(text)); err != nil {
+		return "", false, fmt.Errorf("not a recognised key format")
+	}
+	return FormatOpenSSH, false, nil
+}
+
+// Decode reads a key in any supported format and returns it with the
+// format it was in. passphrase is called for encrypted private keys and may
+// be nil to reject them.
+func Decode(data []byte, passphrase PassphraseFunc) (*Key, string, error) {
+	format, private, err := Detect(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var key *Key
+	switch {
+	case format == FormatPPK:
+		key, err = decodePPK(data, passphrase)
+	case private:
+		key, err = decodePEMPrivate(data, passphrase)
+	case format == FormatRFC4716:
+		key, err = decodeRFC4716(data)
+	case format == FormatOpenSSH:
+		pub, comment, _, _, perr := ssh.ParseAuthorizedKey(data)
+		key, err = &Key{Public: pub, Comment: comment}, perr
+	default:
+		key, err = decodePEMPublic(data)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return key, format, nil
+}
+
+// decodePEMPrivate reads an OpenSSH, PEM or PKCS#8 private key
+func decodePEMPrivate(data []byte, passphrase PassphraseFunc) (*Key, error) {
+	block, _ := pem.Decode(data)
+	var raw any
+	var secret []byte
+	var err error
+	if block.Type == pemEncryptedPrivate {
+		if passphrase == nil {
+			return nil, fmt.Errorf("the key is encrypted")
+		}
+		var perr error
+		secret, perr = passphrase()
+		if perr != nil {
+			return nil, perr
+		}
+		der, derr := decryptPKCS8(block.Bytes, secret)
+		if derr != nil {
+			return nil, derr
+		}
+		raw, err = x509.ParsePKCS8PrivateKey(der)
+	} else {
+		raw, err = ssh.ParseRawPrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			if passphrase == nil {
+				return nil, fmt.Errorf("the key is encrypted")
+			}
+			var perr error
+			secret, perr = passphrase()
+			if perr != nil {
+				return nil, perr
+			}
+			raw, err = ssh.ParseRawPrivateKeyWithPassphrase(data, secret)
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, ErrPassphrase
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	key, err := NewKey(raw, "")
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == pemOpenSSHPrivate {
+		key.Comment = openSSHComment(block.Bytes, secret)
+	}
+	return key, nil
+}
+
+// NewKey returns the Key for a private key as returned by
+// ssh.ParseRawPrivateKey or a crypto key generator
+func NewKey(private crypto.PrivateKey, comment string) (*Key, error) {
+	if k, ok := private.(*ed25519.PrivateKey); ok {
+		private = *k
+	}
+	switch private.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive public key: %w", err)
+	}
+	return &Key{Private: private, Public: signer.PublicKey(), Comment: comment}, nil
+}
+
+// openSSHComment returns the comment stored in an OpenSSH private key. The
+// comment of an encrypted key is only readable after decryption, which the
+// ssh package does without returning it, so it is decrypted again with
+// passphrase; without one the comment is empty.
+func openSSHComment(data, passphrase []byte) string {
+	const magic = "openssh-key-v1\x00"
+	rest, found := bytes.CutPrefix(data, []byte(magic))
+	if !found {
+		return ""
+	}
+	var w struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(rest, &w); err != nil {
+		return ""
+	}
+	if w.CipherName != "none" {
+		if len(passphrase) == 0 {
+			return ""
+		}
+		block, err := decryptOpenSSH(w.CipherName, w.KdfName, w.KdfOpts, w.PrivKeyBlock, passphrase)
+		if err != nil {
+			return ""
+		}
+		w.PrivKeyBlock = block
+	}
+	var priv struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Rest    []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(w.PrivKeyBlock, &priv); err != nil {
+		return ""
+	}
+
+	var comment string
+	var err error
+	switch {
+	case priv.Keytype == ssh.KeyAlgoRSA:
+		var k struct {
+			N, E, D, Iqmp, P, Q *big.Int
+			Comment             string
+			Pad                 []byte `ssh:"rest"`
+		}
+		err = ssh.Unmarshal(priv.Rest, &k)
+		comment = k.Comment
+	case priv.Keytype == ssh.KeyAlgoED25519:
+		var k struct {
+			Pub, Priv []byte
+			Comment   string
+			Pad       []byte `ssh:"rest"`
+		}
+		err = ssh.Unmarshal(priv.Rest, &k)
+		comment = k.Comment
+	case strings.HasPrefix(priv.Keytype, "ecdsa-sha2-"):
+		var k struct {
+			Curve   string
+			Pub     []byte
+			D       *big.Int
+			Comment string
+			Pad     []byte `ssh:"rest"`
+		}
+		err = ssh.Unmarshal(priv.Rest, &k)
+		comment = k.Comment
+	}
+	if err != nil {
+		return ""
+	}
+	return comment
+}
+
+// decodePEMPublic reads a PKCS#1 or PKIX public key
+func decodePEMPublic(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	var pub any
+	var err error
+	if block.Type == pemRSAPublic {
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported public key: %w", err)
+	}
+	return &Key{Public: sshPub}, nil
+}
+
+// decodeRFC4716 reads an SSH2 public key, taking the comment from its
+// Comment header
+func decodeRFC4716(data []byte) (*Key, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	var body strings.Builder
+	var comment, header string
+	inKey := false
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == rfc4716Begin:
+			inKey = true
+			continue
+		case line == rfc4716End:
+			inKey = false
+			continue
+		case !inKey || line == "":
+			continue
+		}
+
+		// Headers are the only lines with a colon, or continue one
+		if header != "" || strings.Contains(line, ":") {
+			header += line
+			if strings.HasSuffix(header, "\\") {
+				header = strings.TrimSuffix(header, "\\")
+				continue
+			}
+			name, value, _ := strings.Cut(header, ":")
+			if strings.EqualFold(strings.TrimSpace(name), "Comment") {
+				comment = strings.TrimSpace(value)
+				if len(comment) >= 2 && strings.HasPrefix(comment, `"`) && strings.HasSuffix(comment, `"`) {
+					comment = comment[1 : len(comment)-1]
+				}
+			}
+			header = ""
+			continue
+		}
+		body.WriteString(line)
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH2 public key: %w", err)
+	}
+	pub, err := ssh.ParsePublicKey(blob)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH2 public key: %w", err)
+	}
+	return &Key{Public: pub, Comment: comment}, nil
+}
+
+// Encode writes key in format
+func Encode(key *Key, format string, opts EncodeOptions) ([]byte, error) {
+	if key.Private == nil || opts.Public {
+		if len(opts.Passphrase) > 0 {
+			return nil, fmt.Errorf("public keys cannot be encrypted")
+		}
+		return encodePublic(key, format)
+	}
+
+	switch format {
+	case FormatOpenSSH:
+		var block *pem.Block
+		var err error
+		if len(opts.Passphrase) > 0 {
+			block, err = ssh.MarshalPrivateKeyWithPassphrase(key.Private, key.Comment, opts.Passphrase)
+		} else {
+			block, err = ssh.MarshalPrivateKey(key.Private, key.Comment)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode private key: %w", err)
+		}
+		return pem.EncodeToMemory(block), nil
+	case FormatPEM:
+		if len(opts.Passphrase) > 0 {
+			return nil, fmt.Errorf("PEM private keys can only be encrypted with the legacy OpenSSL scheme; use pkcs8 for an encrypted key")
+		}
+		switch k := key.Private.(type) {
+		case *rsa.PrivateKey:
+			return pem.EncodeToMemory(&pem.Block{Type: pemRSAPrivate, Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+		case *ecdsa.PrivateKey:
+			der, err := x509.MarshalECPrivateKey(k)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode private key: %w", err)
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: pemECPrivate, Bytes: der}), nil
+		}
+		return nil, fmt.Errorf("%s keys have no PEM format; use pkcs8", key.Public.Type())
+	case FormatPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode private key: %w", err)
+		}
+		if len(opts.Passphrase) == 0 {
+			return pem.EncodeToMemory(&pem.Block{Type: pemPrivate, Bytes: der}), nil
+		}
+		encrypted, err := encryptPKCS8(der, opts.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemEncryptedPrivate, Bytes: encrypted}), nil
+	case FormatPPK:
+		return encodePPK(key, opts)
+	case FormatRFC4716:
+		return nil, fmt.Errorf("the rfc4716 format only holds public keys")
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// encodePublic writes the public half of key in format
+func encodePublic(key *Key, format string) ([]byte, error) {
+	if _, ok := key.Public.(*ssh.Certificate); ok && format != FormatOpenSSH {
+		return nil, fmt.Errorf("certificates can only be written in the openssh format")
+	}
+
+	switch format {
+	case FormatOpenSSH:
+		line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key.Public)))
+		if key.Comment != "" {
+			line += " " + key.Comment
+		}
+		return []byte(line + "\n"), nil
+	case FormatRFC4716:
+		return encodeRFC4716(key), nil
+	case FormatPEM, FormatPKCS8:
+		cryptoPub, ok := key.Public.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported public key type %s", key.Public.Type())
+		}
+		pub := cryptoPub.CryptoPublicKey()
+		if rsaPub, ok := pub.(*rsa.PublicKey); ok && format == FormatPEM {
+			return pem.EncodeToMemory(&pem.Block{Type: pemRSAPublic, Bytes: x509.MarshalPKCS1PublicKey(rsaPub)}), nil
+		}
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode public key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemPublic, Bytes: der}), nil
+	case FormatPPK:
+		return nil, fmt.Errorf("PuTTY public keys use the rfc4716 format")
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// encodeRFC4716 writes an SSH2 public key. Header lines are limited to 72
+// bytes and continued with a backslash; the key is wrapped at 70 columns.
+func encodeRFC4716(key *Key) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(rfc4716Begin + "\n")
+	if key.Comment != "" {
+		header := `Comment: "` + key.Comment + `"`
+		for len(header) > 72 {
+			buf.WriteString(header[:71] + "\\\n")
+			header = header[71:]
+		}
+		buf.WriteString(header + "\n")
+	}
+	encoded := base64.StdEncoding.EncodeToString(key.Public.Marshal())
+	for len(encoded) > 70 {
+		buf.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	buf.WriteString(encoded + "\n")
+	buf.WriteString(rfc4716End + "\n")
+	return buf.Bytes()
+}
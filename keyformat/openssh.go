@@ -0,0 +1,114 @@
+package keyformat
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"fmt"
+
+	"golang.org/x/crypto/blowfish"
+	"golang.org/x/crypto/ssh"
+)
+
+// decryptOpenSSH decrypts the private block of an OpenSSH key, which the
+// ssh package does without returning it, so its comment can be read
+func decryptOpenSSH(cipherName, kdfName, kdfOpts string, block, passphrase []byte) ([]byte, error) {
+	if kdfName != "bcrypt" {
+		return nil, fmt.Errorf("unsupported key derivation %q", kdfName)
+	}
+	var opts struct {
+		Salt   string
+		Rounds uint32
+	}
+	if err := ssh.Unmarshal([]byte(kdfOpts), &opts); err != nil {
+		return nil, fmt.Errorf("invalid key derivation options: %w", err)
+	}
+	k, err := bcryptPBKDF(passphrase, []byte(opts.Salt), int(opts.Rounds), 32+aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	c, err := aes.NewCipher(k[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, len(block))
+	switch cipherName {
+	case "aes256-ctr":
+		cipher.NewCTR(c, k[32:]).XORKeyStream(plain, block)
+	case "aes256-cbc":
+		if len(block)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid encrypted private key length")
+		}
+		cipher.NewCBCDecrypter(c, k[32:]).CryptBlocks(plain, block)
+	default:
+		return nil, fmt.Errorf("unsupported cipher %q", cipherName)
+	}
+	return plain, nil
+}
+
+// bcryptPBKDF derives a key from a passphrase as OpenSSH does for its
+// encrypted private keys: PBKDF2 with bcrypt in place of HMAC, and the
+// output bytes spread across the blocks
+func bcryptPBKDF(password, salt []byte, rounds, keyLen int) ([]byte, error) {
+	const blockSize = 32
+	switch {
+	case rounds < 1:
+		return nil, fmt.Errorf("invalid bcrypt rounds %d", rounds)
+	case len(password) == 0:
+		return nil, fmt.Errorf("empty passphrase")
+	case len(salt) == 0 || len(salt) > 1<<20:
+		return nil, fmt.Errorf("invalid bcrypt salt")
+	}
+
+	numBlocks := (keyLen + blockSize - 1) / blockSize
+	key := make([]byte, numBlocks*blockSize)
+	h := sha512.New()
+	h.Write(password)
+	shapass := h.Sum(nil)
+
+	tmp := make([]byte, blockSize)
+	for block := 1; block <= numBlocks; block++ {
+		h.Reset()
+		h.Write(salt)
+		h.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		bcryptHash(tmp, shapass, h.Sum(nil))
+
+		out := make([]byte, blockSize)
+		copy(out, tmp)
+		for i := 2; i <= rounds; i++ {
+			h.Reset()
+			h.Write(tmp)
+			bcryptHash(tmp, shapass, h.Sum(nil))
+			for j := range out {
+				out[j] ^= tmp[j]
+			}
+		}
+		for i, v := range out {
+			key[i*numBlocks+block-1] = v
+		}
+	}
+	return key[:keyLen], nil
+}
+
+// bcryptHash is the bcrypt variant used by bcryptPBKDF
+func bcryptHash(out, shapass, shasalt []byte) {
+	c, err := blowfish.NewSaltedCipher(shapass, shasalt)
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < 64; i++ {
+		blowfish.ExpandKey(shasalt, c)
+		blowfish.ExpandKey(shapass, c)
+	}
+	copy(out, "OxychromaticBlowfishSwatDynamite")
+	for i := 0; i < 32; i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(out[i:i+8], out[i:i+8])
+		}
+	}
+	// The words are little-endian
+	for i := 0; i < 32; i += 4 {
+		out[i], out[i+1], out[i+2], out[i+3] = out[i+3], out[i+2], out[i+1], out[i]
+	}
+}
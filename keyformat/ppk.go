@@ -0,0 +1,420 @@
+package keyformat
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// ppkHeaderPrefix starts every PuTTY private key file
+const ppkHeaderPrefix = "PuTTY-User-Key-File-"
+
+// PPK encryption settings
+const (
+	ppkEncryptionNone = "none"
+	ppkEncryptionAES  = "aes256-cbc"
+	ppkMACKeyPrefix   = "putty-private-key-file-mac-key"
+)
+
+// Argon2 parameters for new version 3 files, matching puttygen's defaults
+const (
+	ppkArgon2Flavour     = "Argon2id"
+	ppkArgon2Memory      = 8192
+	ppkArgon2Passes      = 13
+	ppkArgon2Parallelism = 1
+)
+
+// ppkFile is a parsed PuTTY private key file
+type ppkFile struct {
+	Version    int
+	Algorithm  string
+	Encryption string
+	Comment    string
+	Public     []byte
+	Private    []byte
+	MAC        []byte
+	// Headers holds the remaining headers, such as the Argon2 parameters
+	Headers map[string]string
+}
+
+// parsePPK splits a PuTTY private key file into its fields
+func parsePPK(data []byte) (*ppkFile, error) {
+	f := &ppkFile{Headers: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	readLines := func(count string) ([]byte, error) {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid line count %q", count)
+		}
+		var encoded strings.Builder
+		for i := 0; i < n; i++ {
+			if !scanner.Scan() {
+				return nil, fmt.Errorf("unexpected end of file")
+			}
+			encoded.WriteString(strings.TrimSpace(scanner.Text()))
+		}
+		return base64.StdEncoding.DecodeString(encoded.String())
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid PuTTY key line %q", line)
+		}
+		value = strings.TrimPrefix(value, " ")
+		var err error
+		switch {
+		case strings.HasPrefix(name, ppkHeaderPrefix):
+			f.Version, err = strconv.Atoi(strings.TrimPrefix(name, ppkHeaderPrefix))
+			f.Algorithm = value
+		case name == "Encryption":
+			f.Encryption = value
+		case name == "Comment":
+			f.Comment = value
+		case name == "Public-Lines":
+			f.Public, err = readLines(value)
+		case name == "Private-Lines":
+			f.Private, err = readLines(value)
+		case name == "Private-MAC":
+			f.MAC, err = hex.DecodeString(value)
+		default:
+			f.Headers[name] = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid PuTTY key %s: %w", name, err)
+		}
+	}
+	if f.Version != 2 && f.Version != 3 {
+		return nil, fmt.Errorf("unsupported PuTTY key file version %d", f.Version)
+	}
+	if f.Public == nil || f.Private == nil || f.MAC == nil {
+		return nil, fmt.Errorf("incomplete PuTTY key file")
+	}
+	return f, nil
+}
+
+// ppkKeys derives the cipher key, IV and MAC key for a file. Version 2
+// uses SHA-1 based derivations with a zero IV; version 3 derives all three
+// from the passphrase with Argon2, and uses an empty MAC key when the file
+// is not encrypted.
+func ppkKeys(version int, encrypted bool, passphrase []byte, headers map[string]string) (cipherKey, iv, macKey []byte, err error) {
+	if version == 2 {
+		if encrypted {
+			for counter := uint32(0); len(cipherKey) < 32; counter++ {
+				h := sha1.New()
+				binary.Write(h, binary.BigEndian, counter)
+				h.Write(passphrase)
+				cipherKey = h.Sum(cipherKey)
+			}
+			cipherKey = cipherKey[:32]
+			iv = make([]byte, aes.BlockSize)
+		}
+		h := sha1.New()
+		h.Write([]byte(ppkMACKeyPrefix))
+		h.Write(passphrase)
+		return cipherKey, iv, h.Sum(nil), nil
+	}
+
+	if !encrypted {
+		return nil, nil, nil, nil
+	}
+	memory, err1 := strconv.ParseUint(headers["Argon2-Memory"], 10, 32)
+	passes, err2 := strconv.ParseUint(headers["Argon2-Passes"], 10, 32)
+	parallelism, err3 := strconv.ParseUint(headers["Argon2-Parallelism"], 10, 8)
+	salt, err4 := hex.DecodeString(headers["Argon2-Salt"])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || parallelism == 0 {
+		return nil, nil, nil, fmt.Errorf("invalid Argon2 parameters")
+	}
+	const length = 32 + aes.BlockSize + 32
+	var derived []byte
+	switch headers["Key-Derivation"] {
+	case "Argon2id":
+		derived = argon2.IDKey(passphrase, salt, uint32(passes), uint32(memory), uint8(parallelism), length)
+	case "Argon2i":
+		derived = argon2.Key(passphrase, salt, uint32(passes), uint32(memory), uint8(parallelism), length)
+	default:
+		return nil, nil, nil, fmt.Errorf("unsupported key derivation %q", headers["Key-Derivation"])
+	}
+	return derived[:32], derived[32 : 32+aes.BlockSize], derived[32+aes.BlockSize:], nil
+}
+
+// ppkMAC computes the MAC protecting the fields of a file
+func ppkMAC(version int, macKey []byte, f *ppkFile, private []byte) []byte {
+	newHash := sha256.New
+	if version == 2 {
+		newHash = func() hash.Hash { return sha1.New() }
+	}
+	mac := hmac.New(newHash, macKey)
+	mac.Write(ssh.Marshal(struct {
+		Algorithm, Encryption, Comment string
+		Public, Private                []byte
+	}{f.Algorithm, f.Encryption, f.Comment, f.Public, private}))
+	return mac.Sum(nil)
+}
+
+// decodePPK reads a PuTTY private key file, version 2 or 3
+func decodePPK(data []byte, passphrase PassphraseFunc) (*Key, error) {
+	f, err := parsePPK(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret []byte
+	switch f.Encryption {
+	case ppkEncryptionNone:
+	case ppkEncryptionAES:
+		if passphrase == nil {
+			return nil, fmt.Errorf("the key is encrypted")
+		}
+		if secret, err = passphrase(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PuTTY key encryption %q", f.Encryption)
+	}
+
+	encrypted := f.Encryption != ppkEncryptionNone
+	cipherKey, iv, macKey, err := ppkKeys(f.Version, encrypted, secret, f.Headers)
+	if err != nil {
+		return nil, err
+	}
+	private := f.Private
+	if encrypted {
+		if len(private)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid PuTTY private key length")
+		}
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		private = make([]byte, len(f.Private))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(private, f.Private)
+	}
+	if !hmac.Equal(ppkMAC(f.Version, macKey, f, private), f.MAC) {
+		if encrypted {
+			return nil, ErrPassphrase
+		}
+		return nil, fmt.Errorf("PuTTY key file is corrupt: MAC mismatch")
+	}
+
+	pub, err := ssh.ParsePublicKey(f.Public)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PuTTY public key: %w", err)
+	}
+	if pub.Type() != f.Algorithm {
+		return nil, fmt.Errorf("PuTTY key type %s does not match its public key %s", f.Algorithm, pub.Type())
+	}
+	key, err := ppkPrivateKey(pub, private)
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(key, f.Comment)
+}
+
+// ppkPrivateKey rebuilds a private key from its public key and the PuTTY
+// private blob, which may be followed by padding
+func ppkPrivateKey(pub ssh.PublicKey, blob []byte) (any, error) {
+	cryptoPub, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported PuTTY key type %s", pub.Type())
+	}
+	switch pk := cryptoPub.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		var w struct {
+			D, P, Q, Iqmp *big.Int
+			Rest          []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(blob, &w); err != nil {
+			return nil, fmt.Errorf("invalid PuTTY RSA key: %w", err)
+		}
+		key := &rsa.PrivateKey{PublicKey: *pk, D: w.D, Primes: []*big.Int{w.P, w.Q}}
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid PuTTY RSA key: %w", err)
+		}
+		key.Precompute()
+		return key, nil
+	case ed25519.PublicKey:
+		var w struct {
+			Seed []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(blob, &w); err != nil || len(w.Seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid PuTTY Ed25519 key")
+		}
+		key := ed25519.NewKeyFromSeed(w.Seed)
+		if !bytes.Equal(key.Public().(ed25519.PublicKey), pk) {
+			return nil, fmt.Errorf("PuTTY Ed25519 key does not match its public key")
+		}
+		return key, nil
+	case *ecdsa.PublicKey:
+		var w struct {
+			D    *big.Int
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(blob, &w); err != nil {
+			return nil, fmt.Errorf("invalid PuTTY ECDSA key: %w", err)
+		}
+		key := &ecdsa.PrivateKey{PublicKey: *pk, D: w.D}
+		if err := checkECDSAKey(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported PuTTY key type %s", pub.Type())
+}
+
+// checkECDSAKey checks that the private scalar of key matches its public point
+func checkECDSAKey(key *ecdsa.PrivateKey) error {
+	curves := map[elliptic.Curve]ecdh.Curve{elliptic.P256(): ecdh.P256(), elliptic.P384(): ecdh.P384(), elliptic.P521(): ecdh.P521()}
+	curve, ok := curves[key.Curve]
+	if !ok {
+		return fmt.Errorf("unsupported ECDSA curve")
+	}
+	scalar := make([]byte, (key.Curve.Params().BitSize+7)/8)
+	if key.D.Sign() <= 0 || len(key.D.Bytes()) > len(scalar) {
+		return fmt.Errorf("invalid PuTTY ECDSA key")
+	}
+	priv, err := curve.NewPrivateKey(key.D.FillBytes(scalar))
+	if err != nil {
+		return fmt.Errorf("invalid PuTTY ECDSA key: %w", err)
+	}
+	want, err := key.PublicKey.ECDH()
+	if err != nil {
+		return fmt.Errorf("invalid PuTTY ECDSA key: %w", err)
+	}
+	if !priv.PublicKey().Equal(want) {
+		return fmt.Errorf("PuTTY ECDSA key does not match its public key")
+	}
+	return nil
+}
+
+// ppkPrivateBlob encodes the private fields of key as PuTTY stores them
+func ppkPrivateBlob(key any) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, fmt.Errorf("multi-prime RSA keys are not supported by PuTTY")
+		}
+		iqmp := new(big.Int).ModInverse(k.Primes[1], k.Primes[0])
+		return ssh.Marshal(struct{ D, P, Q, Iqmp *big.Int }{k.D, k.Primes[0], k.Primes[1], iqmp}), nil
+	case ed25519.PrivateKey:
+		return ssh.Marshal(struct{ Seed []byte }{k.Seed()}), nil
+	case *ecdsa.PrivateKey:
+		return ssh.Marshal(struct{ D *big.Int }{k.D}), nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+// encodePPK writes a PuTTY private key file. Like puttygen, the private
+// blob of an encrypted key is padded to the cipher block size with bytes
+// of its SHA-1 hash.
+func encodePPK(key *Key, opts EncodeOptions) ([]byte, error) {
+	version := opts.PPKVersion
+	if version == 0 {
+		version = 3
+	}
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported PuTTY key file version %d: use 2 or 3", version)
+	}
+	private, err := ppkPrivateBlob(key.Private)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := len(opts.Passphrase) > 0
+	f := &ppkFile{
+		Version:    version,
+		Algorithm:  key.Public.Type(),
+		Encryption: ppkEncryptionNone,
+		Comment:    key.Comment,
+		Public:     key.Public.Marshal(),
+		Headers:    make(map[string]string),
+	}
+	if encrypted {
+		f.Encryption = ppkEncryptionAES
+		if padding := len(private) % aes.BlockSize; padding != 0 {
+			sum := sha1.Sum(private)
+			private = append(private, sum[:aes.BlockSize-padding]...)
+		}
+		if version == 3 {
+			salt := make([]byte, 16)
+			if _, err := rand.Read(salt); err != nil {
+				return nil, err
+			}
+			f.Headers["Key-Derivation"] = ppkArgon2Flavour
+			f.Headers["Argon2-Memory"] = strconv.Itoa(ppkArgon2Memory)
+			f.Headers["Argon2-Passes"] = strconv.Itoa(ppkArgon2Passes)
+			f.Headers["Argon2-Parallelism"] = strconv.Itoa(ppkArgon2Parallelism)
+			f.Headers["Argon2-Salt"] = hex.EncodeToString(salt)
+		}
+	}
+
+	cipherKey, iv, macKey, err := ppkKeys(version, encrypted, opts.Passphrase, f.Headers)
+	if err != nil {
+		return nil, err
+	}
+	f.MAC = ppkMAC(version, macKey, f, private)
+	f.Private = private
+	if encrypted {
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		f.Private = make([]byte, len(private))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(f.Private, private)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s%d: %s\n", ppkHeaderPrefix, f.Version, f.Algorithm)
+	fmt.Fprintf(&buf, "Encryption: %s\n", f.Encryption)
+	fmt.Fprintf(&buf, "Comment: %s\n", f.Comment)
+	writePPKLines(&buf, "Public-Lines", f.Public)
+	if version == 3 && encrypted {
+		for _, name := range []string{"Key-Derivation", "Argon2-Memory", "Argon2-Passes", "Argon2-Parallelism", "Argon2-Salt"} {
+			fmt.Fprintf(&buf, "%s: %s\n", name, f.Headers[name])
+		}
+	}
+	writePPKLines(&buf, "Private-Lines", f.Private)
+	fmt.Fprintf(&buf, "Private-MAC: %s\n", hex.EncodeToString(f.MAC))
+	return buf.Bytes(), nil
+}
+
+// writePPKLines writes data as base64 wrapped at 64 columns after a line count header
+func writePPKLines(buf *bytes.Buffer, name string, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines []string
+	for len(encoded) > 64 {
+		lines = append(lines, encoded[:64])
+		encoded = encoded[64:]
+	}
+	lines = append(lines, encoded)
+	fmt.Fprintf(buf, "%s: %d\n", name, len(lines))
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+}
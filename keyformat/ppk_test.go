@@ -0,0 +1,80 @@
+package keyformat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPPKFile(t *testing.T) {
+	key := newTestKey(t, "ed25519", "eddsa-key-20260301")
+	tests := []struct {
+		name       string
+		version    int
+		passphrase string
+		headers    []string
+	}{
+		{"Version 3", 0, "", []string{"PuTTY-User-Key-File-3: ssh-ed25519", "Encryption: none"}},
+		{"Version 3 encrypted", 3, "secret", []string{"Encryption: aes256-cbc", "Key-Derivation: Argon2id", "Argon2-Memory: 8192"}},
+		{"Version 2", 2, "", []string{"PuTTY-User-Key-File-2: ssh-ed25519", "Encryption: none"}},
+		{"Version 2 encrypted", 2, "secret", []string{"Encryption: aes256-cbc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encode(key, FormatPPK, EncodeOptions{PPKVersion: tt.version, Passphrase: []byte(tt.passphrase)})
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			text := string(data)
+			for _, header := range append(tt.headers, "Comment: eddsa-key-20260301", "Public-Lines: 2", "Private-MAC: ") {
+				if !strings.Contains(text, header) {
+					t.Errorf("PPK file lacks %q:\n%s", header, text)
+				}
+			}
+			if tt.version == 2 && strings.Contains(text, "Argon2") {
+				t.Error("version 2 file has Argon2 parameters")
+			}
+
+			// CRLF line endings, as written on Windows, are accepted
+			decoded, _, err := Decode([]byte(strings.ReplaceAll(text, "\n", "\r\n")), passphraseFunc(tt.passphrase))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			samePrivateKey(t, decoded, key)
+
+			// Changing any field breaks the MAC
+			tampered := strings.Replace(text, "Comment: eddsa-key-20260301", "Comment: eddsa-key-20260302", 1)
+			if _, _, err := Decode([]byte(tampered), passphraseFunc(tt.passphrase)); err == nil {
+				t.Error("Decode() accepted a tampered comment")
+			}
+		})
+	}
+
+	if _, err := Encode(key, FormatPPK, EncodeOptions{PPKVersion: 1}); err == nil {
+		t.Error("Encode() expected error for version 1")
+	}
+}
+
+func TestParsePPKErrors(t *testing.T) {
+	valid, err := Encode(newTestKey(t, "ed25519", "test"), FormatPPK, EncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(valid)
+	invalid := map[string]string{
+		"Version 1":       strings.Replace(text, "File-3", "File-1", 1),
+		"Bad line count":  strings.Replace(text, "Public-Lines: 2", "Public-Lines: x", 1),
+		"Too many lines":  strings.Replace(text, "Public-Lines: 2", "Public-Lines: 20", 1),
+		"Missing MAC":     text[:strings.Index(text, "Private-MAC")],
+		"Bad MAC":         strings.Replace(text, "Private-MAC: ", "Private-MAC: zz", 1),
+		"Unknown cipher":  strings.Replace(text, "Encryption: none", "Encryption: 3des-cbc", 1),
+		"Not a key line":  text + "garbage\n",
+		"Wrong key type":  strings.Replace(text, "File-3: ssh-ed25519", "File-3: ssh-rsa", 1),
+		"Unknown KDF":     strings.Replace(text, "Encryption: none", "Encryption: aes256-cbc\nKey-Derivation: Argon2d", 1),
+		"Truncated blobs": strings.Replace(text, "Private-Lines: 1", "Private-Lines: 0", 1),
+	}
+	for name, data := range invalid {
+		if _, _, err := Decode([]byte(data), passphraseFunc("secret")); err == nil {
+			t.Errorf("%s: Decode() expected error", name)
+		}
+	}
+}
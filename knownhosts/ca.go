@@ -0,0 +1,116 @@
+package knownhosts
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CertAuthorities returns the @cert-authority lines of the file
+func (f *File) CertAuthorities() []*Line {
+	var lines []*Line
+	for _, line := range f.Entries() {
+		if line.Entry.Marker == MarkerCertAuthority {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// IsHostAuthority reports whether an @cert-authority line trusts key to
+// sign the host keys of host on port, as ssh checks host certificates. A CA
+// key marked @revoked for the host is never trusted.
+func (f *File) IsHostAuthority(host string, port int, key ssh.PublicKey) bool {
+	trusted := false
+	for _, line := range f.Entries() {
+		entry := line.Entry
+		if !entry.hasKey(key) || !entry.Match(host, port) {
+			continue
+		}
+		switch entry.Marker {
+		case MarkerRevoked:
+			return false
+		case MarkerCertAuthority:
+			trusted = true
+		}
+	}
+	return trusted
+}
+
+// hasKey reports whether the entry holds key
+func (e *Entry) hasKey(key ssh.PublicKey) bool {
+	pub, err := e.PublicKey()
+	return err == nil && bytes.Equal(pub.Marshal(), key.Marshal())
+}
+
+// TrustCA trusts key to sign the host keys of the hosts matching patterns.
+// Patterns are added to an existing @cert-authority line for the key, so
+// each CA appears once; otherwise a new line is appended. It returns the
+// number of patterns that were not already trusted.
+func (f *File) TrustCA(patterns []string, key ssh.PublicKey, comment string) int {
+	for _, line := range f.CertAuthorities() {
+		if !line.Entry.hasKey(key) {
+			continue
+		}
+		added := 0
+		for _, pattern := range patterns {
+			if !containsFold(line.Entry.Hosts, pattern) {
+				line.Entry.Hosts = append(line.Entry.Hosts, pattern)
+				line.Modified = true
+				added++
+			}
+		}
+		return added
+	}
+
+	entry := &Entry{
+		Marker:  MarkerCertAuthority,
+		Hosts:   patterns,
+		KeyType: key.Type(),
+		KeyData: strings.Fields(string(ssh.MarshalAuthorizedKey(key)))[1],
+		Comment: comment,
+	}
+	f.Lines = append(f.Lines, &Line{Entry: entry, Modified: true})
+	return len(patterns)
+}
+
+// UntrustCA stops trusting key for patterns, removing lines left without
+// patterns, or for every host when no patterns are given. It returns the
+// number of @cert-authority lines changed or removed.
+func (f *File) UntrustCA(key ssh.PublicKey, patterns []string) int {
+	changed := 0
+	f.Remove(func(line *Line) bool {
+		if line.Entry == nil || line.Entry.Marker != MarkerCertAuthority || !line.Entry.hasKey(key) {
+			return false
+		}
+		if len(patterns) == 0 {
+			changed++
+			return true
+		}
+
+		var kept []string
+		for _, host := range line.Entry.Hosts {
+			if !containsFold(patterns, host) {
+				kept = append(kept, host)
+			}
+		}
+		if len(kept) == len(line.Entry.Hosts) {
+			return false
+		}
+		changed++
+		line.Entry.Hosts = kept
+		line.Modified = true
+		return len(kept) == 0
+	})
+	return changed
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
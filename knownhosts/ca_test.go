@@ -0,0 +1,109 @@
+package knownhosts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestTrustCA(t *testing.T) {
+	ca := newTestKey(t)
+	other := newTestKey(t)
+	content := "# corp hosts\nweb.example.com ssh-ed25519 WEB\n"
+	file := Parse([]byte(content))
+
+	if added := file.TrustCA([]string{"*.corp"}, ca, "corp host CA"); added != 1 {
+		t.Errorf("TrustCA() = %d; want 1", added)
+	}
+	if added := file.TrustCA([]string{"*.corp", "*.corp.example.com"}, ca, ""); added != 1 {
+		t.Errorf("TrustCA() again = %d; want 1", added)
+	}
+	file.TrustCA([]string{"*.lab"}, other, "")
+
+	cas := file.CertAuthorities()
+	if len(cas) != 2 {
+		t.Fatalf("CertAuthorities() = %d lines; want 2", len(cas))
+	}
+	want := "@cert-authority *.corp,*.corp.example.com " + ca.Type() + " " + keyData(ca) + " corp host CA"
+	if got := cas[0].Text(); got != want {
+		t.Errorf("CA line = %q; want %q", got, want)
+	}
+
+	// Round trip through the file format
+	file = Parse(file.Bytes())
+	if got := file.CheckKey("web.example.com", 22, ca); got != KeyUnknown {
+		t.Errorf("CheckKey() of CA key = %v; want KeyUnknown", got)
+	}
+
+	if changed := file.UntrustCA(ca, []string{"*.corp"}); changed != 1 {
+		t.Errorf("UntrustCA() = %d; want 1", changed)
+	}
+	if got := file.CertAuthorities()[0].Entry.Hosts; len(got) != 1 || got[0] != "*.corp.example.com" {
+		t.Errorf("CA hosts after untrusting a pattern = %v", got)
+	}
+	if changed := file.UntrustCA(ca, []string{"*.nowhere"}); changed != 0 {
+		t.Errorf("UntrustCA() for an unknown pattern = %d; want 0", changed)
+	}
+	if changed := file.UntrustCA(ca, []string{"*.corp.example.com"}); changed != 1 {
+		t.Errorf("UntrustCA() of the last pattern = %d; want 1", changed)
+	}
+	if changed := file.UntrustCA(other, nil); changed != 1 {
+		t.Errorf("UntrustCA() of every pattern = %d; want 1", changed)
+	}
+	if got := string(file.Bytes()); got != content {
+		t.Errorf("Bytes() = %q; want %q", got, content)
+	}
+}
+
+func keyData(key ssh.PublicKey) string {
+	entry, err := ParseEntry("host " + string(ssh.MarshalAuthorizedKey(key)))
+	if err != nil {
+		panic(err)
+	}
+	return entry.KeyData
+}
+
+func TestIsHostAuthority(t *testing.T) {
+	ca := newTestKey(t)
+	revoked := newTestKey(t)
+	line := func(marker, hosts string, key ssh.PublicKey) string {
+		return marker + " " + hosts + " " + string(ssh.MarshalAuthorizedKey(key))
+	}
+	file := Parse([]byte(line("@cert-authority", "*.corp,[db.corp]:2222", ca) +
+		line("@cert-authority", "*", revoked) +
+		line("@revoked", "*.corp", revoked) +
+		"web.corp " + string(ssh.MarshalAuthorizedKey(newTestKey(t)))))
+
+	tests := []struct {
+		host string
+		port int
+		key  ssh.PublicKey
+		want bool
+	}{
+		{"web.corp", 22, ca, true},
+		{"db.corp", 2222, ca, true},
+		{"web.lab", 22, ca, false},
+		{"web.corp", 22, revoked, false},
+		{"web.lab", 22, revoked, true},
+		{"web.corp", 22, newTestKey(t), false},
+	}
+	for _, tt := range tests {
+		if got := file.IsHostAuthority(tt.host, tt.port, tt.key); got != tt.want {
+			t.Errorf("IsHostAuthority(%s:%d) = %v; want %v", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package knownhosts
+
+import "strings"
+
+// Kinds of problems reported by Check
+const (
+	// ProblemConflict is a host with two different keys of the same type
+	ProblemConflict = "conflict"
+	// ProblemDuplicate is a key recorded again for a host that already has it
+	ProblemDuplicate = "duplicate"
+	// ProblemUnreferenced is a plain host name that no configured host uses
+	ProblemUnreferenced = "unreferenced"
+	// ProblemUnmapped is a hashed entry that matches no configured host
+	ProblemUnmapped = "unmapped"
+)
+
+// Problem is an issue found in a known_hosts file
+type Problem struct {
+	Kind string
+	// Host is the normalized host name the problem concerns, empty for unmapped entries
+	Host string
+	// Line is the line that Fix cleans up
+	Line *Line
+	// Other is the line a conflict or duplicate was found against
+	Other *Line
+}
+
+// recorded is the first line seen holding a key of a type for a host
+type recorded struct {
+	line    *Line
+	keyData string
+}
+
+// Check looks for conflicting, duplicate and stale entries. known lists the
+// normalized names of the hosts in use, as given by Normalize; hashed entries
+// can only be attributed to a host through it. @cert-authority and @revoked
+// lines and lines using patterns are not checked.
+//
+// When a host has conflicting keys the later line is assumed to be the
+// current one, since ssh appends newly accepted keys, and the earlier line is
+// reported.
+func (f *File) Check(known []string) []Problem {
+	knownSet := make(map[string]bool, len(known))
+	for _, name := range known {
+		knownSet[strings.ToLower(name)] = true
+	}
+
+	var problems []Problem
+	seen := make(map[string]recorded)
+	for _, line := range f.Entries() {
+		entry := line.Entry
+		if entry.Marker != "" || entry.HasPatterns() {
+			continue
+		}
+
+		names := entryNames(entry, known)
+		if entry.IsHashed() && len(names) == 0 {
+			problems = append(problems, Problem{Kind: ProblemUnmapped, Line: line})
+			continue
+		}
+
+		for _, name := range names {
+			id := name + " " + entry.KeyType
+			previous, ok := seen[id]
+			switch {
+			case !ok:
+				seen[id] = recorded{line: line, keyData: entry.KeyData}
+			case previous.keyData == entry.KeyData:
+				problems = append(problems, Problem{Kind: ProblemDuplicate, Host: name, Line: line, Other: previous.line})
+			default:
+				problems = append(problems, Problem{Kind: ProblemConflict, Host: name, Line: previous.line, Other: line})
+				seen[id] = recorded{line: line, keyData: entry.KeyData}
+			}
+
+			if !entry.IsHashed() && !knownSet[name] {
+				problems = append(problems, Problem{Kind: ProblemUnreferenced, Host: name, Line: line})
+			}
+		}
+	}
+	return problems
+}
+
+// entryNames returns the normalized host names an entry applies to. For a
+// hashed entry these are the names in known that it matches.
+func entryNames(entry *Entry, known []string) []string {
+	if !entry.IsHashed() {
+		names := make([]string, len(entry.Hosts))
+		for i, host := range entry.Hosts {
+			names[i] = strings.ToLower(host)
+		}
+		return names
+	}
+
+	var names []string
+	for _, name := range known {
+		if matchHashed(entry.Hosts[0], strings.ToLower(name)) {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names
+}
+
+// Fix resolves a problem by removing its host from the reported line, or the
+// whole line when no other host remains on it. Fixing a problem whose line
+// has already been removed does nothing.
+func (f *File) Fix(p Problem) {
+	entry := p.Line.Entry
+	if entry == nil || f.LineNumber(p.Line) == 0 {
+		return
+	}
+
+	if !entry.IsHashed() && p.Host != "" {
+		var hosts []string
+		for _, host := range entry.Hosts {
+			if strings.ToLower(host) != p.Host {
+				hosts = append(hosts, host)
+			}
+		}
+		if len(hosts) > 0 {
+			entry.Hosts = hosts
+			p.Line.Modified = true
+			return
+		}
+	}
+
+	f.Remove(func(line *Line) bool { return line == p.Line })
+}
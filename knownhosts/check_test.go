@@ -0,0 +1,67 @@
+package knownhosts
+
+import (
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	hashedWeb, err := HashHostname("web.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashedGone, err := HashHostname("gone.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := `web.example.com,10.0.0.5 ssh-ed25519 OLD
+db.example.com ssh-ed25519 DB
+` + hashedWeb + ` ssh-ed25519 NEW
+db.example.com ssh-ed25519 DB
+old.example.com ssh-rsa OLDRSA
+` + hashedGone + ` ssh-ed25519 GONE
+*.corp ssh-ed25519 PATTERN
+@cert-authority *.example.com ssh-ed25519 CA
+`
+	file := Parse([]byte(content))
+	problems := file.Check([]string{"web.example.com", "db.example.com", "10.0.0.5"})
+
+	want := []struct {
+		kind string
+		host string
+		line int
+	}{
+		{ProblemConflict, "web.example.com", 1},
+		{ProblemDuplicate, "db.example.com", 4},
+		{ProblemUnreferenced, "old.example.com", 5},
+		{ProblemUnmapped, "", 6},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("Check() = %+v; want %d problems", problems, len(want))
+	}
+	for i, w := range want {
+		p := problems[i]
+		if p.Kind != w.kind || p.Host != w.host || file.LineNumber(p.Line) != w.line {
+			t.Errorf("problem %d = %s %q line %d; want %s %q line %d", i, p.Kind, p.Host, file.LineNumber(p.Line), w.kind, w.host, w.line)
+		}
+	}
+	if file.LineNumber(problems[0].Other) != 3 {
+		t.Errorf("conflict found against line %d; want 3", file.LineNumber(problems[0].Other))
+	}
+
+	for _, p := range problems {
+		file.Fix(p)
+	}
+	wantContent := `10.0.0.5 ssh-ed25519 OLD
+db.example.com ssh-ed25519 DB
+` + hashedWeb + ` ssh-ed25519 NEW
+*.corp ssh-ed25519 PATTERN
+@cert-authority *.example.com ssh-ed25519 CA
+`
+	if got := string(file.Bytes()); got != wantContent {
+		t.Errorf("Bytes() after Fix = %q; want %q", got, wantContent)
+	}
+	if problems := file.Check([]string{"web.example.com", "db.example.com", "10.0.0.5"}); len(problems) != 0 {
+		t.Errorf("Check() after Fix = %+v; want none", problems)
+	}
+}
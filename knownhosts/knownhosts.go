@@ -0,0 +1,303 @@
+// Package knownhosts parses and edits OpenSSH known_hosts files.
+//
+// It understands plain and hashed (|1|salt|hash) host names, bracketed
+// [host]:port forms, host patterns and the @cert-authority and @revoked
+// markers. Parsing is lossless through the linefile package, so untouched
+// lines are written back exactly as they were read.
+package knownhosts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/linefile"
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// MarkerCertAuthority marks a line holding a certificate authority trusted for the hosts
+	MarkerCertAuthority = "@cert-authority"
+	// MarkerRevoked marks a line holding a key that must never be accepted
+	MarkerRevoked = "@revoked"
+
+	hashPrefix = "|1|"
+)
+
+// Normalize returns the name a host is recorded under in known_hosts:
+// the plain host name for the default port and [host]:port otherwise.
+func Normalize(host string, port int) string {
+	host = strings.ToLower(host)
+	if port == 0 || port == 22 {
+		return host
+	}
+	return "[" + host + "]:" + strconv.Itoa(port)
+}
+
+// SplitHostPort parses a host given as host, host:port or [host]:port,
+// defaulting to port 22. Bare IPv6 addresses are accepted without brackets.
+func SplitHostPort(s string) (string, int, error) {
+	if !strings.HasPrefix(s, "[") && strings.Count(s, ":") != 1 {
+		return s, 22, nil
+	}
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid host %q: %w", s, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in %q", s)
+	}
+	return host, port, nil
+}
+
+// HashHostname hashes a normalized host name the way ssh-keygen -H does,
+// using a fresh random salt.
+func HashHostname(name string) (string, error) {
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return hashWithSalt(name, salt), nil
+}
+
+func hashWithSalt(name string, salt []byte) string {
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return hashPrefix + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// matchHashed reports whether a |1|salt|hash host field was produced from name
+func matchHashed(hashed, name string) bool {
+	parts := strings.Split(strings.TrimPrefix(hashed, hashPrefix), "|")
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(hashWithSalt(name, salt)), []byte(hashed))
+}
+
+// Entry is a key line of a known_hosts file
+type Entry struct {
+	Marker  string
+	Hosts   []string
+	KeyType string
+	KeyData string
+	Comment string
+}
+
+// ParseEntry parses a single known_hosts key line
+func ParseEntry(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return nil, fmt.Errorf("not a key line")
+	}
+
+	entry := &Entry{}
+	if strings.HasPrefix(fields[0], "@") {
+		if fields[0] != MarkerCertAuthority && fields[0] != MarkerRevoked {
+			return nil, fmt.Errorf("unknown marker %q", fields[0])
+		}
+		entry.Marker = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected hosts, key type and key")
+	}
+
+	entry.Hosts = strings.Split(fields[0], ",")
+	entry.KeyType = fields[1]
+	entry.KeyData = fields[2]
+	entry.Comment = strings.Join(fields[3:], " ")
+	return entry, nil
+}
+
+// IsHashed reports whether the host names of the entry are hashed
+func (e *Entry) IsHashed() bool {
+	return len(e.Hosts) == 1 && strings.HasPrefix(e.Hosts[0], hashPrefix)
+}
+
+// Match reports whether the entry applies to host on port
+func (e *Entry) Match(host string, port int) bool {
+	name := Normalize(host, port)
+	if e.IsHashed() {
+		return matchHashed(e.Hosts[0], name)
+	}
+	return utils.MatchPatternList(e.Hosts, name)
+}
+
+// HasPatterns reports whether any host of the entry is a wildcard or negated
+// pattern, which cannot be hashed
+func (e *Entry) HasPatterns() bool {
+	for _, host := range e.Hosts {
+		if strings.ContainsAny(host, "*?!") {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicKey decodes the key of the entry
+func (e *Entry) PublicKey() (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(e.KeyType + " " + e.KeyData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return key, nil
+}
+
+// String formats the entry as a known_hosts line
+func (e *Entry) String() string {
+	fields := make([]string, 0, 5)
+	if e.Marker != "" {
+		fields = append(fields, e.Marker)
+	}
+	fields = append(fields, strings.Join(e.Hosts, ","), e.KeyType, e.KeyData)
+	if e.Comment != "" {
+		fields = append(fields, e.Comment)
+	}
+	return strings.Join(fields, " ")
+}
+
+// Line is a single line of a known_hosts file
+type Line = linefile.Line[*Entry]
+
+// File is a parsed known_hosts file
+type File struct {
+	linefile.File[*Entry]
+}
+
+// Parse parses the contents of a known_hosts file
+func Parse(data []byte) *File {
+	f := &File{}
+	f.Lines = linefile.Parse(data, ParseEntry)
+	return f
+}
+
+// Append adds raw lines to the end of the file
+func (f *File) Append(raw ...string) {
+	for _, text := range raw {
+		f.Lines = append(f.Lines, linefile.NewLine(text, ParseEntry))
+	}
+}
+
+// LineNumber returns the 1-based position of line in the file
+func (f *File) LineNumber(line *Line) int {
+	for i, l := range f.Lines {
+		if l == line {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Find returns the key lines that apply to host on port
+func (f *File) Find(host string, port int) []*Line {
+	var found []*Line
+	for _, line := range f.Entries() {
+		if line.Entry.Match(host, port) {
+			found = append(found, line)
+		}
+	}
+	return found
+}
+
+// RemoveHost deletes the keys recorded for host on port, like ssh-keygen -R.
+// @cert-authority lines are kept since they describe trust for a whole
+// pattern rather than a key of this host.
+func (f *File) RemoveHost(host string, port int) int {
+	return f.Remove(func(line *Line) bool {
+		return line.Entry != nil && line.Entry.Marker != MarkerCertAuthority && line.Entry.Match(host, port)
+	})
+}
+
+// HashHosts replaces plain host names with hashes like ssh-keygen -H. Lines
+// listing several hosts are split into one line per host. Lines using
+// patterns and @cert-authority lines are left as they are, since a pattern
+// cannot be hashed. It returns the number of host names hashed.
+func (f *File) HashHosts() (int, error) {
+	var lines []*Line
+	hashed := 0
+	for _, line := range f.Lines {
+		entry := line.Entry
+		if entry == nil || entry.IsHashed() || entry.HasPatterns() || entry.Marker == MarkerCertAuthority {
+			lines = append(lines, line)
+			continue
+		}
+
+		for _, host := range entry.Hosts {
+			hash, err := HashHostname(strings.ToLower(host))
+			if err != nil {
+				return 0, err
+			}
+			hashedEntry := *entry
+			hashedEntry.Hosts = []string{hash}
+			lines = append(lines, &Line{Entry: &hashedEntry, Modified: true})
+			hashed++
+		}
+	}
+	f.Lines = lines
+	return hashed, nil
+}
+
+// KeyStatus is the result of checking a host key against known_hosts
+type KeyStatus int
+
+const (
+	// KeyUnknown means no key of the same type is recorded for the host
+	KeyUnknown KeyStatus = iota
+	// KeyKnown means the key is recorded for the host
+	KeyKnown
+	// KeyChanged means a different key of the same type is recorded for the host
+	KeyChanged
+	// KeyRevoked means the key is marked @revoked
+	KeyRevoked
+)
+
+// CheckKey looks up key for host on port the way ssh verifies a host key.
+// A revoked key always wins, followed by an exact match, so a host that has
+// both its current key and an old one recorded is still reported as known.
+// @cert-authority lines are not consulted; see IsHostAuthority.
+func (f *File) CheckKey(host string, port int, key ssh.PublicKey) KeyStatus {
+	status := KeyUnknown
+	blob := key.Marshal()
+	for _, line := range f.Entries() {
+		entry := line.Entry
+		if entry.Marker == MarkerCertAuthority {
+			continue
+		}
+
+		recorded, err := entry.PublicKey()
+		if err != nil {
+			continue
+		}
+		sameKey := bytes.Equal(recorded.Marshal(), blob)
+
+		if entry.Marker == MarkerRevoked {
+			if sameKey && entry.Match(host, port) {
+				return KeyRevoked
+			}
+			continue
+		}
+		if !entry.Match(host, port) {
+			continue
+		}
+		switch {
+		case sameKey:
+			status = KeyKnown
+		case recorded.Type() == key.Type() && status != KeyKnown:
+			status = KeyChanged
+		}
+	}
+	return status
+}
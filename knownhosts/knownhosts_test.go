@@ -0,0 +1,214 @@
+package knownhosts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		input   string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{"example.com", "example.com", 22, false},
+		{"example.com:2222", "example.com", 2222, false},
+		{"[example.com]:2222", "example.com", 2222, false},
+		{"[::1]:2222", "::1", 2222, false},
+		{"::1", "::1", 22, false},
+		{"example.com:http", "", 0, true},
+		{"example.com:0", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		host, port, err := SplitHostPort(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SplitHostPort(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if host != tt.host || port != tt.port {
+			t.Errorf("SplitHostPort(%q) = %q, %d; want %q, %d", tt.input, host, port, tt.host, tt.port)
+		}
+	}
+
+	if got := Normalize("Example.com", 22); got != "example.com" {
+		t.Errorf("Normalize() = %q; want example.com", got)
+	}
+	if got := Normalize("example.com", 2222); got != "[example.com]:2222" {
+		t.Errorf("Normalize() = %q; want [example.com]:2222", got)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		line    string
+		marker  string
+		hosts   []string
+		comment string
+		wantErr bool
+	}{
+		{line: "example.com,10.0.0.1 ssh-ed25519 AAAA", hosts: []string{"example.com", "10.0.0.1"}},
+		{line: "[example.com]:2222 ssh-rsa AAAA a comment", hosts: []string{"[example.com]:2222"}, comment: "a comment"},
+		{line: "@cert-authority *.corp ssh-ed25519 AAAA", marker: MarkerCertAuthority, hosts: []string{"*.corp"}},
+		{line: "@revoked * ssh-rsa AAAA", marker: MarkerRevoked, hosts: []string{"*"}},
+		{line: "|1|c2FsdA==|aGFzaA== ssh-ed25519 AAAA", hosts: []string{"|1|c2FsdA==|aGFzaA=="}},
+		{line: "@unknown host ssh-rsa AAAA", wantErr: true},
+		{line: "# comment", wantErr: true},
+		{line: "host ssh-rsa", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		entry, err := ParseEntry(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseEntry(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if entry.Marker != tt.marker || strings.Join(entry.Hosts, ",") != strings.Join(tt.hosts, ",") || entry.Comment != tt.comment {
+			t.Errorf("ParseEntry(%q) = %+v", tt.line, entry)
+		}
+		if entry.String() != tt.line {
+			t.Errorf("String() = %q; want %q", entry.String(), tt.line)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	hashed, err := HashHostname("[db.internal]:2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		host string
+		port int
+		want bool
+	}{
+		{"example.com,10.0.0.1 ssh-ed25519 AAAA", "10.0.0.1", 22, true},
+		{"example.com ssh-ed25519 AAAA", "EXAMPLE.COM", 22, true},
+		{"example.com ssh-ed25519 AAAA", "example.com", 2222, false},
+		{"[example.com]:2222 ssh-ed25519 AAAA", "example.com", 2222, true},
+		{"*.corp,!bastion.corp ssh-ed25519 AAAA", "db.corp", 22, true},
+		{"*.corp,!bastion.corp ssh-ed25519 AAAA", "bastion.corp", 22, false},
+		{hashed + " ssh-ed25519 AAAA", "db.internal", 2222, true},
+		{hashed + " ssh-ed25519 AAAA", "db.internal", 22, false},
+	}
+
+	for _, tt := range tests {
+		entry, err := ParseEntry(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := entry.Match(tt.host, tt.port); got != tt.want {
+			t.Errorf("Match(%q, %d) on %q = %v; want %v", tt.host, tt.port, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveHost(t *testing.T) {
+	content := `# my hosts
+example.com ssh-ed25519 AAAA
+example.com ssh-rsa BBBB
+other.com ssh-ed25519 CCCC
+@cert-authority *.com ssh-ed25519 DDDD
+`
+	file := Parse([]byte(content))
+
+	if found := file.Find("example.com", 22); len(found) != 3 {
+		t.Errorf("Find() = %d lines; want 3", len(found))
+	}
+	if removed := file.RemoveHost("example.com", 22); removed != 2 {
+		t.Errorf("RemoveHost() = %d; want 2", removed)
+	}
+
+	want := `# my hosts
+other.com ssh-ed25519 CCCC
+@cert-authority *.com ssh-ed25519 DDDD
+`
+	if got := string(file.Bytes()); got != want {
+		t.Errorf("Bytes() = %q; want %q", got, want)
+	}
+}
+
+func TestHashHosts(t *testing.T) {
+	content := `example.com,10.0.0.1 ssh-ed25519 AAAA
+*.corp ssh-ed25519 BBBB
+@cert-authority db.corp ssh-ed25519 CCCC
+# comment
+`
+	file := Parse([]byte(content))
+
+	hashed, err := file.HashHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashed != 2 {
+		t.Errorf("HashHosts() = %d; want 2", hashed)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(file.Bytes()), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Bytes() = %q; want 5 lines", file.Bytes())
+	}
+	for _, line := range lines[:2] {
+		if !strings.HasPrefix(line, "|1|") || !strings.HasSuffix(line, " ssh-ed25519 AAAA") {
+			t.Errorf("line %q is not a hashed entry", line)
+		}
+	}
+	if lines[2] != "*.corp ssh-ed25519 BBBB" || lines[3] != "@cert-authority db.corp ssh-ed25519 CCCC" {
+		t.Errorf("pattern and marker lines changed: %q", lines[2:4])
+	}
+
+	if found := file.Find("10.0.0.1", 22); len(found) != 1 {
+		t.Errorf("Find() after hashing = %d lines; want 1", len(found))
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	newKey := func() (ssh.PublicKey, string) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer.PublicKey(), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	}
+
+	current, currentLine := newKey()
+	old, oldLine := newKey()
+	revoked, revokedLine := newKey()
+	other, _ := newKey()
+
+	file := Parse([]byte("web.example.com " + currentLine + "\n" +
+		"db.example.com " + oldLine + "\n" +
+		"@revoked * " + revokedLine + "\n"))
+
+	tests := []struct {
+		host string
+		key  ssh.PublicKey
+		want KeyStatus
+	}{
+		{"web.example.com", current, KeyKnown},
+		{"db.example.com", current, KeyChanged},
+		{"db.example.com", old, KeyKnown},
+		{"new.example.com", other, KeyUnknown},
+		{"web.example.com", revoked, KeyRevoked},
+	}
+
+	for _, tt := range tests {
+		if got := file.CheckKey(tt.host, 22, tt.key); got != tt.want {
+			t.Errorf("CheckKey(%s) = %v; want %v", tt.host, got, tt.want)
+		}
+	}
+}
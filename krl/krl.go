@@ -0,0 +1,569 @@
+// Package krl reads and writes OpenSSH key revocation lists.
+//
+// KRLs are the compact binary format described in OpenSSH's PROTOCOL.krl and
+// read by sshd's RevokedKeys option and ssh-keygen -Q. They revoke plain keys,
+// key fingerprints and certificates by serial number or key ID. Like sshd,
+// Load also accepts a plain text list of public keys. Signed KRLs can be
+// read but their signatures are not verified.
+package krl
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// magic starts every binary KRL: "SSHKRL\n\0"
+const magic = 0x5353484b524c0a00
+
+const formatVersion = 1
+
+// Section types of a KRL
+const (
+	sectionCertificates      = 1
+	sectionExplicitKey       = 2
+	sectionFingerprintSHA1   = 3
+	sectionSignature         = 4
+	sectionFingerprintSHA256 = 5
+)
+
+// Certificate subsection types
+const (
+	certSectionSerialList   = 0x20
+	certSectionSerialRange  = 0x21
+	certSectionSerialBitmap = 0x22
+	certSectionKeyID        = 0x23
+)
+
+// SerialRange is an inclusive range of certificate serial numbers
+type SerialRange struct {
+	Min uint64
+	Max uint64
+}
+
+// CertificateRevocations lists the certificates of a CA that are revoked
+type CertificateRevocations struct {
+	// CA is the authority that signed the certificates; nil matches any CA
+	CA      ssh.PublicKey
+	Serials []SerialRange
+	KeyIDs  []string
+}
+
+// KRL is a key revocation list
+type KRL struct {
+	// Version is increased each time the list is updated
+	Version   uint64
+	Generated time.Time
+	Comment   string
+	// Keys are revoked plain keys; revoking a key also revokes its certificates
+	Keys         []ssh.PublicKey
+	SHA1         [][]byte
+	SHA256       [][]byte
+	Certificates []*CertificateRevocations
+}
+
+// IsKRL reports whether data starts like a binary KRL
+func IsKRL(data []byte) bool {
+	return len(data) >= 8 && binary.BigEndian.Uint64(data) == magic
+}
+
+// Load reads the revocation list at path, either a binary KRL or a text
+// file of public keys as sshd accepts for RevokedKeys
+func Load(path string) (*KRL, error) {
+	data, err := os.ReadFile(utils.ExpandUser(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation list: %w", err)
+	}
+	if IsKRL(data) {
+		return Parse(data)
+	}
+
+	k := &KRL{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: not a public key or KRL: %w", path, i+1, err)
+		}
+		k.RevokeKey(pub)
+	}
+	return k, nil
+}
+
+// Write writes the KRL to path in the binary format
+func (k *KRL) Write(path string) error {
+	if err := utils.WriteFileAtomic(utils.ExpandUser(path), k.Marshal(), 0644); err != nil {
+		return fmt.Errorf("failed to write revocation list: %w", err)
+	}
+	return nil
+}
+
+// RevokeKey revokes a key. Certificates are revoked by serial number under
+// their CA, or by key ID when they have no serial, as ssh-keygen -k does.
+func (k *KRL) RevokeKey(key ssh.PublicKey) {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		if cert.Serial == 0 {
+			k.RevokeKeyID(cert.SignatureKey, cert.KeyId)
+		} else {
+			k.RevokeSerials(cert.SignatureKey, cert.Serial, cert.Serial)
+		}
+		return
+	}
+	for _, revoked := range k.Keys {
+		if bytes.Equal(revoked.Marshal(), key.Marshal()) {
+			return
+		}
+	}
+	k.Keys = append(k.Keys, key)
+}
+
+// RevokeFingerprint revokes the key with a fingerprint given as SHA256:<base64>
+// as printed by ssh-keygen -l, or SHA1:<base64>
+func (k *KRL) RevokeFingerprint(fingerprint string) error {
+	algorithm, encoded, found := strings.Cut(fingerprint, ":")
+	hash, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if !found || err != nil {
+		return fmt.Errorf("invalid fingerprint %q", fingerprint)
+	}
+	switch {
+	case algorithm == "SHA256" && len(hash) == sha256.Size:
+		k.SHA256 = appendHash(k.SHA256, hash)
+	case algorithm == "SHA1" && len(hash) == sha1.Size:
+		k.SHA1 = appendHash(k.SHA1, hash)
+	default:
+		return fmt.Errorf("invalid fingerprint %q: use SHA256:<base64> or SHA1:<base64>", fingerprint)
+	}
+	return nil
+}
+
+func appendHash(hashes [][]byte, hash []byte) [][]byte {
+	for _, h := range hashes {
+		if bytes.Equal(h, hash) {
+			return hashes
+		}
+	}
+	return append(hashes, hash)
+}
+
+// RevokeSerials revokes the certificates of ca with serials min to max; a
+// nil ca revokes them whichever CA signed them
+func (k *KRL) RevokeSerials(ca ssh.PublicKey, min, max uint64) {
+	section := k.certificates(ca)
+	section.Serials = append(section.Serials, SerialRange{Min: min, Max: max})
+}
+
+// RevokeKeyID revokes the certificates of ca with key ID id; a nil ca
+// revokes them whichever CA signed them
+func (k *KRL) RevokeKeyID(ca ssh.PublicKey, id string) {
+	section := k.certificates(ca)
+	for _, revoked := range section.KeyIDs {
+		if revoked == id {
+			return
+		}
+	}
+	section.KeyIDs = append(section.KeyIDs, id)
+}
+
+// certificates returns the revocations for ca, adding them when missing
+func (k *KRL) certificates(ca ssh.PublicKey) *CertificateRevocations {
+	for _, section := range k.Certificates {
+		if sameKey(section.CA, ca) {
+			return section
+		}
+	}
+	section := &CertificateRevocations{CA: ca}
+	k.Certificates = append(k.Certificates, section)
+	return section
+}
+
+func sameKey(a, b ssh.PublicKey) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
+
+// ParseSerials parses a serial number or an inclusive range such as 100-200
+func ParseSerials(s string) (uint64, uint64, error) {
+	from, to, isRange := strings.Cut(s, "-")
+	min, err := strconv.ParseUint(strings.TrimSpace(from), 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid serial %q", s)
+	}
+	max := min
+	if isRange {
+		if max, err = strconv.ParseUint(strings.TrimSpace(to), 0, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid serial range %q", s)
+		}
+	}
+	if min == 0 || max < min {
+		return 0, 0, fmt.Errorf("invalid serial range %q: serials start at 1", s)
+	}
+	return min, max, nil
+}
+
+// IsRevoked reports whether key is revoked. Certificates are revoked when
+// their serial or key ID is listed for their CA, or when their key or the
+// key of the CA that signed them is, as OpenSSH's ssh_krl_check_key does.
+func (k *KRL) IsRevoked(key ssh.PublicKey) bool {
+	cert, isCert := key.(*ssh.Certificate)
+	if !isCert {
+		return k.keyRevoked(key)
+	}
+	if k.keyRevoked(cert.Key) || k.keyRevoked(cert.SignatureKey) {
+		return true
+	}
+	for _, section := range k.Certificates {
+		if section.CA != nil && !sameKey(section.CA, cert.SignatureKey) {
+			continue
+		}
+		for _, r := range section.Serials {
+			if cert.Serial != 0 && cert.Serial >= r.Min && cert.Serial <= r.Max {
+				return true
+			}
+		}
+		for _, id := range section.KeyIDs {
+			if id == cert.KeyId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keyRevoked reports whether the plain key is listed itself or by its SHA1
+// or SHA256 hash
+func (k *KRL) keyRevoked(key ssh.PublicKey) bool {
+	blob := key.Marshal()
+	for _, revoked := range k.Keys {
+		if bytes.Equal(revoked.Marshal(), blob) {
+			return true
+		}
+	}
+	sum1 := sha1.Sum(blob)
+	for _, hash := range k.SHA1 {
+		if bytes.Equal(hash, sum1[:]) {
+			return true
+		}
+	}
+	sum256 := sha256.Sum256(blob)
+	for _, hash := range k.SHA256 {
+		if bytes.Equal(hash, sum256[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Marshal encodes the KRL in the binary format
+func (k *KRL) Marshal() []byte {
+	var b builder
+	b.uint64(magic)
+	b.uint32(formatVersion)
+	b.uint64(k.Version)
+	generated := uint64(0)
+	if !k.Generated.IsZero() {
+		generated = uint64(k.Generated.Unix())
+	}
+	b.uint64(generated)
+	b.uint64(0) // flags
+	b.string(nil)
+	b.string([]byte(k.Comment))
+
+	for _, section := range k.Certificates {
+		b.section(sectionCertificates, section.marshal())
+	}
+	if len(k.Keys) > 0 {
+		blobs := make([][]byte, len(k.Keys))
+		for i, key := range k.Keys {
+			blobs[i] = key.Marshal()
+		}
+		b.section(sectionExplicitKey, stringList(blobs))
+	}
+	if len(k.SHA1) > 0 {
+		b.section(sectionFingerprintSHA1, stringList(k.SHA1))
+	}
+	if len(k.SHA256) > 0 {
+		b.section(sectionFingerprintSHA256, stringList(k.SHA256))
+	}
+	return b.Bytes()
+}
+
+func (c *CertificateRevocations) marshal() []byte {
+	var b builder
+	if c.CA != nil {
+		b.string(c.CA.Marshal())
+	} else {
+		b.string(nil)
+	}
+	b.string(nil)
+
+	ranges := append([]SerialRange(nil), c.Serials...)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Min < ranges[j].Min })
+	var list builder
+	for _, r := range ranges {
+		if r.Min == r.Max {
+			list.uint64(r.Min)
+			continue
+		}
+		var rb builder
+		rb.uint64(r.Min)
+		rb.uint64(r.Max)
+		b.section(certSectionSerialRange, rb.Bytes())
+	}
+	if list.Len() > 0 {
+		b.section(certSectionSerialList, list.Bytes())
+	}
+	if len(c.KeyIDs) > 0 {
+		ids := make([][]byte, len(c.KeyIDs))
+		for i, id := range c.KeyIDs {
+			ids[i] = []byte(id)
+		}
+		b.section(certSectionKeyID, stringList(ids))
+	}
+	return b.Bytes()
+}
+
+// stringList encodes values as consecutive SSH strings in sorted order,
+// matching the output of ssh-keygen
+func stringList(values [][]byte) []byte {
+	sorted := append([][]byte(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	var b builder
+	for _, v := range sorted {
+		b.string(v)
+	}
+	return b.Bytes()
+}
+
+// Parse decodes a binary KRL
+func Parse(data []byte) (*KRL, error) {
+	r := &reader{data: data}
+	if r.uint64() != magic {
+		return nil, fmt.Errorf("not a KRL")
+	}
+	if version := r.uint32(); r.err == nil && version != formatVersion {
+		return nil, fmt.Errorf("unsupported KRL format version %d", version)
+	}
+
+	k := &KRL{Version: r.uint64()}
+	if generated := r.uint64(); generated != 0 {
+		k.Generated = time.Unix(int64(generated), 0)
+	}
+	r.uint64() // flags
+	r.string() // reserved
+	k.Comment = string(r.string())
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid KRL header: %w", r.err)
+	}
+
+	for r.remaining() > 0 {
+		kind := r.byte()
+		body := r.string()
+		if r.err != nil {
+			return nil, fmt.Errorf("invalid KRL section: %w", r.err)
+		}
+		var err error
+		switch kind {
+		case sectionCertificates:
+			err = k.parseCertificates(body)
+		case sectionExplicitKey:
+			err = eachString(body, func(blob []byte) error {
+				key, err := ssh.ParsePublicKey(blob)
+				if err == nil {
+					k.Keys = append(k.Keys, key)
+				}
+				return err
+			})
+		case sectionFingerprintSHA1, sectionFingerprintSHA256:
+			size := sha1.Size
+			if kind == sectionFingerprintSHA256 {
+				size = sha256.Size
+			}
+			err = eachString(body, func(hash []byte) error {
+				if len(hash) != size {
+					return fmt.Errorf("invalid fingerprint length %d", len(hash))
+				}
+				if kind == sectionFingerprintSHA1 {
+					k.SHA1 = append(k.SHA1, hash)
+				} else {
+					k.SHA256 = append(k.SHA256, hash)
+				}
+				return nil
+			})
+		case sectionSignature:
+			// Signatures come last and cover everything before them
+			return k, nil
+		default:
+			err = fmt.Errorf("unknown section type %d", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid KRL: %w", err)
+		}
+	}
+	return k, nil
+}
+
+func (k *KRL) parseCertificates(data []byte) error {
+	r := &reader{data: data}
+	section := &CertificateRevocations{}
+	if blob := r.string(); len(blob) > 0 {
+		ca, err := ssh.ParsePublicKey(blob)
+		if err != nil {
+			return fmt.Errorf("invalid CA key: %w", err)
+		}
+		section.CA = ca
+	}
+	r.string() // reserved
+
+	for r.err == nil && r.remaining() > 0 {
+		kind := r.byte()
+		body := &reader{data: r.string()}
+		switch kind {
+		case certSectionSerialList:
+			for body.err == nil && body.remaining() > 0 {
+				serial := body.uint64()
+				section.Serials = append(section.Serials, SerialRange{Min: serial, Max: serial})
+			}
+		case certSectionSerialRange:
+			section.Serials = append(section.Serials, SerialRange{Min: body.uint64(), Max: body.uint64()})
+		case certSectionSerialBitmap:
+			offset := body.uint64()
+			bitmap := new(big.Int).SetBytes(body.string())
+			for i := 0; i < bitmap.BitLen(); i++ {
+				if bitmap.Bit(i) == 1 {
+					section.Serials = append(section.Serials, SerialRange{Min: offset + uint64(i), Max: offset + uint64(i)})
+				}
+			}
+		case certSectionKeyID:
+			if err := eachString(body.data, func(id []byte) error {
+				section.KeyIDs = append(section.KeyIDs, string(id))
+				return nil
+			}); err != nil {
+				return err
+			}
+			body.data = nil
+		default:
+			return fmt.Errorf("unknown certificate section type %d", kind)
+		}
+		if body.err != nil {
+			return body.err
+		}
+		if r.err == nil && body.remaining() > 0 {
+			return fmt.Errorf("trailing data in certificate section")
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	k.Certificates = append(k.Certificates, section)
+	return nil
+}
+
+func eachString(data []byte, fn func([]byte) error) error {
+	r := &reader{data: data}
+	for r.remaining() > 0 {
+		value := r.string()
+		if r.err != nil {
+			return r.err
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// builder encodes SSH wire format values
+type builder struct {
+	bytes.Buffer
+}
+
+func (b *builder) uint32(v uint32) {
+	b.Write(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (b *builder) uint64(v uint64) {
+	b.Write(binary.BigEndian.AppendUint64(nil, v))
+}
+
+func (b *builder) string(v []byte) {
+	b.uint32(uint32(len(v)))
+	b.Write(v)
+}
+
+func (b *builder) section(kind byte, body []byte) {
+	b.WriteByte(kind)
+	b.string(body)
+}
+
+var errTruncated = errors.New("truncated data")
+
+// reader decodes SSH wire format values, remembering the first error
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) remaining() int {
+	return len(r.data)
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errTruncated
+		r.data = nil
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) byte() byte {
+	if v := r.next(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if v := r.next(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if v := r.next(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (r *reader) string() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	return r.next(int(n))
+}
@@ -0,0 +1,281 @@
+package krl
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newKey(t *testing.T) (ssh.PublicKey, ssh.Signer) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer.PublicKey(), signer
+}
+
+func newCert(t *testing.T, ca ssh.Signer, serial uint64, id string) *ssh.Certificate {
+	t.Helper()
+	pub, _ := newKey(t)
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          serial,
+		CertType:        ssh.UserCert,
+		KeyId:           id,
+		ValidPrincipals: []string{"alice"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestRevocation(t *testing.T) {
+	revokedKey, _ := newKey(t)
+	otherKey, _ := newKey(t)
+	fingerprintKey, _ := newKey(t)
+	caKey, ca := newKey(t)
+	_, otherCA := newKey(t)
+	revokedCAKey, revokedCA := newKey(t)
+	fingerprintCAKey, fingerprintCA := newKey(t)
+
+	k := &KRL{Version: 3, Comment: "lost laptop", Generated: time.Unix(1700000000, 0)}
+	k.RevokeKey(revokedKey)
+	k.RevokeKey(revokedKey)
+	if err := k.RevokeFingerprint(ssh.FingerprintSHA256(fingerprintKey)); err != nil {
+		t.Fatal(err)
+	}
+	k.RevokeSerials(caKey, 10, 20)
+	k.RevokeSerials(caKey, 42, 42)
+	k.RevokeKeyID(nil, "mallory")
+	k.RevokeKey(newCert(t, ca, 0, "eve"))
+
+	if len(k.Keys) != 1 {
+		t.Errorf("Keys = %d; want duplicates ignored", len(k.Keys))
+	}
+
+	// Revoking a CA key revokes every certificate it signed
+	k.RevokeKey(revokedCAKey)
+	if err := k.RevokeFingerprint(ssh.FingerprintSHA256(fingerprintCAKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := Parse(k.Marshal())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Version != 3 || parsed.Comment != "lost laptop" || !parsed.Generated.Equal(k.Generated) {
+		t.Errorf("header = %d %q %v; want it preserved", parsed.Version, parsed.Comment, parsed.Generated)
+	}
+
+	certOf := func(key ssh.PublicKey) *ssh.Certificate {
+		cert := newCert(t, ca, 99, "ok")
+		cert.Key = key
+		return cert
+	}
+	tests := []struct {
+		name string
+		key  ssh.PublicKey
+		want bool
+	}{
+		{"Revoked key", revokedKey, true},
+		{"Certificate of revoked key", certOf(revokedKey), true},
+		{"Other key", otherKey, false},
+		{"Revoked fingerprint", fingerprintKey, true},
+		{"Serial in range", newCert(t, ca, 15, "bob"), true},
+		{"Serial in list", newCert(t, ca, 42, "bob"), true},
+		{"Serial outside range", newCert(t, ca, 21, "bob"), false},
+		{"Serial of another CA", newCert(t, otherCA, 15, "bob"), false},
+		{"Key ID for any CA", newCert(t, otherCA, 7, "mallory"), true},
+		{"Key ID of certificate without serial", newCert(t, ca, 0, "eve"), true},
+		{"Key ID under another CA", newCert(t, otherCA, 0, "eve"), false},
+		{"Certificate of revoked CA", newCert(t, revokedCA, 99, "ok"), true},
+		{"Certificate of CA revoked by fingerprint", newCert(t, fingerprintCA, 99, "ok"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsed.IsRevoked(tt.key); got != tt.want {
+				t.Errorf("IsRevoked() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	k := &KRL{}
+	key, _ := newKey(t)
+	k.RevokeKey(key)
+	data := k.Marshal()
+
+	if _, err := Parse([]byte("not a krl at all")); err == nil {
+		t.Error("Parse() expected error for bad magic")
+	}
+	if _, err := Parse(data[:len(data)-3]); err == nil {
+		t.Error("Parse() expected error for truncated data")
+	}
+	if err := k.RevokeFingerprint("SHA256:tooshort"); err == nil {
+		t.Error("RevokeFingerprint() expected error for bad hash")
+	}
+	if err := k.RevokeFingerprint("MD5:" + ssh.FingerprintSHA256(key)[7:]); err == nil {
+		t.Error("RevokeFingerprint() expected error for unknown algorithm")
+	}
+}
+
+func TestParseSerials(t *testing.T) {
+	tests := []struct {
+		input    string
+		min, max uint64
+		wantErr  bool
+	}{
+		{"5", 5, 5, false},
+		{"100-200", 100, 200, false},
+		{"0x10", 16, 16, false},
+		{"0", 0, 0, true},
+		{"9-3", 0, 0, true},
+		{"abc", 0, 0, true},
+	}
+	for _, tt := range tests {
+		min, max, err := ParseSerials(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSerials(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (min != tt.min || max != tt.max) {
+			t.Errorf("ParseSerials(%q) = %d-%d; want %d-%d", tt.input, min, max, tt.min, tt.max)
+		}
+	}
+}
+
+func TestLoadTextList(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "krl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	revoked, _ := newKey(t)
+	other, _ := newKey(t)
+	path := filepath.Join(tmpDir, "revoked_keys")
+	content := "# lost laptop\n" + string(ssh.MarshalAuthorizedKey(revoked))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !k.IsRevoked(revoked) || k.IsRevoked(other) {
+		t.Error("text revocation list not applied")
+	}
+
+	if err := os.WriteFile(path, []byte("garbage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() expected error for a file that is neither a KRL nor keys")
+	}
+}
+
+// TestOpenSSHCompatibility checks KRLs against ssh-keygen when it is installed
+func TestOpenSSHCompatibility(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	tmpDir, err := os.MkdirTemp("", "krl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeKey := func(name string, key ssh.PublicKey) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, ssh.MarshalAuthorizedKey(key), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	caKey, ca := newKey(t)
+	revoked, _ := newKey(t)
+	kept, _ := newKey(t)
+	revokedPath := writeKey("revoked.pub", revoked)
+	keptPath := writeKey("kept.pub", kept)
+	certPath := writeKey("cert.pub", newCert(t, ca, 12, "bob"))
+	caPath := writeKey("ca.pub", caKey)
+
+	t.Run("ssh-keygen reads our KRL", func(t *testing.T) {
+		k := &KRL{Comment: "test"}
+		k.RevokeKey(revoked)
+		k.RevokeSerials(caKey, 10, 20)
+		path := filepath.Join(tmpDir, "ours.krl")
+		if err := k.Write(path); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command("ssh-keygen", "-Q", "-f", path, revokedPath).CombinedOutput(); err == nil {
+			t.Errorf("ssh-keygen -Q accepted a revoked key: %s", out)
+		}
+		if out, err := exec.Command("ssh-keygen", "-Q", "-f", path, certPath).CombinedOutput(); err == nil {
+			t.Errorf("ssh-keygen -Q accepted a revoked certificate: %s", out)
+		}
+		if out, err := exec.Command("ssh-keygen", "-Q", "-f", path, keptPath).CombinedOutput(); err != nil {
+			t.Errorf("ssh-keygen -Q rejected a key that is not revoked: %v %s", err, out)
+		}
+	})
+
+	t.Run("We read ssh-keygen's KRL", func(t *testing.T) {
+		spec := filepath.Join(tmpDir, "spec")
+		if err := os.WriteFile(spec, []byte("serial: 10-20\nid: mallory\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(tmpDir, "theirs.krl")
+		if out, err := exec.Command("ssh-keygen", "-k", "-f", path, "-s", caPath, spec).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen -k: %v %s", err, out)
+		}
+		if out, err := exec.Command("ssh-keygen", "-k", "-u", "-f", path, revokedPath).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen -k -u: %v %s", err, out)
+		}
+
+		k, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !k.IsRevoked(revoked) || k.IsRevoked(kept) {
+			t.Error("explicit key revocation not read")
+		}
+		if !k.IsRevoked(newCert(t, ca, 12, "bob")) || !k.IsRevoked(newCert(t, ca, 99, "mallory")) {
+			t.Error("certificate revocation not read")
+		}
+		if k.IsRevoked(newCert(t, ca, 99, "bob")) {
+			t.Error("certificate outside the revoked serials reported revoked")
+		}
+	})
+
+	t.Run("Revoking a CA revokes its certificates", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "ca.krl")
+		if out, err := exec.Command("ssh-keygen", "-k", "-f", path, caPath).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen -k: %v %s", err, out)
+		}
+		if out, err := exec.Command("ssh-keygen", "-Q", "-f", path, certPath).CombinedOutput(); err == nil {
+			t.Fatalf("ssh-keygen -Q accepted a certificate of a revoked CA: %s", out)
+		}
+		k, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !k.IsRevoked(newCert(t, ca, 12, "bob")) {
+			t.Error("certificate of a revoked CA not reported revoked")
+		}
+	})
+}
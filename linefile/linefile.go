@@ -0,0 +1,102 @@
+// Package linefile holds the lossless line model shared by the OpenSSH files
+// this tool edits, such as authorized_keys, known_hosts and allowed_signers.
+//
+// Each line keeps its original text next to its parsed entry. Lines that are
+// not modified are written back exactly as they were read, so comments, blank
+// lines and entries a parser does not understand survive a round trip.
+package linefile
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Entry is the parsed form of a line, typically a pointer to a struct
+type Entry interface {
+	comparable
+	String() string
+}
+
+// Line is a single line of a file
+type Line[E Entry] struct {
+	// Raw is the original text of the line, used when the line is written back unchanged
+	Raw string
+	// Entry is the parsed line, nil for comments, blank lines and unparseable lines
+	Entry E
+	// Modified marks lines whose Entry must be re-rendered when written
+	Modified bool
+}
+
+// NewLine returns the line holding raw, with its entry if parse accepts it
+func NewLine[E Entry](raw string, parse func(string) (E, error)) *Line[E] {
+	line := &Line[E]{Raw: raw}
+	if entry, err := parse(raw); err == nil {
+		line.Entry = entry
+	}
+	return line
+}
+
+// Text returns the text of the line as it will be written
+func (l *Line[E]) Text() string {
+	var none E
+	if l.Entry != none && l.Modified {
+		return l.Entry.String()
+	}
+	return l.Raw
+}
+
+// File is the lines of a parsed file
+type File[E Entry] struct {
+	Lines []*Line[E]
+}
+
+// Parse splits data into lines, parsing each with parse. A final newline
+// and carriage returns before newlines are dropped.
+func Parse[E Entry](data []byte, parse func(string) (E, error)) []*Line[E] {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	var lines []*Line[E]
+	for _, raw := range strings.Split(text, "\n") {
+		lines = append(lines, NewLine(strings.TrimSuffix(raw, "\r"), parse))
+	}
+	return lines
+}
+
+// Entries returns the lines that hold an entry
+func (f *File[E]) Entries() []*Line[E] {
+	var none E
+	var lines []*Line[E]
+	for _, line := range f.Lines {
+		if line.Entry != none {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Remove deletes the lines for which remove returns true and returns how many were removed
+func (f *File[E]) Remove(remove func(*Line[E]) bool) int {
+	kept := f.Lines[:0]
+	removed := 0
+	for _, line := range f.Lines {
+		if remove(line) {
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	f.Lines = kept
+	return removed
+}
+
+// Bytes formats the file, terminating every line with a newline
+func (f *File[E]) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, line := range f.Lines {
+		buf.WriteString(line.Text())
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,65 @@
+package linefile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type word struct {
+	text string
+}
+
+func (w *word) String() string {
+	return strings.ToUpper(w.text)
+}
+
+func parseWord(line string) (*word, error) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, errors.New("not a word")
+	}
+	return &word{text: strings.TrimSpace(line)}, nil
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"Empty", "", ""},
+		{"Comments and blanks", "# header\n\n  alpha  \n", "# header\n\n  alpha  \n"},
+		{"Missing final newline", "alpha\nbeta", "alpha\nbeta\n"},
+		{"Carriage returns", "alpha\r\nbeta\r\n", "alpha\nbeta\n"},
+	}
+
+	for _, tt := range tests {
+		f := &File[*word]{Lines: Parse([]byte(tt.data), parseWord)}
+		if got := string(f.Bytes()); got != tt.want {
+			t.Errorf("%s: Bytes() = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileEdits(t *testing.T) {
+	f := &File[*word]{Lines: Parse([]byte("# words\nalpha\n\nbeta\ngamma\n"), parseWord)}
+
+	entries := f.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Entries() = %d lines; want 3", len(entries))
+	}
+	entries[0].Modified = true
+
+	removed := f.Remove(func(line *Line[*word]) bool {
+		return line.Entry != nil && line.Entry.text == "beta"
+	})
+	if removed != 1 {
+		t.Errorf("Remove() = %d; want 1", removed)
+	}
+
+	f.Lines = append(f.Lines, NewLine("# not modified", parseWord))
+	want := "# words\nALPHA\n\ngamma\n# not modified\n"
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("Bytes() = %q; want %q", got, want)
+	}
+}
@@ -29,6 +29,7 @@ func init() {
 	cmd.ListCmd.Aliases = []string{"ls"}
 	cmd.RemoveCmd.Aliases = []string{"rm"}
 	cmd.EditCmd.Aliases = []string{"e"}
+	cmd.ConnectCmd.Aliases = []string{"c"}
 
 	// Create help command with ? alias
 	helpCmd := &cobra.Command{
@@ -52,7 +53,25 @@ func init() {
 	rootCmd.AddCommand(cmd.ListCmd)
 	rootCmd.AddCommand(cmd.RemoveCmd)
 	rootCmd.AddCommand(cmd.EditCmd)
+	rootCmd.AddCommand(cmd.KeysCmd)
+	rootCmd.AddCommand(cmd.HostsCmd)
+	rootCmd.AddCommand(cmd.KeygenCmd)
 	rootCmd.AddCommand(cmd.VersionCmd)
+	rootCmd.AddCommand(cmd.AuthorizedKeysCommandCmd)
+	rootCmd.AddCommand(cmd.AuditCmd)
+	rootCmd.AddCommand(cmd.DoctorCmd)
+	rootCmd.AddCommand(cmd.AgentCmd)
+	rootCmd.AddCommand(cmd.CertCmd)
+	rootCmd.AddCommand(cmd.KRLCmd)
+	rootCmd.AddCommand(cmd.SignersCmd)
+	rootCmd.AddCommand(cmd.SignCmd)
+	rootCmd.AddCommand(cmd.VerifyCmd)
+	rootCmd.AddCommand(cmd.RotateCmd)
+	rootCmd.AddCommand(cmd.CopyIDCmd)
+	rootCmd.AddCommand(cmd.FleetCmd)
+	rootCmd.AddCommand(cmd.TestCmd)
+	rootCmd.AddCommand(cmd.ConnectCmd)
+	rootCmd.AddCommand(cmd.RecentCmd)
 }
 
 func main() {
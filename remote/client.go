@@ -0,0 +1,165 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultDialTimeout bounds connecting and logging in when the context has no deadline
+const defaultDialTimeout = 30 * time.Second
+
+// Target describes a server to log in to
+type Target struct {
+	// Addr is the host:port to dial
+	Addr string
+	User string
+	// Auth lists the authentication methods to try, in order
+	Auth []ssh.AuthMethod
+	// HostKeyCallback verifies the key the server identifies itself with
+	HostKeyCallback ssh.HostKeyCallback
+	// HostKeyAlgorithms, when set, restricts the host keys the server may
+	// use to those the callback can verify
+	HostKeyAlgorithms []string
+}
+
+// Client is an authenticated connection to a server
+type Client struct {
+	conn    *ssh.Client
+	onClose []func()
+}
+
+// Dial connects to t.Addr and logs in as t.User
+func Dial(ctx context.Context, t Target) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", t.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", t.Addr, err)
+	}
+	return NewClient(ctx, conn, t)
+}
+
+// NewClient logs in as t.User over conn, an established connection to
+// t.Addr such as one forwarded by a jump host. conn is closed if logging in
+// fails.
+func NewClient(ctx context.Context, conn net.Conn, t Target) (*Client, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultDialTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	// The deadline guards the key exchange, which ends with the host key
+	// check, but not the login after it, which may wait for the user to
+	// type a password
+	callback := t.HostKeyCallback
+	if callback != nil {
+		callback = func(hostname string, addr net.Addr, key ssh.PublicKey) error {
+			if err := t.HostKeyCallback(hostname, addr, key); err != nil {
+				return err
+			}
+			conn.SetDeadline(time.Time{})
+			return nil
+		}
+	}
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, t.Addr, &ssh.ClientConfig{
+		User:              t.User,
+		Auth:              t.Auth,
+		HostKeyCallback:   callback,
+		HostKeyAlgorithms: t.HostKeyAlgorithms,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to log in to %s as %s: %w", t.Addr, t.User, err)
+	}
+	// Commands may take their time
+	conn.SetDeadline(time.Time{})
+	return &Client{conn: ssh.NewClient(clientConn, chans, reqs)}, nil
+}
+
+// OnClose registers f to run once the connection is closed, such as closing
+// the jump hosts it goes through
+func (c *Client) OnClose(f func()) {
+	c.onClose = append(c.onClose, f)
+}
+
+// Close closes the connection, then runs the functions registered with
+// OnClose in reverse order
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	for i := len(c.onClose) - 1; i >= 0; i-- {
+		c.onClose[i]()
+	}
+	c.onClose = nil
+	return err
+}
+
+// DialTCP asks the server to open a connection to addr, as ssh -J does to
+// reach hosts behind a jump host
+func (c *Client) DialTCP(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := c.conn.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// Run runs command through the login shell of the remote user, feeding it
+// stdin, and returns its standard output. A command that exits with a
+// non-zero status fails with its standard error in the message.
+func (c *Client) Run(command string, stdin []byte) ([]byte, error) {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(stdin)
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Run(command); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("remote command failed: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("remote command failed: %w", err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// readAuthorizedKeysCommand prints ~/.ssh/authorized_keys, or nothing if it does not exist
+const readAuthorizedKeysCommand = `cd && if [ -f .ssh/authorized_keys ]; then cat .ssh/authorized_keys; fi`
+
+// writeAuthorizedKeysCommand replaces ~/.ssh/authorized_keys with stdin. The
+// file is written next to the old one and renamed over it, so a dropped
+// connection never leaves a truncated file, and the directory and file get
+// the permissions sshd's StrictModes requires. restorecon fixes the SELinux
+// label where it applies.
+const writeAuthorizedKeysCommand = `cd && umask 077 && mkdir -p .ssh && chmod 700 .ssh && ` +
+	`cat > .ssh/authorized_keys.ssh-config.tmp && chmod 600 .ssh/authorized_keys.ssh-config.tmp && ` +
+	`mv -f .ssh/authorized_keys.ssh-config.tmp .ssh/authorized_keys && ` +
+	`{ command -v restorecon >/dev/null 2>&1 && restorecon -F .ssh .ssh/authorized_keys || true; }`
+
+// ReadAuthorizedKeys returns the contents of the remote user's
+// ~/.ssh/authorized_keys, which is empty if the file does not exist
+func (c *Client) ReadAuthorizedKeys() ([]byte, error) {
+	data, err := c.Run(readAuthorizedKeysCommand, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote authorized_keys: %w", err)
+	}
+	return data, nil
+}
+
+// WriteAuthorizedKeys replaces the remote user's ~/.ssh/authorized_keys with data
+func (c *Client) WriteAuthorizedKeys(data []byte) error {
+	if _, err := c.Run(writeAuthorizedKeysCommand, data); err != nil {
+		return fmt.Errorf("failed to write remote authorized_keys: %w", err)
+	}
+	return nil
+}
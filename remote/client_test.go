@@ -0,0 +1,203 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestDial(t *testing.T) {
+	home, err := os.MkdirTemp("", "remote-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	signer := newTestSigner(t)
+	os.MkdirAll(filepath.Join(home, ".ssh"), 0700)
+	os.WriteFile(filepath.Join(home, ".ssh", "authorized_keys"), ssh.MarshalAuthorizedKey(signer.PublicKey()), 0600)
+
+	server := remotetest.NewServerWithOptions(remotetest.Options{Home: home, Password: "secret"})
+	defer server.Close()
+
+	hostKey := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, hostKey := range server.HostKeys {
+			if bytes.Equal(hostKey.PublicKey().Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown host key")
+	}
+	tests := []struct {
+		name    string
+		auth    ssh.AuthMethod
+		hostKey ssh.HostKeyCallback
+		wantErr bool
+	}{
+		{"Public key", ssh.PublicKeys(signer), hostKey, false},
+		{"Password", ssh.Password("secret"), hostKey, false},
+		{"Unknown key", ssh.PublicKeys(newTestSigner(t)), hostKey, true},
+		{"Wrong password", ssh.Password("guess"), hostKey, true},
+		{"Wrong host key", ssh.PublicKeys(signer), ssh.FixedHostKey(signer.PublicKey()), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			client, err := Dial(ctx, Target{
+				Addr:            server.Addr,
+				User:            "deploy",
+				Auth:            []ssh.AuthMethod{tt.auth},
+				HostKeyCallback: tt.hostKey,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				client.Close()
+			}
+		})
+	}
+}
+
+func TestClientAuthorizedKeys(t *testing.T) {
+	home, err := os.MkdirTemp("", "remote-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	server := remotetest.NewServerWithOptions(remotetest.Options{Home: home, Password: "secret"})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := Dial(ctx, Target{
+		Addr:            server.Addr,
+		User:            "deploy",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	// A missing file reads as empty
+	data, err := client.ReadAuthorizedKeys()
+	if err != nil {
+		t.Fatalf("ReadAuthorizedKeys() error = %v", err)
+	}
+	if len(data) != 0 {
+		t.Errorf("ReadAuthorizedKeys() = %q; want empty", data)
+	}
+
+	signer := newTestSigner(t)
+	content := ssh.MarshalAuthorizedKey(signer.PublicKey())
+	if err := client.WriteAuthorizedKeys(content); err != nil {
+		t.Fatalf("WriteAuthorizedKeys() error = %v", err)
+	}
+	if data, err = client.ReadAuthorizedKeys(); err != nil || string(data) != string(content) {
+		t.Errorf("ReadAuthorizedKeys() = %q, %v; want %q", data, err, content)
+	}
+
+	for path, want := range map[string]os.FileMode{".ssh": 0700, ".ssh/authorized_keys": 0600} {
+		info, err := os.Stat(filepath.Join(home, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s has mode %o; want %o", path, info.Mode().Perm(), want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, ".ssh", "authorized_keys.ssh-config.tmp")); !os.IsNotExist(err) {
+		t.Error("temporary file was left behind")
+	}
+
+	// The written key is now accepted
+	keyClient, err := Dial(ctx, Target{
+		Addr:            server.Addr,
+		User:            "deploy",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("Dial() with the installed key error = %v", err)
+	}
+	keyClient.Close()
+
+	if _, err := client.Run("echo oops >&2; exit 3", nil); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("Run() error = %v; want the command's stderr", err)
+	}
+}
+
+func TestClientDialTCP(t *testing.T) {
+	jump := remotetest.NewServerWithOptions(remotetest.Options{Password: "secret", Forward: true})
+	defer jump.Close()
+	target := remotetest.NewServerWithOptions(remotetest.Options{Password: "target"})
+	defer target.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	jumpClient, err := Dial(ctx, Target{
+		Addr:            jump.Addr,
+		User:            "deploy",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer jumpClient.Close()
+
+	// Log in to the target through the jump host
+	conn, err := jumpClient.DialTCP(ctx, target.Addr)
+	if err != nil {
+		t.Fatalf("DialTCP() error = %v", err)
+	}
+	client, err := NewClient(ctx, conn, Target{
+		Addr:            target.Addr,
+		User:            "deploy",
+		Auth:            []ssh.AuthMethod{ssh.Password("target")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.Close()
+
+	// A port nothing listens on cannot be reached
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+	if _, err := jumpClient.DialTCP(ctx, closed); err == nil {
+		t.Error("DialTCP() expected error for a closed port")
+	}
+}
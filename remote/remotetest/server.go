@@ -0,0 +1,309 @@
+// Package remotetest provides an in-process SSH server for tests, in the
+// spirit of net/http/httptest.
+package remotetest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Options configure a test server
+type Options struct {
+	// Home is the home directory of every user. When set, public keys listed
+	// in Home/.ssh/authorized_keys are accepted and exec requests run in Home
+	// through sh, as sshd would run them.
+	Home string
+	// Password, when set, is accepted for every user
+	Password string
+	// Forward serves direct-tcpip channels, so the server can be used as a
+	// jump host
+	Forward bool
+	// HostCA, when set, signs a certificate for every host key, which the
+	// server also offers
+	HostCA ssh.Signer
+	// HostPrincipals are the names the host certificates are valid for,
+	// 127.0.0.1 when empty
+	HostPrincipals []string
+}
+
+// Server is an SSH server listening on a random local port
+type Server struct {
+	// Addr is the host:port the server listens on
+	Addr string
+	// HostKeys are the keys the server identifies itself with, one per algorithm family
+	HostKeys []ssh.Signer
+
+	opts      Options
+	listener  net.Listener
+	config    *ssh.ServerConfig
+	wg        sync.WaitGroup
+	forwarded atomic.Int32
+}
+
+// NewServer starts a server with freshly generated Ed25519, ECDSA and RSA host
+// keys. Clients can complete the key exchange but every authentication
+// attempt is rejected. The caller must Close the server when done.
+func NewServer() *Server {
+	return NewServerWithOptions(Options{})
+}
+
+// NewServerWithOptions starts a server like NewServer that accepts the
+// logins and runs the commands described by opts
+func NewServerWithOptions(opts Options) *Server {
+	s := &Server{opts: opts}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if opts.Password != "" && string(password) == opts.Password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if s.authorized(key) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("public key rejected for %s", conn.User())
+		},
+	}
+
+	for _, generate := range []func() (any, error){
+		func() (any, error) { _, key, err := ed25519.GenerateKey(rand.Reader); return key, err },
+		func() (any, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) },
+		func() (any, error) { return rsa.GenerateKey(rand.Reader, 2048) },
+	} {
+		key, err := generate()
+		if err != nil {
+			panic(fmt.Sprintf("remotetest: failed to generate host key: %v", err))
+		}
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			panic(fmt.Sprintf("remotetest: failed to create host key signer: %v", err))
+		}
+		s.config.AddHostKey(signer)
+		s.HostKeys = append(s.HostKeys, signer)
+		if opts.HostCA != nil {
+			s.config.AddHostKey(newHostCertSigner(signer, opts))
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("remotetest: failed to listen: %v", err))
+	}
+	s.listener = listener
+	s.Addr = listener.Addr().String()
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// newHostCertSigner returns signer with a host certificate signed by
+// opts.HostCA, valid forever for opts.HostPrincipals
+func newHostCertSigner(signer ssh.Signer, opts Options) ssh.Signer {
+	principals := opts.HostPrincipals
+	if len(principals) == 0 {
+		principals = []string{"127.0.0.1"}
+	}
+	cert := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		CertType:        ssh.HostCert,
+		KeyId:           "remotetest host",
+		ValidPrincipals: principals,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, opts.HostCA); err != nil {
+		panic(fmt.Sprintf("remotetest: failed to sign host certificate: %v", err))
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		panic(fmt.Sprintf("remotetest: failed to create host certificate signer: %v", err))
+	}
+	return certSigner
+}
+
+// Host returns the host part of Addr
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+// Port returns the port part of Addr
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// Forwarded returns the number of connections the server has forwarded as
+// a jump host
+func (s *Server) Forwarded() int {
+	return int(s.forwarded.Load())
+}
+
+// Close stops the server and waits for its connections to finish
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" && s.opts.Forward {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.forward(newChannel)
+			}()
+			continue
+		}
+		if newChannel.ChannelType() != "session" || s.opts.Home == "" {
+			newChannel.Reject(ssh.Prohibited, "no channels are served")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.session(channel, requests)
+		}()
+	}
+}
+
+// authorized reports whether key is listed in the authorized_keys file,
+// which is read again for every attempt like sshd does
+func (s *Server) authorized(key ssh.PublicKey) bool {
+	if s.opts.Home == "" {
+		return false
+	}
+	rest, err := os.ReadFile(filepath.Join(s.opts.Home, ".ssh", "authorized_keys"))
+	if err != nil {
+		return false
+	}
+	for len(rest) > 0 {
+		var listed ssh.PublicKey
+		listed, _, _, rest, err = ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			return false
+		}
+		if bytes.Equal(listed.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// session serves exec requests on a session channel; anything else is refused
+func (s *Server) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Dir = s.opts.Home
+		cmd.Env = []string{"HOME=" + s.opts.Home, "PATH=" + os.Getenv("PATH")}
+		cmd.Stdin = channel
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		status := uint32(0)
+		if err := cmd.Run(); err != nil {
+			status = 255
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				status = uint32(exitErr.ExitCode())
+			}
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// forward connects a direct-tcpip channel to the address it asks for
+func (s *Server) forward(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid request")
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer conn.Close()
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+	s.forwarded.Add(1)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(conn, channel)
+		conn.(*net.TCPConn).CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
@@ -0,0 +1,56 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/evberrypi/ssh-config/remote/remotetest"
+)
+
+func TestScanHostKeys(t *testing.T) {
+	server := remotetest.NewServer()
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keys, err := ScanHostKeys(ctx, server.Addr)
+	if err != nil {
+		t.Fatalf("ScanHostKeys() error = %v", err)
+	}
+	if len(keys) != len(server.HostKeys) {
+		t.Fatalf("ScanHostKeys() returned %d keys; want %d", len(keys), len(server.HostKeys))
+	}
+	for _, hostKey := range server.HostKeys {
+		if !containsKey(keys, hostKey.PublicKey()) {
+			t.Errorf("ScanHostKeys() is missing the %s host key", hostKey.PublicKey().Type())
+		}
+	}
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if bytes.Equal(keys[i].Marshal(), keys[j].Marshal()) {
+				t.Errorf("ScanHostKeys() returned duplicate %s keys", keys[i].Type())
+			}
+		}
+	}
+}
+
+func TestScanHostKeysUnreachable(t *testing.T) {
+	// Reserve a port and close it so nothing is listening there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := ScanHostKeys(ctx, addr); err == nil {
+		t.Error("ScanHostKeys() expected error for closed port")
+	}
+}
@@ -0,0 +1,194 @@
+package sshconfig
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/utils"
+)
+
+// Resolved holds the effective options for a host
+type Resolved struct {
+	// Host is the name the options were resolved for, usually a config alias
+	Host    string
+	options map[string][]Option
+	// keywords lists the keywords set, in the order they were first set
+	keywords []string
+}
+
+// Resolve evaluates the configuration for host and returns its effective options
+func (c *Config) Resolve(host string) *Resolved {
+	r := &Resolved{Host: host, options: make(map[string][]Option)}
+	for _, block := range c.Blocks {
+		if !block.Matches(host) {
+			continue
+		}
+		for _, opt := range block.Options {
+			keyword := strings.ToLower(opt.Keyword)
+			if len(r.options[keyword]) == 0 {
+				r.keywords = append(r.keywords, keyword)
+			}
+			if multiValued[keyword] || len(r.options[keyword]) == 0 {
+				r.options[keyword] = append(r.options[keyword], opt)
+			}
+		}
+	}
+	return r
+}
+
+// Get returns the value of keyword, or an empty string if it is not set
+func (r *Resolved) Get(keyword string) string {
+	opts := r.options[strings.ToLower(keyword)]
+	if len(opts) == 0 {
+		return ""
+	}
+	return opts[0].Value()
+}
+
+// GetAll returns every value of a keyword whose values accumulate, such as IdentityFile
+func (r *Resolved) GetAll(keyword string) []string {
+	var values []string
+	for _, opt := range r.options[strings.ToLower(keyword)] {
+		values = append(values, opt.Value())
+	}
+	return values
+}
+
+// Option returns the option that set keyword, used to report where a value came from
+func (r *Resolved) Option(keyword string) (Option, bool) {
+	opts := r.options[strings.ToLower(keyword)]
+	if len(opts) == 0 {
+		return Option{}, false
+	}
+	return opts[0], true
+}
+
+// Options returns the effective options in the order the config sets them,
+// with every value of the keywords whose values accumulate
+func (r *Resolved) Options() []Option {
+	var opts []Option
+	for _, keyword := range r.keywords {
+		opts = append(opts, r.options[keyword]...)
+	}
+	return opts
+}
+
+// HostName returns the real host name to connect to, defaulting to the host itself
+func (r *Resolved) HostName() string {
+	if hostname := r.Get("HostName"); hostname != "" {
+		return r.expand(hostname, false)
+	}
+	return r.Host
+}
+
+// Port returns the port to connect to, defaulting to 22
+func (r *Resolved) Port() int {
+	if port, err := strconv.Atoi(r.Get("Port")); err == nil && port > 0 {
+		return port
+	}
+	return 22
+}
+
+// User returns the remote user name, defaulting to the local user
+func (r *Resolved) User() string {
+	if u := r.Get("User"); u != "" {
+		return u
+	}
+	return localUser()
+}
+
+// HostKeyAlias returns the name host keys are recorded under in known_hosts
+func (r *Resolved) HostKeyAlias() string {
+	if alias := r.Get("HostKeyAlias"); alias != "" {
+		return alias
+	}
+	return r.HostName()
+}
+
+// IdentityFiles returns the identity files for the host with ~ and tokens expanded
+func (r *Resolved) IdentityFiles() []string {
+	return r.expandedPaths("IdentityFile")
+}
+
+// CertificateFiles returns the certificate files for the host with ~ and tokens expanded
+func (r *Resolved) CertificateFiles() []string {
+	return r.expandedPaths("CertificateFile")
+}
+
+// UserKnownHostsFiles returns the user known_hosts files for the host,
+// defaulting to ~/.ssh/known_hosts
+func (r *Resolved) UserKnownHostsFiles() []string {
+	value := r.Get("UserKnownHostsFile")
+	if value == "" {
+		return []string{utils.ExpandUser(utils.SSHPaths.KnownHosts)}
+	}
+	var files []string
+	for _, file := range strings.Fields(value) {
+		files = append(files, r.expand(file, true))
+	}
+	return files
+}
+
+func (r *Resolved) expandedPaths(keyword string) []string {
+	var paths []string
+	for _, value := range r.GetAll(keyword) {
+		if strings.EqualFold(value, "none") {
+			continue
+		}
+		paths = append(paths, r.expand(value, true))
+	}
+	return paths
+}
+
+// expand replaces the % tokens ssh supports in paths and host names, and a
+// leading ~ when path is true
+func (r *Resolved) expand(value string, path bool) string {
+	if path {
+		value = utils.ExpandUser(value)
+	}
+	if !strings.Contains(value, "%") {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case '%':
+			b.WriteByte('%')
+		case 'd':
+			b.WriteString(os.Getenv("HOME"))
+		case 'h':
+			if path {
+				b.WriteString(r.HostName())
+			} else {
+				b.WriteString(r.Host)
+			}
+		case 'n':
+			b.WriteString(r.Host)
+		case 'p':
+			b.WriteString(strconv.Itoa(r.Port()))
+		case 'r':
+			b.WriteString(r.User())
+		case 'u':
+			b.WriteString(localUser())
+		default:
+			b.WriteByte('%')
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+func localUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,81 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	// Set the HOME environment variable to a fixed directory
+	home := filepath.Join(os.TempDir(), "home")
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", oldHome)
+
+	config := `Host web
+    HostName %h.example.com
+    User deploy
+    IdentityFile ~/.ssh/id_%r_%n
+    HostKeyAlias web-alias
+
+Host *
+    User nobody
+    Port 2200
+    IdentityFile ~/.ssh/id_ed25519
+    UserKnownHostsFile ~/.ssh/known_hosts ~/.ssh/known_hosts2
+`
+	cfg, err := Parse(strings.NewReader(config), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := cfg.Resolve("web")
+	if got := web.HostName(); got != "web.example.com" {
+		t.Errorf("HostName() = %q; want web.example.com", got)
+	}
+	if got := web.User(); got != "deploy" {
+		t.Errorf("User() = %q; want deploy (first value wins)", got)
+	}
+	if got := web.Port(); got != 2200 {
+		t.Errorf("Port() = %d; want 2200", got)
+	}
+	if got := web.HostKeyAlias(); got != "web-alias" {
+		t.Errorf("HostKeyAlias() = %q; want web-alias", got)
+	}
+	wantIdentities := []string{filepath.Join(home, ".ssh/id_deploy_web"), filepath.Join(home, ".ssh/id_ed25519")}
+	if got := web.IdentityFiles(); !reflect.DeepEqual(got, wantIdentities) {
+		t.Errorf("IdentityFiles() = %q; want %q", got, wantIdentities)
+	}
+	wantKnownHosts := []string{filepath.Join(home, ".ssh/known_hosts"), filepath.Join(home, ".ssh/known_hosts2")}
+	if got := web.UserKnownHostsFiles(); !reflect.DeepEqual(got, wantKnownHosts) {
+		t.Errorf("UserKnownHostsFiles() = %q; want %q", got, wantKnownHosts)
+	}
+
+	var keywords []string
+	for _, opt := range web.Options() {
+		keywords = append(keywords, opt.Keyword+" "+opt.Value())
+	}
+	wantOptions := []string{
+		"HostName %h.example.com",
+		"User deploy",
+		"IdentityFile ~/.ssh/id_%r_%n",
+		"IdentityFile ~/.ssh/id_ed25519",
+		"HostKeyAlias web-alias",
+		"Port 2200",
+		"UserKnownHostsFile ~/.ssh/known_hosts ~/.ssh/known_hosts2",
+	}
+	if !reflect.DeepEqual(keywords, wantOptions) {
+		t.Errorf("Options() = %q; want %q", keywords, wantOptions)
+	}
+
+	other := cfg.Resolve("10.0.0.1")
+	if got := other.HostName(); got != "10.0.0.1" {
+		t.Errorf("HostName() = %q; want the host itself", got)
+	}
+	if got := other.HostKeyAlias(); got != "10.0.0.1" {
+		t.Errorf("HostKeyAlias() = %q; want the host name", got)
+	}
+}
@@ -0,0 +1,264 @@
+// Package sshconfig parses OpenSSH client configuration files and resolves
+// the effective options for a host the way ssh does: blocks are evaluated in
+// order and the first value obtained for an option wins.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/utils"
+)
+
+// maxIncludeDepth bounds nested Include directives so include loops fail instead of recursing forever
+const maxIncludeDepth = 16
+
+// multiValued lists the keywords whose values accumulate instead of the first one winning
+var multiValued = map[string]bool{
+	"certificatefile": true,
+	"dynamicforward":  true,
+	"identityfile":    true,
+	"localforward":    true,
+	"remoteforward":   true,
+	"sendenv":         true,
+	"setenv":          true,
+}
+
+// Option is a single keyword and its arguments
+type Option struct {
+	Keyword string
+	Args    []string
+	File    string
+	Line    int
+}
+
+// Value returns the arguments of the option joined by spaces
+func (o Option) Value() string {
+	return strings.Join(o.Args, " ")
+}
+
+// Block is a Host or Match section, or the global options before the first
+// section, which have an empty Kind and apply to every host
+type Block struct {
+	Kind     string
+	Patterns []string
+	Options  []Option
+	File     string
+	Line     int
+}
+
+// Config is a parsed client configuration with its includes expanded
+type Config struct {
+	Blocks []*Block
+}
+
+// Load reads a configuration file and the files it includes. A missing file
+// yields an empty configuration, like ssh behaves without ~/.ssh/config.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	global := &Block{File: path}
+	cfg.Blocks = append(cfg.Blocks, global)
+	if err := cfg.load(utils.ExpandUser(path), global, 0); err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Parse parses a configuration without following Include directives
+func Parse(r io.Reader, path string) (*Config, error) {
+	cfg := &Config{}
+	global := &Block{File: path}
+	cfg.Blocks = append(cfg.Blocks, global)
+	if err := cfg.parse(r, path, global, -1); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) load(path string, current *Block, depth int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.parse(file, path, current, depth)
+}
+
+// parse reads options into current until a Host or Match line starts a new
+// block. A negative depth disables Include processing.
+func (c *Config) parse(r io.Reader, path string, current *Block, depth int) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		keyword, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", path, lineNum, err)
+		}
+		if keyword == "" {
+			continue
+		}
+
+		switch strings.ToLower(keyword) {
+		case "host", "match":
+			if len(args) == 0 {
+				return fmt.Errorf("%s line %d: %s requires an argument", path, lineNum, keyword)
+			}
+			current = &Block{Kind: canonicalKind(keyword), Patterns: args, File: path, Line: lineNum}
+			c.Blocks = append(c.Blocks, current)
+		case "include":
+			if depth < 0 {
+				current.Options = append(current.Options, Option{Keyword: keyword, Args: args, File: path, Line: lineNum})
+				continue
+			}
+			if depth >= maxIncludeDepth {
+				return fmt.Errorf("%s line %d: too many nested includes", path, lineNum)
+			}
+			for _, pattern := range args {
+				matches, err := filepath.Glob(includePath(pattern))
+				if err != nil {
+					return fmt.Errorf("%s line %d: invalid include %q: %w", path, lineNum, pattern, err)
+				}
+				sort.Strings(matches)
+				for _, match := range matches {
+					if err := c.load(match, current, depth+1); err != nil {
+						return err
+					}
+					// An included file may open new blocks; options after the
+					// Include line still belong to the block it appeared in
+					if last := c.Blocks[len(c.Blocks)-1]; last != current {
+						current = c.continuation(current, path, lineNum)
+					}
+				}
+			}
+		default:
+			current.Options = append(current.Options, Option{Keyword: keyword, Args: args, File: path, Line: lineNum})
+		}
+	}
+	return scanner.Err()
+}
+
+// continuation opens a block with the same condition as block, used to carry
+// on a block after an included file started blocks of its own
+func (c *Config) continuation(block *Block, path string, line int) *Block {
+	next := &Block{Kind: block.Kind, Patterns: block.Patterns, File: path, Line: line}
+	c.Blocks = append(c.Blocks, next)
+	return next
+}
+
+// includePath resolves an Include argument. Relative paths are taken from ~/.ssh.
+func includePath(pattern string) string {
+	pattern = utils.ExpandUser(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(utils.ExpandUser("~/.ssh"), pattern)
+	}
+	return pattern
+}
+
+func canonicalKind(keyword string) string {
+	if strings.EqualFold(keyword, "match") {
+		return "Match"
+	}
+	return "Host"
+}
+
+// splitLine splits a configuration line into its keyword and arguments.
+// The keyword may be separated by whitespace or a single =, and arguments
+// may be double quoted to contain spaces.
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return line, nil, nil
+	}
+	keyword := line[:end]
+	rest := strings.TrimLeft(line[end:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+
+	var args []string
+	for rest != "" {
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated quote")
+			}
+			args = append(args, rest[1:closing+1])
+			rest = strings.TrimLeft(rest[closing+2:], " \t")
+			continue
+		}
+		if strings.HasPrefix(rest, "#") {
+			break
+		}
+		next := strings.IndexAny(rest, " \t")
+		if next < 0 {
+			args = append(args, rest)
+			break
+		}
+		args = append(args, rest[:next])
+		rest = strings.TrimLeft(rest[next:], " \t")
+	}
+	return keyword, args, nil
+}
+
+// Hosts returns the host aliases defined by Host lines, excluding wildcard
+// and negated patterns, in the order they first appear
+func (c *Config) Hosts() []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, block := range c.Blocks {
+		if block.Kind != "Host" {
+			continue
+		}
+		for _, pattern := range block.Patterns {
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			hosts = append(hosts, pattern)
+		}
+	}
+	return hosts
+}
+
+// Matches reports whether the block applies to host. Match blocks are only
+// evaluated for the all, host and originalhost criteria; blocks using other
+// criteria are treated as not matching.
+func (b *Block) Matches(host string) bool {
+	switch b.Kind {
+	case "":
+		return true
+	case "Host":
+		return utils.MatchPatternList(b.Patterns, host)
+	}
+
+	args := b.Patterns
+	for i := 0; i < len(args); i++ {
+		criterion := strings.ToLower(args[i])
+		switch {
+		case criterion == "all":
+			continue
+		case (criterion == "host" || criterion == "originalhost") && i+1 < len(args):
+			i++
+			if !utils.MatchPatternList(strings.Split(args[i], ","), host) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
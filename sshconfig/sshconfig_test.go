@@ -0,0 +1,139 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		keyword string
+		args    []string
+		wantErr bool
+	}{
+		{"", "", nil, false},
+		{"  # comment", "", nil, false},
+		{"HostName example.com", "HostName", []string{"example.com"}, false},
+		{"Port=2222", "Port", []string{"2222"}, false},
+		{"User = alice", "User", []string{"alice"}, false},
+		{`IdentityFile "~/My Keys/id_ed25519"`, "IdentityFile", []string{"~/My Keys/id_ed25519"}, false},
+		{"Host web db # servers", "Host", []string{"web", "db"}, false},
+		{`ProxyCommand "ssh -W`, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		keyword, args, err := splitLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if keyword != tt.keyword || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("splitLine(%q) = %q, %q; want %q, %q", tt.line, keyword, args, tt.keyword, tt.args)
+		}
+	}
+}
+
+func TestLoadWithInclude(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(filepath.Join(sshDir, "config.d"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"config": `User default
+Host web
+    HostName web.example.com
+    Include config.d/*
+    Port 2222
+
+Host *.internal !bastion.internal
+    ProxyJump bastion
+`,
+		"config.d/db": `Host db
+    HostName db.example.com
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sshDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := Load("~/.ssh/config")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := cfg.Hosts(); !reflect.DeepEqual(got, []string{"web", "db"}) {
+		t.Errorf("Hosts() = %q; want [web db]", got)
+	}
+
+	// Port after the Include line still belongs to the web block
+	web := cfg.Resolve("web")
+	if web.Port() != 2222 || web.HostName() != "web.example.com" {
+		t.Errorf("Resolve(web) = %s:%d; want web.example.com:2222", web.HostName(), web.Port())
+	}
+	db := cfg.Resolve("db")
+	if db.Port() != 22 || db.HostName() != "db.example.com" {
+		t.Errorf("Resolve(db) = %s:%d; want db.example.com:22", db.HostName(), db.Port())
+	}
+	if opt, ok := db.Option("HostName"); !ok || !strings.HasSuffix(opt.File, "config.d/db") || opt.Line != 2 {
+		t.Errorf("Option(HostName) = %+v; want config.d/db line 2", opt)
+	}
+
+	if got := cfg.Resolve("app.internal").Get("ProxyJump"); got != "bastion" {
+		t.Errorf("ProxyJump for app.internal = %q; want bastion", got)
+	}
+	if got := cfg.Resolve("bastion.internal").Get("ProxyJump"); got != "" {
+		t.Errorf("ProxyJump for bastion.internal = %q; want none", got)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	cfg, err := Load(filepath.Join(os.TempDir(), "ssh-config-does-not-exist"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Hosts()) != 0 {
+		t.Errorf("Hosts() = %q; want none", cfg.Hosts())
+	}
+}
+
+func TestBlockMatches(t *testing.T) {
+	tests := []struct {
+		config string
+		host   string
+		want   bool
+	}{
+		{"Host web*", "web1", true},
+		{"Host web* !web2", "web2", false},
+		{"Match host *.example.com", "db.example.com", true},
+		{"Match originalhost db,web", "web", true},
+		{"Match all", "anything", true},
+		{"Match user alice", "web", false},
+	}
+
+	for _, tt := range tests {
+		cfg, err := Parse(strings.NewReader(tt.config+"\n    User bob\n"), "config")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.Blocks[1].Matches(tt.host); got != tt.want {
+			t.Errorf("%q Matches(%q) = %v; want %v", tt.config, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package sshkeys
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// Critical options and extensions of OpenSSH user certificates
+const (
+	CertOptionForceCommand   = "force-command"
+	CertOptionSourceAddress  = "source-address"
+	CertOptionVerifyRequired = "verify-required"
+)
+
+// defaultUserExtensions are the extensions ssh-keygen grants user certificates
+var defaultUserExtensions = []string{
+	"permit-X11-forwarding",
+	"permit-agent-forwarding",
+	"permit-port-forwarding",
+	"permit-pty",
+	"permit-user-rc",
+}
+
+// SignOptions represents the options for signing a certificate
+type SignOptions struct {
+	KeyID      string
+	Principals []string
+	// Host signs a host certificate instead of a user certificate
+	Host   bool
+	Serial uint64
+	// ValidAfter and ValidBefore bound the validity; zero values mean always and forever
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	// CriticalOptions and Extensions default to the ssh-keygen defaults when nil
+	CriticalOptions map[string]string
+	Extensions      map[string]string
+}
+
+// SetOption applies an ssh-keygen -O style certificate option: clear,
+// force-command=<command>, source-address=<cidrs>, verify-required, or
+// no-<feature> and permit-<feature> for the user extensions
+func (o *SignOptions) SetOption(option string) error {
+	if o.CriticalOptions == nil {
+		o.CriticalOptions = make(map[string]string)
+	}
+	if o.Extensions == nil {
+		o.Extensions = DefaultExtensions(o.Host)
+	}
+
+	name, value, hasValue := strings.Cut(option, "=")
+	if o.Host && option != "clear" {
+		return fmt.Errorf("host certificates do not take options")
+	}
+	switch {
+	case name == "clear" && !hasValue:
+		o.Extensions = make(map[string]string)
+	case name == CertOptionForceCommand || name == CertOptionSourceAddress:
+		if !hasValue || value == "" {
+			return fmt.Errorf("certificate option %s requires a value", name)
+		}
+		o.CriticalOptions[name] = value
+	case name == CertOptionVerifyRequired && !hasValue:
+		o.CriticalOptions[name] = ""
+	case strings.HasPrefix(name, "no-") && !hasValue:
+		extension, ok := userExtension(strings.TrimPrefix(name, "no-"))
+		if !ok {
+			return fmt.Errorf("unknown certificate option %q", option)
+		}
+		delete(o.Extensions, extension)
+	case strings.HasPrefix(name, "permit-") && !hasValue:
+		extension, ok := userExtension(strings.TrimPrefix(name, "permit-"))
+		if !ok {
+			return fmt.Errorf("unknown certificate option %q", option)
+		}
+		o.Extensions[extension] = ""
+	default:
+		return fmt.Errorf("unknown certificate option %q", option)
+	}
+	return nil
+}
+
+// userExtension returns the extension for a feature name such as pty or
+// x11-forwarding, matching case-insensitively as ssh-keygen does
+func userExtension(feature string) (string, bool) {
+	for _, extension := range defaultUserExtensions {
+		if strings.EqualFold(extension, "permit-"+feature) {
+			return extension, true
+		}
+	}
+	return "", false
+}
+
+// DefaultExtensions returns the extensions a new certificate gets without options
+func DefaultExtensions(host bool) map[string]string {
+	extensions := make(map[string]string)
+	if !host {
+		for _, extension := range defaultUserExtensions {
+			extensions[extension] = ""
+		}
+	}
+	return extensions
+}
+
+// SignCertificate signs pub with the CA key, returning the certificate
+func SignCertificate(ca ssh.Signer, pub ssh.PublicKey, opts SignOptions) (*ssh.Certificate, error) {
+	if _, ok := pub.(*ssh.Certificate); ok {
+		return nil, fmt.Errorf("the key to sign is already a certificate")
+	}
+	if opts.Host && len(opts.Principals) == 0 {
+		return nil, fmt.Errorf("host certificates require at least one principal")
+	}
+	if !opts.ValidAfter.IsZero() && !opts.ValidBefore.IsZero() && !opts.ValidBefore.After(opts.ValidAfter) {
+		return nil, fmt.Errorf("certificate validity ends before it starts")
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          opts.Serial,
+		CertType:        ssh.UserCert,
+		KeyId:           opts.KeyID,
+		ValidPrincipals: opts.Principals,
+		ValidAfter:      0,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if opts.Host {
+		cert.CertType = ssh.HostCert
+	}
+	if !opts.ValidAfter.IsZero() {
+		cert.ValidAfter = uint64(opts.ValidAfter.Unix())
+	}
+	if !opts.ValidBefore.IsZero() {
+		cert.ValidBefore = uint64(opts.ValidBefore.Unix())
+	}
+	cert.CriticalOptions = opts.CriticalOptions
+	cert.Extensions = opts.Extensions
+	if cert.Extensions == nil {
+		cert.Extensions = DefaultExtensions(opts.Host)
+	}
+
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// ParseValidity parses a validity interval as accepted by ssh-keygen -V:
+// a single time is the end of an interval starting now, and "from:to" sets
+// both ends. Times are relative durations such as +8h, -5m, 1d or 52w,
+// absolute dates as YYYYMMDD[HHMM[SS]] in local time (append Z for UTC), or
+// "now", "always" and "forever". Zero times stand for always and forever.
+func ParseValidity(s string, now time.Time) (time.Time, time.Time, error) {
+	if s == "" {
+		return time.Time{}, time.Time{}, nil
+	}
+	from, to, found := strings.Cut(s, ":")
+	if !found {
+		from, to = "now", s
+	}
+
+	after, err := parseValidityTime(from, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	before, err := parseValidityTime(to, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if from == "forever" || to == "always" {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid validity interval %q", s)
+	}
+	if !after.IsZero() && !before.IsZero() && !before.After(after) {
+		return time.Time{}, time.Time{}, fmt.Errorf("validity interval %q ends before it starts", s)
+	}
+	return after, before, nil
+}
+
+func parseValidityTime(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "always", "forever":
+		return time.Time{}, nil
+	case "now":
+		return now, nil
+	case "":
+		return time.Time{}, fmt.Errorf("missing validity time")
+	}
+
+	if s[0] == '+' || s[0] == '-' || !isDigits(s) {
+		d, err := parseCertDuration(strings.TrimPrefix(s, "+"))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid validity time %q", s)
+		}
+		return now.Add(d), nil
+	}
+
+	loc := time.Local
+	value := s
+	if strings.HasSuffix(value, "Z") {
+		loc = time.UTC
+		value = strings.TrimSuffix(value, "Z")
+	}
+	layouts := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(value)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid validity time %q", s)
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid validity time %q", s)
+	}
+	return t, nil
+}
+
+// parseCertDuration parses a Go duration, also accepting d (days) and w (weeks)
+func parseCertDuration(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if len(s) > 1 {
+		if unit, ok := units[s[len(s)-1]]; ok {
+			n, err := strconv.Atoi(s[:len(s)-1])
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+func isDigits(s string) bool {
+	for _, r := range strings.TrimSuffix(s, "Z") {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CertificatePath returns the path ssh looks for the certificate of a key
+// at: the key path without .pub followed by -cert.pub
+func CertificatePath(keyPath string) string {
+	return strings.TrimSuffix(keyPath, ".pub") + "-cert.pub"
+}
+
+// WriteCertificate writes cert in the authorized_keys format ssh reads
+func WriteCertificate(path string, cert *ssh.Certificate, comment string) error {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert)))
+	if comment != "" {
+		line += " " + comment
+	}
+	if err := utils.WriteFileAtomic(utils.ExpandUser(path), []byte(line+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// ReadCertificate reads the certificate at path and its comment
+func ReadCertificate(path string) (*ssh.Certificate, string, error) {
+	data, err := os.ReadFile(utils.ExpandUser(path))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read certificate: %w", err)
+	}
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse certificate %s: %w", path, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, "", fmt.Errorf("%s is a %s key, not a certificate", path, pub.Type())
+	}
+	return cert, comment, nil
+}
+
+// CertificateValidity describes the validity interval of cert
+func CertificateValidity(cert *ssh.Certificate) string {
+	format := func(t uint64) string {
+		return time.Unix(int64(t), 0).Format("2006-01-02T15:04:05")
+	}
+	switch {
+	case cert.ValidAfter == 0 && cert.ValidBefore == ssh.CertTimeInfinity:
+		return "forever"
+	case cert.ValidBefore == ssh.CertTimeInfinity:
+		return "from " + format(cert.ValidAfter)
+	case cert.ValidAfter == 0:
+		return "until " + format(cert.ValidBefore)
+	}
+	return "from " + format(cert.ValidAfter) + " to " + format(cert.ValidBefore)
+}
+
+// CertificateStatus reports whether cert is valid, expired or not yet valid at now
+func CertificateStatus(cert *ssh.Certificate, now time.Time) string {
+	unix := uint64(now.Unix())
+	switch {
+	case unix < cert.ValidAfter:
+		return "not yet valid"
+	case cert.ValidBefore != ssh.CertTimeInfinity && unix >= cert.ValidBefore:
+		return "expired"
+	}
+	return "valid"
+}
+
+// SortedKeys returns the names of a certificate option or extension map in order
+func SortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,207 @@
+package sshkeys
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseValidity(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input      string
+		wantAfter  time.Time
+		wantBefore time.Time
+		wantErr    bool
+	}{
+		{"", time.Time{}, time.Time{}, false},
+		{"8h", now, now.Add(8 * time.Hour), false},
+		{"+52w", now, now.Add(52 * 7 * 24 * time.Hour), false},
+		{"-5m:+1h", now.Add(-5 * time.Minute), now.Add(time.Hour), false},
+		{"always:+1d", time.Time{}, now.Add(24 * time.Hour), false},
+		{"now:forever", now, time.Time{}, false},
+		{"20260101Z:20260201Z", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), false},
+		{"202601011230Z:20260101123045Z", time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC), time.Date(2026, 1, 1, 12, 30, 45, 0, time.UTC), false},
+		{"+1h:-1h", time.Time{}, time.Time{}, true},
+		{"forever:always", time.Time{}, time.Time{}, true},
+		{"2026:+1h", time.Time{}, time.Time{}, true},
+		{"soon", time.Time{}, time.Time{}, true},
+		{":+1h", time.Time{}, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			after, before, err := ParseValidity(tt.input, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseValidity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !after.Equal(tt.wantAfter) || !before.Equal(tt.wantBefore) {
+				t.Errorf("ParseValidity() = %v, %v, want %v, %v", after, before, tt.wantAfter, tt.wantBefore)
+			}
+		})
+	}
+}
+
+func TestSignOptionsSetOption(t *testing.T) {
+	tests := []struct {
+		name           string
+		host           bool
+		options        []string
+		wantCritical   map[string]string
+		wantExtensions []string
+		wantErr        bool
+	}{
+		{
+			name:           "restrict a user certificate",
+			options:        []string{"no-pty", "no-X11-forwarding", "force-command=/usr/bin/backup", "source-address=10.0.0.0/8"},
+			wantCritical:   map[string]string{"force-command": "/usr/bin/backup", "source-address": "10.0.0.0/8"},
+			wantExtensions: []string{"permit-agent-forwarding", "permit-port-forwarding", "permit-user-rc"},
+		},
+		{
+			name:           "clear then permit",
+			options:        []string{"clear", "permit-pty", "verify-required"},
+			wantCritical:   map[string]string{"verify-required": ""},
+			wantExtensions: []string{"permit-pty"},
+		},
+		{name: "unknown option", options: []string{"no-such-thing"}, wantErr: true},
+		{name: "missing value", options: []string{"force-command="}, wantErr: true},
+		{name: "host certificate", host: true, options: []string{"no-pty"}, wantErr: true},
+		{name: "host certificate clear", host: true, options: []string{"clear"}, wantCritical: map[string]string{}, wantExtensions: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := SignOptions{Host: tt.host}
+			var err error
+			for _, option := range tt.options {
+				if err = opts.SetOption(option); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetOption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(opts.CriticalOptions, tt.wantCritical) {
+				t.Errorf("CriticalOptions = %v, want %v", opts.CriticalOptions, tt.wantCritical)
+			}
+			if got := SortedKeys(opts.Extensions); !reflect.DeepEqual(got, tt.wantExtensions) {
+				t.Errorf("Extensions = %v, want %v", got, tt.wantExtensions)
+			}
+		})
+	}
+}
+
+func TestSignCertificate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caPair, err := Generate(GenerateOptions{Type: KeyTypeEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := ssh.ParseRawPrivateKey(caPair.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := Generate(GenerateOptions{Type: KeyTypeEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	cert, err := SignCertificate(ca, user.Public, SignOptions{
+		KeyID:       "alice",
+		Principals:  []string{"alice", "deploy"},
+		Serial:      7,
+		ValidAfter:  now.Add(-time.Minute),
+		ValidBefore: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("SignCertificate() error = %v", err)
+	}
+	if len(cert.Extensions) != len(defaultUserExtensions) {
+		t.Errorf("Extensions = %v, want the ssh-keygen defaults", cert.Extensions)
+	}
+
+	checker := ssh.CertChecker{IsUserAuthority: func(auth ssh.PublicKey) bool {
+		return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal())
+	}}
+	if _, err := checker.Authenticate(connMetadata("deploy"), cert); err != nil {
+		t.Errorf("Authenticate() error = %v", err)
+	}
+	if _, err := checker.Authenticate(connMetadata("root"), cert); err == nil {
+		t.Error("Authenticate() expected error for a principal not in the certificate")
+	}
+
+	path := CertificatePath(filepath.Join(dir, "id_ed25519.pub"))
+	if path != filepath.Join(dir, "id_ed25519-cert.pub") {
+		t.Errorf("CertificatePath() = %s", path)
+	}
+	if err := WriteCertificate(path, cert, "alice@laptop"); err != nil {
+		t.Fatal(err)
+	}
+	read, comment, err := ReadCertificate(path)
+	if err != nil {
+		t.Fatalf("ReadCertificate() error = %v", err)
+	}
+	if read.KeyId != "alice" || read.Serial != 7 || comment != "alice@laptop" {
+		t.Errorf("ReadCertificate() = %q serial %d comment %q", read.KeyId, read.Serial, comment)
+	}
+	if status := CertificateStatus(read, now); status != "valid" {
+		t.Errorf("CertificateStatus() = %s, want valid", status)
+	}
+	if status := CertificateStatus(read, now.Add(2*time.Hour)); status != "expired" {
+		t.Errorf("CertificateStatus() = %s, want expired", status)
+	}
+	if status := CertificateStatus(read, now.Add(-time.Hour)); status != "not yet valid" {
+		t.Errorf("CertificateStatus() = %s, want not yet valid", status)
+	}
+
+	if _, err := SignCertificate(ca, cert, SignOptions{}); err == nil {
+		t.Error("SignCertificate() expected error signing a certificate")
+	}
+	if _, err := SignCertificate(ca, user.Public, SignOptions{Host: true}); err == nil {
+		t.Error("SignCertificate() expected error for a host certificate without principals")
+	}
+
+	hostCert, err := SignCertificate(ca, user.Public, SignOptions{Host: true, Principals: []string{"web.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostCert.CertType != ssh.HostCert || len(hostCert.Extensions) != 0 || CertificateValidity(hostCert) != "forever" {
+		t.Errorf("host certificate = type %d extensions %v validity %s", hostCert.CertType, hostCert.Extensions, CertificateValidity(hostCert))
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "plain.pub"), ssh.MarshalAuthorizedKey(user.Public), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadCertificate(filepath.Join(dir, "plain.pub")); err == nil {
+		t.Error("ReadCertificate() expected error for a plain public key")
+	}
+}
+
+// connMetadata is the minimal ssh.ConnMetadata a CertChecker needs
+type connMetadata string
+
+func (c connMetadata) User() string          { return string(c) }
+func (c connMetadata) SessionID() []byte     { return nil }
+func (c connMetadata) ClientVersion() []byte { return nil }
+func (c connMetadata) ServerVersion() []byte { return nil }
+func (c connMetadata) RemoteAddr() net.Addr  { return nil }
+func (c connMetadata) LocalAddr() net.Addr   { return nil }
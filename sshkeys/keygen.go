@@ -0,0 +1,172 @@
+// Package sshkeys generates SSH key pairs and reads the keys stored under
+// ~/.ssh. Private keys are written in the OpenSSH format ssh-keygen uses, with
+// optional bcrypt-pbkdf passphrase encryption.
+package sshkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// Key types understood by Generate
+const (
+	KeyTypeEd25519 = "ed25519"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeRSA     = "rsa"
+)
+
+// DefaultRSABits is the RSA key size used when none is given, as in ssh-keygen
+const DefaultRSABits = 3072
+
+// DefaultIdentityNames are the files in ~/.ssh that ssh tries, in its order,
+// when a host sets no IdentityFile
+var DefaultIdentityNames = []string{"id_rsa", "id_ecdsa", "id_ecdsa_sk", "id_ed25519", "id_ed25519_sk"}
+
+// GenerateOptions represents the options for generating a key pair
+type GenerateOptions struct {
+	Type string
+	// Bits is the key size; 0 selects the default for the type
+	Bits    int
+	Comment string
+	// Passphrase encrypts the private key when not empty
+	Passphrase []byte
+}
+
+// KeyPair is a generated key in its on-disk forms
+type KeyPair struct {
+	// Private is the PEM encoded OpenSSH private key
+	Private []byte
+	Public  ssh.PublicKey
+	Comment string
+}
+
+// Generate creates a new key pair
+func Generate(opts GenerateOptions) (*KeyPair, error) {
+	key, err := generateKey(opts.Type, opts.Bits)
+	if err != nil {
+		return nil, err
+	}
+
+	var block *pem.Block
+	if len(opts.Passphrase) > 0 {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, opts.Comment, opts.Passphrase)
+	} else {
+		block, err = ssh.MarshalPrivateKey(key, opts.Comment)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	signer, err := ssh.NewSignerFromSigner(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive public key: %w", err)
+	}
+	return &KeyPair{Private: pem.EncodeToMemory(block), Public: signer.PublicKey(), Comment: opts.Comment}, nil
+}
+
+func generateKey(keyType string, bits int) (crypto.Signer, error) {
+	switch strings.ToLower(keyType) {
+	case KeyTypeEd25519, "":
+		if bits != 0 && bits != 256 {
+			return nil, fmt.Errorf("ed25519 keys are always 256 bits")
+		}
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case KeyTypeECDSA:
+		curves := map[int]elliptic.Curve{0: elliptic.P256(), 256: elliptic.P256(), 384: elliptic.P384(), 521: elliptic.P521()}
+		curve, ok := curves[bits]
+		if !ok {
+			return nil, fmt.Errorf("invalid ecdsa key size %d: must be 256, 384 or 521", bits)
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case KeyTypeRSA:
+		if bits == 0 {
+			bits = DefaultRSABits
+		}
+		if bits < 2048 || bits > 16384 {
+			return nil, fmt.Errorf("invalid rsa key size %d: must be between 2048 and 16384", bits)
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q: use ed25519, ecdsa or rsa", keyType)
+	}
+}
+
+// AuthorizedKey returns the public key as an authorized_keys line with the comment
+func (k *KeyPair) AuthorizedKey() []byte {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.Public)))
+	if k.Comment != "" {
+		line += " " + k.Comment
+	}
+	return []byte(line + "\n")
+}
+
+// Write saves the private key to path with 0600 permissions and the public
+// key to path.pub with 0644 permissions. Existing keys are only replaced
+// when overwrite is set.
+func (k *KeyPair) Write(path string, overwrite bool) error {
+	path = utils.ExpandUser(path)
+	if !overwrite {
+		for _, p := range []string{path, path + ".pub"} {
+			if _, err := os.Stat(p); err == nil {
+				return fmt.Errorf("%s already exists", p)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := utils.WriteFileAtomic(path, k.Private, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := utils.WriteFileAtomic(path+".pub", k.AuthorizedKey(), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+	return nil
+}
+
+// DefaultKeyPath returns the conventional path for a key of keyType, such as ~/.ssh/id_ed25519
+func DefaultKeyPath(keyType string) string {
+	if keyType == "" {
+		keyType = KeyTypeEd25519
+	}
+	return "~/.ssh/id_" + strings.ToLower(keyType)
+}
+
+// DefaultIdentity returns the private key a new host should use: the first
+// of the standard identity files that exists, or ~/.ssh/id_ed25519
+func DefaultIdentity() string {
+	for _, name := range DefaultIdentityNames {
+		path := "~/.ssh/" + name
+		if _, err := os.Stat(utils.ExpandUser(path)); err == nil {
+			return path
+		}
+	}
+	return DefaultKeyPath(KeyTypeEd25519)
+}
+
+// DefaultComment returns the user@host comment ssh-keygen uses
+func DefaultComment() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = filepath.Base(utils.ExpandUser("~"))
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return user
+	}
+	return user + "@" + host
+}
@@ -0,0 +1,126 @@
+package sshkeys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		keyType  string
+		bits     int
+		wantType string
+		wantErr  bool
+	}{
+		{KeyTypeEd25519, 0, ssh.KeyAlgoED25519, false},
+		{KeyTypeECDSA, 0, ssh.KeyAlgoECDSA256, false},
+		{KeyTypeECDSA, 384, ssh.KeyAlgoECDSA384, false},
+		{KeyTypeRSA, 2048, ssh.KeyAlgoRSA, false},
+		{KeyTypeECDSA, 512, "", true},
+		{KeyTypeRSA, 1024, "", true},
+		{"dsa", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		pair, err := Generate(GenerateOptions{Type: tt.keyType, Bits: tt.bits, Comment: "alice@laptop"})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Generate(%s, %d) error = %v, wantErr %v", tt.keyType, tt.bits, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if pair.Public.Type() != tt.wantType {
+			t.Errorf("Generate(%s, %d) type = %s; want %s", tt.keyType, tt.bits, pair.Public.Type(), tt.wantType)
+		}
+
+		signer, err := ssh.ParsePrivateKey(pair.Private)
+		if err != nil {
+			t.Fatalf("ParsePrivateKey() error = %v", err)
+		}
+		if string(signer.PublicKey().Marshal()) != string(pair.Public.Marshal()) {
+			t.Errorf("private key does not match public key for %s", tt.keyType)
+		}
+		if !strings.HasSuffix(strings.TrimSpace(string(pair.AuthorizedKey())), " alice@laptop") {
+			t.Errorf("AuthorizedKey() = %q; want comment", pair.AuthorizedKey())
+		}
+	}
+}
+
+func TestGenerateWithPassphrase(t *testing.T) {
+	pair, err := Generate(GenerateOptions{Type: KeyTypeEd25519, Passphrase: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ssh.ParsePrivateKey(pair.Private); err == nil {
+		t.Error("ParsePrivateKey() succeeded without passphrase")
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(pair.Private, []byte("wrong")); err == nil {
+		t.Error("ParsePrivateKeyWithPassphrase() succeeded with wrong passphrase")
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(pair.Private, []byte("secret")); err != nil {
+		t.Errorf("ParsePrivateKeyWithPassphrase() error = %v", err)
+	}
+}
+
+func TestKeyPairWrite(t *testing.T) {
+	// Create a temporary directory
+	tmpDir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Set the HOME environment variable to the temporary directory
+	os.Setenv("HOME", tmpDir)
+
+	if got := DefaultIdentity(); got != "~/.ssh/id_ed25519" {
+		t.Errorf("DefaultIdentity() without keys = %q; want ~/.ssh/id_ed25519", got)
+	}
+
+	pair, err := Generate(GenerateOptions{Type: KeyTypeECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pair.Write(DefaultKeyPath(KeyTypeECDSA), false); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	path := filepath.Join(tmpDir, ".ssh", "id_ecdsa")
+	for file, perm := range map[string]os.FileMode{path: 0600, path + ".pub": 0644} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != perm {
+			t.Errorf("%s permissions = %v; want %v", file, info.Mode().Perm(), perm)
+		}
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf(".ssh directory not created with 0700: %v", err)
+	}
+
+	if err := pair.Write(DefaultKeyPath(KeyTypeECDSA), false); err == nil {
+		t.Error("Write() expected error for existing key")
+	}
+	if err := pair.Write(DefaultKeyPath(KeyTypeECDSA), true); err != nil {
+		t.Errorf("Write() with overwrite error = %v", err)
+	}
+
+	if got := DefaultIdentity(); got != "~/.ssh/id_ecdsa" {
+		t.Errorf("DefaultIdentity() = %q; want ~/.ssh/id_ecdsa", got)
+	}
+
+	// ssh tries id_ecdsa before id_ed25519
+	if err := pair.Write(DefaultKeyPath(KeyTypeEd25519), false); err != nil {
+		t.Fatal(err)
+	}
+	if got := DefaultIdentity(); got != "~/.ssh/id_ecdsa" {
+		t.Errorf("DefaultIdentity() with id_ed25519 = %q; want ~/.ssh/id_ecdsa", got)
+	}
+}
@@ -0,0 +1,218 @@
+package sshkeys
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// notKeyFiles are the files in ~/.ssh that are never keys
+var notKeyFiles = map[string]bool{
+	"config":           true,
+	"known_hosts":      true,
+	"known_hosts.old":  true,
+	"authorized_keys":  true,
+	"authorized_keys2": true,
+	"environment":      true,
+	"rc":               true,
+}
+
+// LocalKey is a key pair, or half of one, found on disk
+type LocalKey struct {
+	// PrivatePath is empty when only the public key was found
+	PrivatePath string
+	// PublicPath is empty when only the private key was found
+	PublicPath string
+	// Public is nil when it could not be determined, such as for an
+	// encrypted PEM key without a .pub file
+	Public  ssh.PublicKey
+	Comment string
+	// Encrypted reports whether the private key is protected by a passphrase
+	Encrypted   bool
+	PrivateMode os.FileMode
+	PublicMode  os.FileMode
+	// Mismatch reports that the .pub file holds a different key than the private key
+	Mismatch bool
+}
+
+// Path returns the private key path, or the public key path for a lone public key
+func (k *LocalKey) Path() string {
+	if k.PrivatePath != "" {
+		return k.PrivatePath
+	}
+	return k.PublicPath
+}
+
+// Type returns the key type, such as ssh-ed25519, or "unknown"
+func (k *LocalKey) Type() string {
+	if k.Public == nil {
+		return "unknown"
+	}
+	return k.Public.Type()
+}
+
+// Bits returns the size of the key, or 0 when it is unknown
+func (k *LocalKey) Bits() int {
+	if k.Public == nil {
+		return 0
+	}
+	return KeyBits(k.Public)
+}
+
+// KeyBits returns the size of a public key in bits, or 0 for types it does not know
+func KeyBits(pub ssh.PublicKey) int {
+	if cert, ok := pub.(*ssh.Certificate); ok {
+		pub = cert.Key
+	}
+	if pub.Type() == ssh.KeyAlgoED25519 || pub.Type() == ssh.KeyAlgoSKED25519 {
+		return 256
+	}
+	cryptoKey, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch key := cryptoKey.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	}
+	return 0
+}
+
+// Problems returns the health warnings for the key
+func (k *LocalKey) Problems() []string {
+	var problems []string
+	if k.PrivatePath != "" && k.PrivateMode&0077 != 0 {
+		problems = append(problems, fmt.Sprintf("private key permissions %04o are too open; ssh will refuse to use it (chmod 600)", k.PrivateMode))
+	}
+	if k.PublicPath != "" && k.PublicMode&0022 != 0 {
+		problems = append(problems, fmt.Sprintf("public key permissions %04o allow others to modify it", k.PublicMode))
+	}
+	if k.Mismatch {
+		problems = append(problems, "public key file does not match the private key")
+	}
+	if k.PrivatePath == "" {
+		problems = append(problems, "no private key found for this public key")
+	}
+	if k.Type() == ssh.KeyAlgoRSA && k.Bits() < 2048 {
+		problems = append(problems, fmt.Sprintf("RSA key of %d bits is too weak", k.Bits()))
+	}
+	if k.Type() == ssh.KeyAlgoDSA {
+		problems = append(problems, "DSA keys are no longer accepted by OpenSSH")
+	}
+	return problems
+}
+
+// Scan finds the private and public keys in dir, without descending into
+// subdirectories, and pairs each private key with its .pub file
+func Scan(dir string) ([]*LocalKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	keys := make(map[string]*LocalKey)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || notKeyFiles[name] || strings.HasSuffix(name, "-cert.pub") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		if strings.HasSuffix(name, ".pub") {
+			pub, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				continue
+			}
+			key := keyFor(keys, strings.TrimSuffix(path, ".pub"))
+			key.PublicPath = path
+			key.PublicMode = info.Mode().Perm()
+			key.Comment = comment
+			if key.Public != nil {
+				key.Mismatch = !bytes.Equal(key.Public.Marshal(), pub.Marshal())
+			} else {
+				key.Public = pub
+			}
+			continue
+		}
+
+		if !IsPrivateKey(data) {
+			continue
+		}
+		key := keyFor(keys, path)
+		key.PrivatePath = path
+		key.PrivateMode = info.Mode().Perm()
+		pub, encrypted, err := privateKeyInfo(data)
+		if err != nil {
+			continue
+		}
+		key.Encrypted = encrypted
+		if pub != nil {
+			if key.Public != nil && key.PublicPath != "" {
+				key.Mismatch = !bytes.Equal(key.Public.Marshal(), pub.Marshal())
+			}
+			key.Public = pub
+		}
+	}
+
+	found := make([]*LocalKey, 0, len(keys))
+	for _, key := range keys {
+		found = append(found, key)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Path() < found[j].Path() })
+	return found, nil
+}
+
+func keyFor(keys map[string]*LocalKey, base string) *LocalKey {
+	if key, ok := keys[base]; ok {
+		return key
+	}
+	key := &LocalKey{}
+	keys[base] = key
+	return key
+}
+
+// IsPrivateKey reports whether data looks like a PEM encoded private key
+func IsPrivateKey(data []byte) bool {
+	text := strings.TrimSpace(string(data))
+	return strings.HasPrefix(text, "-----BEGIN ") && strings.Contains(text[:min(len(text), 64)], "PRIVATE KEY-----")
+}
+
+// IsEncrypted reports whether the private key in data is protected by a passphrase
+func IsEncrypted(data []byte) (bool, error) {
+	_, encrypted, err := privateKeyInfo(data)
+	return encrypted, err
+}
+
+// privateKeyInfo returns the public half of a private key and whether it is
+// encrypted. The public key of an encrypted key is only available for the
+// OpenSSH format, which stores it unencrypted.
+func privateKeyInfo(data []byte) (ssh.PublicKey, bool, error) {
+	signer, err := ssh.ParsePrivateKey(data)
+	if err == nil {
+		return signer.PublicKey(), false, nil
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return missing.PublicKey, true, nil
+	}
+	return nil, false, err
+}
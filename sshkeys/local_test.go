@@ -0,0 +1,87 @@
+package sshkeys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestScan(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plain, err := Generate(GenerateOptions{Type: KeyTypeEd25519, Comment: "plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := Generate(GenerateOptions{Type: KeyTypeECDSA, Comment: "encrypted", Passphrase: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Generate(GenerateOptions{Type: KeyTypeEd25519, Comment: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]struct {
+		data []byte
+		perm os.FileMode
+	}{
+		"id_ed25519":          {plain.Private, 0600},
+		"id_ed25519.pub":      {plain.AuthorizedKey(), 0644},
+		"id_ecdsa":            {encrypted.Private, 0644},
+		"mismatched":          {plain.Private, 0600},
+		"mismatched.pub":      {other.AuthorizedKey(), 0644},
+		"lonely.pub":          {other.AuthorizedKey(), 0644},
+		"config":              {[]byte("Host web\n"), 0644},
+		"known_hosts":         {[]byte("web " + string(other.AuthorizedKey())), 0644},
+		"notes.txt":           {[]byte("not a key"), 0644},
+		"id_ed25519-cert.pub": {other.AuthorizedKey(), 0644},
+	}
+	for name, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), f.data, f.perm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filepath.Join(dir, name), f.perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := Scan(dir)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	byName := make(map[string]*LocalKey)
+	for _, key := range keys {
+		byName[filepath.Base(key.Path())] = key
+	}
+	if len(byName) != 4 {
+		t.Fatalf("Scan() found %v; want 4 keys", byName)
+	}
+
+	key := byName["id_ed25519"]
+	if key.PublicPath == "" || key.Comment != "plain" || key.Encrypted || key.Bits() != 256 || len(key.Problems()) != 0 {
+		t.Errorf("id_ed25519 = %+v, problems %q", key, key.Problems())
+	}
+
+	key = byName["id_ecdsa"]
+	if !key.Encrypted || key.Public == nil || key.Type() != ssh.KeyAlgoECDSA256 || key.PublicPath != "" {
+		t.Errorf("id_ecdsa = %+v; want encrypted ECDSA key without .pub", key)
+	}
+	if len(key.Problems()) != 1 {
+		t.Errorf("id_ecdsa problems = %q; want permissions too open", key.Problems())
+	}
+
+	if key = byName["mismatched"]; !key.Mismatch {
+		t.Errorf("mismatched = %+v; want Mismatch", key)
+	}
+	if key = byName["lonely.pub"]; key.PrivatePath != "" || len(key.Problems()) != 1 {
+		t.Errorf("lonely.pub = %+v, problems %q; want lone public key", key, key.Problems())
+	}
+}
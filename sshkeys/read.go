@@ -0,0 +1,109 @@
+package sshkeys
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/evberrypi/ssh-config/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// PassphraseFunc asks for the passphrase of an encrypted private key
+type PassphraseFunc func(path string) ([]byte, error)
+
+// ReadPrivateKey reads and decrypts the private key at path. passphrase is
+// only called when the key is encrypted; it may be nil to reject encrypted keys.
+func ReadPrivateKey(path string, passphrase PassphraseFunc) (any, error) {
+	path = utils.ExpandUser(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+		}
+		return key, nil
+	}
+
+	if passphrase == nil {
+		return nil, fmt.Errorf("private key %s is encrypted", path)
+	}
+	secret, err := passphrase(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadPublicKey returns the public key and comment for a key file. path may
+// name either half of a pair: the .pub file is preferred, and otherwise the
+// public key is taken from the private key, which works for encrypted keys
+// in the OpenSSH format without asking for the passphrase.
+func LoadPublicKey(path string) (ssh.PublicKey, string, error) {
+	path = strings.TrimSuffix(utils.ExpandUser(path), ".pub")
+	if data, err := os.ReadFile(path + ".pub"); err == nil {
+		pub, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse public key %s.pub: %w", path, err)
+		}
+		return pub, comment, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read key: %w", err)
+	}
+	pub, _, err := privateKeyInfo(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse private key %s: %w", path, err)
+	}
+	if pub == nil {
+		return nil, "", fmt.Errorf("the public key of %s is encrypted and there is no %s.pub", path, path)
+	}
+	return pub, "", nil
+}
+
+// ReadPublicKeys returns every public key in a file of authorized_keys
+// style lines, such as a .pub file or a list of keys. A private key file
+// yields its public key as LoadPublicKey would.
+func ReadPublicKeys(path string) ([]ssh.PublicKey, error) {
+	path = utils.ExpandUser(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys: %w", err)
+	}
+	if IsPrivateKey(data) {
+		pub, _, err := LoadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.PublicKey{pub}, nil
+	}
+
+	var keys []ssh.PublicKey
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key in %s: %w", path, err)
+		}
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", path)
+	}
+	return keys, nil
+}
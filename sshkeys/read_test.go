@@ -0,0 +1,122 @@
+package sshkeys
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestReadPrivateKey(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pair, err := Generate(GenerateOptions{Type: KeyTypeEd25519, Comment: "alice@laptop", Passphrase: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "id_ed25519")
+	if err := pair.Write(path, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadPrivateKey(path, nil); err == nil {
+		t.Error("ReadPrivateKey() without passphrase func expected error")
+	}
+	if _, err := ReadPrivateKey(path, func(string) ([]byte, error) { return []byte("wrong"), nil }); err == nil {
+		t.Error("ReadPrivateKey() with wrong passphrase expected error")
+	}
+	if _, err := ReadPrivateKey(path, func(string) ([]byte, error) { return nil, fmt.Errorf("cancelled") }); err == nil {
+		t.Error("ReadPrivateKey() expected error when prompt fails")
+	}
+
+	key, err := ReadPrivateKey(path, func(string) ([]byte, error) { return []byte("secret"), nil })
+	if err != nil {
+		t.Fatalf("ReadPrivateKey() error = %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), pair.Public.Marshal()) {
+		t.Error("ReadPrivateKey() returned a different key")
+	}
+
+	// The public key comes from the .pub file, or from the private key without it
+	for _, p := range []string{path, path + ".pub"} {
+		pub, comment, err := LoadPublicKey(p)
+		if err != nil || !bytes.Equal(pub.Marshal(), pair.Public.Marshal()) || comment != "alice@laptop" {
+			t.Errorf("LoadPublicKey(%s) = %v, %q, %v", p, pub, comment, err)
+		}
+	}
+	if err := os.Remove(path + ".pub"); err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := LoadPublicKey(path)
+	if err != nil || !bytes.Equal(pub.Marshal(), pair.Public.Marshal()) {
+		t.Errorf("LoadPublicKey() without .pub = %v, %v", pub, err)
+	}
+}
+
+func TestReadPublicKeys(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first, err := Generate(GenerateOptions{Type: KeyTypeEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Generate(GenerateOptions{Type: KeyTypeEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := first.Write(keyPath, false); err != nil {
+		t.Fatal(err)
+	}
+	listPath := filepath.Join(dir, "keys")
+	list := "# team keys\n" + string(ssh.MarshalAuthorizedKey(first.Public)) + "\n" + string(ssh.MarshalAuthorizedKey(second.Public))
+	if err := os.WriteFile(listPath, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyPath := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyPath, []byte("# nothing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    int
+		wantErr bool
+	}{
+		{"Private key", keyPath, 1, false},
+		{"Public key", keyPath + ".pub", 1, false},
+		{"Key list", listPath, 2, false},
+		{"No keys", emptyPath, 0, true},
+		{"Missing file", filepath.Join(dir, "missing"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ReadPublicKeys(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadPublicKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(keys) != tt.want {
+				t.Errorf("ReadPublicKeys() = %d keys; want %d", len(keys), tt.want)
+			}
+			if len(keys) > 0 && !bytes.Equal(keys[0].Marshal(), first.Public.Marshal()) {
+				t.Error("ReadPublicKeys() returned the wrong key first")
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Package sshsig creates and verifies signatures in the OpenSSH SSHSIG
+// format described in PROTOCOL.sshsig, as made by ssh-keygen -Y sign and
+// used by git to sign commits with SSH keys.
+//
+// A signature covers a hash of the message together with a namespace such
+// as "git" or "file", so a signature made for one purpose cannot be replayed
+// for another.
+package sshsig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	magicPreamble = "SSHSIG"
+	sigVersion    = 1
+	// pemType is the armor label ssh-keygen uses for signatures
+	pemType = "SSH SIGNATURE"
+)
+
+// Hash algorithms allowed in signatures
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+// Signature is a parsed SSHSIG signature
+type Signature struct {
+	PublicKey     ssh.PublicKey
+	Namespace     string
+	HashAlgorithm string
+	Signature     *ssh.Signature
+}
+
+// wireSignature is the binary layout of a signature after the preamble
+type wireSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// signedData is the blob that is actually signed
+type signedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", algorithm)
+}
+
+// messageToSign hashes message and returns the blob covered by the signature
+func messageToSign(message io.Reader, namespace, algorithm string) ([]byte, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	data := ssh.Marshal(signedData{Namespace: namespace, HashAlgorithm: algorithm, Hash: h.Sum(nil)})
+	return append([]byte(magicPreamble), data...), nil
+}
+
+// Sign signs message for namespace with SHA-512, as ssh-keygen does. RSA keys
+// sign with rsa-sha2-512 because SHA-1 signatures are not accepted.
+func Sign(signer ssh.Signer, message io.Reader, namespace string) (*Signature, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("a namespace is required")
+	}
+	data, err := messageToSign(message, namespace, HashSHA512)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *ssh.Signature
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && underlyingType(signer.PublicKey()) == ssh.KeyAlgoRSA {
+		sig, err = algorithmSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return &Signature{
+		PublicKey:     signer.PublicKey(),
+		Namespace:     namespace,
+		HashAlgorithm: HashSHA512,
+		Signature:     sig,
+	}, nil
+}
+
+// Verify checks that s is a valid signature of message for namespace by
+// s.PublicKey. It does not decide whether the key is trusted; see
+// allowedsigners for that.
+func (s *Signature) Verify(message io.Reader, namespace string) error {
+	if s.Namespace != namespace {
+		return fmt.Errorf("signature is for namespace %q, not %q", s.Namespace, namespace)
+	}
+	if underlyingType(s.PublicKey) == ssh.KeyAlgoRSA && s.Signature.Format == ssh.KeyAlgoRSA {
+		return fmt.Errorf("RSA signatures using SHA-1 are not accepted")
+	}
+	data, err := messageToSign(message, s.Namespace, s.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	if err := s.PublicKey.Verify(data, s.Signature); err != nil {
+		return fmt.Errorf("bad signature: %w", err)
+	}
+	return nil
+}
+
+// underlyingType returns the type of key, or of the key a certificate certifies
+func underlyingType(key ssh.PublicKey) string {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return cert.Key.Type()
+	}
+	return key.Type()
+}
+
+// Marshal encodes the signature in the binary format
+func (s *Signature) Marshal() []byte {
+	data := ssh.Marshal(wireSignature{
+		Version:       sigVersion,
+		PublicKey:     s.PublicKey.Marshal(),
+		Namespace:     s.Namespace,
+		HashAlgorithm: s.HashAlgorithm,
+		Signature:     ssh.Marshal(s.Signature),
+	})
+	return append([]byte(magicPreamble), data...)
+}
+
+// Armor encodes the signature in the armored text format written by
+// ssh-keygen, wrapped at 70 columns
+func (s *Signature) Armor() []byte {
+	encoded := base64.StdEncoding.EncodeToString(s.Marshal())
+	var buf bytes.Buffer
+	buf.WriteString("-----BEGIN " + pemType + "-----\n")
+	for len(encoded) > 70 {
+		buf.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	buf.WriteString(encoded + "\n")
+	buf.WriteString("-----END " + pemType + "-----\n")
+	return buf.Bytes()
+}
+
+// Parse decodes an armored or binary signature
+func Parse(data []byte) (*Signature, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != pemType {
+			return nil, fmt.Errorf("unexpected %s block, want %s", block.Type, pemType)
+		}
+		data = block.Bytes
+	} else if strings.Contains(string(data), "-----BEGIN") {
+		return nil, fmt.Errorf("malformed armored signature")
+	}
+
+	rest, found := bytes.CutPrefix(data, []byte(magicPreamble))
+	if !found {
+		return nil, fmt.Errorf("not an SSH signature")
+	}
+	var wire wireSignature
+	if err := ssh.Unmarshal(rest, &wire); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if wire.Version != sigVersion {
+		return nil, fmt.Errorf("unsupported signature version %d", wire.Version)
+	}
+	if _, err := newHash(wire.HashAlgorithm); err != nil {
+		return nil, err
+	}
+	pub, err := ssh.ParsePublicKey(wire.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature key: %w", err)
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(wire.Signature, sig); err != nil {
+		return nil, fmt.Errorf("invalid signature blob: %w", err)
+	}
+	return &Signature{
+		PublicKey:     pub,
+		Namespace:     wire.Namespace,
+		HashAlgorithm: wire.HashAlgorithm,
+		Signature:     sig,
+	}, nil
+}
@@ -0,0 +1,177 @@
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T, keyType string) (ssh.Signer, crypto.PrivateKey) {
+	t.Helper()
+	var key crypto.PrivateKey
+	var err error
+	switch keyType {
+	case "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "ecdsa":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, key
+}
+
+func TestSignVerify(t *testing.T) {
+	message := []byte("release artefact\n")
+	for _, keyType := range []string{"ed25519", "ecdsa", "rsa"} {
+		t.Run(keyType, func(t *testing.T) {
+			signer, _ := newSigner(t, keyType)
+			sig, err := Sign(signer, bytes.NewReader(message), "file")
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if keyType == "rsa" && sig.Signature.Format != ssh.KeyAlgoRSASHA512 {
+				t.Errorf("RSA signature format = %s; want %s", sig.Signature.Format, ssh.KeyAlgoRSASHA512)
+			}
+
+			armored := sig.Armor()
+			if !strings.HasPrefix(string(armored), "-----BEGIN SSH SIGNATURE-----\n") {
+				t.Errorf("Armor() = %q", armored)
+			}
+			for _, line := range strings.Split(strings.TrimSpace(string(armored)), "\n") {
+				if len(line) > 70 {
+					t.Errorf("armored line is %d characters; want at most 70", len(line))
+				}
+			}
+
+			for _, data := range [][]byte{armored, sig.Marshal()} {
+				parsed, err := Parse(data)
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				if err := parsed.Verify(bytes.NewReader(message), "file"); err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+				if err := parsed.Verify(bytes.NewReader(message), "git"); err == nil {
+					t.Error("Verify() accepted another namespace")
+				}
+				if err := parsed.Verify(strings.NewReader("tampered\n"), "file"); err == nil {
+					t.Error("Verify() accepted a tampered message")
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	signer, _ := newSigner(t, "ed25519")
+	sig, err := Sign(signer, strings.NewReader("data"), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := sig.Marshal()
+
+	invalid := map[string][]byte{
+		"Not a signature": []byte("hello"),
+		"Truncated":       raw[:len(raw)-5],
+		"Wrong armor":     pem.EncodeToMemory(&pem.Block{Type: "PGP SIGNATURE", Bytes: raw}),
+		"Broken armor":    []byte("-----BEGIN SSH SIGNATURE-----\n!!!\n-----END SSH SIGNATURE-----\n"),
+	}
+	for name, data := range invalid {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("%s: Parse() expected error", name)
+		}
+	}
+	if _, err := Sign(signer, strings.NewReader("data"), ""); err == nil {
+		t.Error("Sign() expected error without a namespace")
+	}
+}
+
+// TestOpenSSHCompatibility exchanges signatures with ssh-keygen -Y when it is installed
+func TestOpenSSHCompatibility(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	dir, err := os.MkdirTemp("", "sshsig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, keyType := range []string{"ed25519", "ecdsa", "rsa"} {
+		t.Run(keyType, func(t *testing.T) {
+			signer, key := newSigner(t, keyType)
+			block, err := ssh.MarshalPrivateKey(key, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			keyPath := filepath.Join(dir, "id_"+keyType)
+			if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+				t.Fatal(err)
+			}
+			signersPath := filepath.Join(dir, "allowed_signers_"+keyType)
+			line := "alice@example.com " + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+			if err := os.WriteFile(signersPath, []byte(line), 0644); err != nil {
+				t.Fatal(err)
+			}
+			messagePath := filepath.Join(dir, "message_"+keyType)
+			message := []byte("bundle contents\n")
+			if err := os.WriteFile(messagePath, message, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// ssh-keygen verifies our signature
+			sig, err := Sign(signer, bytes.NewReader(message), "file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ourSig := filepath.Join(dir, "ours_"+keyType+".sig")
+			if err := os.WriteFile(ourSig, sig.Armor(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			verify := exec.Command("ssh-keygen", "-Y", "verify", "-f", signersPath, "-I", "alice@example.com", "-n", "file", "-s", ourSig)
+			verify.Stdin = bytes.NewReader(message)
+			if out, err := verify.CombinedOutput(); err != nil {
+				t.Errorf("ssh-keygen -Y verify rejected our signature: %v %s", err, out)
+			}
+
+			// We verify ssh-keygen's signature
+			if out, err := exec.Command("ssh-keygen", "-Y", "sign", "-f", keyPath, "-n", "file", messagePath).CombinedOutput(); err != nil {
+				t.Fatalf("ssh-keygen -Y sign: %v %s", err, out)
+			}
+			data, err := os.ReadFile(messagePath + ".sig")
+			if err != nil {
+				t.Fatal(err)
+			}
+			theirs, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse() of ssh-keygen signature error = %v", err)
+			}
+			if err := theirs.Verify(bytes.NewReader(message), "file"); err != nil {
+				t.Errorf("Verify() of ssh-keygen signature error = %v", err)
+			}
+			if !bytes.Equal(theirs.PublicKey.Marshal(), signer.PublicKey().Marshal()) {
+				t.Error("ssh-keygen signature carries a different key")
+			}
+		})
+	}
+}
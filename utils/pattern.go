@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"strings"
+)
+
+// MatchPattern reports whether s matches an OpenSSH pattern, where * matches
+// any sequence of characters and ? matches exactly one. Matching is case
+// insensitive like host name matching in ssh.
+func MatchPattern(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+
+	// Iterative glob matching with backtracking to the last star
+	p, i := 0, 0
+	star, mark := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// MatchPatternList reports whether s matches a list of OpenSSH patterns. A
+// pattern prefixed with ! negates the match: if s matches any negated pattern
+// the whole list fails, regardless of the other patterns.
+func MatchPatternList(patterns []string, s string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if MatchPattern(negated, s) {
+				return false
+			}
+			continue
+		}
+		if MatchPattern(pattern, s) {
+			matched = true
+		}
+	}
+	return matched
+}
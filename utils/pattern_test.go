@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com", true},
+		{"*.example.com", "web.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"web?", "web1", true},
+		{"web?", "web10", false},
+		{"*", "anything", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"[db.internal]:*", "[db.internal]:2222", true},
+		{"10.0.0.*", "10.0.1.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v; want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPatternList(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		s        string
+		want     bool
+	}{
+		{[]string{"web1", "web2"}, "web2", true},
+		{[]string{"*.corp", "!bastion.corp"}, "db.corp", true},
+		{[]string{"*.corp", "!bastion.corp"}, "bastion.corp", false},
+		{[]string{"!bastion.corp"}, "db.corp", false},
+		{nil, "db.corp", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPatternList(tt.patterns, tt.s); got != tt.want {
+			t.Errorf("MatchPatternList(%v, %q) = %v; want %v", tt.patterns, tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultKeyCacheDir is the default directory used to cache keys fetched from providers
+const DefaultKeyCacheDir = "~/.cache/ssh-config/keys"
+
+// HTTPStatusError is returned by FetchKeys when the provider answers with a
+// status other than 200 OK
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to fetch keys: HTTP %d", e.StatusCode)
+}
+
+// FetchKeys fetches the public keys published by a user on the given service.
+// The request is bound to ctx so callers can enforce a deadline. A response
+// other than 200 OK fails with an *HTTPStatusError.
+func FetchKeys(ctx context.Context, service, username string) ([]byte, error) {
+	urlTmpl, found := ServiceURLs[service]
+	if !found {
+		return nil, fmt.Errorf("invalid service specified: %s", service)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(urlTmpl, username), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+
+	keys, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys: %w", err)
+	}
+	return keys, nil
+}
+
+// KeyCachePath returns the path of the cache file holding the keys of a provider user
+func KeyCachePath(dir, service, username string) (string, error) {
+	for _, part := range []string{service, username} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return "", fmt.Errorf("invalid cache entry name: %q", part)
+		}
+	}
+	return filepath.Join(ExpandUser(dir), service, username+".keys"), nil
+}
+
+// ReadCachedKeys returns the keys previously cached for a provider user. An
+// entry older than maxAge is refused, unless maxAge is 0.
+func ReadCachedKeys(dir, service, username string, maxAge time.Duration) ([]byte, error) {
+	path, err := KeyCachePath(dir, service, username)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached keys: %w", err)
+	}
+	if age := time.Since(info.ModTime()); maxAge > 0 && age > maxAge {
+		return nil, fmt.Errorf("cached keys are %s old, more than the maximum of %s", age.Round(time.Second), maxAge)
+	}
+	keys, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RemoveCachedKeys deletes the cache entry of a provider user, if there is one
+func RemoveCachedKeys(dir, service, username string) error {
+	path, err := KeyCachePath(dir, service, username)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cached keys: %w", err)
+	}
+	return nil
+}
+
+// WriteCachedKeys stores the keys of a provider user in the cache, replacing
+// any previous entry atomically so concurrent readers never see a partial file.
+func WriteCachedKeys(dir, service, username string, keys []byte) error {
+	path, err := KeyCachePath(dir, service, username)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return WriteFileAtomic(path, keys, 0644)
+}
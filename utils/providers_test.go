@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFetchKeys(t *testing.T) {
+	mockKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHmock user@host\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/testuser.keys" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, mockKey)
+	}))
+	defer ts.Close()
+
+	oldURLs := ServiceURLs
+	ServiceURLs = map[string]string{"github": ts.URL + "/%s.keys"}
+	defer func() { ServiceURLs = oldURLs }()
+
+	keys, err := FetchKeys(context.Background(), "github", "testuser")
+	if err != nil {
+		t.Fatalf("FetchKeys() error = %v", err)
+	}
+	if string(keys) != mockKey {
+		t.Errorf("FetchKeys() = %q; want %q", keys, mockKey)
+	}
+
+	var statusErr *HTTPStatusError
+	if _, err := FetchKeys(context.Background(), "github", "missing"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("FetchKeys() error = %v; want HTTP 404", err)
+	}
+	if _, err := FetchKeys(context.Background(), "invalid", "testuser"); err == nil {
+		t.Error("FetchKeys() expected error for unknown service")
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ssh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if _, err := ReadCachedKeys(tmpDir, "github", "alice", 0); err == nil {
+		t.Error("ReadCachedKeys() expected error for missing entry")
+	}
+
+	keys := []byte("ssh-ed25519 AAAA alice\n")
+	if err := WriteCachedKeys(tmpDir, "github", "alice", keys); err != nil {
+		t.Fatalf("WriteCachedKeys() error = %v", err)
+	}
+
+	got, err := ReadCachedKeys(tmpDir, "github", "alice", time.Hour)
+	if err != nil {
+		t.Fatalf("ReadCachedKeys() error = %v", err)
+	}
+	if string(got) != string(keys) {
+		t.Errorf("ReadCachedKeys() = %q; want %q", got, keys)
+	}
+
+	// An entry older than the maximum age is refused, unless there is no maximum
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(tmpDir, "github", "alice.keys"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCachedKeys(tmpDir, "github", "alice", time.Hour); err == nil {
+		t.Error("ReadCachedKeys() expected error for a stale entry")
+	}
+	if _, err := ReadCachedKeys(tmpDir, "github", "alice", 0); err != nil {
+		t.Errorf("ReadCachedKeys() error = %v; want no age limit", err)
+	}
+
+	info, err := os.Stat(filepath.Join(tmpDir, "github", "alice.keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("cache file permissions = %v; want 0644", info.Mode().Perm())
+	}
+
+	if err := RemoveCachedKeys(tmpDir, "github", "alice"); err != nil {
+		t.Fatalf("RemoveCachedKeys() error = %v", err)
+	}
+	if _, err := ReadCachedKeys(tmpDir, "github", "alice", 0); err == nil {
+		t.Error("ReadCachedKeys() expected error for a removed entry")
+	}
+	if err := RemoveCachedKeys(tmpDir, "github", "alice"); err != nil {
+		t.Errorf("RemoveCachedKeys() error = %v; want none for a missing entry", err)
+	}
+
+	for _, name := range []string{"", "..", "../etc/passwd", `a\b`} {
+		if _, err := KeyCachePath(tmpDir, "github", name); err == nil {
+			t.Errorf("KeyCachePath(%q) expected error", name)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// TargetUser is a local account whose SSH files are managed on its behalf,
+// typically by root on a shared server
+type TargetUser struct {
+	Name string
+	Home string
+	UID  int
+	GID  int
+}
+
+// LookupUser resolves a local account from the passwd database.
+// It is a function variable so tests can substitute their own accounts.
+var LookupUser = func(name string) (*TargetUser, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user %s: %w", name, err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported uid %q for user %s", u.Uid, name)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported gid %q for user %s", u.Gid, name)
+	}
+	if u.HomeDir == "" {
+		return nil, fmt.Errorf("user %s has no home directory", name)
+	}
+	return &TargetUser{Name: u.Username, Home: u.HomeDir, UID: uid, GID: gid}, nil
+}
+
+// SSHDir returns the user's ~/.ssh directory
+func (u *TargetUser) SSHDir() string {
+	return filepath.Join(u.Home, ".ssh")
+}
+
+// Path returns the path of a file in the user's ~/.ssh directory
+func (u *TargetUser) Path(name string) string {
+	return filepath.Join(u.SSHDir(), name)
+}
+
+// CheckUserPath refuses paths in the user's ~/.ssh that are symbolic links.
+// The user controls these paths, so following a link while running as root
+// would let them read or take ownership of arbitrary files.
+func CheckUserPath(u *TargetUser, path string) error {
+	for _, p := range []string{u.SSHDir(), path} {
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to check %s: %w", p, err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to use %s: it is a symbolic link", p)
+		}
+	}
+	return nil
+}
+
+// EnsureUserFile ensures that a file in the user's ~/.ssh exists with the
+// given permissions, creating ~/.ssh with 0700 when needed, and that both are
+// owned by the user so sshd's StrictModes accepts them. The directory and the
+// file are opened without following links and changed through the open
+// descriptors, so the user cannot swap in a link once they are checked.
+func EnsureUserFile(u *TargetUser, path string, perm os.FileMode) error {
+	dir, err := openUserSSHDir(u, path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	fd, err := unix.Openat(int(dir.Fd()), filepath.Base(path), unix.O_CREAT|unix.O_WRONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, uint32(perm))
+	if err != nil {
+		return userPathError(path, err)
+	}
+	file := os.NewFile(uintptr(fd), path)
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("refusing to use %s: it is not a regular file", path)
+	}
+	if err := file.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if err := file.Chown(u.UID, u.GID); err != nil {
+		return fmt.Errorf("failed to change owner of %s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteUserFile atomically replaces a file in the user's ~/.ssh with data,
+// owned by the user. The temporary file is created and renamed relative to
+// the open ~/.ssh, so a link swapped in for the directory is never followed
+// and a link in place of the file is replaced rather than written through.
+func WriteUserFile(u *TargetUser, path string, data []byte, perm os.FileMode) error {
+	dir, err := openUserSSHDir(u, path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	dirfd := int(dir.Fd())
+	name := filepath.Base(path)
+	tmpName := fmt.Sprintf(".%s-%d", name, rand.Uint32())
+	fd, err := unix.Openat(dirfd, tmpName, unix.O_CREAT|unix.O_EXCL|unix.O_WRONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmp := os.NewFile(uintptr(fd), filepath.Join(u.SSHDir(), tmpName))
+	defer unix.Unlinkat(dirfd, tmpName, 0)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if err := tmp.Chown(u.UID, u.GID); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to change owner of %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := unix.Renameat(dirfd, tmpName, dirfd, name); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// openUserSSHDir opens the user's ~/.ssh, which must hold path, without
+// following a link, creating it when needed, and makes it 0700 and owned by
+// the user
+func openUserSSHDir(u *TargetUser, path string) (*os.File, error) {
+	sshDir := u.SSHDir()
+	if filepath.Dir(path) != sshDir {
+		return nil, fmt.Errorf("refusing to use %s: it is not in %s", path, sshDir)
+	}
+	if err := os.Mkdir(sshDir, 0700); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("failed to create %s: %w", sshDir, err)
+	}
+
+	fd, err := unix.Open(sshDir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, userPathError(sshDir, err)
+	}
+	dir := os.NewFile(uintptr(fd), sshDir)
+	if err := dir.Chmod(0700); err != nil {
+		dir.Close()
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", sshDir, err)
+	}
+	if err := dir.Chown(u.UID, u.GID); err != nil {
+		dir.Close()
+		return nil, fmt.Errorf("failed to change owner of %s: %w", sshDir, err)
+	}
+	return dir, nil
+}
+
+// userPathError describes a failure to open path without following links
+func userPathError(path string, err error) error {
+	if errors.Is(err, unix.ELOOP) {
+		return fmt.Errorf("refusing to use %s: it is a symbolic link", path)
+	}
+	return fmt.Errorf("failed to open %s: %w", path, err)
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestEnsureUserFile(t *testing.T) {
+	// Create a temporary directory acting as the user's home
+	tmpDir, err := os.MkdirTemp("", "ssh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	u := &TargetUser{Name: "deploy", Home: tmpDir, UID: os.Getuid(), GID: os.Getgid()}
+	path := u.Path("authorized_keys")
+	if path != filepath.Join(tmpDir, ".ssh", "authorized_keys") {
+		t.Errorf("Path() = %s", path)
+	}
+
+	if err := EnsureUserFile(u, path, 0600); err != nil {
+		t.Fatalf("EnsureUserFile() error = %v", err)
+	}
+
+	for p, perm := range map[string]os.FileMode{u.SSHDir(): 0700, path: 0600} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", p, err)
+		}
+		if info.Mode().Perm() != perm {
+			t.Errorf("%s permissions = %v; want %v", p, info.Mode().Perm(), perm)
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != u.UID {
+			t.Errorf("%s owner = %d; want %d", p, stat.Uid, u.UID)
+		}
+	}
+}
+
+func TestCheckUserPathRejectsSymlinks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ssh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	u := &TargetUser{Name: "mallory", Home: tmpDir, UID: os.Getuid(), GID: os.Getgid()}
+	if err := os.MkdirAll(u.SSHDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := filepath.Join(tmpDir, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := u.Path("authorized_keys")
+	if err := os.Symlink(secret, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckUserPath(u, path); err == nil {
+		t.Error("CheckUserPath() expected error for symlinked authorized_keys")
+	}
+	if err := EnsureUserFile(u, path, 0600); err == nil {
+		t.Error("EnsureUserFile() expected error for symlinked authorized_keys")
+	}
+}
+
+func TestEnsureUserFileRejectsSymlinkedDir(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ssh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// ~/.ssh points at a directory the user must not reach through root
+	u := &TargetUser{Name: "mallory", Home: filepath.Join(tmpDir, "home"), UID: os.Getuid(), GID: os.Getgid()}
+	elsewhere := filepath.Join(tmpDir, "etc")
+	for _, dir := range []string{u.Home, elsewhere} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(elsewhere, u.SSHDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	path := u.Path("authorized_keys")
+	if err := EnsureUserFile(u, path, 0600); err == nil {
+		t.Error("EnsureUserFile() expected error for symlinked ~/.ssh")
+	}
+	if err := WriteUserFile(u, path, []byte("key\n"), 0600); err == nil {
+		t.Error("WriteUserFile() expected error for symlinked ~/.ssh")
+	}
+	if info, err := os.Stat(elsewhere); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("link target mode changed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(elsewhere, "authorized_keys")); !os.IsNotExist(err) {
+		t.Errorf("file created through the link, stat error = %v", err)
+	}
+}
+
+func TestWriteUserFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ssh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	u := &TargetUser{Name: "deploy", Home: tmpDir, UID: os.Getuid(), GID: os.Getgid()}
+	path := u.Path("authorized_keys")
+	if err := WriteUserFile(u, path, []byte("first\n"), 0600); err != nil {
+		t.Fatalf("WriteUserFile() error = %v", err)
+	}
+	if err := WriteUserFile(u, path, []byte("second\n"), 0600); err != nil {
+		t.Fatalf("WriteUserFile() again error = %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "second\n" {
+		t.Errorf("content = %q (%v); want second", content, err)
+	}
+	for p, perm := range map[string]os.FileMode{u.SSHDir(): 0700, path: 0600} {
+		if info, err := os.Stat(p); err != nil || info.Mode().Perm() != perm {
+			t.Errorf("%s has mode %v (%v); want %v", p, info.Mode().Perm(), err, perm)
+		}
+	}
+	if entries, _ := os.ReadDir(u.SSHDir()); len(entries) != 1 {
+		t.Errorf("~/.ssh has %d entries; want the temporary file removed", len(entries))
+	}
+
+	// A link in place of the file is replaced, not written through
+	secret := filepath.Join(tmpDir, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	if err := os.Symlink(secret, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteUserFile(u, path, []byte("third\n"), 0600); err != nil {
+		t.Fatalf("WriteUserFile() over a link error = %v", err)
+	}
+	if content, _ := os.ReadFile(secret); string(content) != "secret" {
+		t.Errorf("link target = %q; want it untouched", content)
+	}
+	if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("%s is not a regular file: %v", path, err)
+	}
+
+	if err := WriteUserFile(u, filepath.Join(tmpDir, "elsewhere"), nil, 0600); err == nil {
+		t.Error("WriteUserFile() expected error for a path outside ~/.ssh")
+	}
+}
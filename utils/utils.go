@@ -3,7 +3,10 @@ package utils
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,6 +16,12 @@ const (
 	DefaultAuthorizedKeysPath = "~/.ssh/authorized_keys"
 	// DefaultKnownHostsPath is the default path to the known_hosts file
 	DefaultKnownHostsPath = "~/.ssh/known_hosts"
+	// DefaultRevokedKeysPath is the default path to the key revocation list
+	DefaultRevokedKeysPath = "~/.ssh/revoked_keys"
+	// DefaultAllowedSignersPath is the default path to the allowed_signers file
+	DefaultAllowedSignersPath = "~/.ssh/allowed_signers"
+	// DefaultHistoryPath is the default path to the history of hosts connected to
+	DefaultHistoryPath = "~/.ssh/ssh-config_history"
 )
 
 // SSHPaths contains all the relevant SSH file paths
@@ -20,10 +29,16 @@ var SSHPaths = struct {
 	Config         string
 	AuthorizedKeys string
 	KnownHosts     string
+	RevokedKeys    string
+	AllowedSigners string
+	History        string
 }{
 	Config:         DefaultSSHConfigPath,
 	AuthorizedKeys: DefaultAuthorizedKeysPath,
 	KnownHosts:     DefaultKnownHostsPath,
+	RevokedKeys:    DefaultRevokedKeysPath,
+	AllowedSigners: DefaultAllowedSignersPath,
+	History:        DefaultHistoryPath,
 }
 
 // ServiceURLs allows patching in tests
@@ -81,6 +96,34 @@ func EnsureFileExists(path string, perm os.FileMode) error {
 	return nil
 }
 
+// WriteFileAtomic replaces the contents of a file by writing a temporary file in
+// the same directory and renaming it over the original, so readers such as sshd
+// never observe a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	expandedPath := ExpandUser(path)
+	tmp, err := os.CreateTemp(filepath.Dir(expandedPath), "."+filepath.Base(expandedPath)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), expandedPath); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
 // GetDefaultEditor returns the default editor to use
 func GetDefaultEditor() string {
 	if editor := os.Getenv("EDITOR"); editor != "" {
@@ -100,3 +143,24 @@ func FormatSSHConfig(host, hostname, user, identityFile string, extraArgs map[st
 
 	return config
 }
+
+// ParseDuration parses a duration such as 7d, 2w or 12h. In addition to the units
+// understood by time.ParseDuration it accepts whole days (d) and weeks (w).
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if count, found := strings.CutSuffix(s, suffix); found {
+			n, err := strconv.Atoi(count)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}